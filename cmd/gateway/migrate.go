@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/urfave/cli/v2"
+	"github.com/yann-y/fds/internal/backup"
+	"github.com/yann-y/fds/internal/kv"
+	"github.com/yann-y/fds/internal/lock"
+	"github.com/yann-y/fds/internal/migrate"
+)
+
+var migrateCmd = &cli.Command{
+	Name:  "migrate",
+	Usage: "Migrate the metadata of a stopped gateway to the current schema",
+	Description: "The metadata replicated through raft is migrated by the daemon at startup, " +
+		"under the lock shared with the cluster peers.",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "data-dir",
+			Aliases: []string{"data"},
+			Usage:   "directory the data is stored in",
+			Value:   "./store-data",
+		},
+		&cli.StringFlag{
+			Name:  "meta-backend",
+			Usage: "set the engine of the metadata db: leveldb, pebble or sqlite",
+			Value: "leveldb",
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "print the pending migrations and the keys they would write without applying them",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		datadir := cctx.String("data-dir")
+		db, err := openDB(cctx, datadir)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		migrator, err := newMigrator(db, nil, datadir)
+		if err != nil {
+			return err
+		}
+		version, err := migrator.Version()
+		if err != nil {
+			return err
+		}
+		results, err := migrator.Run(cctx.Context, cctx.Bool("dry-run"))
+		for _, result := range results {
+			fmt.Printf("%d: %s, %d keys\n", result.Version, result.Name, result.Writes)
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case len(results) == 0:
+			fmt.Printf("schema version %d, nothing to migrate\n", version)
+		case cctx.Bool("dry-run"):
+			fmt.Printf("schema version %d, %d migrations pending\n", version, len(results))
+		default:
+			fmt.Printf("migrated schema version %d to %d\n", version, migrator.Latest())
+		}
+		return nil
+	},
+}
+
+// newMigrator returns the migrator of the metadata db, which backs the db up
+// to the migrate-backups directory of datadir before migrating it, and locks
+// the migrations with lockProvider unless nil.
+func newMigrator(db *kv.DB, lockProvider lock.Provider, datadir string) (*migrate.Migrator, error) {
+	migrator, err := migrate.New(db, migrate.Migrations...)
+	if err != nil {
+		return nil, err
+	}
+	if lockProvider != nil {
+		migrator.SetLockProvider(lockProvider)
+	}
+	migrator.SetBackup(func(ctx context.Context) error {
+		target, err := backup.NewDirTarget(filepath.Join(datadir, "migrate-backups"), 0)
+		if err != nil {
+			return err
+		}
+		return backup.NewScheduler(db.Store(), target).Snapshot(ctx)
+	})
+	return migrator, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"github.com/yann-y/fds/internal/raftstore"
+)
+
+var raftFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "endpoint",
+		Usage: "set the fds server address",
+		Value: "http://127.0.0.1:9000",
+	},
+	&cli.StringFlag{
+		Name:     "cluster-secret",
+		Usage:    "set the secret of the cluster",
+		EnvVars:  []string{EnvClusterSecret},
+		Required: true,
+	},
+}
+
+var raftCmd = &cli.Command{
+	Name:  "raft",
+	Usage: "Manage the raft cluster replicating the metadata",
+	Subcommands: []*cli.Command{
+		{
+			Name:  "status",
+			Usage: "Print the members of the cluster",
+			Flags: raftFlags,
+			Action: func(cctx *cli.Context) error {
+				body, err := raftCall(cctx, http.MethodGet, "/status")
+				if err != nil {
+					return err
+				}
+				var status raftstore.Status
+				if err = json.Unmarshal(body, &status); err != nil {
+					return err
+				}
+				fmt.Printf("node %s is %s, applied index %d\n", status.ID, status.State, status.AppliedIndex)
+				for _, member := range status.Members {
+					role := "voter"
+					if member.Leader {
+						role = "leader"
+					}
+					fmt.Printf("%s\t%s\t%s\t%s\n", member.ID, member.Address, member.Endpoint, role)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "remove",
+			Usage:     "Remove a member from the cluster",
+			ArgsUsage: "<id>",
+			Flags:     raftFlags,
+			Action: func(cctx *cli.Context) error {
+				if cctx.NArg() != 1 {
+					return fmt.Errorf("expected a member id, got %d arguments", cctx.NArg())
+				}
+				if _, err := raftCall(cctx, http.MethodPost, "/remove?id="+url.QueryEscape(cctx.Args().Get(0))); err != nil {
+					return err
+				}
+				fmt.Printf("member %s removed\n", cctx.Args().Get(0))
+				return nil
+			},
+		},
+	},
+}
+
+// raftCall sends a raft call to the gateway of --endpoint.
+func raftCall(cctx *cli.Context, method, path string) ([]byte, error) {
+	u := strings.TrimSuffix(cctx.String("endpoint"), "/") + raftstore.PathPrefix + path
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+cctx.String("cluster-secret"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("raft call failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
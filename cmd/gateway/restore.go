@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ipfs/kubo/client/rpc"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/urfave/cli/v2"
+	dagpool "github.com/yann-y/fds/dag/pool/ipfs"
+	"github.com/yann-y/fds/internal/backup"
+)
+
+var restoreCmd = &cli.Command{
+	Name:  "restore",
+	Usage: "Rebuild the metadata of a data dir from a snapshot",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "data-dir",
+			Aliases:  []string{"data"},
+			Usage:    "set the directory to rebuild, it must be empty",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "meta-backend",
+			Usage: "set the engine of the metadata db: leveldb, pebble or sqlite",
+			Value: "leveldb",
+		},
+		&cli.StringFlag{
+			Name:  "file",
+			Usage: "restore the snapshot saved to this file",
+		},
+		&cli.StringFlag{
+			Name:  "cid",
+			Usage: "restore the snapshot saved to the IPFS pool with this root CID",
+		},
+		&cli.StringFlag{
+			Name:  "pool-addr",
+			Usage: "set the ipfs http address the snapshot is read from",
+			Value: "/ip4/127.0.0.1/tcp/5001",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		dir := cctx.String("data-dir")
+		if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+			return fmt.Errorf("data dir %s is not empty", dir)
+		} else if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		snapshot, err := openSnapshot(cctx)
+		if err != nil {
+			return err
+		}
+		defer snapshot.Close()
+
+		db, err := openDB(cctx, dir)
+		if err != nil {
+			return err
+		}
+		info, err := backup.Restore(snapshot, db.Store())
+		if cerr := db.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			// never leave a partial metadata db behind
+			os.RemoveAll(dir)
+			return err
+		}
+		fmt.Printf("restored %d keys of the snapshot taken at %s, checksum %s\n", info.Keys, info.Created.Format("2006-01-02 15:04:05"), info.Checksum)
+		return nil
+	},
+}
+
+// openSnapshot opens the snapshot of --file or --cid.
+func openSnapshot(cctx *cli.Context) (io.ReadCloser, error) {
+	file, root := cctx.String("file"), cctx.String("cid")
+	switch {
+	case file != "" && root != "":
+		return nil, errors.New("a snapshot is restored either from a file or from a CID")
+	case file != "":
+		return os.Open(file)
+	case root != "":
+		kuboApi, err := rpc.NewApi(ma.StringCast(cctx.String("pool-addr")))
+		if err != nil {
+			return nil, err
+		}
+		poolClient, err := dagpool.NewPoolClient(kuboApi, false)
+		if err != nil {
+			return nil, fmt.Errorf("connect dagpool server err: %w", err)
+		}
+		return poolClient.Store().Get(context.Background(), root)
+	default:
+		return nil, errors.New("missing --file or --cid")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"github.com/yann-y/fds/internal/iam/auth"
+	"github.com/yann-y/fds/internal/s3api"
+	"github.com/yann-y/fds/internal/utils"
+)
+
+var resyncCmd = &cli.Command{
+	Name:      "resync",
+	Usage:     "Queue the replication of the existing objects of a bucket",
+	ArgsUsage: "<bucket>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "endpoint",
+			Usage: "set the fds server address",
+			Value: "http://127.0.0.1:9000",
+		},
+		&cli.StringFlag{
+			Name:    "root-user",
+			Usage:   "set root file dag root user",
+			EnvVars: []string{EnvRootUser},
+			Value:   auth.DefaultAccessKey,
+		},
+		&cli.StringFlag{
+			Name:    "root-password",
+			Usage:   "set root file dag root password",
+			EnvVars: []string{EnvRootPassword},
+			Value:   auth.DefaultSecretKey,
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.NArg() != 1 {
+			return fmt.Errorf("expected a bucket, got %d arguments", cctx.NArg())
+		}
+		u := strings.TrimSuffix(cctx.String("endpoint"), "/") + "/" + url.PathEscape(cctx.Args().Get(0)) + "?replication-resync"
+		req, err := utils.NewRequest(http.MethodPost, u, 0, nil)
+		if err != nil {
+			return err
+		}
+		if err = utils.SignRequestV4(req, cctx.String("root-user"), cctx.String("root-password"), "s3"); err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("resync failed: %s: %s", resp.Status, body)
+		}
+		var result s3api.ReplicationResyncResult
+		if err = xml.Unmarshal(body, &result); err != nil {
+			return err
+		}
+		fmt.Printf("%d objects queued for replication\n", result.Objects)
+		return nil
+	},
+}
@@ -7,8 +7,11 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 	logging "github.com/ipfs/go-log/v2"
@@ -16,9 +19,25 @@ import (
 	ma "github.com/multiformats/go-multiaddr"
 	"github.com/urfave/cli/v2"
 	dagpool "github.com/yann-y/fds/dag/pool/ipfs"
+	"github.com/yann-y/fds/internal/audit"
+	"github.com/yann-y/fds/internal/backup"
+	"github.com/yann-y/fds/internal/event"
+	"github.com/yann-y/fds/internal/httpserver"
 	"github.com/yann-y/fds/internal/iam"
 	"github.com/yann-y/fds/internal/iam/auth"
+	"github.com/yann-y/fds/internal/iam/kms"
+	"github.com/yann-y/fds/internal/iam/openid"
 	"github.com/yann-y/fds/internal/iamapi"
+	"github.com/yann-y/fds/internal/kv"
+	"github.com/yann-y/fds/internal/kv/pebblekv"
+	"github.com/yann-y/fds/internal/kv/sqlitekv"
+	"github.com/yann-y/fds/internal/lock"
+	"github.com/yann-y/fds/internal/lock/dsync"
+	"github.com/yann-y/fds/internal/metrics"
+	"github.com/yann-y/fds/internal/raftstore"
+	"github.com/yann-y/fds/internal/ratelimit"
+	"github.com/yann-y/fds/internal/replication"
+	"github.com/yann-y/fds/internal/reqinfo"
 	"github.com/yann-y/fds/internal/s3api"
 	"github.com/yann-y/fds/internal/store"
 	"github.com/yann-y/fds/internal/uleveldb"
@@ -26,8 +45,12 @@ import (
 )
 
 const (
-	EnvRootUser     = "FILEDAG_ROOT_USER"
-	EnvRootPassword = "FILEDAG_ROOT_PASSWORD"
+	EnvRootUser          = "FILEDAG_ROOT_USER"
+	EnvRootPassword      = "FILEDAG_ROOT_PASSWORD"
+	EnvMasterKey         = "FILEDAG_MASTER_KEY"
+	EnvPreviousMasterKey = "FILEDAG_PREVIOUS_MASTER_KEY"
+	EnvMetricsToken      = "FILEDAG_METRICS_TOKEN"
+	EnvClusterSecret     = "FILEDAG_CLUSTER_SECRET"
 )
 
 var log = logging.Logger("sever")
@@ -38,6 +61,373 @@ func missingCredentialError(user, pwd string) error {
 		"FILEDAG_ROOT_USER and FILEDAG_ROOT_PASSWORD respectively", user, pwd))
 }
 
+// loadKeyring returns the keyring of the configured master keys, nil when no
+// master key is configured.
+func loadKeyring(cctx *cli.Context) (*kms.Keyring, error) {
+	current, ok, err := kms.LoadMasterKey(cctx.String("master-key"), cctx.String("master-key-file"))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if len(cctx.StringSlice("previous-master-key")) > 0 {
+			return nil, errors.New("previous master keys require a master key")
+		}
+		return nil, nil
+	}
+	var previous []kms.MasterKey
+	for _, s := range cctx.StringSlice("previous-master-key") {
+		key, err := kms.ParseMasterKey(s)
+		if err != nil {
+			return nil, err
+		}
+		previous = append(previous, key)
+	}
+	return kms.NewKeyring(current, previous...)
+}
+
+// loadNotificationSys returns the notification sys of the configured
+// targets, nil when no target is configured.
+func loadNotificationSys(cctx *cli.Context, db *kv.DB) (*event.NotificationSys, error) {
+	webhooks := cctx.StringSlice("notify-webhook")
+	if len(webhooks) == 0 {
+		return nil, nil
+	}
+	sys := event.NewNotificationSys(db, cctx.Duration("notify-retry-interval"), cctx.Int("notify-queue-limit"))
+	for _, webhook := range webhooks {
+		id, endpoint, ok := strings.Cut(webhook, "=")
+		if !ok || strings.ContainsAny(id, ":/") {
+			return nil, fmt.Errorf("invalid webhook target %q, expected <id>=<endpoint>", webhook)
+		}
+		target, err := event.NewWebhookTarget(id, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		if err = sys.AddTarget(cctx.Context, target); err != nil {
+			return nil, err
+		}
+	}
+	return sys, nil
+}
+
+// loadReplicationSys returns the replication sys of the configured targets,
+// nil when no replication target is configured.
+func loadReplicationSys(cctx *cli.Context, db *kv.DB, storageSys *store.StorageSys) (*replication.ReplicationSys, error) {
+	targets := cctx.StringSlice("replication-target")
+	if len(targets) == 0 {
+		return nil, nil
+	}
+	sys := replication.NewReplicationSys(db, storageSys, cctx.Int("replication-workers"), cctx.Duration("replication-retry-interval"), cctx.Int("replication-max-attempts"))
+	for _, t := range targets {
+		id, endpoint, ok := strings.Cut(t, "=")
+		if !ok || strings.ContainsAny(id, ":/") {
+			return nil, fmt.Errorf("invalid replication target %q, expected <id>=<endpoint>", t)
+		}
+		target, err := replication.NewTarget(id, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		if err = sys.AddTarget(target); err != nil {
+			return nil, err
+		}
+	}
+	return sys, nil
+}
+
+// loadAuditSys returns the audit sys of the configured targets, nil when no
+// audit target is configured.
+func loadAuditSys(cctx *cli.Context) (*audit.Sys, error) {
+	file, webhooks := cctx.String("audit-file"), cctx.StringSlice("audit-webhook")
+	if file == "" && len(webhooks) == 0 {
+		return nil, nil
+	}
+	sys := audit.NewSys(cctx.Int("audit-queue-size"))
+	if file != "" {
+		target, err := audit.NewFileTarget(file, cctx.Int64("audit-file-max-size"), cctx.Int("audit-file-max-backups"))
+		if err != nil {
+			return nil, err
+		}
+		sys.AddTarget(target)
+	}
+	for _, endpoint := range webhooks {
+		target, err := audit.NewWebhookTarget(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		sys.AddTarget(target)
+	}
+	return sys, nil
+}
+
+// loadSnapshotScheduler returns the scheduler of the metadata snapshots, nil
+// when no snapshot is configured.
+func loadSnapshotScheduler(cctx *cli.Context, db *kv.DB, storageSys *store.StorageSys) (*backup.Scheduler, error) {
+	interval := cctx.Duration("snapshot-interval")
+	dir, toPool := cctx.String("snapshot-dir"), cctx.Bool("snapshot-pool")
+	if interval <= 0 {
+		if dir != "" || toPool {
+			return nil, errors.New("the metadata snapshots need a positive --snapshot-interval")
+		}
+		return nil, nil
+	}
+	keep := cctx.Int("snapshot-keep")
+	var targets []backup.Target
+	if dir != "" {
+		target, err := backup.NewDirTarget(dir, keep)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	if toPool {
+		targets = append(targets, backup.NewPoolTarget(storageSys.Pool, storageSys.DagPool, db, keep))
+	}
+	if len(targets) == 0 {
+		return nil, errors.New("the metadata snapshots need --snapshot-dir or --snapshot-pool")
+	}
+	return backup.NewScheduler(db.Store(), targets...), nil
+}
+
+// loadRateLimiter returns the limiter of the requests, nil when no limit is
+// set. The routes of the cluster, the readiness probe and the metrics are
+// never limited.
+func loadRateLimiter(cctx *cli.Context, authSys *iam.AuthSys) (*ratelimit.Limiter, error) {
+	config := ratelimit.Config{
+		KeyRequests:    cctx.Float64("rate-limit-key-requests"),
+		KeyBytes:       float64(cctx.Int64("rate-limit-key-bytes")),
+		BucketRequests: cctx.Float64("rate-limit-bucket-requests"),
+		BucketBytes:    float64(cctx.Int64("rate-limit-bucket-bytes")),
+		GlobalRequests: cctx.Float64("rate-limit-global-requests"),
+		GlobalBytes:    float64(cctx.Int64("rate-limit-global-bytes")),
+		KeyInFlight:    cctx.Int("rate-limit-key-inflight"),
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if !config.Enabled() {
+		return nil, nil
+	}
+	limiter := ratelimit.NewLimiter(config, authSys.VerifiedAccessKey)
+	limiter.SetExempt(dsync.LockPathPrefix, raftstore.PathPrefix, "/status", "/metrics")
+	return limiter, nil
+}
+
+// loadMetricsEndpoint returns the handler of the metrics endpoint, nil when
+// the metrics are neither protected by a token nor public.
+func loadMetricsEndpoint(cctx *cli.Context) (http.Handler, error) {
+	token, public := cctx.String("metrics-token"), cctx.Bool("metrics-public")
+	if token != "" && public {
+		return nil, errors.New("public metrics take no token")
+	}
+	if token == "" && !public {
+		return nil, nil
+	}
+	return metrics.NewEndpoint(token), nil
+}
+
+// loadOpenIDConfigs returns the configurations of the OpenID providers of
+// issuers. The client id and the JWKS source are given once for every
+// issuer, or once per issuer in their order.
+func loadOpenIDConfigs(cctx *cli.Context, issuers []string) ([]openid.Config, error) {
+	perIssuer := func(name string) ([]string, error) {
+		values := cctx.StringSlice(name)
+		switch len(values) {
+		case 0:
+			return make([]string, len(issuers)), nil
+		case 1:
+			all := make([]string, len(issuers))
+			for i := range all {
+				all[i] = values[0]
+			}
+			return all, nil
+		case len(issuers):
+			return values, nil
+		}
+		return nil, fmt.Errorf("%s is given %d times for %d issuers", name, len(values), len(issuers))
+	}
+	clientIDs, err := perIssuer("openid-client-id")
+	if err != nil {
+		return nil, err
+	}
+	jwksURLs, err := perIssuer("openid-jwks-url")
+	if err != nil {
+		return nil, err
+	}
+	jwksFiles, err := perIssuer("openid-jwks-file")
+	if err != nil {
+		return nil, err
+	}
+	cfgs := make([]openid.Config, len(issuers))
+	for i, issuer := range issuers {
+		cfgs[i] = openid.Config{
+			Issuer:      issuer,
+			ClientID:    clientIDs[i],
+			JWKSURL:     jwksURLs[i],
+			JWKSFile:    jwksFiles[i],
+			ClaimName:   cctx.String("openid-claim-name"),
+			GroupsClaim: cctx.String("openid-groups-claim"),
+		}
+	}
+	return cfgs, nil
+}
+
+// loadLockProvider serves the local locks to the peers of the cluster and
+// returns the provider of the locks shared with them, nil when no peer is
+// configured. The peers share the metadata through raft only, the locks of
+// gateways with their own metadata would not keep it consistent.
+func loadLockProvider(cctx *cli.Context, router *mux.Router) (lock.Provider, error) {
+	peers := cctx.StringSlice("cluster-peer")
+	if len(peers) == 0 {
+		return nil, nil
+	}
+	if cctx.String("raft-id") == "" {
+		return nil, errors.New("cluster peers require the metadata to be replicated through raft, set --raft-id")
+	}
+	secret := cctx.String("cluster-secret")
+	if secret == "" {
+		return nil, errors.New("cluster peers require a cluster secret")
+	}
+	local := dsync.NewLocalLocker(dsync.DefaultLockValidity)
+	local.Start(cctx.Context)
+	dsync.RegisterLockServer(router, local, secret)
+	lockers := []dsync.NetLocker{local}
+	for _, peer := range peers {
+		locker, err := dsync.NewRestLocker(peer, secret)
+		if err != nil {
+			return nil, err
+		}
+		lockers = append(lockers, locker)
+	}
+	return dsync.New(lockers, dsync.DefaultRefreshInterval), nil
+}
+
+// openDB opens the db at path with the backend of --meta-backend, the other
+// backends than leveldb keep their files in a sub directory named after them
+// so that they never read the files of another one.
+func openDB(cctx *cli.Context, path string) (*kv.DB, error) {
+	var store kv.Store
+	var err error
+	switch backend := cctx.String("meta-backend"); backend {
+	case "", "leveldb":
+		store, err = uleveldb.Open(path)
+	case "pebble":
+		store, err = pebblekv.Open(filepath.Join(path, backend))
+	case "sqlite":
+		store, err = sqlitekv.Open(filepath.Join(path, backend))
+	default:
+		return nil, fmt.Errorf("unknown metadata backend %q", backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return kv.NewDB(store), nil
+}
+
+// loadRaftNode opens the metadata db replicated through raft and starts its
+// node, nil when raft is not configured.
+func loadRaftNode(cctx *cli.Context, router *mux.Router, datadir string) (*raftstore.Node, *kv.DB, error) {
+	id := cctx.String("raft-id")
+	if id == "" {
+		return nil, nil, nil
+	}
+	dir := cctx.String("raft-dir")
+	if dir == "" {
+		dir = filepath.Join(datadir, "raft")
+	}
+	if cctx.Bool("raft-bootstrap") && cctx.String("raft-join") != "" {
+		return nil, nil, errors.New("a raft node either bootstraps a cluster or joins one")
+	}
+	metaDB, err := openDB(cctx, filepath.Join(dir, "state"))
+	if err != nil {
+		return nil, nil, err
+	}
+	node, err := raftstore.NewNode(raftstore.Config{
+		ID:        id,
+		BindAddr:  cctx.String("raft-addr"),
+		Endpoint:  cctx.String("raft-endpoint"),
+		Dir:       dir,
+		Bootstrap: cctx.Bool("raft-bootstrap"),
+		Secret:    cctx.String("cluster-secret"),
+	}, metaDB)
+	if err != nil {
+		metaDB.Close()
+		return nil, nil, err
+	}
+	raftstore.RegisterHandlers(router, node)
+	return node, metaDB, nil
+}
+
+// joinRaftCluster joins the cluster of --raft-join once the gateway serves
+// the raft calls, and waits for the leader.
+func joinRaftCluster(cctx *cli.Context, node *raftstore.Node) error {
+	ctx, cancel := context.WithTimeout(cctx.Context, time.Minute)
+	defer cancel()
+	if join := cctx.String("raft-join"); join != "" {
+		if err := node.Join(ctx, join); err != nil {
+			return err
+		}
+	}
+	return node.WaitForLeader(ctx)
+}
+
+// migrateMetadata migrates the metadata to the current schema before the
+// requests are served, the gateways of a cluster migrate it once under the
+// lock they share.
+func migrateMetadata(ctx context.Context, db *kv.DB, lockProvider lock.Provider, datadir string) error {
+	migrator, err := newMigrator(db, lockProvider, datadir)
+	if err != nil {
+		return err
+	}
+	_, err = migrator.Run(ctx, false)
+	return err
+}
+
+// recoverMetadata repairs the metadata a crash of a previous version left
+// inconsistent, before the requests are served.
+func recoverMetadata(ctx context.Context, storageSys *store.StorageSys, iamSys *iam.IdentityAMSys) error {
+	n, err := storageSys.Recover(ctx)
+	if err != nil {
+		return err
+	}
+	m, err := iamSys.Recover(ctx)
+	if err != nil {
+		return err
+	}
+	if n+m > 0 {
+		log.Infof("repaired %d inconsistent storage and %d iam metadata", n, m)
+	}
+	return nil
+}
+
+// loadServerConfig - returns the configuration of the http servers and the
+// manager of their TLS certificates, nil when TLS is disabled.
+func loadServerConfig(cctx *cli.Context) (httpserver.Config, *httpserver.CertManager, error) {
+	config := httpserver.Config{
+		ReadTimeout:       cctx.Duration("read-timeout"),
+		ReadHeaderTimeout: cctx.Duration("read-header-timeout"),
+		WriteTimeout:      cctx.Duration("write-timeout"),
+		IdleTimeout:       cctx.Duration("idle-timeout"),
+		MaxHeaderBytes:    cctx.Int("max-header-bytes"),
+		ShutdownTimeout:   cctx.Duration("shutdown-timeout"),
+	}
+	certFile, keyFile := cctx.String("tls-cert"), cctx.String("tls-key")
+	if certFile == "" && keyFile == "" {
+		if cctx.String("tls-client-ca") != "" {
+			return config, nil, errors.New("mutual TLS requires --tls-cert and --tls-key")
+		}
+		return config, nil, nil
+	}
+	clientCAFile, clientAuth := cctx.String("tls-client-ca"), httpserver.ClientAuthNone
+	if clientCAFile != "" {
+		clientAuth = cctx.String("tls-client-auth")
+	}
+	certs, err := httpserver.NewCertManager(certFile, keyFile, clientCAFile, clientAuth)
+	if err != nil {
+		return config, nil, err
+	}
+	config.TLS = certs.TLSConfig()
+	return config, certs, nil
+}
+
 // startServer Start a IamServer
 func startServer(cctx *cli.Context) {
 	listen := cctx.String("listen")
@@ -55,12 +445,27 @@ func startServer(cctx *cli.Context) {
 			"Root user length should be at least 3, and password length at least 8 characters")
 	}
 
-	db, err := uleveldb.OpenDb(datadir)
+	db, err := openDB(cctx, datadir)
 	if err != nil {
-		return
+		log.Fatalf("open db err: %v", err)
 	}
 	defer db.Close()
 	router := mux.NewRouter()
+	// the metadata db, the local db unless it is replicated through raft,
+	// while the queues of the notifications and the replication stay local
+	metaDB := db
+	raftNode, raftDB, err := loadRaftNode(cctx, router, datadir)
+	if err != nil {
+		log.Fatalf("start raft node err: %v", err)
+	}
+	if raftNode != nil {
+		metaDB = raftDB
+		defer raftDB.Close()
+		defer raftNode.Shutdown()
+		if err = joinRaftCluster(cctx, raftNode); err != nil {
+			log.Fatalf("join raft cluster err: %v", err)
+		}
+	}
 	kuboApi, err := rpc.NewApi(ma.StringCast(poolAddr))
 	if err != nil {
 		log.Fatal(err)
@@ -69,43 +474,171 @@ func startServer(cctx *cli.Context) {
 	if err != nil {
 		log.Fatalf("connect dagpool server err: %v", err)
 	}
+	poolClient.SetAddr(poolAddr)
 	defer poolClient.Close()
-	storageSys := store.NewStorageSys(cctx.Context, poolClient, db)
-	authSys := iam.NewAuthSys(db, cred)
-	bmSys := store.NewBucketMetadataSys(db)
+	storageSys := store.NewStorageSys(cctx.Context, poolClient, metaDB)
+	authSys := iam.NewAuthSys(metaDB, cred)
+	keyring, err := loadKeyring(cctx)
+	if err != nil {
+		log.Fatalf("load master key err: %v", err)
+	}
+	if err = authSys.Iam.InitSecretEncryption(cctx.Context, keyring); err != nil {
+		log.Fatalf("init secret encryption err: %v", err)
+	}
+	stsMinDuration, stsMaxDuration := cctx.Duration("sts-min-duration"), cctx.Duration("sts-max-duration")
+	if stsMinDuration <= 0 || stsMinDuration > stsMaxDuration {
+		log.Fatalf("invalid sts duration bounds [%v, %v]", stsMinDuration, stsMaxDuration)
+	}
+	authSys.Iam.SetSTSDurationBounds(stsMinDuration, stsMaxDuration)
+	if interval := cctx.Duration("sts-cleanup-interval"); interval > 0 {
+		authSys.Iam.StartSessionReaper(cctx.Context, interval)
+	}
+	if issuers := cctx.StringSlice("openid-issuer"); len(issuers) > 0 {
+		cfgs, err := loadOpenIDConfigs(cctx, issuers)
+		if err != nil {
+			log.Fatalf("invalid openid flags: %v", err)
+		}
+		providers, err := openid.NewProviders(cfgs...)
+		if err != nil {
+			log.Fatalf("init openid provider err: %v", err)
+		}
+		authSys.SetOpenIDProviders(providers)
+	}
+	bmSys := store.NewBucketMetadataSys(metaDB)
+	lockProvider, err := loadLockProvider(cctx, router)
+	if err != nil {
+		log.Fatalf("load cluster locks err: %v", err)
+	}
+	if lockProvider != nil {
+		storageSys.SetLockProvider(lockProvider)
+		bmSys.SetLockProvider(lockProvider)
+	}
 	storageSys.SetNewBucketNSLock(bmSys.NewNSLock)
 	storageSys.SetHasBucket(bmSys.HasBucket)
 	bmSys.SetEmptyBucket(storageSys.EmptyBucket)
+	bmSys.SetCleanBucket(storageSys.CleanBucket)
+	if err = migrateMetadata(cctx.Context, metaDB, lockProvider, datadir); err != nil {
+		log.Fatalf("migrate metadata err: %v", err)
+	}
+	if err = recoverMetadata(cctx.Context, storageSys, authSys.Iam); err != nil {
+		log.Fatalf("recover metadata err: %v", err)
+	}
+	snapshotScheduler, err := loadSnapshotScheduler(cctx, metaDB, storageSys)
+	if err != nil {
+		log.Fatalf("load metadata snapshots err: %v", err)
+	}
+	if snapshotScheduler != nil {
+		snapshotScheduler.Start(cctx.Context, cctx.Duration("snapshot-interval"))
+	}
+	authSys.SetGetObjectInfo(storageSys.GetObjectInfo)
 
-	cleanData := func(accessKey string) {
-		ctx := context.Background()
-		bkts, err := bmSys.GetAllBucketsOfUser(ctx, accessKey)
-		if err != nil {
-			log.Errorf("GetAllBucketsOfUser error: %v", err)
-		}
-		for _, bkt := range bkts {
-			if err = storageSys.CleanObjectsInBucket(ctx, bkt.Name); err != nil {
-				log.Errorf("CleanObjectsInBucket error: %v", err)
-				continue
+	purger := store.NewBucketPurger(cctx.Context, storageSys, bmSys, cctx.Int("purge-workers"))
+	if n, err := purger.Resume(cctx.Context); err != nil {
+		log.Fatalf("resume bucket force deletions err: %v", err)
+	} else if n > 0 {
+		log.Infof("resumed %d bucket force deletions", n)
+	}
+	eventBus := event.NewBus()
+	notificationSys, err := loadNotificationSys(cctx, db)
+	if err != nil {
+		log.Fatalf("load notification targets err: %v", err)
+	}
+	if notificationSys != nil {
+		notificationSys.Start(cctx.Context)
+	}
+	replicationSys, err := loadReplicationSys(cctx, db, storageSys)
+	if err != nil {
+		log.Fatalf("load replication targets err: %v", err)
+	}
+	if replicationSys != nil {
+		replicationSys.Start(cctx.Context)
+	}
+	domains := cctx.StringSlice("domain")
+	authSys.SetDomains(domains)
+	handler := s3api.CorsHandler(router, bmSys, domains)
+	metricsEndpoint, err := loadMetricsEndpoint(cctx)
+	if err != nil {
+		log.Fatalf("load metrics endpoint err: %v", err)
+	}
+	if metricsEndpoint != nil {
+		// ahead of the S3 routes, which would take it for a bucket
+		router.Methods(http.MethodGet).Path("/metrics").Handler(metricsEndpoint)
+	}
+	quotaSys := store.NewQuotaSys(storageSys, bmSys)
+	s3api.NewS3Server(router, authSys, bmSys, storageSys, domains, notificationSys, eventBus, replicationSys, purger, quotaSys)
+	iamapi.NewIamApiServer(router, authSys, purger, quotaSys)
+	auditSys, err := loadAuditSys(cctx)
+	if err != nil {
+		log.Fatalf("load audit targets err: %v", err)
+	}
+	if auditSys != nil {
+		defer auditSys.Close()
+	}
+	router.Use(reqinfo.SetRoute)
+	limiter, err := loadRateLimiter(cctx, authSys)
+	if err != nil {
+		log.Fatalf("load rate limits err: %v", err)
+	}
+	if limiter != nil {
+		// after the routes are recorded, so that the rejected requests are
+		// reported by API
+		router.Use(limiter.Middleware)
+		limiter.Start(cctx.Context)
+	}
+
+	websiteDomain := cctx.String("website-domain")
+	websiteHandler := s3api.NewWebsiteHandler(authSys, bmSys, storageSys, websiteDomain)
+	if raftNode != nil {
+		// the reads of a request see the writes committed on any node
+		handler = raftNode.SyncHandler(handler)
+		websiteHandler = raftNode.SyncHandler(websiteHandler)
+	}
+	if websiteDomain != "" {
+		apiHandler := handler
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if s3api.IsWebsiteHost(r.Host, websiteDomain) {
+				websiteHandler.ServeHTTP(w, r)
+				return
 			}
-			if err = bmSys.DeleteBucket(ctx, bkt.Name); err != nil {
-				log.Errorf("DeleteBucket error: %v", err)
+			apiHandler.ServeHTTP(w, r)
+		})
+	}
+	serverConfig, certs, err := loadServerConfig(cctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	scheme := "http"
+	if certs != nil {
+		scheme = "https"
+	}
+	var servers []*httpserver.Server
+	if websiteListen := cctx.String("website-listen"); websiteListen != "" {
+		log.Infof("start website endpoint at %v://%v", scheme, websiteListen)
+		// the website requests are audited and measured as the API requests
+		websiteServer := httpserver.New(websiteListen,
+			metrics.Handler(audit.Handler(websiteHandler, auditSys, authSys.VerifiedAccessKey)), serverConfig)
+		servers = append(servers, websiteServer)
+		go func() {
+			if err := websiteServer.ListenAndServe(); err != nil {
+				log.Errorf("Website Listen And Serve err%v", err)
 			}
-		}
+		}()
 	}
-	handler := s3api.CorsHandler(router)
-	s3api.NewS3Server(router, authSys, bmSys, storageSys)
-	iamapi.NewIamApiServer(router, authSys, cleanData)
+
+	handler = audit.Handler(handler, auditSys, authSys.VerifiedAccessKey)
+	handler = metrics.Handler(handler)
 
 	if strings.HasPrefix(listen, ":") {
 		for _, ip := range utils.MustGetLocalIP4().ToSlice() {
-			log.Infof("start sever at http://%v%v", ip, listen)
+			log.Infof("start sever at %v://%v%v", scheme, ip, listen)
 		}
 	} else {
-		log.Infof("start sever at http://%v", listen)
+		log.Infof("start sever at %v://%v", scheme, listen)
 	}
+	server := httpserver.New(listen, handler, serverConfig)
+	servers = append(servers, server)
 	go func() {
-		if err = http.ListenAndServe(listen, handler); err != nil {
+		if err := server.ListenAndServe(); err != nil {
 			log.Errorf("Listen And Serve err%v", err)
 		}
 	}()
@@ -115,8 +648,35 @@ func startServer(cctx *cli.Context) {
 	// kill (no param) default send syscall.SIGTERM
 	// kill -2 is syscall.SIGINT
 	// kill -9 is syscall.SIGKILL but can't be catch, so don't need add it
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	// kill -1 is syscall.SIGHUP, which reloads the TLS certificates
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range quit {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		if certs == nil {
+			continue
+		}
+		if err := certs.Reload(); err != nil {
+			log.Errorw("reload TLS certificates error", "error", err)
+			continue
+		}
+		log.Info("TLS certificates reloaded")
+	}
+	signal.Stop(quit)
 	log.Info("Shutdown Server ...")
+	// the requests in flight are drained, those left at the shutdown timeout
+	// are cancelled and what they stored is marked to delete
+	var wg sync.WaitGroup
+	for _, s := range servers {
+		wg.Add(1)
+		go func(s *httpserver.Server) {
+			defer wg.Done()
+			if err := s.Shutdown(); err != nil {
+				log.Errorw("shutdown server error", "error", err)
+			}
+		}(s)
+	}
+	wg.Wait()
 	log.Info("Server exit")
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"github.com/yann-y/fds/internal/iam/auth"
+	"github.com/yann-y/fds/internal/utils"
+)
+
+var simulateCmd = &cli.Command{
+	Name:      "simulate",
+	Usage:     "Explain whether a user is allowed to perform an action on a resource",
+	ArgsUsage: "<access-key> <action> [bucket] [object]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "endpoint",
+			Usage: "set the fds server address",
+			Value: "http://127.0.0.1:9000",
+		},
+		&cli.StringFlag{
+			Name:    "root-user",
+			Usage:   "set root file dag root user",
+			EnvVars: []string{EnvRootUser},
+			Value:   auth.DefaultAccessKey,
+		},
+		&cli.StringFlag{
+			Name:    "root-password",
+			Usage:   "set root file dag root password",
+			EnvVars: []string{EnvRootPassword},
+			Value:   auth.DefaultSecretKey,
+		},
+		&cli.StringSliceFlag{
+			Name:  "context",
+			Usage: "set a condition context key as key=value, can be repeated",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.NArg() < 2 {
+			return fmt.Errorf("expected at least access key and action, got %d arguments", cctx.NArg())
+		}
+		query := url.Values{}
+		query.Set("accessKey", cctx.Args().Get(0))
+		query.Set("action", cctx.Args().Get(1))
+		query.Set("bucket", cctx.Args().Get(2))
+		query.Set("object", cctx.Args().Get(3))
+		for _, kv := range cctx.StringSlice("context") {
+			query.Add("context", kv)
+		}
+		u := strings.TrimSuffix(cctx.String("endpoint"), "/") + "/admin/v1/simulate-access?" + query.Encode()
+		req, err := utils.NewRequest(http.MethodGet, u, 0, nil)
+		if err != nil {
+			return err
+		}
+		if err = utils.SignRequestV4(req, cctx.String("root-user"), cctx.String("root-password"), "s3"); err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("simulate access failed: %s: %s", resp.Status, body)
+		}
+		var out bytes.Buffer
+		if err = json.Indent(&out, body, "", "  "); err != nil {
+			return err
+		}
+		fmt.Println(out.String())
+		return nil
+	},
+}
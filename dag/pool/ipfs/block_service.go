@@ -12,6 +12,7 @@ import (
 	"github.com/multiformats/go-multicodec"
 	"golang.org/x/xerrors"
 	"strings"
+	"time"
 )
 
 type BlockAPI PoolClient
@@ -37,11 +38,13 @@ func (b *BlockAPI) Has(ctx context.Context, cid cid.Cid) (bool, error) {
 
 func (b *BlockAPI) Get(ctx context.Context, cid cid.Cid) (blocks.Block, error) {
 	log.Debugf(cid.String())
+	start := time.Now()
 	node, err := b.api.Dag().Get(ctx, cid)
+	if err != nil && strings.Contains(err.Error(), "not found") {
+		err = format.ErrNotFound{Cid: cid}
+	}
+	(*PoolClient)(b).observe("dag/get", start, err)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			return nil, format.ErrNotFound{Cid: cid}
-		}
 		return nil, err
 	}
 	return node, nil
@@ -49,17 +52,21 @@ func (b *BlockAPI) Get(ctx context.Context, cid cid.Cid) (blocks.Block, error) {
 
 func (b *BlockAPI) GetSize(ctx context.Context, cid cid.Cid) (int, error) {
 	log.Debugf(cid.String())
+	start := time.Now()
 	stat, err := b.api.Block().Stat(ctx, path.IpfsPath(cid))
+	(*PoolClient)(b).observe("block/stat", start, err)
 	return stat.Size(), err
 }
 
 func (b *BlockAPI) Put(ctx context.Context, block blocks.Block) error {
 	cidBuilder, _ := merkledag.PrefixForCidVersion(0)
 	cidCodec := multicodec.Code(cidBuilder.Codec).String()
+	start := time.Now()
 	_, err := b.api.Block().Put(ctx, bytes.NewReader(block.RawData()),
 		options.Block.Hash(cidBuilder.MhType, cidBuilder.MhLength),
 		options.Block.CidCodec(cidCodec),
 		options.Block.Format("v0"))
+	(*PoolClient)(b).observe("block/put", start, err)
 	return err
 }
 
@@ -5,8 +5,11 @@ import (
 	"github.com/ipfs/boxo/exchange/offline"
 	"github.com/ipfs/go-blockservice"
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	format "github.com/ipfs/go-ipld-format"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/ipfs/kubo/client/rpc"
+	"github.com/yann-y/fds/internal/metrics"
+	"time"
 )
 
 var log = logging.Logger("ipfs-client")
@@ -31,6 +34,21 @@ func NewPoolClient(api *rpc.HttpApi, enablePin bool) (*PoolClient, error) {
 	_, err := pool.api.Swarm().ListenAddrs(context.Background())
 	return pool, err
 }
+
+// SetAddr sets the address of the kubo node, used to label the RPC metrics.
+func (i *PoolClient) SetAddr(addr string) {
+	i.addr = addr
+}
+
+// observe records the metrics of a kubo RPC call started at start, a block
+// not found is an answer of the node rather than an error.
+func (i *PoolClient) observe(method string, start time.Time, err error) {
+	if format.IsNotFound(err) {
+		err = nil
+	}
+	metrics.ObserveIPFSRPC(i.addr, method, start, err)
+}
+
 func (i *PoolClient) Close() {}
 func (i *PoolClient) Block() *BlockAPI {
 	return (*BlockAPI)(i)
@@ -39,7 +57,9 @@ func (i *PoolClient) Store() *Store {
 	return (*Store)(i)
 }
 func (i *PoolClient) Health(ctx context.Context) bool {
+	start := time.Now()
 	_, err := i.api.Swarm().ListenAddrs(ctx)
+	i.observe("swarm/addrs/listen", start, err)
 	if err != nil {
 		log.Error("IPFS is not healthy %v", err)
 	}
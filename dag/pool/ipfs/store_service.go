@@ -7,19 +7,25 @@ import (
 	"github.com/ipfs/boxo/files"
 	"github.com/ipfs/go-cid"
 	"io"
+	"time"
 )
 
 type Store PoolClient
 
 func (s *Store) Add(ctx context.Context, reader io.ReadCloser) (path.Resolved, error) {
-	return s.api.Unixfs().Add(ctx, files.NewReaderFile(reader))
+	start := time.Now()
+	resolved, err := s.api.Unixfs().Add(ctx, files.NewReaderFile(reader))
+	(*PoolClient)(s).observe("add", start, err)
+	return resolved, err
 }
 func (s *Store) Get(ctx context.Context, cidStr string) (io.ReadCloser, error) {
 	meatCid, err := cid.Decode(cidStr)
 	if err != nil {
 		return nil, err
 	}
+	start := time.Now()
 	f, err := s.api.Unixfs().Get(ctx, path.IpfsPath(meatCid))
+	(*PoolClient)(s).observe("get", start, err)
 	if err != nil {
 		return nil, err
 	}
@@ -2,7 +2,9 @@ package apierrors
 
 import (
 	"context"
+	"github.com/yann-y/fds/internal/event"
 	"github.com/yann-y/fds/internal/lock"
+	"github.com/yann-y/fds/internal/replication"
 	"github.com/yann-y/fds/internal/store"
 	"github.com/yann-y/fds/internal/utils/hash"
 	"github.com/yann-y/fds/pkg/s3utils"
@@ -45,6 +47,40 @@ func ToApiError(ctx context.Context, err error) ErrorCode {
 		errCode = ErrNoSuchBucketPolicy
 	case store.BucketTaggingNotFound:
 		errCode = ErrBucketTaggingNotFound
+	case store.BucketCorsNotFound:
+		errCode = ErrNoSuchCORSConfiguration
+	case store.BucketWebsiteNotFound:
+		errCode = ErrNoSuchWebsiteConfiguration
+	case store.BucketReplicationNotFound:
+		errCode = ErrReplicationConfigurationNotFoundError
+	case replication.ErrInvalidARN:
+		errCode = ErrReplicationDestinationInvalid
+	case replication.ErrTargetNotFound:
+		errCode = ErrReplicationTargetNotFound
+	case event.ErrInvalidEventName:
+		errCode = ErrEventNotification
+	case event.ErrInvalidARN, event.ErrARNNotFound:
+		errCode = ErrARNNotification
+	case event.ErrUnknownRegion:
+		errCode = ErrRegionNotification
+	case event.ErrInvalidFilterName:
+		errCode = ErrFilterNameInvalid
+	case event.ErrFilterNamePrefix:
+		errCode = ErrFilterNamePrefix
+	case event.ErrFilterNameSuffix:
+		errCode = ErrFilterNameSuffix
+	case event.ErrInvalidFilterValue:
+		errCode = ErrFilterValueInvalid
+	case store.BucketOwnershipControlsNotFound:
+		errCode = ErrOwnershipControlsNotFound
+	case store.BucketACLNotSupported:
+		errCode = ErrAccessControlListNotSupported
+	case store.InvalidBucketACLWithObjectOwnership:
+		errCode = ErrInvalidBucketAclWithObjectOwnership
+	case store.BucketQuotaExceeded:
+		errCode = ErrAdminBucketQuotaExceeded
+	case store.UserQuotaExceeded:
+		errCode = ErrAdminUserQuotaExceeded
 	case s3utils.BucketNameInvalid:
 		errCode = ErrInvalidBucketName
 	case s3utils.ObjectNameInvalid:
@@ -74,6 +110,8 @@ func ToApiError(ctx context.Context, err error) ErrorCode {
 			errCode = ErrNoSuchKey
 		} else if xerrors.Is(err, store.ErrBucketNotEmpty) {
 			errCode = ErrBucketNotEmpty
+		} else if xerrors.Is(err, store.ErrInvalidQuota) {
+			errCode = ErrAdminInvalidQuota
 		}
 	}
 	return errCode
@@ -76,6 +76,8 @@ const (
 	ErrUserAlreadyExists
 	ErrNoSuchUserPolicy
 	ErrUserPolicyAlreadyExists
+	ErrNoSuchRole
+	ErrNoSuchPolicy
 	ErrNoSuchBucket
 	ErrNoSuchBucketPolicy
 	ErrNoSuchLifecycleConfiguration
@@ -137,6 +139,17 @@ const (
 	ErrBucketTaggingNotFound
 	ErrObjectLockInvalidHeaders
 	ErrInvalidTagDirective
+	ErrMalformedACLError
+	ErrUnresolvableGrantByEmailAddress
+	ErrAccessControlListNotSupported
+	ErrInvalidBucketAclWithObjectOwnership
+	ErrOwnershipControlsNotFound
+	ErrCORSRequestNotAllowed
+	ErrReplicationDestinationInvalid
+	ErrReplicationTargetNotFound
+	ErrAdminBucketQuotaExceeded
+	ErrAdminUserQuotaExceeded
+	ErrAdminInvalidQuota
 	// Add new error codes here.
 
 	// SSE-S3 related API errors
@@ -432,6 +445,16 @@ var errorCodeResponse = map[ErrorCode]APIError{
 		Description:    "The same user policy already exists .",
 		HTTPStatusCode: http.StatusConflict,
 	},
+	ErrNoSuchRole: {
+		Code:           "NoSuchRole",
+		Description:    "The specified role does not exist",
+		HTTPStatusCode: http.StatusNotFound,
+	},
+	ErrNoSuchPolicy: {
+		Code:           "NoSuchPolicy",
+		Description:    "The specified policy does not exist",
+		HTTPStatusCode: http.StatusNotFound,
+	},
 	ErrNoSuchKey: {
 		Code:           "NoSuchKey",
 		Description:    "The specified key does not exist.",
@@ -613,6 +636,61 @@ var errorCodeResponse = map[ErrorCode]APIError{
 		Description:    "The TagSet does not exist",
 		HTTPStatusCode: http.StatusNotFound,
 	},
+	ErrMalformedACLError: {
+		Code:           "MalformedACLError",
+		Description:    "The XML you provided was not well-formed or did not validate against our published schema.",
+		HTTPStatusCode: http.StatusBadRequest,
+	},
+	ErrUnresolvableGrantByEmailAddress: {
+		Code:           "UnresolvableGrantByEmailAddress",
+		Description:    "The email address you provided does not match any account on record.",
+		HTTPStatusCode: http.StatusBadRequest,
+	},
+	ErrAccessControlListNotSupported: {
+		Code:           "AccessControlListNotSupported",
+		Description:    "The bucket does not allow ACLs",
+		HTTPStatusCode: http.StatusBadRequest,
+	},
+	ErrInvalidBucketAclWithObjectOwnership: {
+		Code:           "InvalidBucketAclWithObjectOwnership",
+		Description:    "Bucket cannot have ACLs set with ObjectOwnership's BucketOwnerEnforced setting",
+		HTTPStatusCode: http.StatusBadRequest,
+	},
+	ErrOwnershipControlsNotFound: {
+		Code:           "OwnershipControlsNotFoundError",
+		Description:    "The bucket ownership controls were not found",
+		HTTPStatusCode: http.StatusNotFound,
+	},
+	ErrCORSRequestNotAllowed: {
+		Code:           "AccessForbidden",
+		Description:    "CORSResponse: This CORS request is not allowed. This is usually because the evalution of Origin, request method / Access-Control-Request-Method or Access-Control-Request-Headers are not whitelisted by the resource's CORS spec.",
+		HTTPStatusCode: http.StatusForbidden,
+	},
+	ErrReplicationDestinationInvalid: {
+		Code:           "InvalidArgument",
+		Description:    "The destination bucket must be an ARN of the form arn:fds:replication::<target>:<bucket>",
+		HTTPStatusCode: http.StatusBadRequest,
+	},
+	ErrReplicationTargetNotFound: {
+		Code:           "InvalidArgument",
+		Description:    "The replication target of the destination bucket is not configured",
+		HTTPStatusCode: http.StatusBadRequest,
+	},
+	ErrAdminBucketQuotaExceeded: {
+		Code:           "XFdsAdminBucketQuotaExceeded",
+		Description:    "Bucket quota exceeded",
+		HTTPStatusCode: http.StatusBadRequest,
+	},
+	ErrAdminUserQuotaExceeded: {
+		Code:           "XFdsAdminUserQuotaExceeded",
+		Description:    "User quota exceeded",
+		HTTPStatusCode: http.StatusBadRequest,
+	},
+	ErrAdminInvalidQuota: {
+		Code:           "XFdsAdminInvalidQuota",
+		Description:    "The quota must not be negative, and its soft limit must not be over its hard limit",
+		HTTPStatusCode: http.StatusBadRequest,
+	},
 	ErrObjectLockConfigurationNotAllowed: {
 		Code:           "InvalidBucketState",
 		Description:    "Object Lock configuration cannot be enabled on existing buckets",
@@ -1271,6 +1349,8 @@ const (
 	ErrSTSMissingParameter
 	ErrSTSInvalidParameterValue
 	ErrSTSInternalError
+	ErrSTSInvalidIdentityToken
+	ErrSTSNotInitialized
 )
 
 type stsErrorCodeMap map[STSErrorCode]STSError
@@ -1307,4 +1387,14 @@ var StsErrCodes = stsErrorCodeMap{
 		Description:    "We encountered an internal error generating credentials, please try again.",
 		HTTPStatusCode: http.StatusInternalServerError,
 	},
+	ErrSTSInvalidIdentityToken: {
+		Code:           "InvalidIdentityToken",
+		Description:    "The web identity token that was passed could not be validated. Get a new identity token from the identity provider and then retry the request.",
+		HTTPStatusCode: http.StatusBadRequest,
+	},
+	ErrSTSNotInitialized: {
+		Code:           "STSNotInitialized",
+		Description:    "STS API not initialized, please configure an OpenID provider.",
+		HTTPStatusCode: http.StatusNotImplemented,
+	},
 }
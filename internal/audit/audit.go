@@ -0,0 +1,147 @@
+package audit
+
+import (
+	logging "github.com/ipfs/go-log/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var log = logging.Logger("audit")
+
+const (
+	// DefaultQueueSize - the default number of entries buffered per target.
+	DefaultQueueSize = 10000
+	// maxBatchSize - the maximum number of entries sent to a target at once.
+	maxBatchSize = 100
+	// retryInterval - the interval between sends to a target that failed.
+	retryInterval = time.Second
+)
+
+// Target - a destination of audit entries.
+type Target interface {
+	// Name identifies the target in logs.
+	Name() string
+	// Send delivers entries in order, entries are sent again on error.
+	Send(entries []Entry) error
+	// Close releases the target once every entry is sent.
+	Close() error
+}
+
+// targetWorker - sends the buffered entries of a target.
+type targetWorker struct {
+	target  Target
+	entries chan Entry
+	dropped uint64
+	done    chan struct{}
+}
+
+// Sys - buffers the entries of every request and sends them to the targets,
+// entries are dropped while the buffer of a target is full so that requests
+// never wait for a target.
+type Sys struct {
+	queueSize int
+	workers   []*targetWorker
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewSys returns an audit sys buffering queueSize entries per target.
+func NewSys(queueSize int) *Sys {
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	return &Sys{
+		queueSize: queueSize,
+		closed:    make(chan struct{}),
+	}
+}
+
+// AddTarget - starts sending entries to the target, targets must be added
+// before any entry is logged.
+func (sys *Sys) AddTarget(target Target) {
+	w := &targetWorker{
+		target:  target,
+		entries: make(chan Entry, sys.queueSize),
+		done:    make(chan struct{}),
+	}
+	sys.workers = append(sys.workers, w)
+	go sys.run(w)
+}
+
+// Log - queues the entry for every target.
+func (sys *Sys) Log(entry Entry) {
+	if sys == nil {
+		return
+	}
+	select {
+	case <-sys.closed:
+		return
+	default:
+	}
+	for _, w := range sys.workers {
+		select {
+		case w.entries <- entry:
+		default:
+			if n := atomic.AddUint64(&w.dropped, 1); n == 1 || n%1000 == 0 {
+				log.Warnf("audit target %s is full, %d entries dropped", w.target.Name(), n)
+			}
+		}
+	}
+}
+
+// Close - sends the entries buffered and closes the targets.
+func (sys *Sys) Close() {
+	if sys == nil {
+		return
+	}
+	sys.closeOnce.Do(func() {
+		close(sys.closed)
+		for _, w := range sys.workers {
+			<-w.done
+			if err := w.target.Close(); err != nil {
+				log.Errorf("close audit target %s err:%v", w.target.Name(), err)
+			}
+		}
+	})
+}
+
+// run - sends the entries of w in batches until the sys is closed and the
+// buffer is empty.
+func (sys *Sys) run(w *targetWorker) {
+	defer close(w.done)
+	for {
+		var entry Entry
+		select {
+		case entry = <-w.entries:
+		case <-sys.closed:
+			if len(w.entries) == 0 {
+				return
+			}
+			entry = <-w.entries
+		}
+		batch := append(make([]Entry, 0, maxBatchSize), entry)
+		for len(batch) < maxBatchSize && len(w.entries) > 0 {
+			batch = append(batch, <-w.entries)
+		}
+		sys.send(w, batch)
+	}
+}
+
+// send - sends the batch to the target of w, retrying until it is sent or
+// the sys is closed.
+func (sys *Sys) send(w *targetWorker, batch []Entry) {
+	for {
+		err := w.target.Send(batch)
+		if err == nil {
+			return
+		}
+		log.Errorf("send audit entries to %s err:%v", w.target.Name(), err)
+		select {
+		case <-sys.closed:
+			log.Warnf("audit target %s is closed, %d entries dropped", w.target.Name(), len(batch))
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
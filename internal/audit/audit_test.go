@@ -0,0 +1,258 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/yann-y/fds/internal/iam"
+	"github.com/yann-y/fds/internal/iam/auth"
+	"github.com/yann-y/fds/internal/reqinfo"
+	"github.com/yann-y/fds/internal/uleveldb"
+	"github.com/yann-y/fds/internal/utils"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memTarget - keeps the entries sent, failing while down is set.
+type memTarget struct {
+	mu      sync.Mutex
+	down    bool
+	entries []Entry
+}
+
+func (t *memTarget) Name() string {
+	return "mem"
+}
+
+func (t *memTarget) Send(entries []Entry) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.down {
+		return errors.New("down")
+	}
+	t.entries = append(t.entries, entries...)
+	return nil
+}
+
+func (t *memTarget) Close() error {
+	return nil
+}
+
+func (t *memTarget) sent() []Entry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Entry(nil), t.entries...)
+}
+
+type testServer struct{}
+
+func (testServer) PutObjectHandler(w http.ResponseWriter, r *http.Request) {
+	io.Copy(io.Discard, r.Body)
+	w.Header().Set("x-amz-request-id", "1")
+	w.Write([]byte("ok"))
+}
+
+func (testServer) GetObjectHandler(w http.ResponseWriter, r *http.Request) {
+	reqinfo.SetErrorCode(w, "NoSuchKey")
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func TestHandler(t *testing.T) {
+	target := &memTarget{}
+	sys := NewSys(10)
+	sys.AddTarget(target)
+
+	var s testServer
+	router := mux.NewRouter()
+	bucket := router.PathPrefix("/{bucket}").Subrouter()
+	bucket.Methods(http.MethodPut).Path("/{object:.+}").HandlerFunc(s.PutObjectHandler)
+	bucket.Methods(http.MethodGet).Path("/{object:.+}").HandlerFunc(s.GetObjectHandler)
+	router.Use(reqinfo.SetRoute)
+	credentials := func(r *http.Request) (string, string) {
+		return "temp", "parent"
+	}
+	handler := Handler(router, sys, credentials)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/bucket/dir/a%20b.txt", strings.NewReader("hello"))
+	req.RemoteAddr = "10.0.0.1:1234"
+	handler.ServeHTTP(w, req)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/bucket/missing", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	sys.Close()
+
+	entries := target.sent()
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, but instead found %d", len(entries))
+	}
+	put := entries[0]
+	if put.API.Name != "PutObject" || put.API.Bucket != "bucket" || put.API.Object != "dir/a b.txt" {
+		t.Errorf("Unexpected API %+v", put.API)
+	}
+	if put.AccessKey != "temp" || put.ParentUser != "parent" || put.SourceIP != "10.0.0.1" || put.RequestID != "1" {
+		t.Errorf("Unexpected entry %+v", put)
+	}
+	if put.API.StatusCode != http.StatusOK || put.API.InputBytes != 5 || put.API.OutputBytes != 2 {
+		t.Errorf("Unexpected API %+v", put.API)
+	}
+	get := entries[1]
+	if get.API.Name != "GetObject" || get.API.StatusCode != http.StatusNotFound || get.API.ErrorCode != "NoSuchKey" {
+		t.Errorf("Unexpected API %+v", get.API)
+	}
+	if notFound := entries[2]; notFound.API.Name != "" || notFound.API.StatusCode != http.StatusNotFound {
+		t.Errorf("Unexpected API %+v", notFound.API)
+	}
+}
+
+func TestHandler_VerifiedCredentials(t *testing.T) {
+	db, err := uleveldb.OpenDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	cred, err := auth.CreateCredentials(auth.DefaultAccessKey, auth.DefaultSecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authSys := iam.NewAuthSys(db, cred)
+
+	target := &memTarget{}
+	sys := NewSys(10)
+	sys.AddTarget(target)
+	router := mux.NewRouter()
+	router.Methods(http.MethodGet).Path("/{bucket}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	router.Use(reqinfo.SetRoute)
+	handler := Handler(router, sys, authSys.VerifiedAccessKey)
+
+	testCases := []struct {
+		secretKey string
+		accessKey string
+	}{
+		// Test case - 1.
+		// a request naming the access key with a forged signature.
+		{secretKey: "forged-secret", accessKey: ""},
+		// Test case - 2.
+		{secretKey: auth.DefaultSecretKey, accessKey: auth.DefaultAccessKey},
+	}
+	for _, testCase := range testCases {
+		r := utils.MustNewSignedV4Request(http.MethodGet, "http://127.0.0.1:9000/bucket", 0, nil, "s3", auth.DefaultAccessKey, testCase.secretKey, t)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	sys.Close()
+
+	entries := target.sent()
+	if len(entries) != len(testCases) {
+		t.Fatalf("Expected %d entries, but instead found %d", len(testCases), len(entries))
+	}
+	for i, testCase := range testCases {
+		if entries[i].AccessKey != testCase.accessKey {
+			t.Errorf("Test %d: Expected the access key %q, but instead found %q", i+1, testCase.accessKey, entries[i].AccessKey)
+		}
+	}
+}
+
+func TestSysRetry(t *testing.T) {
+	target := &memTarget{down: true}
+	sys := NewSys(10)
+	sys.AddTarget(target)
+	for i := 0; i < 5; i++ {
+		sys.Log(Entry{RequestID: "r"})
+	}
+	time.Sleep(100 * time.Millisecond)
+	target.mu.Lock()
+	target.down = false
+	target.mu.Unlock()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(target.sent()) < 5 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	sys.Close()
+	if n := len(target.sent()); n != 5 {
+		t.Errorf("Expected 5 entries, but instead found %d", n)
+	}
+}
+
+func TestFileTarget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.log")
+	target, err := NewFileTarget(path, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if err = target.Send([]Entry{{RequestID: "r"}, {RequestID: "s"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = target.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Errorf("Expected 2 rotated files, but instead found %d", len(backups))
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var lines []Entry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, entry)
+	}
+	if len(lines) != 2 || lines[0].RequestID != "r" || lines[1].RequestID != "s" {
+		t.Errorf("Unexpected entries %+v", lines)
+	}
+}
+
+func TestWebhookTarget(t *testing.T) {
+	var mu sync.Mutex
+	var received []Entry
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dec := json.NewDecoder(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		for {
+			var entry Entry
+			if err := dec.Decode(&entry); err != nil {
+				break
+			}
+			received = append(received, entry)
+		}
+	}))
+	defer server.Close()
+
+	target, err := NewWebhookTarget(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = target.Send([]Entry{{RequestID: "r"}, {RequestID: "s"}}); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 2 || received[1].RequestID != "s" {
+		t.Errorf("Unexpected entries %+v", received)
+	}
+
+	if _, err = NewWebhookTarget("ftp://host"); err == nil {
+		t.Error("Expected an invalid endpoint to fail")
+	}
+}
@@ -0,0 +1,40 @@
+// Package audit records one structured entry per API request and delivers
+// the entries to buffered targets, such as a rotating file or a webhook.
+package audit
+
+import (
+	"time"
+)
+
+// Version - the version of the entry format.
+const Version = "1"
+
+// Entry - the audit entry of a request.
+type Entry struct {
+	Version   string    `json:"version"`
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestID,omitempty"`
+	// AccessKey is the access key the request is signed with, ParentUser
+	// the user a temporary access key was issued to.
+	AccessKey  string `json:"accessKey,omitempty"`
+	ParentUser string `json:"parentUser,omitempty"`
+	SourceIP   string `json:"sourceIP,omitempty"`
+	UserAgent  string `json:"userAgent,omitempty"`
+	API        API    `json:"api"`
+}
+
+// API - the API called by a request and its outcome.
+type API struct {
+	Name       string `json:"name,omitempty"`
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	Bucket     string `json:"bucket,omitempty"`
+	Object     string `json:"object,omitempty"`
+	StatusCode int    `json:"statusCode"`
+	ErrorCode  string `json:"errorCode,omitempty"`
+	// InputBytes is the size of the request body read, OutputBytes the
+	// size of the response body written.
+	InputBytes  int64  `json:"rx"`
+	OutputBytes int64  `json:"tx"`
+	Latency     string `json:"latency"`
+}
@@ -0,0 +1,128 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultFileMaxSize - the default size a file is rotated at.
+	DefaultFileMaxSize = 100 << 20
+	// DefaultFileMaxBackups - the default number of rotated files kept.
+	DefaultFileMaxBackups = 10
+
+	// backupTimeFormat - rotated files are named <path>.<time>.
+	backupTimeFormat = "20060102T150405.000000000"
+)
+
+// FileTarget - appends the entries as JSON lines to a file, which is renamed
+// with the time as suffix once it reaches its maximum size.
+type FileTarget struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	file *os.File
+	size int64
+}
+
+// NewFileTarget returns the target writing to path, rotated at maxSize bytes
+// with at most maxBackups rotated files kept, all of them when maxBackups is
+// not positive.
+func NewFileTarget(path string, maxSize int64, maxBackups int) (*FileTarget, error) {
+	if path == "" {
+		return nil, errors.New("empty audit file path")
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultFileMaxSize
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	target := &FileTarget{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := target.open(); err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// Name - returns the path of the file.
+func (target *FileTarget) Name() string {
+	return "file:" + target.path
+}
+
+// Send - appends the entries, rotating the file first when it is full.
+func (target *FileTarget) Send(entries []Entry) error {
+	if target.size >= target.maxSize {
+		if err := target.rotate(); err != nil {
+			return err
+		}
+	}
+	w := bufio.NewWriter(target.file)
+	enc := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+	}
+	n := w.Buffered()
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	target.size += int64(n)
+	return nil
+}
+
+// Close - closes the file.
+func (target *FileTarget) Close() error {
+	return target.file.Close()
+}
+
+func (target *FileTarget) open() error {
+	file, err := os.OpenFile(target.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	target.file, target.size = file, info.Size()
+	return nil
+}
+
+// rotate - renames the file, opens a new one and removes the oldest backups.
+func (target *FileTarget) rotate() error {
+	if err := target.file.Close(); err != nil {
+		return err
+	}
+	backup := target.path + "." + time.Now().UTC().Format(backupTimeFormat)
+	if err := os.Rename(target.path, backup); err != nil {
+		return err
+	}
+	if err := target.open(); err != nil {
+		return err
+	}
+	if target.maxBackups <= 0 {
+		return nil
+	}
+	backups, err := filepath.Glob(target.path + ".*")
+	if err != nil {
+		return err
+	}
+	// backup names sort by time
+	sort.Strings(backups)
+	for len(backups) > target.maxBackups {
+		if err = os.Remove(backups[0]); err != nil {
+			log.Errorf("remove audit file %s err:%v", backups[0], err)
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
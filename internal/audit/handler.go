@@ -0,0 +1,54 @@
+package audit
+
+import (
+	"github.com/yann-y/fds/internal/consts"
+	"github.com/yann-y/fds/internal/reqinfo"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Credentials - returns the access key of a request whose signature verifies
+// and the parent user of a temporary access key, or empty strings for the
+// other requests.
+type Credentials func(r *http.Request) (accessKey, parentUser string)
+
+// Handler logs an entry to sys for every request served by h, the API name,
+// bucket and object are those of the route recorded by reqinfo.SetRoute.
+func Handler(h http.Handler, sys *Sys, credentials Credentials) http.Handler {
+	if sys == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		// before the request is served, which may remove its credentials
+		accessKey, parentUser := credentials(r)
+		info := reqinfo.Serve(h, w, r)
+
+		sourceIP, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			sourceIP = r.RemoteAddr
+		}
+		sys.Log(Entry{
+			Version:    Version,
+			Time:       start.UTC(),
+			RequestID:  w.Header().Get(consts.AmzRequestID),
+			AccessKey:  accessKey,
+			ParentUser: parentUser,
+			SourceIP:   sourceIP,
+			UserAgent:  r.UserAgent(),
+			API: API{
+				Name:        info.API,
+				Method:      r.Method,
+				Path:        r.URL.Path,
+				Bucket:      info.Bucket,
+				Object:      info.Object,
+				StatusCode:  info.StatusCode,
+				ErrorCode:   info.ErrorCode,
+				InputBytes:  info.InputBytes,
+				OutputBytes: info.OutputBytes,
+				Latency:     time.Since(start).String(),
+			},
+		})
+	})
+}
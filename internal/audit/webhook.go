@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/yann-y/fds/internal/consts"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// webhookTimeout - the timeout of a single post to a webhook.
+const webhookTimeout = 10 * time.Second
+
+// WebhookTarget - posts the entries as JSON lines to an HTTP endpoint.
+type WebhookTarget struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewWebhookTarget returns the target posting to endpoint.
+func NewWebhookTarget(endpoint string) (*WebhookTarget, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid audit webhook endpoint %q", u.Redacted())
+	}
+	return &WebhookTarget{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: webhookTimeout},
+	}, nil
+}
+
+// Name - returns the endpoint.
+func (target *WebhookTarget) Name() string {
+	u, _ := url.Parse(target.endpoint)
+	return "webhook:" + u.Redacted()
+}
+
+// Send - posts the entries, any status but 2XX is an error.
+func (target *WebhookTarget) Send(entries []Entry) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(http.MethodPost, target.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(consts.ContentType, "application/x-ndjson")
+	resp, err := target.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("audit webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Close - closes the idle connections.
+func (target *WebhookTarget) Close() error {
+	target.client.CloseIdleConnections()
+	return nil
+}
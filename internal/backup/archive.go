@@ -0,0 +1,154 @@
+// Package backup exports consistent snapshots of the metadata db as
+// checksummed archives, to a directory or to the IPFS pool, and restores a
+// db from them.
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/yann-y/fds/internal/kv"
+	"hash"
+	"io"
+	"time"
+)
+
+const (
+	// Version - the version of the archive format.
+	Version = 1
+	// magic - identifies an archive.
+	magic = "fds-metadata-snapshot"
+	// restoreBatchSize - the number of keys written at once by a restore.
+	restoreBatchSize = 1000
+)
+
+// ErrCorrupted - the archive is truncated or its checksum does not match.
+var ErrCorrupted = errors.New("corrupted metadata snapshot")
+
+// Info - describes an archive.
+type Info struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Keys    int64     `json:"keys"`
+	// Checksum is the hex SHA-256 of the keys and values
+	Checksum string `json:"checksum"`
+}
+
+// header - the first record of an archive.
+type header struct {
+	Magic   string
+	Version int
+	Created time.Time
+}
+
+// record - a key of the archive, or its end which holds the number of keys
+// and their checksum.
+type record struct {
+	Key      []byte `msgpack:",omitempty"`
+	Value    []byte `msgpack:",omitempty"`
+	End      bool   `msgpack:",omitempty"`
+	Keys     int64  `msgpack:",omitempty"`
+	Checksum []byte `msgpack:",omitempty"`
+}
+
+// Write - writes the archive of every key of r, a snapshot of the db, to w.
+func Write(w io.Writer, r kv.Reader) (Info, error) {
+	info := Info{Version: Version, Created: time.Now().UTC()}
+	zw := gzip.NewWriter(w)
+	enc := msgpack.NewEncoder(zw)
+	if err := enc.Encode(header{Magic: magic, Version: Version, Created: info.Created}); err != nil {
+		return info, err
+	}
+	sum := sha256.New()
+	iter := r.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		if err := enc.Encode(record{Key: iter.Key(), Value: iter.Value()}); err != nil {
+			return info, err
+		}
+		hashKey(sum, iter.Key(), iter.Value())
+		info.Keys++
+	}
+	if err := iter.Error(); err != nil {
+		return info, err
+	}
+	checksum := sum.Sum(nil)
+	if err := enc.Encode(record{End: true, Keys: info.Keys, Checksum: checksum}); err != nil {
+		return info, err
+	}
+	info.Checksum = hex.EncodeToString(checksum)
+	return info, zw.Close()
+}
+
+// Read - calls fn with every key of the archive in order, and checks the
+// archive is complete and matches its checksum once they are read.
+func Read(r io.Reader, fn func(key, value []byte) error) (Info, error) {
+	var info Info
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return info, fmt.Errorf("%w: %v", ErrCorrupted, err)
+	}
+	defer zr.Close()
+	dec := msgpack.NewDecoder(zr)
+	var h header
+	if err = dec.Decode(&h); err != nil || h.Magic != magic {
+		return info, fmt.Errorf("%w: not a metadata snapshot", ErrCorrupted)
+	}
+	if h.Version > Version {
+		return info, fmt.Errorf("unsupported metadata snapshot version %d", h.Version)
+	}
+	info.Version, info.Created = h.Version, h.Created
+	sum := sha256.New()
+	for {
+		var rec record
+		if err = dec.Decode(&rec); err != nil {
+			return info, fmt.Errorf("%w: %v", ErrCorrupted, err)
+		}
+		if rec.End {
+			if rec.Keys != info.Keys || !bytes.Equal(rec.Checksum, sum.Sum(nil)) {
+				return info, fmt.Errorf("%w: checksum mismatch", ErrCorrupted)
+			}
+			info.Checksum = hex.EncodeToString(rec.Checksum)
+			return info, nil
+		}
+		hashKey(sum, rec.Key, rec.Value)
+		info.Keys++
+		if err = fn(rec.Key, rec.Value); err != nil {
+			return info, err
+		}
+	}
+}
+
+// Restore - writes every key of the archive to store, which should be
+// empty. A failed restore may leave part of the keys written.
+func Restore(r io.Reader, store kv.Store) (Info, error) {
+	batch := kv.NewBatch()
+	info, err := Read(r, func(key, value []byte) error {
+		batch.Put(key, value)
+		if batch.Len() < restoreBatchSize {
+			return nil
+		}
+		err := store.Write(batch)
+		batch = kv.NewBatch()
+		return err
+	})
+	if err != nil {
+		return info, err
+	}
+	return info, store.Write(batch)
+}
+
+// hashKey - adds the key and its value to sum, prefixed by their lengths so
+// that the boundaries between them count.
+func hashKey(sum hash.Hash, key, value []byte) {
+	var n [binary.MaxVarintLen64]byte
+	sum.Write(n[:binary.PutUvarint(n[:], uint64(len(key)))])
+	sum.Write(key)
+	sum.Write(n[:binary.PutUvarint(n[:], uint64(len(value)))])
+	sum.Write(value)
+}
@@ -0,0 +1,128 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/yann-y/fds/internal/kv"
+	"github.com/yann-y/fds/internal/uleveldb"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openStore(t *testing.T) kv.Store {
+	store, err := uleveldb.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		store.Close()
+	})
+	return store
+}
+
+func TestWriteRestore(t *testing.T) {
+	src := openStore(t)
+	for i := 0; i < 2500; i++ {
+		if err := src.Put([]byte(fmt.Sprintf("key/%05d", i)), []byte(fmt.Sprintf("value%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := src.Put([]byte("empty"), nil); err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	info, err := Write(&archive, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Keys != 2501 || info.Version != Version || info.Checksum == "" {
+		t.Fatalf("Unexpected info %+v", info)
+	}
+
+	dst := openStore(t)
+	restored, err := Restore(bytes.NewReader(archive.Bytes()), dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Keys != info.Keys || restored.Checksum != info.Checksum || !restored.Created.Equal(info.Created) {
+		t.Errorf("Expected %+v, but instead found %+v", info, restored)
+	}
+	for _, key := range []string{"key/00000", "key/02499", "empty"} {
+		expected, _ := src.Get([]byte(key))
+		value, err := dst.Get([]byte(key))
+		if err != nil || !bytes.Equal(value, expected) {
+			t.Errorf("Expected %q to be %q, but instead found %q, %v", key, expected, value, err)
+		}
+	}
+}
+
+func TestReadCorrupted(t *testing.T) {
+	src := openStore(t)
+	for i := 0; i < 100; i++ {
+		if err := src.Put([]byte(fmt.Sprintf("key/%d", i)), bytes.Repeat([]byte{byte(i)}, 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var archive bytes.Buffer
+	if _, err := Write(&archive, src); err != nil {
+		t.Fatal(err)
+	}
+	data := archive.Bytes()
+	flipped := append([]byte(nil), data...)
+	flipped[len(flipped)/2] ^= 0xff
+
+	testCases := [][]byte{
+		data[:len(data)/2],
+		flipped,
+		[]byte("not an archive"),
+	}
+	for i, testCase := range testCases {
+		_, err := Read(bytes.NewReader(testCase), func(key, value []byte) error {
+			return nil
+		})
+		if !errors.Is(err, ErrCorrupted) {
+			t.Errorf("Test %d: Expected %v, but instead found %v", i+1, ErrCorrupted, err)
+		}
+	}
+}
+
+func TestSchedulerDirTarget(t *testing.T) {
+	src := openStore(t)
+	if err := src.Put([]byte("a"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "snapshots")
+	target, err := NewDirTarget(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduler := NewScheduler(src, target)
+	for i := 0; i < 3; i++ {
+		if err = scheduler.Snapshot(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 snapshots kept, but instead found %d", len(entries))
+	}
+
+	file, err := os.Open(filepath.Join(dir, entries[1].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	dst := openStore(t)
+	if _, err = Restore(file, dst); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := dst.Get([]byte("a")); err != nil || string(value) != "1" {
+		t.Errorf("Expected 1, but instead found %q, %v", value, err)
+	}
+}
@@ -0,0 +1,243 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	dagpoolcli "github.com/filedag-project/filedag-storage/dag/pool/client"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log/v2"
+	dagpool "github.com/yann-y/fds/dag/pool/ipfs"
+	"github.com/yann-y/fds/internal/kv"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var log = logging.Logger("backup")
+
+const (
+	// fileNamePrefix, fileNameSuffix - a snapshot is named
+	// <prefix><time><suffix>, so that the names sort by time.
+	fileNamePrefix = "fds-meta-"
+	fileNameSuffix = ".snap"
+	timeFormat     = "20060102T150405.000000000Z"
+
+	// poolIndexPrefix - the snapshots saved to the pool are indexed in the db
+	// under <prefix><name>, with their root CID as value.
+	poolIndexPrefix = "backup/"
+)
+
+// Target - a destination of snapshots.
+type Target interface {
+	// Name identifies the target in logs.
+	Name() string
+	// Save saves the archive written by write under name, removes the
+	// snapshots beyond the retention, and returns where it is saved.
+	Save(ctx context.Context, name string, write func(w io.Writer) error) (string, error)
+}
+
+// snapshotName - returns the name of the snapshot taken at t.
+func snapshotName(t time.Time) string {
+	return fileNamePrefix + t.UTC().Format(timeFormat) + fileNameSuffix
+}
+
+// DirTarget - saves the snapshots as files of a directory.
+type DirTarget struct {
+	dir string
+	// keep is the number of snapshots kept, all of them when not positive
+	keep int
+}
+
+// NewDirTarget returns the target saving to dir and keeping the keep latest
+// snapshots.
+func NewDirTarget(dir string, keep int) (*DirTarget, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &DirTarget{dir: dir, keep: keep}, nil
+}
+
+// Name - returns the directory.
+func (t *DirTarget) Name() string {
+	return "dir:" + t.dir
+}
+
+// Save - writes the archive to a temporary file renamed once complete.
+func (t *DirTarget) Save(ctx context.Context, name string, write func(w io.Writer) error) (string, error) {
+	file, err := os.CreateTemp(t.dir, ".tmp-"+name)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+	if err = write(file); err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(t.dir, name)
+	if err = os.Rename(file.Name(), path); err != nil {
+		return "", err
+	}
+	t.prune()
+	return path, nil
+}
+
+// prune - removes the oldest snapshots beyond the retention.
+func (t *DirTarget) prune() {
+	if t.keep <= 0 {
+		return
+	}
+	names, err := filepath.Glob(filepath.Join(t.dir, fileNamePrefix+"*"+fileNameSuffix))
+	if err != nil {
+		log.Errorf("list snapshots of %s err:%v", t.dir, err)
+		return
+	}
+	sort.Strings(names)
+	for len(names) > t.keep {
+		if err = os.Remove(names[0]); err != nil {
+			log.Errorf("remove snapshot %s err:%v", names[0], err)
+		}
+		names = names[1:]
+	}
+}
+
+// PoolTarget - saves the snapshots as files of the IPFS pool, indexed by
+// name in the db.
+type PoolTarget struct {
+	pool *dagpool.PoolClient
+	dag  ipld.DAGService
+	db   *kv.DB
+	keep int
+}
+
+// NewPoolTarget returns the target saving to pool, indexing the snapshots in
+// db and keeping the keep latest ones, whose DAGs are removed through dag.
+func NewPoolTarget(pool *dagpool.PoolClient, dag ipld.DAGService, db *kv.DB, keep int) *PoolTarget {
+	return &PoolTarget{pool: pool, dag: dag, db: db, keep: keep}
+}
+
+// Name - returns the name of the target.
+func (t *PoolTarget) Name() string {
+	return "pool"
+}
+
+// Save - adds the archive to the pool, its root CID is the location.
+func (t *PoolTarget) Save(ctx context.Context, name string, write func(w io.Writer) error) (string, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(write(pw))
+	}()
+	resolved, err := t.pool.Store().Add(ctx, pr)
+	pr.CloseWithError(err)
+	if err != nil {
+		return "", err
+	}
+	root := resolved.Cid().String()
+	if err = t.db.Put(poolIndexPrefix+name, root); err != nil {
+		return "", err
+	}
+	t.prune(ctx)
+	return root, nil
+}
+
+// prune - removes the oldest snapshots beyond the retention.
+func (t *PoolTarget) prune(ctx context.Context) {
+	if t.keep <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	all, err := t.db.ReadAllChan(ctx, poolIndexPrefix, "")
+	if err != nil {
+		log.Errorf("list pool snapshots err:%v", err)
+		return
+	}
+	// the index keys sort by time
+	var keys, roots []string
+	for entry := range all {
+		var root string
+		if err = entry.UnmarshalValue(&root); err != nil {
+			log.Errorf("decode pool snapshot %s err:%v", entry.Key, err)
+			continue
+		}
+		keys, roots = append(keys, entry.Key), append(roots, root)
+	}
+	for i := 0; i < len(keys)-t.keep; i++ {
+		if c, err := cid.Decode(roots[i]); err == nil {
+			if err = dagpoolcli.RemoveDAG(ctx, t.dag, c); err != nil {
+				log.Errorf("remove pool snapshot %s err:%v", roots[i], err)
+				continue
+			}
+		}
+		if err = t.db.Delete(keys[i]); err != nil {
+			log.Errorf("remove pool snapshot index %s err:%v", keys[i], err)
+		}
+	}
+}
+
+// Scheduler - takes a snapshot of a store and saves it to every target,
+// periodically once started.
+type Scheduler struct {
+	store   kv.Store
+	targets []Target
+}
+
+// NewScheduler returns the scheduler of the snapshots of store.
+func NewScheduler(store kv.Store, targets ...Target) *Scheduler {
+	return &Scheduler{store: store, targets: targets}
+}
+
+// Snapshot - saves a consistent snapshot of the store to every target, while
+// the store keeps serving writes.
+func (s *Scheduler) Snapshot(ctx context.Context) error {
+	snap, err := s.store.NewSnapshot()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+	name := snapshotName(time.Now())
+	var failed []string
+	for _, target := range s.targets {
+		var info Info
+		location, err := target.Save(ctx, name, func(w io.Writer) (err error) {
+			info, err = Write(w, snap)
+			return err
+		})
+		if err != nil {
+			log.Errorf("save metadata snapshot to %s err:%v", target.Name(), err)
+			failed = append(failed, target.Name())
+			continue
+		}
+		log.Infow("saved metadata snapshot", "target", target.Name(), "location", location, "keys", info.Keys, "checksum", info.Checksum)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("save metadata snapshot to %s failed", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Start - takes a snapshot every interval until ctx is done.
+func (s *Scheduler) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.Snapshot(ctx); err != nil {
+					log.Errorf("metadata snapshot err:%v", err)
+				}
+			}
+		}
+	}()
+}
@@ -22,11 +22,24 @@ const (
 	MaxSkewTime = 15 * time.Minute // 15 minutes skew allowed.
 
 	// STS API version.
-	StsAPIVersion   = "2011-06-15"
-	StsVersion      = "Version"
-	StsAction       = "Action"
-	AssumeRole      = "AssumeRole"
-	SignV4Algorithm = "AWS4-HMAC-SHA256"
+	StsAPIVersion      = "2011-06-15"
+	StsVersion         = "Version"
+	StsAction          = "Action"
+	AssumeRole         = "AssumeRole"
+	StsDurationSeconds = "DurationSeconds"
+	StsPolicy          = "Policy"
+	StsRoleArn         = "RoleArn"
+	StsRoleSessionName = "RoleSessionName"
+	// StsSessionPolicyLimit maximum size of an inline session policy.
+	StsSessionPolicyLimit = 2048
+	SignV4Algorithm       = "AWS4-HMAC-SHA256"
+
+	// AssumeRoleWithWebIdentity and AssumeRoleWithClientGrants exchange a JWT
+	// issued by an OpenID provider for temporary credentials.
+	AssumeRoleWithWebIdentity  = "AssumeRoleWithWebIdentity"
+	AssumeRoleWithClientGrants = "AssumeRoleWithClientGrants"
+	StsWebIdentityToken        = "WebIdentityToken"
+	StsToken                   = "Token"
 
 	DefaultOwnerID      = "02d6176db174dc93cb1b899f7c6078f08654445fe8cf1b6ce98d8855f66bdbf4"
 	DisplayName         = "FileDagStorage"
@@ -85,6 +98,14 @@ const (
 	// Dummy putBucketACL
 	AmzACL = "x-amz-acl"
 
+	// AmzObjectOwner - metadata key carrying the owner of a stored object,
+	// it is never taken from request headers.
+	AmzObjectOwner = "x-fds-internal-object-owner"
+
+	// ForceDelete - set to true, DeleteBucket deletes the bucket along with
+	// its objects in the background.
+	ForceDelete = "X-FileDagStorage-Force-Delete"
+
 	// Signature V4 related contants.
 	AmzContentSha256        = "X-Amz-Content-Sha256"
 	AmzDate                 = "X-Amz-Date"
@@ -146,6 +167,20 @@ const (
 	Range              = "Range"
 )
 
+// CORS request and response headers
+const (
+	Origin                        = "Origin"
+	Vary                          = "Vary"
+	AccessControlRequestMethod    = "Access-Control-Request-Method"
+	AccessControlRequestHeaders   = "Access-Control-Request-Headers"
+	AccessControlAllowOrigin      = "Access-Control-Allow-Origin"
+	AccessControlAllowMethods     = "Access-Control-Allow-Methods"
+	AccessControlAllowHeaders     = "Access-Control-Allow-Headers"
+	AccessControlAllowCredentials = "Access-Control-Allow-Credentials"
+	AccessControlExposeHeaders    = "Access-Control-Expose-Headers"
+	AccessControlMaxAge           = "Access-Control-Max-Age"
+)
+
 // object const
 const (
 	MaxObjectSize = 5 * humanize.TiByte
@@ -0,0 +1,199 @@
+// Package cors models the CORS configuration of a bucket and matches cross
+// origin requests against its rules.
+package cors
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxRules is the maximum number of rules of a configuration.
+const maxRules = 100
+
+var (
+	errNoRules          = errors.New("CORS configuration has no rule")
+	errTooManyRules     = fmt.Errorf("CORS configuration has more than %d rules", maxRules)
+	errMissingOrigin    = errors.New("CORS rule has no AllowedOrigin")
+	errMissingMethod    = errors.New("CORS rule has no AllowedMethod")
+	errInvalidMethod    = errors.New("unsupported method in CORS rule")
+	errInvalidWildcard  = errors.New("CORS rule may only contain one wildcard")
+	errInvalidMaxAge    = errors.New("negative MaxAgeSeconds in CORS rule")
+	errDuplicateRuleID  = errors.New("duplicate CORS rule ID")
+	errRuleIDTooLong    = errors.New("CORS rule ID longer than 255 characters")
+	errEmptyOrigin      = errors.New("empty AllowedOrigin in CORS rule")
+	errEmptyHeader      = errors.New("empty AllowedHeader in CORS rule")
+	errEmptyExposedName = errors.New("empty ExposeHeader in CORS rule")
+)
+
+// Config - CORSConfiguration of a bucket as per
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketCors.html
+type Config struct {
+	XMLName xml.Name `xml:"CORSConfiguration"`
+	XMLNS   string   `xml:"xmlns,attr,omitempty"`
+	Rules   []Rule   `xml:"CORSRule"`
+}
+
+// Rule - origins and methods allowed to access a bucket.
+type Rule struct {
+	ID             string   `xml:"ID,omitempty"`
+	AllowedHeaders []string `xml:"AllowedHeader"`
+	AllowedMethods []string `xml:"AllowedMethod"`
+	AllowedOrigins []string `xml:"AllowedOrigin"`
+	ExposeHeaders  []string `xml:"ExposeHeader"`
+	MaxAgeSeconds  int      `xml:"MaxAgeSeconds,omitempty"`
+}
+
+// ParseConfig parses and validates a CORSConfiguration.
+func ParseConfig(reader io.Reader) (*Config, error) {
+	var config Config
+	if err := xml.NewDecoder(reader).Decode(&config); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Validate - checks the configuration has between 1 and 100 valid rules.
+func (c Config) Validate() error {
+	if len(c.Rules) == 0 {
+		return errNoRules
+	}
+	if len(c.Rules) > maxRules {
+		return errTooManyRules
+	}
+	ids := make(map[string]struct{}, len(c.Rules))
+	for _, rule := range c.Rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+		if rule.ID == "" {
+			continue
+		}
+		if _, ok := ids[rule.ID]; ok {
+			return fmt.Errorf("%w: %s", errDuplicateRuleID, rule.ID)
+		}
+		ids[rule.ID] = struct{}{}
+	}
+	return nil
+}
+
+// Validate - checks the rule allows at least one origin and one supported
+// method, origins and headers may contain at most one wildcard.
+func (r Rule) Validate() error {
+	if len(r.ID) > 255 {
+		return errRuleIDTooLong
+	}
+	if len(r.AllowedOrigins) == 0 {
+		return errMissingOrigin
+	}
+	if len(r.AllowedMethods) == 0 {
+		return errMissingMethod
+	}
+	for _, method := range r.AllowedMethods {
+		switch method {
+		case http.MethodGet, http.MethodPut, http.MethodHead, http.MethodPost, http.MethodDelete:
+		default:
+			return fmt.Errorf("%w: %s", errInvalidMethod, method)
+		}
+	}
+	for _, origin := range r.AllowedOrigins {
+		if origin == "" {
+			return errEmptyOrigin
+		}
+		if strings.Count(origin, "*") > 1 {
+			return fmt.Errorf("%w: %s", errInvalidWildcard, origin)
+		}
+	}
+	for _, header := range r.AllowedHeaders {
+		if header == "" {
+			return errEmptyHeader
+		}
+		if strings.Count(header, "*") > 1 {
+			return fmt.Errorf("%w: %s", errInvalidWildcard, header)
+		}
+	}
+	for _, header := range r.ExposeHeaders {
+		if header == "" {
+			return errEmptyExposedName
+		}
+	}
+	if r.MaxAgeSeconds < 0 {
+		return errInvalidMaxAge
+	}
+	return nil
+}
+
+// Match returns the first rule allowing origin to send a request of method
+// with headers, nil when no rule does.
+func (c Config) Match(origin, method string, headers []string) *Rule {
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		if rule.allowsOrigin(origin) && rule.allowsMethod(method) && rule.allowsHeaders(headers) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// AllowsAnyOrigin - checks whether origin is allowed by the "*" wildcard
+// only, so that the response does not depend on the origin.
+func (r Rule) AllowsAnyOrigin() bool {
+	for _, allowed := range r.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) allowsOrigin(origin string) bool {
+	for _, allowed := range r.AllowedOrigins {
+		if wildcardMatch(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) allowsMethod(method string) bool {
+	for _, allowed := range r.AllowedMethods {
+		if allowed == method {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsHeaders - header names are case-insensitive.
+func (r Rule) allowsHeaders(headers []string) bool {
+	for _, header := range headers {
+		allowed := false
+		for _, pattern := range r.AllowedHeaders {
+			if wildcardMatch(strings.ToLower(pattern), strings.ToLower(header)) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// wildcardMatch matches s against pattern holding at most one "*", which
+// matches any sequence of characters.
+func wildcardMatch(pattern, s string) bool {
+	prefix, suffix, ok := strings.Cut(pattern, "*")
+	if !ok {
+		return pattern == s
+	}
+	return len(s) >= len(prefix)+len(suffix) &&
+		strings.HasPrefix(s, prefix) && strings.HasSuffix(s, suffix)
+}
@@ -0,0 +1,93 @@
+package cors
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	testCases := []struct {
+		config  string
+		success bool
+	}{
+		{`<CORSConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><CORSRule><AllowedOrigin>https://*.example.com</AllowedOrigin><AllowedMethod>GET</AllowedMethod><AllowedHeader>*</AllowedHeader><ExposeHeader>ETag</ExposeHeader><MaxAgeSeconds>3000</MaxAgeSeconds></CORSRule></CORSConfiguration>`, true},
+		{`<CORSConfiguration><CORSRule><AllowedOrigin>*</AllowedOrigin><AllowedMethod>PUT</AllowedMethod><AllowedMethod>POST</AllowedMethod></CORSRule></CORSConfiguration>`, true},
+		{`<CORSConfiguration></CORSConfiguration>`, false},
+		{`<CORSConfiguration><CORSRule><AllowedMethod>GET</AllowedMethod></CORSRule></CORSConfiguration>`, false},
+		{`<CORSConfiguration><CORSRule><AllowedOrigin>*</AllowedOrigin></CORSRule></CORSConfiguration>`, false},
+		{`<CORSConfiguration><CORSRule><AllowedOrigin>*</AllowedOrigin><AllowedMethod>PATCH</AllowedMethod></CORSRule></CORSConfiguration>`, false},
+		{`<CORSConfiguration><CORSRule><AllowedOrigin>https://*.*.com</AllowedOrigin><AllowedMethod>GET</AllowedMethod></CORSRule></CORSConfiguration>`, false},
+		{`<CORSConfiguration><CORSRule><ID>a</ID><AllowedOrigin>*</AllowedOrigin><AllowedMethod>GET</AllowedMethod></CORSRule><CORSRule><ID>a</ID><AllowedOrigin>*</AllowedOrigin><AllowedMethod>PUT</AllowedMethod></CORSRule></CORSConfiguration>`, false},
+		{`<CORSConfiguration><CORSRule>`, false},
+	}
+	for i, testCase := range testCases {
+		_, err := ParseConfig(strings.NewReader(testCase.config))
+		if testCase.success && err != nil {
+			t.Errorf("Test %d: Expected success, but instead found %v", i+1, err)
+		}
+		if !testCase.success && err == nil {
+			t.Errorf("Test %d: Expected failure, but instead succeeded", i+1)
+		}
+	}
+}
+
+func TestConfigMatch(t *testing.T) {
+	config := Config{Rules: []Rule{
+		{
+			ID:             "app",
+			AllowedOrigins: []string{"https://*.example.com"},
+			AllowedMethods: []string{"GET", "PUT"},
+			AllowedHeaders: []string{"Content-Type", "x-amz-*"},
+		},
+		{
+			ID:             "public",
+			AllowedOrigins: []string{"*"},
+			AllowedMethods: []string{"GET"},
+		},
+	}}
+	testCases := []struct {
+		origin  string
+		method  string
+		headers []string
+		ruleID  string
+	}{
+		{"https://app.example.com", "PUT", []string{"content-type", "X-Amz-Date"}, "app"},
+		{"https://app.example.com", "PUT", []string{"Authorization"}, ""},
+		{"https://app.example.com", "GET", nil, "app"},
+		{"https://example.com", "GET", nil, "public"},
+		{"https://example.com", "PUT", nil, ""},
+		{"http://app.example.com", "DELETE", nil, ""},
+		{"https://other.org", "GET", []string{"Content-Type"}, ""},
+	}
+	for i, testCase := range testCases {
+		rule := config.Match(testCase.origin, testCase.method, testCase.headers)
+		ruleID := ""
+		if rule != nil {
+			ruleID = rule.ID
+		}
+		if ruleID != testCase.ruleID {
+			t.Errorf("Test %d: Expected rule %q, got %q", i+1, testCase.ruleID, ruleID)
+		}
+	}
+}
+
+func TestWildcardMatch(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		s       string
+		match   bool
+	}{
+		{"*", "anything", true},
+		{"https://*.example.com", "https://a.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"http://*", "http://a", true},
+		{"ab*ba", "aba", false},
+		{"exact", "exact", true},
+		{"exact", "Exact", false},
+	}
+	for i, testCase := range testCases {
+		if match := wildcardMatch(testCase.pattern, testCase.s); match != testCase.match {
+			t.Errorf("Test %d: Expected %v, got %v", i+1, testCase.match, match)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package event
+
+import (
+	"context"
+	"sync"
+)
+
+// Bus - an in-process publish/subscribe of the events of object operations,
+// for the subsystems watching objects as they change.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[*subscriber]struct{}
+}
+
+type subscriber struct {
+	ch     chan Args
+	filter func(Args) bool
+}
+
+// NewBus returns a bus without subscribers.
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[*subscriber]struct{})}
+}
+
+// Subscribe - returns the published events passing filter, a nil filter
+// passing every event, until ctx is done and the channel is closed. Events
+// are dropped rather than blocking the publisher while the buffer of the
+// subscriber is full.
+func (b *Bus) Subscribe(ctx context.Context, buffer int, filter func(Args) bool) <-chan Args {
+	sub := &subscriber{ch: make(chan Args, buffer), filter: filter}
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		delete(b.subscribers, sub)
+		close(sub.ch)
+		b.mu.Unlock()
+	}()
+	return sub.ch
+}
+
+// Publish - delivers the event to every subscriber it passes the filter of.
+func (b *Bus) Publish(args Args) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subscribers {
+		if sub.filter != nil && !sub.filter(args) {
+			continue
+		}
+		select {
+		case sub.ch <- args:
+		default:
+			log.Warnf("drop event %s of %s/%s, subscriber is full", args.EventName, args.BucketName, args.Object.Key)
+		}
+	}
+}
+
+// HasSubscribers - checks whether any subscriber is listening.
+func (b *Bus) HasSubscribers() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subscribers) > 0
+}
@@ -0,0 +1,56 @@
+package event
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBusSubscribe(t *testing.T) {
+	bus := NewBus()
+	if bus.HasSubscribers() {
+		t.Fatal("Expected no subscriber")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	created := bus.Subscribe(ctx, 10, func(args Args) bool {
+		return ObjectCreatedAll.Matches(args.EventName)
+	})
+	all := bus.Subscribe(ctx, 1, nil)
+	if !bus.HasSubscribers() {
+		t.Fatal("Expected subscribers")
+	}
+
+	bus.Publish(Args{EventName: ObjectCreatedPut, BucketName: "bucket", Object: Object{Key: "a"}})
+	bus.Publish(Args{EventName: ObjectRemovedDelete, BucketName: "bucket", Object: Object{Key: "a"}})
+	bus.Publish(Args{EventName: ObjectCreatedCopy, BucketName: "bucket", Object: Object{Key: "b"}})
+
+	for _, want := range []Name{ObjectCreatedPut, ObjectCreatedCopy} {
+		if args := <-created; args.EventName != want {
+			t.Errorf("Expected %s, but instead found %s", want, args.EventName)
+		}
+	}
+	// the buffer of one event drops the events published while it is full
+	if args := <-all; args.EventName != ObjectCreatedPut {
+		t.Errorf("Expected %s, but instead found %s", ObjectCreatedPut, args.EventName)
+	}
+	select {
+	case args := <-all:
+		t.Errorf("Expected dropped events, but instead found %s", args.EventName)
+	default:
+	}
+
+	cancel()
+	select {
+	case _, ok := <-created:
+		if ok {
+			t.Error("Expected a closed channel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the channel to be closed once ctx is done")
+	}
+	for bus.HasSubscribers() {
+		time.Sleep(time.Millisecond)
+	}
+	var nilBus *Bus
+	nilBus.Publish(Args{EventName: ObjectCreatedPut})
+}
@@ -0,0 +1,230 @@
+package event
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxFilterValueSize - the maximum size of a prefix or suffix filter value.
+const maxFilterValueSize = 1024
+
+// ErrInvalidEventName - invalid event name error.
+type ErrInvalidEventName struct {
+	Name Name
+}
+
+func (err ErrInvalidEventName) Error() string {
+	return "invalid event name '" + string(err.Name) + "'"
+}
+
+// ErrInvalidARN - invalid ARN error.
+type ErrInvalidARN struct {
+	ARN string
+}
+
+func (err ErrInvalidARN) Error() string {
+	return "invalid ARN '" + err.ARN + "'"
+}
+
+// ErrARNNotFound - ARN of no configured target error.
+type ErrARNNotFound struct {
+	ARN ARN
+}
+
+func (err ErrARNNotFound) Error() string {
+	return "ARN '" + err.ARN.String() + "' not found"
+}
+
+// ErrUnknownRegion - ARN of another region error.
+type ErrUnknownRegion struct {
+	Region string
+}
+
+func (err ErrUnknownRegion) Error() string {
+	return "unknown region '" + err.Region + "'"
+}
+
+// ErrInvalidFilterName - filter name is neither prefix nor suffix.
+type ErrInvalidFilterName struct {
+	FilterName string
+}
+
+func (err ErrInvalidFilterName) Error() string {
+	return "invalid filter name '" + err.FilterName + "'"
+}
+
+// ErrFilterNamePrefix - more than one prefix filter rule error.
+type ErrFilterNamePrefix struct{}
+
+func (err ErrFilterNamePrefix) Error() string {
+	return "more than one prefix in filter rule"
+}
+
+// ErrFilterNameSuffix - more than one suffix filter rule error.
+type ErrFilterNameSuffix struct{}
+
+func (err ErrFilterNameSuffix) Error() string {
+	return "more than one suffix in filter rule"
+}
+
+// ErrInvalidFilterValue - filter value longer than 1024 bytes or not UTF-8.
+type ErrInvalidFilterValue struct {
+	FilterValue string
+}
+
+func (err ErrInvalidFilterValue) Error() string {
+	return "invalid filter value '" + err.FilterValue + "'"
+}
+
+// Config - NotificationConfiguration of a bucket as per
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketNotificationConfiguration.html
+// Events are delivered to queues, whose ARN names a configured target.
+type Config struct {
+	XMLName   xml.Name `xml:"NotificationConfiguration"`
+	XMLNS     string   `xml:"xmlns,attr,omitempty"`
+	QueueList []Queue  `xml:"QueueConfiguration,omitempty"`
+}
+
+// Queue - the events, filtered by key, delivered to a target.
+type Queue struct {
+	ID     string  `xml:"Id,omitempty"`
+	Filter *Filter `xml:"Filter,omitempty"`
+	Events []Name  `xml:"Event"`
+	ARN    string  `xml:"Queue"`
+}
+
+// Filter - object key filter of a queue.
+type Filter struct {
+	S3Key KeyFilter `xml:"S3Key"`
+}
+
+// KeyFilter - the prefix and suffix rules object keys must match.
+type KeyFilter struct {
+	FilterRules []FilterRule `xml:"FilterRule"`
+}
+
+// FilterRule - a prefix or suffix rule.
+type FilterRule struct {
+	Name  string `xml:"Name"`
+	Value string `xml:"Value"`
+}
+
+// ParseConfig parses and validates a NotificationConfiguration, region is
+// the region of the bucket and targetExists tells whether a target is configured.
+func ParseConfig(reader io.Reader, region string, targetExists func(TargetID) bool) (*Config, error) {
+	var config Config
+	if err := xml.NewDecoder(reader).Decode(&config); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(region, targetExists); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Validate - checks the events, the filters and the ARNs of every queue.
+func (c Config) Validate(region string, targetExists func(TargetID) bool) error {
+	for _, q := range c.QueueList {
+		if err := q.Validate(region, targetExists); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate - checks the queue names a configured target of region with
+// supported events and a valid filter.
+func (q Queue) Validate(region string, targetExists func(TargetID) bool) error {
+	if len(q.Events) == 0 {
+		return ErrInvalidEventName{}
+	}
+	for _, name := range q.Events {
+		if !name.IsValid() {
+			return ErrInvalidEventName{Name: name}
+		}
+	}
+	if q.Filter != nil {
+		if err := q.Filter.S3Key.Validate(); err != nil {
+			return err
+		}
+	}
+	arn, err := ParseARN(q.ARN)
+	if err != nil {
+		return err
+	}
+	if arn.Region != "" && arn.Region != region {
+		return ErrUnknownRegion{Region: arn.Region}
+	}
+	if !targetExists(arn.TargetID) {
+		return ErrARNNotFound{ARN: *arn}
+	}
+	return nil
+}
+
+// Validate - checks the filter has at most one prefix and one suffix rule.
+func (f KeyFilter) Validate() error {
+	var prefix, suffix bool
+	for _, rule := range f.FilterRules {
+		switch strings.ToLower(rule.Name) {
+		case "prefix":
+			if prefix {
+				return ErrFilterNamePrefix{}
+			}
+			prefix = true
+		case "suffix":
+			if suffix {
+				return ErrFilterNameSuffix{}
+			}
+			suffix = true
+		default:
+			return ErrInvalidFilterName{FilterName: rule.Name}
+		}
+		if len(rule.Value) > maxFilterValueSize || !utf8.ValidString(rule.Value) {
+			return ErrInvalidFilterValue{FilterValue: rule.Value}
+		}
+	}
+	return nil
+}
+
+// matches - checks whether the queue covers the event name for key.
+func (q Queue) matches(name Name, key string) bool {
+	matched := false
+	for _, n := range q.Events {
+		if n.Matches(name) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return false
+	}
+	if q.Filter == nil {
+		return true
+	}
+	for _, rule := range q.Filter.S3Key.FilterRules {
+		switch strings.ToLower(rule.Name) {
+		case "prefix":
+			if !strings.HasPrefix(key, rule.Value) {
+				return false
+			}
+		case "suffix":
+			if !strings.HasSuffix(key, rule.Value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Match returns the queues the event name for key is delivered to.
+func (c Config) Match(name Name, key string) []Queue {
+	var queues []Queue
+	for _, q := range c.QueueList {
+		if q.matches(name, key) {
+			queues = append(queues, q)
+		}
+	}
+	return queues
+}
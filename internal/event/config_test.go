@@ -0,0 +1,124 @@
+package event
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	targetExists := func(id TargetID) bool {
+		return id == TargetID{ID: "1", Name: "webhook"}
+	}
+	testCases := []struct {
+		config  string
+		region  string
+		success bool
+	}{
+		{`<NotificationConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><QueueConfiguration><Id>1</Id><Filter><S3Key><FilterRule><Name>prefix</Name><Value>images/</Value></FilterRule><FilterRule><Name>suffix</Name><Value>.jpg</Value></FilterRule></S3Key></Filter><Queue>arn:fds:sqs::1:webhook</Queue><Event>s3:ObjectCreated:*</Event></QueueConfiguration></NotificationConfiguration>`, "", true},
+		{`<NotificationConfiguration><QueueConfiguration><Queue>arn:fds:sqs:us-east-1:1:webhook</Queue><Event>s3:ObjectCreated:Put</Event><Event>s3:ObjectRemoved:Delete</Event></QueueConfiguration></NotificationConfiguration>`, "us-east-1", true},
+		{`<NotificationConfiguration></NotificationConfiguration>`, "", true},
+		{`<NotificationConfiguration><QueueConfiguration><Queue>arn:fds:sqs:us-east-1:1:webhook</Queue><Event>s3:ObjectCreated:Put</Event></QueueConfiguration></NotificationConfiguration>`, "", false},
+		{`<NotificationConfiguration><QueueConfiguration><Queue>arn:fds:sqs::2:webhook</Queue><Event>s3:ObjectCreated:Put</Event></QueueConfiguration></NotificationConfiguration>`, "", false},
+		{`<NotificationConfiguration><QueueConfiguration><Queue>arn:aws:sqs::1:webhook</Queue><Event>s3:ObjectCreated:Put</Event></QueueConfiguration></NotificationConfiguration>`, "", false},
+		{`<NotificationConfiguration><QueueConfiguration><Queue>arn:fds:sqs::1:webhook</Queue><Event>s3:ObjectAccessed:Get</Event></QueueConfiguration></NotificationConfiguration>`, "", false},
+		{`<NotificationConfiguration><QueueConfiguration><Queue>arn:fds:sqs::1:webhook</Queue></QueueConfiguration></NotificationConfiguration>`, "", false},
+		{`<NotificationConfiguration><QueueConfiguration><Filter><S3Key><FilterRule><Name>prefix</Name><Value>a</Value></FilterRule><FilterRule><Name>prefix</Name><Value>b</Value></FilterRule></S3Key></Filter><Queue>arn:fds:sqs::1:webhook</Queue><Event>s3:ObjectCreated:*</Event></QueueConfiguration></NotificationConfiguration>`, "", false},
+		{`<NotificationConfiguration><QueueConfiguration><Filter><S3Key><FilterRule><Name>suffix</Name><Value>a</Value></FilterRule><FilterRule><Name>suffix</Name><Value>b</Value></FilterRule></S3Key></Filter><Queue>arn:fds:sqs::1:webhook</Queue><Event>s3:ObjectCreated:*</Event></QueueConfiguration></NotificationConfiguration>`, "", false},
+		{`<NotificationConfiguration><QueueConfiguration><Filter><S3Key><FilterRule><Name>middle</Name><Value>a</Value></FilterRule></S3Key></Filter><Queue>arn:fds:sqs::1:webhook</Queue><Event>s3:ObjectCreated:*</Event></QueueConfiguration></NotificationConfiguration>`, "", false},
+		{`<NotificationConfiguration><QueueConfiguration><Filter><S3Key><FilterRule><Name>prefix</Name><Value>` + strings.Repeat("a", 1025) + `</Value></FilterRule></S3Key></Filter><Queue>arn:fds:sqs::1:webhook</Queue><Event>s3:ObjectCreated:*</Event></QueueConfiguration></NotificationConfiguration>`, "", false},
+		{`<NotificationConfiguration><QueueConfiguration>`, "", false},
+	}
+	for i, testCase := range testCases {
+		_, err := ParseConfig(strings.NewReader(testCase.config), testCase.region, targetExists)
+		if testCase.success && err != nil {
+			t.Errorf("Test %d: Expected success, but instead found %v", i+1, err)
+		}
+		if !testCase.success && err == nil {
+			t.Errorf("Test %d: Expected failure, but instead succeeded", i+1)
+		}
+	}
+}
+
+func TestConfigMatch(t *testing.T) {
+	config := Config{QueueList: []Queue{
+		{
+			ID:     "images",
+			Filter: &Filter{S3Key: KeyFilter{FilterRules: []FilterRule{{Name: "prefix", Value: "images/"}, {Name: "suffix", Value: ".jpg"}}}},
+			Events: []Name{ObjectCreatedAll},
+			ARN:    "arn:fds:sqs::1:webhook",
+		},
+		{
+			ID:     "removed",
+			Events: []Name{ObjectRemovedDelete},
+			ARN:    "arn:fds:sqs::2:webhook",
+		},
+	}}
+	testCases := []struct {
+		name    Name
+		key     string
+		queueID string
+	}{
+		{ObjectCreatedPut, "images/a.jpg", "images"},
+		{ObjectCreatedCompleteMultipartUpload, "images/b.jpg", "images"},
+		{ObjectCreatedPut, "images/a.png", ""},
+		{ObjectCreatedPut, "docs/a.jpg", ""},
+		{ObjectRemovedDelete, "images/a.jpg", "removed"},
+		{ObjectRemovedDelete, "a.txt", "removed"},
+	}
+	for i, testCase := range testCases {
+		queues := config.Match(testCase.name, testCase.key)
+		var queueID string
+		if len(queues) > 0 {
+			queueID = queues[0].ID
+		}
+		if len(queues) > 1 || queueID != testCase.queueID {
+			t.Errorf("Test %d: Expected queue %q, but instead found %v", i+1, testCase.queueID, queues)
+		}
+	}
+}
+
+func TestNameMatches(t *testing.T) {
+	testCases := []struct {
+		name      Name
+		eventName Name
+		matches   bool
+	}{
+		{ObjectCreatedAll, ObjectCreatedPut, true},
+		{ObjectCreatedAll, ObjectCreatedCopy, true},
+		{ObjectCreatedAll, ObjectRemovedDelete, false},
+		{ObjectRemovedAll, ObjectRemovedDelete, true},
+		{ObjectCreatedPut, ObjectCreatedPut, true},
+		{ObjectCreatedPut, ObjectCreatedPost, false},
+	}
+	for i, testCase := range testCases {
+		if matches := testCase.name.Matches(testCase.eventName); matches != testCase.matches {
+			t.Errorf("Test %d: Expected %v, but instead found %v", i+1, testCase.matches, matches)
+		}
+	}
+}
+
+func TestParseARN(t *testing.T) {
+	testCases := []struct {
+		arn     string
+		success bool
+	}{
+		{"arn:fds:sqs::1:webhook", true},
+		{"arn:fds:sqs:us-east-1:1:webhook", true},
+		{"arn:fds:sqs::1", false},
+		{"arn:fds:sqs:::webhook", false},
+		{"arn:aws:sqs::1:webhook", false},
+		{"", false},
+	}
+	for i, testCase := range testCases {
+		arn, err := ParseARN(testCase.arn)
+		if testCase.success && err != nil {
+			t.Errorf("Test %d: Expected success, but instead found %v", i+1, err)
+		}
+		if !testCase.success && err == nil {
+			t.Errorf("Test %d: Expected failure, but instead succeeded", i+1)
+		}
+		if err == nil && arn.String() != testCase.arn {
+			t.Errorf("Test %d: Expected %s, but instead found %s", i+1, testCase.arn, arn)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package event
+
+import (
+	"fmt"
+	"github.com/yann-y/fds/internal/consts"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	eventVersion        = "2.0"
+	eventSource         = "fds:s3"
+	eventSchemaVersion  = "1.0"
+	bucketARNPrefix     = "arn:aws:s3:::"
+	requestSourceIPAddr = "sourceIPAddress"
+	responseRequestID   = "x-amz-request-id"
+)
+
+// Identity represents access key who caused the event.
+type Identity struct {
+	PrincipalID string `json:"principalId"`
+}
+
+// Bucket represents bucket metadata of the event.
+type Bucket struct {
+	Name          string   `json:"name"`
+	OwnerIdentity Identity `json:"ownerIdentity"`
+	ARN           string   `json:"arn"`
+}
+
+// Object represents object metadata of the event.
+type Object struct {
+	Key          string            `json:"key"`
+	Size         int64             `json:"size,omitempty"`
+	ETag         string            `json:"eTag,omitempty"`
+	ContentType  string            `json:"contentType,omitempty"`
+	UserMetadata map[string]string `json:"userMetadata,omitempty"`
+	VersionID    string            `json:"versionId,omitempty"`
+	Sequencer    string            `json:"sequencer"`
+}
+
+// Metadata represents event metadata.
+type Metadata struct {
+	SchemaVersion   string `json:"s3SchemaVersion"`
+	ConfigurationID string `json:"configurationId"`
+	Bucket          Bucket `json:"bucket"`
+	Object          Object `json:"object"`
+}
+
+// Event represents an S3 event record as per
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/notification-content-structure.html
+type Event struct {
+	EventVersion      string            `json:"eventVersion"`
+	EventSource       string            `json:"eventSource"`
+	AwsRegion         string            `json:"awsRegion"`
+	EventTime         string            `json:"eventTime"`
+	EventName         string            `json:"eventName"`
+	UserIdentity      Identity          `json:"userIdentity"`
+	RequestParameters map[string]string `json:"requestParameters"`
+	ResponseElements  map[string]string `json:"responseElements"`
+	S3                Metadata          `json:"s3"`
+}
+
+// Log represents the payload sent to a target.
+type Log struct {
+	EventName Name
+	Key       string
+	Records   []Event
+}
+
+// Args - the operation an event notifies of.
+type Args struct {
+	EventName   Name
+	BucketName  string
+	BucketOwner string
+	Region      string
+	Object      Object
+	// AccessKey of the request, empty for anonymous requests.
+	AccessKey string
+	SourceIP  string
+	RequestID string
+}
+
+// ToEvent returns the event record of args for the queue configured by id.
+func (args Args) ToEvent(configurationID string, eventTime time.Time) Event {
+	object := args.Object
+	object.Key = url.QueryEscape(object.Key)
+	object.Sequencer = fmt.Sprintf("%X", eventTime.UnixNano())
+	return Event{
+		EventVersion: eventVersion,
+		EventSource:  eventSource,
+		AwsRegion:    args.Region,
+		EventTime:    eventTime.UTC().Format(consts.Iso8601TimeFormat),
+		EventName:    strings.TrimPrefix(string(args.EventName), "s3:"),
+		UserIdentity: Identity{PrincipalID: args.AccessKey},
+		RequestParameters: map[string]string{
+			requestSourceIPAddr: args.SourceIP,
+		},
+		ResponseElements: map[string]string{
+			responseRequestID: args.RequestID,
+		},
+		S3: Metadata{
+			SchemaVersion:   eventSchemaVersion,
+			ConfigurationID: configurationID,
+			Bucket: Bucket{
+				Name:          args.BucketName,
+				OwnerIdentity: Identity{PrincipalID: args.BucketOwner},
+				ARN:           bucketARNPrefix + args.BucketName,
+			},
+			Object: object,
+		},
+	}
+}
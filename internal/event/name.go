@@ -0,0 +1,47 @@
+// Package event delivers bucket event notifications: the S3 event records of
+// object operations, matched against the notification configuration of their
+// bucket and queued in LevelDB until their target accepts them.
+package event
+
+import (
+	"strings"
+)
+
+// Name - event type enum.
+type Name string
+
+// Supported event names, a name ending with "*" covers every name with its prefix.
+const (
+	ObjectCreatedAll                     Name = "s3:ObjectCreated:*"
+	ObjectCreatedPut                     Name = "s3:ObjectCreated:Put"
+	ObjectCreatedPost                    Name = "s3:ObjectCreated:Post"
+	ObjectCreatedCopy                    Name = "s3:ObjectCreated:Copy"
+	ObjectCreatedCompleteMultipartUpload Name = "s3:ObjectCreated:CompleteMultipartUpload"
+	ObjectRemovedAll                     Name = "s3:ObjectRemoved:*"
+	ObjectRemovedDelete                  Name = "s3:ObjectRemoved:Delete"
+)
+
+var supportedNames = map[Name]struct{}{
+	ObjectCreatedAll:                     {},
+	ObjectCreatedPut:                     {},
+	ObjectCreatedPost:                    {},
+	ObjectCreatedCopy:                    {},
+	ObjectCreatedCompleteMultipartUpload: {},
+	ObjectRemovedAll:                     {},
+	ObjectRemovedDelete:                  {},
+}
+
+// IsValid - checks if name is a supported event name.
+func (name Name) IsValid() bool {
+	_, ok := supportedNames[name]
+	return ok
+}
+
+// Matches - checks whether name, as configured in a notification rule,
+// covers the event name eventName.
+func (name Name) Matches(eventName Name) bool {
+	if strings.HasSuffix(string(name), "*") {
+		return strings.HasPrefix(string(eventName), strings.TrimSuffix(string(name), "*"))
+	}
+	return name == eventName
+}
@@ -0,0 +1,159 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/yann-y/fds/internal/kv"
+	"time"
+)
+
+var log = logging.Logger("event")
+
+// DefaultRetryInterval - the default interval between deliveries to a
+// target that failed.
+const DefaultRetryInterval = 30 * time.Second
+
+// targetWorker - delivers the queue of a target.
+type targetWorker struct {
+	target Target
+	queue  *queueStore
+	wake   chan struct{}
+}
+
+// NotificationSys - queues the events matching the notification
+// configuration of their bucket and delivers them to their targets.
+type NotificationSys struct {
+	db            *kv.DB
+	targets       map[TargetID]*targetWorker
+	retryInterval time.Duration
+	queueLimit    int
+	seq           uint64
+}
+
+// NewNotificationSys returns a notification sys queuing events in db, at most
+// queueLimit per target when queueLimit is positive.
+func NewNotificationSys(db *kv.DB, retryInterval time.Duration, queueLimit int) *NotificationSys {
+	if retryInterval <= 0 {
+		retryInterval = DefaultRetryInterval
+	}
+	return &NotificationSys{
+		db:            db,
+		targets:       make(map[TargetID]*targetWorker),
+		retryInterval: retryInterval,
+		queueLimit:    queueLimit,
+	}
+}
+
+// AddTarget - registers a target, the events it did not accept before a
+// restart are delivered again once Start is called.
+func (sys *NotificationSys) AddTarget(ctx context.Context, target Target) error {
+	if _, ok := sys.targets[target.ID()]; ok {
+		return fmt.Errorf("duplicate target %s", target.ID())
+	}
+	queue, err := newQueueStore(ctx, sys.db, target.ID(), sys.queueLimit, &sys.seq)
+	if err != nil {
+		return err
+	}
+	sys.targets[target.ID()] = &targetWorker{
+		target: target,
+		queue:  queue,
+		wake:   make(chan struct{}, 1),
+	}
+	return nil
+}
+
+// HasTarget - checks whether the target is registered.
+func (sys *NotificationSys) HasTarget(id TargetID) bool {
+	if sys == nil {
+		return false
+	}
+	_, ok := sys.targets[id]
+	return ok
+}
+
+// Start - delivers the queue of every target until ctx is done.
+func (sys *NotificationSys) Start(ctx context.Context) {
+	for _, w := range sys.targets {
+		go w.run(ctx, sys.retryInterval)
+	}
+}
+
+// Send - queues the event of args for every queue of config it matches.
+func (sys *NotificationSys) Send(config *Config, args Args) {
+	if sys == nil || config == nil {
+		return
+	}
+	now := time.Now()
+	for _, q := range config.Match(args.EventName, args.Object.Key) {
+		arn, err := ParseARN(q.ARN)
+		if err != nil {
+			log.Errorf("notification of bucket %s: %v", args.BucketName, err)
+			continue
+		}
+		w, ok := sys.targets[arn.TargetID]
+		if !ok {
+			log.Errorf("notification of bucket %s: target %s not found", args.BucketName, arn.TargetID)
+			continue
+		}
+		eventLog := Log{
+			EventName: args.EventName,
+			Key:       args.BucketName + "/" + args.Object.Key,
+			Records:   []Event{args.ToEvent(q.ID, now)},
+		}
+		if err = w.queue.put(eventLog); err != nil {
+			log.Errorf("queue event %s of %s err:%v", args.EventName, eventLog.Key, err)
+			continue
+		}
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run - flushes the queue whenever an event is queued, and retries every
+// retryInterval while the target fails.
+func (w *targetWorker) run(ctx context.Context, retryInterval time.Duration) {
+	for {
+		var retry <-chan time.Time
+		if !w.flush(ctx) {
+			retry = time.After(retryInterval)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wake:
+			if retry != nil {
+				// wait for the target to recover before sending again
+				select {
+				case <-ctx.Done():
+					return
+				case <-retry:
+				}
+			}
+		case <-retry:
+		}
+	}
+}
+
+// flush - sends the queued logs in order, stopping at the first failure,
+// and reports whether the queue was emptied.
+func (w *targetWorker) flush(ctx context.Context) bool {
+	entries, err := w.queue.list(ctx)
+	if err != nil {
+		log.Errorf("list event queue of target %s err:%v", w.target.ID(), err)
+		return false
+	}
+	for _, entry := range entries {
+		if err = w.target.Send(ctx, entry.log); err != nil {
+			log.Warnf("send event %s to target %s err:%v", entry.log.EventName, w.target.ID(), err)
+			return false
+		}
+		if err = w.queue.del(entry.key); err != nil {
+			log.Errorf("delete queued event %s err:%v", entry.key, err)
+			return false
+		}
+	}
+	return true
+}
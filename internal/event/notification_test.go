@@ -0,0 +1,189 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/yann-y/fds/internal/uleveldb"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookStandIn - a local HTTP stand-in of a webhook endpoint, failing
+// while down is set.
+type webhookStandIn struct {
+	mu       sync.Mutex
+	down     bool
+	received []Log
+}
+
+func (s *webhookStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var eventLog Log
+	if err := json.NewDecoder(r.Body).Decode(&eventLog); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.received = append(s.received, eventLog)
+}
+
+func (s *webhookStandIn) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+func (s *webhookStandIn) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for _, eventLog := range s.received {
+		keys = append(keys, eventLog.Key)
+	}
+	return keys
+}
+
+func waitForKeys(t *testing.T, s *webhookStandIn, want []string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if keys := s.keys(); len(keys) >= len(want) {
+			for i := range want {
+				if keys[i] != want[i] {
+					t.Fatalf("Expected events %v, but instead found %v", want, keys)
+				}
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Expected events %v, but instead found %v", want, s.keys())
+}
+
+func testConfig() *Config {
+	return &Config{QueueList: []Queue{{
+		ID:     "created",
+		Events: []Name{ObjectCreatedAll},
+		ARN:    "arn:fds:sqs::1:webhook",
+	}}}
+}
+
+func TestWebhookTargetSend(t *testing.T) {
+	standIn := &webhookStandIn{}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	target, err := NewWebhookTarget("1", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := Args{
+		EventName:  ObjectCreatedPut,
+		BucketName: "bucket",
+		Object:     Object{Key: "a b.txt", Size: 3, ETag: "etag"},
+		AccessKey:  "user",
+	}
+	eventLog := Log{EventName: args.EventName, Key: "bucket/a b.txt", Records: []Event{args.ToEvent("created", time.Now())}}
+	if err = target.Send(context.Background(), eventLog); err != nil {
+		t.Fatal(err)
+	}
+	if len(standIn.received) != 1 {
+		t.Fatalf("Expected 1 event, but instead found %d", len(standIn.received))
+	}
+	record := standIn.received[0].Records[0]
+	if record.EventName != "ObjectCreated:Put" || record.S3.Object.Key != "a+b.txt" || record.S3.ConfigurationID != "created" {
+		t.Errorf("Unexpected event record %+v", record)
+	}
+
+	standIn.setDown(true)
+	if err = target.Send(context.Background(), eventLog); err == nil {
+		t.Error("Expected failure of a down webhook, but instead succeeded")
+	}
+	if _, err = NewWebhookTarget("1", "ftp://example.com"); err == nil {
+		t.Error("Expected failure of a non HTTP endpoint, but instead succeeded")
+	}
+}
+
+func TestNotificationSysRetry(t *testing.T) {
+	db, err := uleveldb.OpenDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	standIn := &webhookStandIn{down: true}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sys := NewNotificationSys(db, 20*time.Millisecond, 0)
+	target, err := NewWebhookTarget("1", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sys.AddTarget(ctx, target); err != nil {
+		t.Fatal(err)
+	}
+	sys.Start(ctx)
+
+	config := testConfig()
+	for _, key := range []string{"a", "b", "c"} {
+		sys.Send(config, Args{EventName: ObjectCreatedPut, BucketName: "bucket", Object: Object{Key: key}})
+	}
+	sys.Send(config, Args{EventName: ObjectRemovedDelete, BucketName: "bucket", Object: Object{Key: "d"}})
+	time.Sleep(50 * time.Millisecond)
+	if keys := standIn.keys(); len(keys) != 0 {
+		t.Fatalf("Expected no event while the target is down, but instead found %v", keys)
+	}
+
+	standIn.setDown(false)
+	waitForKeys(t, standIn, []string{"bucket/a", "bucket/b", "bucket/c"})
+	time.Sleep(50 * time.Millisecond)
+	if keys := standIn.keys(); len(keys) != 3 {
+		t.Errorf("Expected 3 events, but instead found %v", keys)
+	}
+}
+
+func TestNotificationSysReplay(t *testing.T) {
+	db, err := uleveldb.OpenDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	standIn := &webhookStandIn{}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+	target, err := NewWebhookTarget("1", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// events queued by a sys that stops before delivering them
+	sys := NewNotificationSys(db, time.Minute, 2)
+	if err = sys.AddTarget(context.Background(), target); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		sys.Send(testConfig(), Args{EventName: ObjectCreatedPut, BucketName: "bucket", Object: Object{Key: key}})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sys = NewNotificationSys(db, time.Minute, 2)
+	if err = sys.AddTarget(ctx, target); err != nil {
+		t.Fatal(err)
+	}
+	sys.Start(ctx)
+	waitForKeys(t, standIn, []string{"bucket/a", "bucket/b"})
+	time.Sleep(50 * time.Millisecond)
+	if keys := standIn.keys(); len(keys) != 2 {
+		t.Errorf("Expected the queue limit to drop the third event, but instead found %v", keys)
+	}
+}
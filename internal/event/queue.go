@@ -0,0 +1,107 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"github.com/yann-y/fds/internal/kv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// queueKeyFormat - queued logs are keyed by target, enqueue time and a
+	// sequence number so that they are replayed in order.
+	queueKeyFormat    = "eventQueue/%s/%020d-%010d"
+	queuePrefixFormat = "eventQueue/%s/"
+)
+
+// ErrQueueFull - the queue of a target holds its limit of events.
+type ErrQueueFull struct {
+	Target TargetID
+}
+
+func (err ErrQueueFull) Error() string {
+	return "event queue of target " + err.Target.String() + " is full"
+}
+
+// queueEntry - a queued log and its key.
+type queueEntry struct {
+	key string
+	log Log
+}
+
+// queueStore - the persistent queue of the logs not yet accepted by a target.
+type queueStore struct {
+	db     *kv.DB
+	target TargetID
+	limit  int
+	seq    *uint64
+
+	mu    sync.Mutex
+	count int
+}
+
+// newQueueStore returns the queue of target, counting the logs left by a
+// previous run.
+func newQueueStore(ctx context.Context, db *kv.DB, target TargetID, limit int, seq *uint64) (*queueStore, error) {
+	q := &queueStore{db: db, target: target, limit: limit, seq: seq}
+	entries, err := q.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	q.count = len(entries)
+	return q, nil
+}
+
+// put - appends the log to the queue, limit 0 means unlimited.
+func (q *queueStore) put(eventLog Log) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.limit > 0 && q.count >= q.limit {
+		return ErrQueueFull{Target: q.target}
+	}
+	key := fmt.Sprintf(queueKeyFormat, q.target, time.Now().UnixNano(), atomic.AddUint64(q.seq, 1))
+	if err := q.db.Put(key, eventLog); err != nil {
+		return err
+	}
+	q.count++
+	return nil
+}
+
+// list - returns the queued logs, oldest first.
+func (q *queueStore) list(ctx context.Context) ([]queueEntry, error) {
+	all, err := q.db.ReadAllChan(ctx, fmt.Sprintf(queuePrefixFormat, q.target), "")
+	if err != nil {
+		return nil, err
+	}
+	var entries []queueEntry
+	for entry := range all {
+		var eventLog Log
+		if err = entry.UnmarshalValue(&eventLog); err != nil {
+			log.Errorf("drop queued event %s, unmarshal err:%v", entry.Key, err)
+			q.db.Delete(entry.Key)
+			continue
+		}
+		entries = append(entries, queueEntry{key: entry.Key, log: eventLog})
+	}
+	return entries, nil
+}
+
+// del - removes a log accepted by the target.
+func (q *queueStore) del(key string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.db.Delete(key); err != nil {
+		return err
+	}
+	q.count--
+	return nil
+}
+
+// len - returns the number of queued logs.
+func (q *queueStore) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.count
+}
@@ -0,0 +1,62 @@
+package event
+
+import (
+	"context"
+	"strings"
+)
+
+// arnPrefix - ARNs of targets are arn:fds:sqs:<region>:<id>:<name>.
+const arnPrefix = "arn:fds:sqs:"
+
+// TargetID - the id and the type name of a target, such as 1:webhook.
+type TargetID struct {
+	ID   string
+	Name string
+}
+
+// String - returns the id:name representation of the target.
+func (tid TargetID) String() string {
+	return tid.ID + ":" + tid.Name
+}
+
+// ToARN - returns the ARN of the target in region.
+func (tid TargetID) ToARN(region string) ARN {
+	return ARN{TargetID: tid, Region: region}
+}
+
+// ARN - the ARN of a target.
+type ARN struct {
+	TargetID
+	Region string
+}
+
+// String - returns the arn:fds:sqs:<region>:<id>:<name> representation of the ARN.
+func (arn ARN) String() string {
+	if arn.ID == "" && arn.Name == "" && arn.Region == "" {
+		return ""
+	}
+	return arnPrefix + arn.Region + ":" + arn.TargetID.String()
+}
+
+// ParseARN - parses an arn:fds:sqs:<region>:<id>:<name> ARN.
+func ParseARN(s string) (*ARN, error) {
+	if !strings.HasPrefix(s, arnPrefix) {
+		return nil, ErrInvalidARN{ARN: s}
+	}
+	tokens := strings.Split(strings.TrimPrefix(s, arnPrefix), ":")
+	if len(tokens) != 3 || tokens[1] == "" || tokens[2] == "" {
+		return nil, ErrInvalidARN{ARN: s}
+	}
+	return &ARN{
+		TargetID: TargetID{ID: tokens[1], Name: tokens[2]},
+		Region:   tokens[0],
+	}, nil
+}
+
+// Target - a destination of event notifications.
+type Target interface {
+	ID() TargetID
+	// Send delivers the log of an event, an error leaves the event queued
+	// to be sent again.
+	Send(ctx context.Context, eventLog Log) error
+}
@@ -0,0 +1,71 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/yann-y/fds/internal/consts"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// webhookTimeout - the timeout of a single delivery to a webhook.
+const webhookTimeout = 10 * time.Second
+
+// WebhookTarget - posts the log of every event as JSON to an HTTP endpoint.
+type WebhookTarget struct {
+	id       TargetID
+	endpoint string
+	client   *http.Client
+}
+
+// NewWebhookTarget returns the webhook target id posting to endpoint.
+func NewWebhookTarget(id, endpoint string) (*WebhookTarget, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook endpoint %q", endpoint)
+	}
+	if id == "" {
+		return nil, errors.New("empty webhook target id")
+	}
+	return &WebhookTarget{
+		id:       TargetID{ID: id, Name: "webhook"},
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: webhookTimeout},
+	}, nil
+}
+
+// ID - returns the target id.
+func (target *WebhookTarget) ID() TargetID {
+	return target.id
+}
+
+// Send - posts the log, any status but 2XX is an error.
+func (target *WebhookTarget) Send(ctx context.Context, eventLog Log) error {
+	data, err := json.Marshal(eventLog)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(consts.ContentType, "application/json")
+	resp, err := target.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook %s returned %s", target.endpoint, resp.Status)
+	}
+	return nil
+}
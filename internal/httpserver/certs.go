@@ -0,0 +1,97 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// The client authentication modes of mutual TLS.
+const (
+	ClientAuthNone    = "none"
+	ClientAuthRequest = "request"
+	ClientAuthRequire = "require"
+)
+
+// CertManager - holds the server certificate and the client CAs, which are
+// reloaded from their files without a restart.
+type CertManager struct {
+	certFile, keyFile, clientCAFile string
+	clientAuth                      tls.ClientAuthType
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// NewCertManager returns the manager of the certificate and key files, and
+// of the client CAs file when clientAuth is not ClientAuthNone.
+func NewCertManager(certFile, keyFile, clientCAFile, clientAuth string) (*CertManager, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("both the TLS certificate and key are required")
+	}
+	m := &CertManager{certFile: certFile, keyFile: keyFile, clientCAFile: clientCAFile}
+	switch strings.ToLower(clientAuth) {
+	case "", ClientAuthNone:
+		m.clientAuth = tls.NoClientCert
+	case ClientAuthRequest:
+		m.clientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		m.clientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("invalid client auth %q, expected %s, %s or %s", clientAuth, ClientAuthNone, ClientAuthRequest, ClientAuthRequire)
+	}
+	if m.clientAuth != tls.NoClientCert && clientCAFile == "" {
+		return nil, fmt.Errorf("the client CAs are required to verify the client certificates")
+	}
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Reload - reads the files again, the previous certificates are kept if one
+// of them is invalid.
+func (m *CertManager) Reload() error {
+	cert, err := tls.LoadX509KeyPair(m.certFile, m.keyFile)
+	if err != nil {
+		return fmt.Errorf("load TLS certificate: %w", err)
+	}
+	var clientCAs *x509.CertPool
+	if m.clientAuth != tls.NoClientCert {
+		pem, err := os.ReadFile(m.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("load client CAs: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("load client CAs: no certificate found in %s", m.clientCAFile)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cert = &cert
+	m.clientCAs = clientCAs
+	return nil
+}
+
+// TLSConfig - returns the configuration serving the current certificates.
+func (m *CertManager) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			m.mu.RLock()
+			defer m.mu.RUnlock()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*m.cert},
+				ClientAuth:   m.clientAuth,
+				ClientCAs:    m.clientCAs,
+			}, nil
+		},
+	}
+}
@@ -0,0 +1,229 @@
+package httpserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert - a certificate of 127.0.0.1 signed by parent, self signed when
+// parent is nil.
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCert(t *testing.T, name string, isCA bool, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func (c *testCert) write(t *testing.T, certFile, keyFile string) {
+	if err := os.WriteFile(certFile, c.certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, c.keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *testCert) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.cert)
+	return pool
+}
+
+// serveTLS - serves OK over TLS with certs and returns the address.
+func serveTLS(t *testing.T, certs *CertManager) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(ln.Addr().String(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), Config{TLS: certs.TLSConfig(), ShutdownTimeout: time.Second})
+	go s.Serve(ln)
+	t.Cleanup(func() { s.Shutdown() })
+	return ln.Addr().String()
+}
+
+// peerCert - returns the common name of the certificate served at addr.
+func peerCert(addr string, config *tls.Config) (string, error) {
+	conn, err := tls.Dial("tcp", addr, config)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if err = conn.Handshake(); err != nil {
+		return "", err
+	}
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+}
+
+func TestCertManagerReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	first := newTestCert(t, "first", false, nil)
+	first.write(t, certFile, keyFile)
+
+	certs, err := NewCertManager(certFile, keyFile, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveTLS(t, certs)
+
+	name, err := peerCert(addr, &tls.Config{RootCAs: first.pool()})
+	if err != nil || name != "first" {
+		t.Fatalf("Expected the first certificate, but instead found %q, %v", name, err)
+	}
+
+	second := newTestCert(t, "second", false, nil)
+	second.write(t, certFile, keyFile)
+	if err = certs.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	name, err = peerCert(addr, &tls.Config{RootCAs: second.pool()})
+	if err != nil || name != "second" {
+		t.Fatalf("Expected the reloaded certificate, but instead found %q, %v", name, err)
+	}
+
+	// an invalid key keeps the previous certificate
+	if err = os.WriteFile(keyFile, []byte("invalid"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = certs.Reload(); err == nil {
+		t.Fatal("Expected an error reloading an invalid key")
+	}
+	name, err = peerCert(addr, &tls.Config{RootCAs: second.pool()})
+	if err != nil || name != "second" {
+		t.Fatalf("Expected the previous certificate, but instead found %q, %v", name, err)
+	}
+}
+
+func TestCertManagerClientAuth(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	caFile := filepath.Join(dir, "ca.pem")
+	server := newTestCert(t, "server", false, nil)
+	server.write(t, certFile, keyFile)
+	ca := newTestCert(t, "ca", true, nil)
+	if err := os.WriteFile(caFile, ca.certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	client := newTestCert(t, "client", false, ca)
+	clientCert, err := tls.X509KeyPair(client.certPEM, client.keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := newTestCert(t, "other", false, nil)
+	otherCert, err := tls.X509KeyPair(other.certPEM, other.keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = NewCertManager(certFile, keyFile, "", ClientAuthRequire); err == nil {
+		t.Fatal("Expected an error requiring client certificates without CAs")
+	}
+	if _, err = NewCertManager(certFile, keyFile, caFile, "invalid"); err == nil {
+		t.Fatal("Expected an error for an invalid client auth")
+	}
+
+	testCases := []struct {
+		clientAuth string
+		certs      []tls.Certificate
+		expectErr  bool
+	}{
+		// Test case - 1.
+		// a client certificate signed by the CA.
+		{clientAuth: ClientAuthRequire, certs: []tls.Certificate{clientCert}, expectErr: false},
+		// Test case - 2.
+		// no client certificate.
+		{clientAuth: ClientAuthRequire, expectErr: true},
+		// Test case - 3.
+		// a client certificate of another CA.
+		{clientAuth: ClientAuthRequire, certs: []tls.Certificate{otherCert}, expectErr: true},
+		// Test case - 4.
+		// no client certificate, which is optional.
+		{clientAuth: ClientAuthRequest, expectErr: false},
+		// Test case - 5.
+		// a client certificate of another CA, which is verified when given.
+		{clientAuth: ClientAuthRequest, certs: []tls.Certificate{otherCert}, expectErr: true},
+	}
+	for i, testCase := range testCases {
+		certs, err := NewCertManager(certFile, keyFile, caFile, testCase.clientAuth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := serveTLS(t, certs)
+		resp, err := (&http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs: server.pool(),
+				// sends the certificate even if the server does not accept its CA
+				GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					if len(testCase.certs) == 0 {
+						return &tls.Certificate{}, nil
+					}
+					return &testCase.certs[0], nil
+				},
+			},
+		}}).Get("https://" + addr)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if (err != nil) != testCase.expectErr {
+			t.Errorf("Test %d: Expected error %v, but instead found %v", i+1, testCase.expectErr, err)
+		}
+	}
+}
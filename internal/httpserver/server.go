@@ -0,0 +1,138 @@
+// Package httpserver serves the gateway over an http.Server with timeouts,
+// TLS whose certificates are reloaded in place, and a graceful shutdown.
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	logging "github.com/ipfs/go-log/v2"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var log = logging.Logger("httpserver")
+
+// The defaults of the server configuration.
+const (
+	DefaultReadHeaderTimeout = 30 * time.Second
+	DefaultIdleTimeout       = 2 * time.Minute
+	DefaultMaxHeaderBytes    = 1 << 20
+	DefaultShutdownTimeout   = 30 * time.Second
+)
+
+// abortTimeout - the time the requests cancelled at the end of the drain
+// are given to clean up what they stored.
+const abortTimeout = 10 * time.Second
+
+// Config - the configuration of a server, a zero timeout is none.
+type Config struct {
+	// ReadTimeout - the time to read a whole request, body included.
+	ReadTimeout time.Duration
+	// ReadHeaderTimeout - the time to read the headers of a request.
+	ReadHeaderTimeout time.Duration
+	// WriteTimeout - the time to write a response, from the end of the
+	// request headers.
+	WriteTimeout time.Duration
+	// IdleTimeout - the time a keep-alive connection waits for the next
+	// request.
+	IdleTimeout time.Duration
+	// MaxHeaderBytes - the size of the request headers.
+	MaxHeaderBytes int
+	// ShutdownTimeout - the time the requests in flight are given to end at
+	// shutdown, before they are cancelled.
+	ShutdownTimeout time.Duration
+	// TLS - the TLS configuration, nil serves plain HTTP.
+	TLS *tls.Config
+}
+
+// Server - an http.Server draining its requests at shutdown.
+type Server struct {
+	srv             *http.Server
+	tls             bool
+	shutdownTimeout time.Duration
+	// abort cancels the requests in flight
+	abort    context.CancelFunc
+	inFlight sync.WaitGroup
+}
+
+// New returns the server of handler at addr.
+func New(addr string, handler http.Handler, config Config) *Server {
+	ctx, abort := context.WithCancel(context.Background())
+	s := &Server{
+		tls:             config.TLS != nil,
+		shutdownTimeout: config.ShutdownTimeout,
+		abort:           abort,
+	}
+	s.srv = &http.Server{
+		Addr: addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.inFlight.Add(1)
+			defer s.inFlight.Done()
+			handler.ServeHTTP(w, r)
+		}),
+		TLSConfig:         config.TLS,
+		ReadTimeout:       config.ReadTimeout,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+		MaxHeaderBytes:    config.MaxHeaderBytes,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+	return s
+}
+
+// ListenAndServe - serves until the server is shut down, when it returns
+// nil.
+func (s *Server) ListenAndServe() error {
+	ln, err := net.Listen("tcp", s.srv.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve - serves the connections of ln until the server is shut down, when
+// it returns nil.
+func (s *Server) Serve(ln net.Listener) error {
+	var err error
+	if s.tls {
+		// the certificates are those of the TLS configuration
+		err = s.srv.ServeTLS(ln, "", "")
+	} else {
+		err = s.srv.Serve(ln)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown - stops accepting connections and waits for the requests in
+// flight until the shutdown timeout, then cancels those left and gives them
+// a while to clean up what they stored before closing their connections.
+func (s *Server) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	err := s.srv.Shutdown(ctx)
+	if err == nil {
+		return nil
+	}
+	log.Warnw("cancel the requests in flight after the shutdown timeout", "addr", s.srv.Addr, "err", err)
+	s.abort()
+	done := make(chan struct{})
+	go func() {
+		s.inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(abortTimeout):
+		log.Warnw("close the requests still in flight", "addr", s.srv.Addr)
+	}
+	return s.srv.Close()
+}
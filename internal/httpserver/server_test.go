@@ -0,0 +1,130 @@
+package httpserver
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTestServer - serves handler and returns the server and its address.
+func startTestServer(t *testing.T, handler http.Handler, config Config) (*Server, string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(ln.Addr().String(), handler, config)
+	go func() {
+		if err := s.Serve(ln); err != nil {
+			t.Error(err)
+		}
+	}()
+	return s, ln.Addr().String()
+}
+
+func TestServerShutdownDrains(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	s, addr := startTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	}), Config{ShutdownTimeout: 5 * time.Second})
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr)
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- s.Shutdown()
+	}()
+	time.Sleep(50 * time.Millisecond)
+	// a new connection is refused while the request in flight is drained
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Error("Expected a new connection to be refused during the shutdown")
+	}
+	close(release)
+
+	if err := <-shutdown; err != nil {
+		t.Errorf("Expected no error, but instead found %v", err)
+	}
+	if b := <-body; b != "done" {
+		t.Errorf("Expected the request in flight to be drained, but instead found %q", b)
+	}
+}
+
+func TestServerShutdownCancels(t *testing.T) {
+	started, cleaned := make(chan struct{}), make(chan error, 1)
+	s, addr := startTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+		// the request cleans up what it stored
+		time.Sleep(50 * time.Millisecond)
+		cleaned <- r.Context().Err()
+	}), Config{ShutdownTimeout: 100 * time.Millisecond})
+
+	go func() {
+		resp, err := http.Post("http://"+addr, "text/plain", strings.NewReader("data"))
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	start := time.Now()
+	s.Shutdown()
+	select {
+	case err := <-cleaned:
+		if err != context.Canceled {
+			t.Errorf("Expected %v, but instead found %v", context.Canceled, err)
+		}
+	default:
+		t.Error("Expected the shutdown to wait for the cancelled request")
+	}
+	if elapsed := time.Since(start); elapsed > abortTimeout {
+		t.Errorf("Expected the shutdown to end before %v, but instead found %v", abortTimeout, elapsed)
+	}
+}
+
+func TestServerConfig(t *testing.T) {
+	_, addr := startTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), Config{MaxHeaderBytes: 1 << 10, ReadHeaderTimeout: 100 * time.Millisecond})
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Large", strings.Repeat("a", 8<<10))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("Expected %d, but instead found %d", http.StatusRequestHeaderFieldsTooLarge, resp.StatusCode)
+	}
+
+	// a client which does not send its headers is disconnected
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err = conn.Read(make([]byte, 1)); err == nil || strings.Contains(err.Error(), "timeout") {
+		t.Errorf("Expected the connection to be closed by the server, but instead found %v", err)
+	}
+}
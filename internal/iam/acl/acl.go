@@ -0,0 +1,298 @@
+// Package acl models S3 access control lists: the grants given to canonical
+// users and to the predefined groups on a bucket or an object.
+package acl
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/yann-y/fds/internal/iam/policy"
+	"github.com/yann-y/fds/internal/iam/s3action"
+)
+
+// Permission May be one of READ, WRITE, READ_ACP, WRITE_ACP, FULL_CONTROL
+type Permission string
+
+// Permissions a grant can give.
+const (
+	PermissionRead        Permission = "READ"
+	PermissionWrite       Permission = "WRITE"
+	PermissionReadACP     Permission = "READ_ACP"
+	PermissionWriteACP    Permission = "WRITE_ACP"
+	PermissionFullControl Permission = "FULL_CONTROL"
+)
+
+// IsValid - checks if permission is valid or not.
+func (p Permission) IsValid() bool {
+	switch p {
+	case PermissionRead, PermissionWrite, PermissionReadACP, PermissionWriteACP, PermissionFullControl:
+		return true
+	}
+	return false
+}
+
+// Grantee types.
+const (
+	TypeCanonicalUser = "CanonicalUser"
+	TypeGroup         = "Group"
+	// TypeEmail is accepted by S3 but not supported, users are identified by their access key.
+	TypeEmail = "AmazonCustomerByEmail"
+)
+
+// Predefined groups.
+const (
+	// AllUsersGroup - anyone, including anonymous requests.
+	AllUsersGroup = "http://acs.amazonaws.com/groups/global/AllUsers"
+	// AuthenticatedUsersGroup - any signed request.
+	AuthenticatedUsersGroup = "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+)
+
+// Canned ACLs in addition to policy.Private, policy.PublicRead and policy.PublicReadWrite.
+const (
+	AuthenticatedRead      = "authenticated-read"
+	BucketOwnerRead        = "bucket-owner-read"
+	BucketOwnerFullControl = "bucket-owner-full-control"
+)
+
+// Object ownership controls.
+const (
+	// ObjectWriter - the account that uploads an object owns it, ACLs are enforced.
+	ObjectWriter = "ObjectWriter"
+	// BucketOwnerPreferred - objects uploaded with bucket-owner-full-control are owned by the bucket owner.
+	BucketOwnerPreferred = "BucketOwnerPreferred"
+	// BucketOwnerEnforced - the bucket owner owns every object and ACLs are disabled.
+	BucketOwnerEnforced = "BucketOwnerEnforced"
+)
+
+const xsiNamespace = "http://www.w3.org/2001/XMLSchema-instance"
+
+var (
+	errInvalidPermission = errors.New("invalid permission")
+	errInvalidGrantee    = errors.New("invalid grantee")
+	// ErrUnsupportedEmail - grantees are identified by their access key, not by email.
+	ErrUnsupportedEmail = errors.New("grantee by email address is not supported")
+	errInvalidCannedACL = errors.New("invalid canned ACL")
+)
+
+// Grantee - a canonical user, identified by its access key, or a predefined group.
+type Grantee struct {
+	Type         string `xml:"-"`
+	ID           string `xml:"ID,omitempty"`
+	DisplayName  string `xml:"DisplayName,omitempty"`
+	URI          string `xml:"URI,omitempty"`
+	EmailAddress string `xml:"EmailAddress,omitempty"`
+}
+
+// MarshalXML encodes the grantee type as the xsi:type attribute.
+func (g Grantee) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Attr = append(start.Attr,
+		xml.Attr{Name: xml.Name{Local: "xmlns:xsi"}, Value: xsiNamespace},
+		xml.Attr{Name: xml.Name{Local: "xsi:type"}, Value: g.Type},
+	)
+	type grantee Grantee
+	return e.EncodeElement(grantee(g), start)
+}
+
+// UnmarshalXML decodes the grantee type from the xsi:type attribute.
+func (g *Grantee) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type grantee Grantee
+	var v grantee
+	if err := d.DecodeElement(&v, &start); err != nil {
+		return err
+	}
+	for _, attr := range start.Attr {
+		if attr.Name.Local == "type" {
+			v.Type = attr.Value
+		}
+	}
+	*g = Grantee(v)
+	return nil
+}
+
+// Validate - checks the grantee is a canonical user or a known group.
+func (g Grantee) Validate() error {
+	switch g.Type {
+	case TypeCanonicalUser:
+		if g.ID == "" {
+			return errInvalidGrantee
+		}
+	case TypeGroup:
+		if g.URI != AllUsersGroup && g.URI != AuthenticatedUsersGroup {
+			return fmt.Errorf("%w: unknown group %s", errInvalidGrantee, g.URI)
+		}
+	case TypeEmail:
+		return ErrUnsupportedEmail
+	default:
+		return fmt.Errorf("%w: unknown type %s", errInvalidGrantee, g.Type)
+	}
+	return nil
+}
+
+// Matches - checks whether the grantee covers accountName, an empty account
+// name is an anonymous request.
+func (g Grantee) Matches(accountName string) bool {
+	switch g.Type {
+	case TypeCanonicalUser:
+		return accountName != "" && g.ID == accountName
+	case TypeGroup:
+		switch g.URI {
+		case AllUsersGroup:
+			return true
+		case AuthenticatedUsersGroup:
+			return accountName != ""
+		}
+	}
+	return false
+}
+
+// Grant grant
+type Grant struct {
+	Grantee    Grantee    `xml:"Grantee"`
+	Permission Permission `xml:"Permission"`
+}
+
+// Validate - checks the grantee and the permission of the grant.
+func (g Grant) Validate() error {
+	if !g.Permission.IsValid() {
+		return fmt.Errorf("%w: %s", errInvalidPermission, g.Permission)
+	}
+	return g.Grantee.Validate()
+}
+
+// NewUserGrant returns a grant of permission to the canonical user id.
+func NewUserGrant(id string, permission Permission) Grant {
+	return Grant{
+		Grantee:    Grantee{Type: TypeCanonicalUser, ID: id, DisplayName: id},
+		Permission: permission,
+	}
+}
+
+// NewGroupGrant returns a grant of permission to the predefined group uri.
+func NewGroupGrant(uri string, permission Permission) Grant {
+	return Grant{
+		Grantee:    Grantee{Type: TypeGroup, URI: uri},
+		Permission: permission,
+	}
+}
+
+// ACL - the owner of a bucket or an object and the grants on it.
+type ACL struct {
+	Owner  string
+	Grants []Grant
+}
+
+// Validate - checks all grants are valid.
+func (a ACL) Validate() error {
+	for _, grant := range a.Grants {
+		if err := grant.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsPrivate - checks whether the ACL grants nothing to anyone but the owner.
+func (a ACL) IsPrivate() bool {
+	for _, grant := range a.Grants {
+		if grant.Grantee.Type != TypeCanonicalUser || grant.Grantee.ID != a.Owner {
+			return false
+		}
+	}
+	return true
+}
+
+// IsAllowed - checks whether accountName holds permission. The owner can
+// always read and write the ACL, so that it can never lock itself out.
+func (a ACL) IsAllowed(accountName string, permission Permission) bool {
+	if accountName != "" && accountName == a.Owner &&
+		(permission == PermissionReadACP || permission == PermissionWriteACP) {
+		return true
+	}
+	for _, grant := range a.Grants {
+		if (grant.Permission == permission || grant.Permission == PermissionFullControl) &&
+			grant.Grantee.Matches(accountName) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidCanned - checks if canned is a canned ACL. default is the object ACL
+// following the bucket ACL.
+func IsValidCanned(canned string) bool {
+	switch canned {
+	case policy.Private, policy.PublicRead, policy.PublicReadWrite, policy.Default,
+		AuthenticatedRead, BucketOwnerRead, BucketOwnerFullControl:
+		return true
+	}
+	return false
+}
+
+// Canned returns the ACL of the canned ACL for a resource owned by owner,
+// bucketOwner is the owner of the bucket of an object.
+func Canned(canned, owner, bucketOwner string) (ACL, error) {
+	a := ACL{
+		Owner:  owner,
+		Grants: []Grant{NewUserGrant(owner, PermissionFullControl)},
+	}
+	switch canned {
+	case "", policy.Private, policy.Default:
+	case policy.PublicRead:
+		a.Grants = append(a.Grants, NewGroupGrant(AllUsersGroup, PermissionRead))
+	case policy.PublicReadWrite:
+		a.Grants = append(a.Grants,
+			NewGroupGrant(AllUsersGroup, PermissionRead),
+			NewGroupGrant(AllUsersGroup, PermissionWrite))
+	case AuthenticatedRead:
+		a.Grants = append(a.Grants, NewGroupGrant(AuthenticatedUsersGroup, PermissionRead))
+	case BucketOwnerRead:
+		if bucketOwner != "" && bucketOwner != owner {
+			a.Grants = append(a.Grants, NewUserGrant(bucketOwner, PermissionRead))
+		}
+	case BucketOwnerFullControl:
+		if bucketOwner != "" && bucketOwner != owner {
+			a.Grants = append(a.Grants, NewUserGrant(bucketOwner, PermissionFullControl))
+		}
+	default:
+		return ACL{}, fmt.Errorf("%w: %s", errInvalidCannedACL, canned)
+	}
+	return a, nil
+}
+
+// IsValidOwnership - checks if ownership is a valid object ownership control.
+func IsValidOwnership(ownership string) bool {
+	switch ownership {
+	case ObjectWriter, BucketOwnerPreferred, BucketOwnerEnforced:
+		return true
+	}
+	return false
+}
+
+// ActionPermission returns the permission a grant on a bucket, or on an object
+// when object is true, must give to allow action. ok is false when action can
+// not be granted by an ACL.
+func ActionPermission(action s3action.Action, object bool) (permission Permission, ok bool) {
+	if object {
+		switch action {
+		case s3action.GetObjectAction, s3action.GetObjectVersionAction:
+			return PermissionRead, true
+		case s3action.GetObjectAclAction:
+			return PermissionReadACP, true
+		case s3action.PutObjectAclAction:
+			return PermissionWriteACP, true
+		}
+		return "", false
+	}
+	switch action {
+	case s3action.ListBucketAction, s3action.ListBucketVersionsAction, s3action.ListBucketMultipartUploadsAction:
+		return PermissionRead, true
+	case s3action.PutObjectAction, s3action.DeleteObjectAction, s3action.DeleteObjectVersionAction,
+		s3action.AbortMultipartUploadAction:
+		return PermissionWrite, true
+	case s3action.GetBucketAclAction:
+		return PermissionReadACP, true
+	case s3action.PutBucketAclAction:
+		return PermissionWriteACP, true
+	}
+	return "", false
+}
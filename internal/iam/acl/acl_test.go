@@ -0,0 +1,138 @@
+package acl
+
+import (
+	"encoding/xml"
+	"errors"
+	"github.com/yann-y/fds/internal/iam/policy"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCanned(t *testing.T) {
+	testCases := []struct {
+		canned      string
+		owner       string
+		bucketOwner string
+		account     string
+		permission  Permission
+		allowed     bool
+		private     bool
+	}{
+		{policy.Private, "owner", "owner", "owner", PermissionWrite, true, true},
+		{policy.Private, "owner", "owner", "other", PermissionRead, false, true},
+		{policy.Private, "owner", "owner", "", PermissionRead, false, true},
+		{policy.PublicRead, "owner", "owner", "", PermissionRead, true, false},
+		{policy.PublicRead, "owner", "owner", "", PermissionWrite, false, false},
+		{policy.PublicReadWrite, "owner", "owner", "", PermissionWrite, true, false},
+		{AuthenticatedRead, "owner", "owner", "", PermissionRead, false, false},
+		{AuthenticatedRead, "owner", "owner", "other", PermissionRead, true, false},
+		{BucketOwnerRead, "writer", "owner", "owner", PermissionRead, true, false},
+		{BucketOwnerRead, "writer", "owner", "owner", PermissionWrite, false, false},
+		{BucketOwnerFullControl, "writer", "owner", "owner", PermissionWriteACP, true, false},
+		{BucketOwnerFullControl, "owner", "owner", "other", PermissionRead, false, true},
+	}
+	for i, testCase := range testCases {
+		a, err := Canned(testCase.canned, testCase.owner, testCase.bucketOwner)
+		if err != nil {
+			t.Fatalf("Test %d: %v", i+1, err)
+		}
+		if allowed := a.IsAllowed(testCase.account, testCase.permission); allowed != testCase.allowed {
+			t.Errorf("Test %d: Expected allowed %v, got %v", i+1, testCase.allowed, allowed)
+		}
+		if private := a.IsPrivate(); private != testCase.private {
+			t.Errorf("Test %d: Expected private %v, got %v", i+1, testCase.private, private)
+		}
+	}
+	if _, err := Canned("not-canned", "owner", "owner"); err == nil {
+		t.Errorf("Expected failure for an unknown canned ACL")
+	}
+}
+
+func TestIsAllowed(t *testing.T) {
+	a := ACL{
+		Owner: "owner",
+		Grants: []Grant{
+			NewUserGrant("reader", PermissionRead),
+			NewUserGrant("admin", PermissionFullControl),
+		},
+	}
+	testCases := []struct {
+		account    string
+		permission Permission
+		allowed    bool
+	}{
+		// the owner can always manage the ACL, even without a grant
+		{"owner", PermissionReadACP, true},
+		{"owner", PermissionWriteACP, true},
+		{"owner", PermissionRead, false},
+		{"reader", PermissionRead, true},
+		{"reader", PermissionWrite, false},
+		{"admin", PermissionWriteACP, true},
+		{"", PermissionRead, false},
+	}
+	for i, testCase := range testCases {
+		if allowed := a.IsAllowed(testCase.account, testCase.permission); allowed != testCase.allowed {
+			t.Errorf("Test %d: Expected allowed %v, got %v", i+1, testCase.allowed, allowed)
+		}
+	}
+}
+
+func TestParseGrantHeaders(t *testing.T) {
+	testCases := []struct {
+		header   http.Header
+		expected []Grant
+		err      error
+	}{
+		{
+			header: http.Header{
+				AmzGrantRead:        []string{`id="user1", uri="` + AllUsersGroup + `"`},
+				AmzGrantFullControl: []string{`id="user2"`},
+			},
+			expected: []Grant{
+				NewUserGrant("user1", PermissionRead),
+				NewGroupGrant(AllUsersGroup, PermissionRead),
+				NewUserGrant("user2", PermissionFullControl),
+			},
+		},
+		{header: http.Header{AmzGrantWrite: []string{`emailAddress="a@b.c"`}}, err: ErrUnsupportedEmail},
+		{header: http.Header{AmzGrantWrite: []string{`uri="http://acs.amazonaws.com/groups/s3/LogDelivery"`}}, err: errInvalidGrantee},
+		{header: http.Header{AmzGrantWrite: []string{`user1`}}, err: errInvalidGrantee},
+		{header: http.Header{AmzGrantWrite: []string{`name="user1"`}}, err: errInvalidGrantee},
+	}
+	for i, testCase := range testCases {
+		grants, err := ParseGrantHeaders(testCase.header)
+		if !errors.Is(err, testCase.err) {
+			t.Errorf("Test %d: Expected error %v, got %v", i+1, testCase.err, err)
+			continue
+		}
+		if !reflect.DeepEqual(grants, testCase.expected) {
+			t.Errorf("Test %d: Expected %v, got %v", i+1, testCase.expected, grants)
+		}
+	}
+}
+
+func TestGrantXML(t *testing.T) {
+	grants := []Grant{
+		NewUserGrant("user1", PermissionFullControl),
+		NewGroupGrant(AllUsersGroup, PermissionRead),
+	}
+	data, err := xml.Marshal(grants)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `xsi:type="CanonicalUser"`) || !strings.Contains(string(data), `xsi:type="Group"`) {
+		t.Errorf("Expected the grantee types in %s", data)
+	}
+
+	body := `<Grant><Grantee xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="Group"><URI>` +
+		AllUsersGroup + `</URI></Grantee><Permission>READ</Permission></Grant>`
+	var grant Grant
+	if err = xml.Unmarshal([]byte(body), &grant); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(grant, grants[1]) {
+		t.Errorf("Expected %v, got %v", grants[1], grant)
+	}
+}
@@ -0,0 +1,80 @@
+package acl
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Headers granting a permission, their value is a comma separated list of
+// grantees: id="<access key>", uri="<group uri>" or emailAddress="<email>".
+const (
+	AmzGrantRead        = "X-Amz-Grant-Read"
+	AmzGrantWrite       = "X-Amz-Grant-Write"
+	AmzGrantReadACP     = "X-Amz-Grant-Read-Acp"
+	AmzGrantWriteACP    = "X-Amz-Grant-Write-Acp"
+	AmzGrantFullControl = "X-Amz-Grant-Full-Control"
+)
+
+var grantHeaders = []struct {
+	header     string
+	permission Permission
+}{
+	{AmzGrantRead, PermissionRead},
+	{AmzGrantWrite, PermissionWrite},
+	{AmzGrantReadACP, PermissionReadACP},
+	{AmzGrantWriteACP, PermissionWriteACP},
+	{AmzGrantFullControl, PermissionFullControl},
+}
+
+// HasGrantHeaders - checks whether any x-amz-grant-* header is set.
+func HasGrantHeaders(h http.Header) bool {
+	for _, gh := range grantHeaders {
+		if h.Get(gh.header) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseGrantHeaders returns the grants given by the x-amz-grant-* headers.
+func ParseGrantHeaders(h http.Header) ([]Grant, error) {
+	var grants []Grant
+	for _, gh := range grantHeaders {
+		for _, value := range h.Values(gh.header) {
+			for _, elem := range strings.Split(value, ",") {
+				elem = strings.TrimSpace(elem)
+				if elem == "" {
+					continue
+				}
+				grantee, err := parseGrantee(elem)
+				if err != nil {
+					return nil, err
+				}
+				grants = append(grants, Grant{Grantee: grantee, Permission: gh.permission})
+			}
+		}
+	}
+	return grants, nil
+}
+
+// parseGrantee parses a grantee of the form key="value".
+func parseGrantee(s string) (Grantee, error) {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return Grantee{}, fmt.Errorf("%w: %s", errInvalidGrantee, s)
+	}
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+	var g Grantee
+	switch strings.ToLower(strings.TrimSpace(key)) {
+	case "id":
+		g = Grantee{Type: TypeCanonicalUser, ID: value, DisplayName: value}
+	case "uri":
+		g = Grantee{Type: TypeGroup, URI: value}
+	case "emailaddress":
+		g = Grantee{Type: TypeEmail, EmailAddress: value}
+	default:
+		return Grantee{}, fmt.Errorf("%w: %s", errInvalidGrantee, s)
+	}
+	return g, g.Validate()
+}
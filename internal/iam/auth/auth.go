@@ -89,6 +89,10 @@ type Credentials struct {
 	SessionToken string    `xml:"SessionToken" json:"sessionToken"`
 	Status       string    `xml:"-" json:"status,omitempty"`
 	ParentUser   string    `xml:"-" json:"parentUser,omitempty"`
+	RoleName     string    `xml:"-" json:"roleName,omitempty"`
+	// RecordVersion is the layout the stored credentials were written
+	// with, 0 before the records were versioned.
+	RecordVersion int `xml:"-" json:"-" msgpack:",omitempty"`
 }
 
 // generateCredentials - creates randomly generated credentials of maximum
@@ -4,8 +4,8 @@ import (
 	"context"
 	"github.com/yann-y/fds/internal/iam/auth"
 	"github.com/yann-y/fds/internal/iam/policy"
+	"github.com/yann-y/fds/internal/kv"
 	"github.com/yann-y/fds/internal/store"
-	"github.com/yann-y/fds/internal/uleveldb"
 )
 
 // iPolicySys - policy subsystem.
@@ -14,7 +14,7 @@ type iPolicySys struct {
 }
 
 // newIPolicySys  - creates new policy system.
-func newIPolicySys(db *uleveldb.ULevelDB) *iPolicySys {
+func newIPolicySys(db *kv.DB) *iPolicySys {
 	return &iPolicySys{
 		bmSys: store.NewBucketMetadataSys(db),
 	}
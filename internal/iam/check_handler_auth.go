@@ -6,11 +6,15 @@ import (
 	"encoding/hex"
 	"github.com/yann-y/fds/internal/apierrors"
 	"github.com/yann-y/fds/internal/consts"
+	"github.com/yann-y/fds/internal/iam/acl"
 	"github.com/yann-y/fds/internal/iam/auth"
+	"github.com/yann-y/fds/internal/iam/openid"
 	"github.com/yann-y/fds/internal/iam/s3action"
-	"github.com/yann-y/fds/internal/uleveldb"
+	"github.com/yann-y/fds/internal/kv"
+	"github.com/yann-y/fds/internal/store"
 	"github.com/yann-y/fds/internal/utils/hash"
 	"github.com/yann-y/fds/pkg/etag"
+	"go.uber.org/zap/zapcore"
 	"io"
 	"net/http"
 	"net/url"
@@ -23,17 +27,42 @@ type AuthSys struct {
 	Iam       *IdentityAMSys
 	PolicySys *iPolicySys
 	AdminCred auth.Credentials
+	// OpenID validates the tokens of AssumeRoleWithWebIdentity and
+	// AssumeRoleWithClientGrants, nil when no provider is configured.
+	OpenID *openid.Providers
+
+	getObjectInfo func(ctx context.Context, bucket, object string) (store.ObjectInfo, error)
+	// domains of virtual-hosted-style requests, their bucket is part of the
+	// host and not of the path.
+	domains []string
 }
 
 // NewAuthSys new an AuthSys
-func NewAuthSys(db *uleveldb.ULevelDB, adminCred auth.Credentials) *AuthSys {
+func NewAuthSys(db *kv.DB, adminCred auth.Credentials) *AuthSys {
+	iamSys := NewIdentityAMSys(db)
+	iamSys.owner = adminCred.AccessKey
 	return &AuthSys{
-		Iam:       NewIdentityAMSys(db),
+		Iam:       iamSys,
 		PolicySys: newIPolicySys(db),
 		AdminCred: adminCred,
 	}
 }
 
+// SetOpenIDProviders sets the OpenID providers STS trusts.
+func (s *AuthSys) SetOpenIDProviders(ps *openid.Providers) {
+	s.OpenID = ps
+}
+
+// SetGetObjectInfo sets the lookup of the object ACLs evaluated alongside policies.
+func (s *AuthSys) SetGetObjectInfo(getObjectInfo func(ctx context.Context, bucket, object string) (store.ObjectInfo, error)) {
+	s.getObjectInfo = getObjectInfo
+}
+
+// SetDomains sets the domains of virtual-hosted-style requests.
+func (s *AuthSys) SetDomains(domains []string) {
+	s.domains = domains
+}
+
 // CheckRequestAuthTypeCredential Check request auth type verifies the incoming http request
 //   - validates the request signature
 //   - validates the policy action if anonymous tests bucket policies if any,
@@ -83,57 +112,152 @@ func (s *AuthSys) CheckRequestAuthTypeCredential(ctx context.Context, r *http.Re
 		}
 	}
 
+	return cred, owner, s.CheckCredentialAccess(ctx, r, cred, owner, action, bucketName, objectName)
+}
+
+// CheckCredentialAccess evaluates the policies and the ACLs for a request
+// whose signature is verified, and which authenticated with cred, so that a
+// request acting on several objects is verified once.
+func (s *AuthSys) CheckCredentialAccess(ctx context.Context, r *http.Request, cred auth.Credentials, owner bool, action s3action.Action, bucketName, objectName string) (s3Err apierrors.ErrorCode) {
 	// Anonymous user
 	if cred.AccessKey == "" {
 		owner = false
 	}
 
-	// check bucket policy
-	if s.PolicySys.isAllowed(ctx, auth.Args{
+	args := auth.Args{
 		AccountName: cred.AccessKey,
 		Action:      action,
 		BucketName:  bucketName,
-		IsOwner:     owner,
+		Conditions:  getConditions(r, cred.AccessKey),
 		ObjectName:  objectName,
-	}) {
+		IsOwner:     owner,
+	}
+	if s3Err = s.checkAccess(ctx, args, nil); s3Err == apierrors.ErrAccessDenied && log.Desugar().Core().Enabled(zapcore.DebugLevel) {
+		trace := s.SimulateAccess(ctx, args)
+		log.Debugw("access denied", "accessKey", cred.AccessKey, "action", action,
+			"bucket", bucketName, "object", objectName, "decision", trace.Decision, "statements", trace.Statements)
+	}
+	return s3Err
+}
+
+// CheckAnonymousAccess checks whether an anonymous request may perform
+// action, whatever credentials the request carries. Website endpoints serve
+// every request anonymously.
+func (s *AuthSys) CheckAnonymousAccess(ctx context.Context, r *http.Request, action s3action.Action, bucketName, objectName string) apierrors.ErrorCode {
+	return s.checkAccess(ctx, auth.Args{
+		Action:     action,
+		BucketName: bucketName,
+		Conditions: getConditions(r, ""),
+		ObjectName: objectName,
+	}, nil)
+}
+
+// checkAccess evaluates bucket policy and IAM policies for an authenticated request.
+// When trace is not nil, the matching statements of every evaluated source are recorded in it.
+func (s *AuthSys) checkAccess(ctx context.Context, args auth.Args, trace *AccessTrace) apierrors.ErrorCode {
+	if args.AccountName != "" && !args.IsOwner && args.BucketName != "" && args.Action != s3action.CreateBucketAction {
+		if temp, _, err := s.Iam.IsTempUser(ctx, args.AccountName); err == nil && temp {
+			return s.checkSTSAccess(ctx, args, trace)
+		}
+	}
+	bucketArgs := args
+
+	// check bucket policy
+	s.traceBucketPolicy(ctx, bucketArgs, trace)
+	if s.PolicySys.isAllowed(ctx, bucketArgs) {
 		// Request is allowed return the appropriate access key.
-		return cred, owner, apierrors.ErrNone
+		trace.setDecision(DecisionBucketPolicy)
+		return apierrors.ErrNone
 	}
-	if action == s3action.ListBucketVersionsAction {
+	if args.Action == s3action.ListBucketVersionsAction {
 		// In AWS S3 s3:ListBucket permission is same as s3:ListBucketVersions permission
 		// verify as a fallback.
-		if s.PolicySys.isAllowed(ctx, auth.Args{
-			AccountName: cred.AccessKey,
-			Action:      s3action.ListBucketAction,
-			BucketName:  bucketName,
-			IsOwner:     owner,
-			ObjectName:  objectName,
-		}) {
+		bucketArgs.Action = s3action.ListBucketAction
+		s.traceBucketPolicy(ctx, bucketArgs, trace)
+		if s.PolicySys.isAllowed(ctx, bucketArgs) {
 			// Request is allowed return the appropriate access key.
-			return cred, owner, apierrors.ErrNone
+			trace.setDecision(DecisionBucketPolicy)
+			return apierrors.ErrNone
 		}
 	}
 
 	// check user policy
-	if bucketName == "" || action == s3action.CreateBucketAction {
-		if s.Iam.IsAllowed(r.Context(), auth.Args{
-			AccountName: cred.AccessKey,
-			Action:      action,
-			BucketName:  bucketName,
-			Conditions:  getConditions(r, cred.AccessKey),
-			ObjectName:  objectName,
-			IsOwner:     owner,
-		}) {
+	if args.BucketName == "" || args.Action == s3action.CreateBucketAction {
+		s.traceUserPolicy(ctx, args, trace)
+		if s.Iam.IsAllowed(ctx, args) {
 			// Request is allowed return the appropriate access key.
-			return cred, owner, apierrors.ErrNone
+			switch {
+			case args.IsOwner:
+				trace.setDecision(DecisionOwner)
+			case trace != nil && trace.ParentUser != "":
+				trace.setDecision(DecisionSTS)
+			default:
+				trace.setDecision(DecisionUserPolicy)
+			}
+			return apierrors.ErrNone
 		}
 	} else {
-		if !s.PolicySys.bmSys.HasBucket(ctx, bucketName) {
-			return cred, owner, apierrors.ErrNoSuchBucket
+		meta, err := s.PolicySys.bmSys.GetBucketMeta(ctx, args.BucketName)
+		if err != nil {
+			return apierrors.ErrNoSuchBucket
 		}
+		if s.isACLAllowed(ctx, meta, args) {
+			trace.setDecision(DecisionACLGrant)
+			return apierrors.ErrNone
+		}
+	}
+
+	return apierrors.ErrAccessDenied
+}
+
+// checkSTSAccess evaluates a bucket or object request of temporary
+// credentials. A bucket policy explicitly denying the request denies it,
+// else the credentials are allowed what their identity is: the assumed role,
+// the federated policy, or the parent user as its own request would be. The
+// session policy restricts them further.
+func (s *AuthSys) checkSTSAccess(ctx context.Context, args auth.Args, trace *AccessTrace) apierrors.ErrorCode {
+	meta, err := s.PolicySys.bmSys.GetBucketMeta(ctx, args.BucketName)
+	if err != nil {
+		return apierrors.ErrNoSuchBucket
 	}
+	s.traceBucketPolicy(ctx, args, trace)
+	if meta.PolicyConfig != nil && meta.PolicyConfig.IsDenied(args) {
+		return apierrors.ErrAccessDenied
+	}
+	s.traceUserPolicy(ctx, args, trace)
+	allowed := s.Iam.isAllowedSTS(ctx, args, func(parentArgs auth.Args) bool {
+		return s.checkAccess(ctx, parentArgs, trace) == apierrors.ErrNone
+	})
+	if !allowed {
+		return apierrors.ErrAccessDenied
+	}
+	trace.setDecision(DecisionSTS)
+	return apierrors.ErrNone
+}
 
-	return cred, owner, apierrors.ErrAccessDenied
+// isACLAllowed checks whether the bucket ACL, or the ACL of the object, grants
+// the permission args.Action requires. Grants are ignored when the bucket
+// enforces object ownership, and never override an explicit deny of the
+// bucket policy.
+func (s *AuthSys) isACLAllowed(ctx context.Context, meta store.BucketMetadata, args auth.Args) bool {
+	if !meta.ACLsEnabled() {
+		return false
+	}
+	if meta.PolicyConfig != nil && meta.PolicyConfig.IsDenied(args) {
+		return false
+	}
+	if permission, ok := acl.ActionPermission(args.Action, false); ok && meta.ACL().IsAllowed(args.AccountName, permission) {
+		return true
+	}
+	permission, ok := acl.ActionPermission(args.Action, true)
+	if !ok || args.ObjectName == "" || s.getObjectInfo == nil {
+		return false
+	}
+	objInfo, err := s.getObjectInfo(ctx, args.BucketName, args.ObjectName)
+	if err != nil {
+		return false
+	}
+	return objInfo.ACL(meta.Owner).IsAllowed(args.AccountName, permission)
 }
 
 // Verify if request has valid AWS Signature Version '2'.
@@ -257,6 +381,13 @@ func getConditions(r *http.Request, username string) map[string][]string {
 	}
 
 	cloneHeader := r.Header.Clone()
+	// a header must not shadow the values set by the gateway, such as
+	// SecureTransport, which are looked up by their canonical header key first
+	for key := range args {
+		if key != http.CanonicalHeaderKey(key) {
+			cloneHeader.Del(key)
+		}
+	}
 
 	for key, values := range cloneHeader {
 		if existingValues, found := args[key]; found {
@@ -311,22 +442,57 @@ func (s *AuthSys) IsPutActionAllowed(ctx context.Context, r *http.Request, actio
 	}
 
 	// check bucket policy
-	if s.PolicySys.isAllowed(ctx, auth.Args{
+	args := auth.Args{
 		AccountName: cred.AccessKey,
 		Action:      action,
 		BucketName:  bucketName,
 		IsOwner:     owner,
 		ObjectName:  objectName,
-	}) {
+	}
+	if s.PolicySys.isAllowed(ctx, args) {
 		return apierrors.ErrNone
 	}
 
-	if !s.PolicySys.bmSys.HasBucket(ctx, bucketName) {
+	meta, err := s.PolicySys.bmSys.GetBucketMeta(ctx, bucketName)
+	if err != nil {
 		return apierrors.ErrNoSuchBucket
 	}
+	if s.isACLAllowed(ctx, meta, args) {
+		return apierrors.ErrNone
+	}
 	return apierrors.ErrAccessDenied
 }
 
+// CheckPostPolicyAuth verifies the signature of a browser-based upload form and
+// checks whether the signer may put objectName into bucketName. Forms without a
+// signature are anonymous uploads, allowed only by the bucket policy.
+func (s *AuthSys) CheckPostPolicyAuth(ctx context.Context, r *http.Request, formValues http.Header, bucketName, objectName string) (cred auth.Credentials, s3Err apierrors.ErrorCode) {
+	switch {
+	case formValues.Get(consts.AmzSignature) != "":
+		if formValues.Get(consts.AmzAlgorithm) != signV4Algorithm {
+			return cred, apierrors.ErrSignatureVersionNotSupported
+		}
+		cred, s3Err = s.doesPolicySignatureV4Match(formValues)
+	case formValues.Get(consts.AmzSignatureV2) != "":
+		cred, s3Err = s.doesPolicySignatureV2Match(formValues)
+	}
+	if s3Err != apierrors.ErrNone {
+		return cred, s3Err
+	}
+	if cred.IsTemp() && formValues.Get(consts.AmzSecurityToken) != cred.SessionToken {
+		return cred, apierrors.ErrInvalidToken
+	}
+	owner := cred.AccessKey != "" && cred.AccessKey == s.AdminCred.AccessKey
+	return cred, s.checkAccess(ctx, auth.Args{
+		AccountName: cred.AccessKey,
+		Action:      s3action.PutObjectAction,
+		BucketName:  bucketName,
+		Conditions:  getConditions(r, cred.AccessKey),
+		ObjectName:  objectName,
+		IsOwner:     owner,
+	}, nil)
+}
+
 func (s *AuthSys) GetCredential(r *http.Request) (cred auth.Credentials, owner bool, s3Err apierrors.ErrorCode) {
 	switch GetRequestAuthType(r) {
 	case AuthTypeUnknown:
@@ -339,3 +505,35 @@ func (s *AuthSys) GetCredential(r *http.Request) (cred auth.Credentials, owner b
 	}
 	return
 }
+
+// VerifiedAccessKey returns the access key of a request whose signature
+// verifies and the parent user of a temporary access key, or empty strings
+// for an anonymous request or one whose signature does not verify. The
+// signature is verified against the declared payload hash, leaving the body
+// unread, and the query of the request is read as its form.
+func (s *AuthSys) VerifiedAccessKey(r *http.Request) (accessKey, parentUser string) {
+	if r.Form == nil {
+		clone := *r
+		clone.Form = r.URL.Query()
+		r = &clone
+	}
+	var s3Err apierrors.ErrorCode
+	switch GetRequestAuthType(r) {
+	case AuthTypeSignedV2, AuthTypePresignedV2:
+		s3Err = s.IsReqAuthenticatedV2(r)
+	case AuthTypeSigned, AuthTypePresigned:
+		s3Err = s.ReqSignatureV4Verify(r, "", ServiceS3)
+	case AuthTypeStreamingSigned:
+		_, _, _, _, s3Err = s.CalculateSeedSignature(r)
+	default:
+		return "", ""
+	}
+	if s3Err != apierrors.ErrNone {
+		return "", ""
+	}
+	cred, _, s3Err := s.GetCredential(r)
+	if s3Err != apierrors.ErrNone {
+		return "", ""
+	}
+	return cred.AccessKey, cred.ParentUser
+}
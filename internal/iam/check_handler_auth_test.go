@@ -1,5 +1,19 @@
 package iam
 
+import (
+	"context"
+	"crypto/tls"
+	"github.com/yann-y/fds/internal/apierrors"
+	"github.com/yann-y/fds/internal/iam/auth"
+	"github.com/yann-y/fds/internal/iam/policy"
+	"github.com/yann-y/fds/internal/iam/policy/condition"
+	"github.com/yann-y/fds/internal/iam/s3action"
+	"github.com/yann-y/fds/internal/uleveldb"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
 //func TestV2CheckRequestAuthType(t *testing.T) {
 //	var aSys AuthSys
 //	aSys.Init()
@@ -14,3 +28,84 @@ package iam
 //	_, _, err := aSys.CheckRequestAuthTypeCredential(context.Background(), req, s3action.ListAllMyBucketsAction, "test", "testobject")
 //	fmt.Println(apierrors.GetAPIError(err))
 //}
+
+func TestGetConditionsSecureTransport(t *testing.T) {
+	testCases := []struct {
+		tls      bool
+		header   string
+		expected bool
+	}{
+		// Test case - 1.
+		// plain HTTP.
+		{tls: false, expected: false},
+		// Test case - 2.
+		// TLS.
+		{tls: true, expected: true},
+		// Test case - 3.
+		// a header does not make plain HTTP secure.
+		{tls: false, header: "true", expected: false},
+	}
+	data := []byte(`{"Bool":{"aws:SecureTransport":"true"}}`)
+	var cs condition.Conditions
+	if err := cs.UnmarshalJSON(data); err != nil {
+		t.Fatal(err)
+	}
+	for i, testCase := range testCases {
+		r := httptest.NewRequest("GET", "/bucket/object", nil)
+		if testCase.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		if testCase.header != "" {
+			r.Header.Set("SecureTransport", testCase.header)
+		}
+		if result := cs.Evaluate(getConditions(r, "user")); result != testCase.expected {
+			t.Errorf("Test %d: Expected %v, but instead found %v", i+1, testCase.expected, result)
+		}
+	}
+}
+
+func TestAuthSys_BucketPolicySecureTransport(t *testing.T) {
+	db, err := uleveldb.OpenDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	cred, err := auth.CreateCredentials(auth.DefaultAccessKey, auth.DefaultSecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewAuthSys(db, cred)
+	ctx := context.Background()
+	if err = s.PolicySys.bmSys.CreateBucket(ctx, "bucket", "", "owner1", ""); err != nil {
+		t.Fatal(err)
+	}
+	p, err := policy.ParseConfig(strings.NewReader(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":["owner1"]},"Action":["s3:*"],"Resource":["arn:aws:s3:::bucket","arn:aws:s3:::bucket/*"]},{"Effect":"Deny","Principal":{"AWS":["*"]},"Action":["s3:*"],"Resource":["arn:aws:s3:::bucket","arn:aws:s3:::bucket/*"],"Condition":{"Bool":{"aws:SecureTransport":"false"}}}]}`), "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.PolicySys.bmSys.UpdateBucketPolicy(ctx, "bucket", p); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		tls      bool
+		expected apierrors.ErrorCode
+	}{
+		// Test case - 1.
+		// the bucket owner over plain HTTP is denied.
+		{tls: false, expected: apierrors.ErrAccessDenied},
+		// Test case - 2.
+		// the bucket owner over TLS is allowed by the bucket policy.
+		{tls: true, expected: apierrors.ErrNone},
+	}
+	for i, testCase := range testCases {
+		r := httptest.NewRequest("GET", "/bucket/object", nil)
+		if testCase.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		s3Err := s.CheckCredentialAccess(ctx, r, auth.Credentials{AccessKey: "owner1"}, false, s3action.GetObjectAction, "bucket", "object")
+		if s3Err != testCase.expected {
+			t.Errorf("Test %d: Expected %v, but instead found %v", i+1, testCase.expected, s3Err)
+		}
+	}
+}
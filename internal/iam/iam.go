@@ -6,9 +6,12 @@ import (
 	"github.com/aws/aws-sdk-go/service/iam"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/yann-y/fds/internal/iam/auth"
+	"github.com/yann-y/fds/internal/iam/kms"
 	"github.com/yann-y/fds/internal/iam/policy"
 	"github.com/yann-y/fds/internal/iam/s3action"
-	"github.com/yann-y/fds/internal/uleveldb"
+	"github.com/yann-y/fds/internal/kv"
+	"strings"
+	"time"
 )
 
 const (
@@ -20,17 +23,29 @@ const (
 var errNoSuchUser = errors.New("specified user does not exist")
 var errUserIsExpired = errors.New("specified user is expired")
 
+// federatedUserPrefix prefixes the parent user of credentials issued to
+// external identities, it can't collide with access keys of regular users.
+const federatedUserPrefix = "openid:"
+
 var log = logging.Logger("iam")
 
 // IdentityAMSys - config system.
 type IdentityAMSys struct {
 	// Persistence layer for IAM subsystem
 	store *iamStoreSys
+	// access key of the owner, policies don't apply to it
+	owner string
+
+	stsMinDuration time.Duration
+	stsMaxDuration time.Duration
 }
 
 // NewIdentityAMSys - new an IdentityAM config system
-func NewIdentityAMSys(db *uleveldb.ULevelDB) *IdentityAMSys {
-	sys := &IdentityAMSys{}
+func NewIdentityAMSys(db *kv.DB) *IdentityAMSys {
+	sys := &IdentityAMSys{
+		stsMinDuration: DefaultSTSMinDuration,
+		stsMaxDuration: DefaultSTSMaxDuration,
+	}
 	sys.store = &iamStoreSys{newIAMLevelDBStore(db)}
 	// TODO: Is it necessary?
 	//err := sys.store.saveUserIdentity(context.Background(), auth.DefaultAccessKey, UserIdentity{Credentials: auth.GetDefaultActiveCred()})
@@ -48,12 +63,12 @@ func (sys *IdentityAMSys) IsAllowed(ctx context.Context, args auth.Args) bool {
 		return true
 	}
 	// If the credential is temporary, perform STS related checks.
-	ok, parentUser, err := sys.IsTempUser(ctx, args.AccountName)
+	ok, _, err := sys.IsTempUser(ctx, args.AccountName)
 	if err != nil {
 		return false
 	}
 	if ok {
-		return sys.IsAllowedSTS(args, parentUser)
+		return sys.IsAllowedSTS(ctx, args)
 	}
 	// Continue with the assumption of a regular user
 	ps, _, err := sys.store.loadUserAllPolicies(ctx, args.AccountName)
@@ -64,20 +79,67 @@ func (sys *IdentityAMSys) IsAllowed(ctx context.Context, args auth.Args) bool {
 		// No policy found.
 		return false
 	}
-	var pol, pmer policy.Policy
+	var pol policy.Policy
 	for _, p := range ps {
-		pmer = pol.Merge(p)
+		pol = pol.Merge(p)
 	}
 	// Policies were found, evaluate all of them.
-	return pmer.IsAllowed(args)
+	return pol.IsAllowed(args)
 }
 
-// IsAllowedSTS is meant for STS based temporary credentials,
-// which implements claims validation and verification other than
-// applying policies.
-func (sys *IdentityAMSys) IsAllowedSTS(args auth.Args, parentUser string) bool {
-	//todo check parentUser policy
-	return true
+// IsAllowedSTS is meant for STS based temporary credentials. A temporary
+// credential is never allowed more than the identity it was issued for:
+// the assumed role, or the parent user when no role was assumed. A session
+// policy given at issue time restricts it further.
+func (sys *IdentityAMSys) IsAllowedSTS(ctx context.Context, args auth.Args) bool {
+	return sys.isAllowedSTS(ctx, args, func(parentArgs auth.Args) bool {
+		return sys.IsAllowed(ctx, parentArgs)
+	})
+}
+
+// isAllowedSTS is IsAllowedSTS, the parent user being allowed what
+// parentAllowed allows it.
+func (sys *IdentityAMSys) isAllowedSTS(ctx context.Context, args auth.Args, parentAllowed func(parentArgs auth.Args) bool) bool {
+	cred, ok := sys.GetUser(ctx, args.AccountName)
+	if !ok {
+		return false
+	}
+	federated := IsFederatedUser(cred.ParentUser)
+	// The parent must still be valid for its sessions to be usable.
+	if cred.ParentUser != sys.owner && !federated {
+		if _, ok = sys.GetUser(ctx, cred.ParentUser); !ok {
+			return false
+		}
+	}
+	switch {
+	case cred.RoleName != "":
+		role, err := sys.GetRole(ctx, cred.RoleName)
+		if err != nil || role.Policy == nil || !role.Policy.IsAllowed(args) {
+			return false
+		}
+	case federated:
+		var p policy.PolicyDocument
+		if err := sys.store.loadUserPolicy(ctx, args.AccountName, federatedPolicyName, &p); err != nil {
+			return false
+		}
+		if !(policy.Policy{Version: p.Version, Statements: p.Statement}).IsAllowed(args) {
+			return false
+		}
+	default:
+		parentArgs := args
+		parentArgs.AccountName = cred.ParentUser
+		parentArgs.IsOwner = cred.ParentUser == sys.owner
+		if !parentAllowed(parentArgs) {
+			return false
+		}
+	}
+
+	var p policy.PolicyDocument
+	if err := sys.store.loadUserPolicy(ctx, args.AccountName, sessionPolicyName, &p); err != nil {
+		// No session policy, the session has the permissions of its identity.
+		return true
+	}
+	return policy.Policy{Version: p.Version, Statements: p.Statement}.IsAllowed(args)
 }
 
 // IsTempUser - returns if given key is a temporary user.
@@ -87,7 +149,7 @@ func (sys *IdentityAMSys) IsTempUser(ctx context.Context, name string) (bool, st
 		return false, "", errNoSuchUser
 	}
 	if cred.IsExpired() {
-		err := sys.store.removeUserIdentity(ctx, name)
+		err := sys.removeTempUser(ctx, name)
 		if err != nil {
 			return false, "", err
 		}
@@ -136,17 +198,11 @@ func (sys *IdentityAMSys) AddUser(ctx context.Context, accessKey, secretKey stri
 		return err
 	}
 	p := policy.CreateUserPolicy(accessKey, []s3action.Action{s3action.AllActions}, "*")
-	err = sys.store.saveUserPolicy(ctx, accessKey, "default", policy.PolicyDocument{
-		Version:   p.Version,
-		Statement: p.Statements,
+	err = sys.store.saveUserWithPolicies(ctx, UserIdentity{credentials}, map[string]policy.PolicyDocument{
+		"default": policyDocument(p),
 	})
-	if err != nil {
-		return err
-	}
-	err = sys.store.saveUserIdentity(ctx, UserIdentity{credentials})
 	if err != nil {
 		log.Errorf("save UserIdentity err:%v", err)
-		sys.store.removeUserPolicy(ctx, accessKey, "default")
 		return err
 	}
 
@@ -170,12 +226,18 @@ func (sys *IdentityAMSys) AddSubUser(ctx context.Context, accessKey, secretKey,
 	return nil
 }
 
-// UpdateUser Update User
+// UpdateUser Update User, disabling a user revokes its sessions
 func (sys *IdentityAMSys) UpdateUser(ctx context.Context, cred auth.Credentials) error {
 	err := sys.store.saveUserIdentity(ctx, UserIdentity{Credentials: cred})
 	if err != nil {
 		return err
 	}
+	if cred.Status == auth.AccountOff && !cred.IsTemp() {
+		if _, err = sys.RevokeSessions(ctx, cred.AccessKey); err != nil {
+			log.Errorf("revoke sessions of %s err:%v", cred.AccessKey, err)
+			return err
+		}
+	}
 	return nil
 }
 
@@ -192,13 +254,13 @@ func (sys *IdentityAMSys) GetUser(ctx context.Context, accessKey string) (cred a
 
 // RemoveUser Remove User
 func (sys *IdentityAMSys) RemoveUser(ctx context.Context, accessKey string) error {
-	err := sys.store.removeUserAllPolicies(ctx, accessKey)
+	err := sys.store.removeUser(ctx, accessKey)
 	if err != nil {
-		log.Errorf("remove user all policies error: %v", err)
+		log.Errorf("Remove UserIdentity err:%v", err)
 		return err
 	}
-	if err = sys.store.removeUserIdentity(ctx, accessKey); err != nil {
-		log.Errorf("Remove UserIdentity err:%v", err)
+	if _, err = sys.RevokeSessions(ctx, accessKey); err != nil {
+		log.Errorf("revoke sessions of %s err:%v", accessKey, err)
 		return err
 	}
 	return nil
@@ -214,6 +276,25 @@ func (sys *IdentityAMSys) CreatePolicy(ctx context.Context, policyName string, p
 	return nil
 }
 
+// GetPolicy Get Policy
+func (sys *IdentityAMSys) GetPolicy(ctx context.Context, policyName string) (*policy.Policy, error) {
+	var p policy.PolicyDocument
+	if err := sys.store.loadPolicy(ctx, policyName, &p); err != nil {
+		return nil, err
+	}
+	return &policy.Policy{Version: p.Version, Statements: p.Statement}, nil
+}
+
+// RemovePolicy Remove Policy
+func (sys *IdentityAMSys) RemovePolicy(ctx context.Context, policyName string) error {
+	err := sys.store.removePolicy(ctx, policyName)
+	if err != nil {
+		log.Errorf("remove Policy err:%v", err)
+		return err
+	}
+	return nil
+}
+
 // PutUserPolicy Create Policy
 func (sys *IdentityAMSys) PutUserPolicy(ctx context.Context, userName, policyName string, policyDocument policy.PolicyDocument) error {
 	err := sys.store.saveUserPolicy(ctx, userName, policyName, policyDocument)
@@ -269,17 +350,59 @@ func (sys *IdentityAMSys) GetUserInfo(ctx context.Context, accessKey string) (cr
 	return
 }
 
+// Recover - removes the policies left without a user by a crash of a previous
+// version, which saved and removed users in several writes, and returns how
+// many were removed.
+func (sys *IdentityAMSys) Recover(ctx context.Context) (int, error) {
+	return sys.store.removeOrphanPolicies(ctx)
+}
+
 // SetTempUser - set temporary user credentials, these credentials have an
-// expiry. The permissions for these STS credentials is determined in one of the
-// following ways:
-func (sys *IdentityAMSys) SetTempUser(ctx context.Context, accessKey string, cred auth.Credentials, policyName string) error {
-	err := sys.store.SetTempUser(ctx, accessKey, cred, policyName)
+// expiry. The permissions for these STS credentials are those of the assumed
+// role or of the parent user, restricted by the session policy if any.
+func (sys *IdentityAMSys) SetTempUser(ctx context.Context, accessKey string, cred auth.Credentials, sessionPolicy *policy.Policy) error {
+	err := sys.store.SetTempUser(ctx, accessKey, cred, sessionPolicy)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// InitSecretEncryption - encrypts the secret keys and session tokens stored at rest
+// with keyring, a nil keyring keeps them in plaintext. It fails when the stored
+// secrets were encrypted before but keyring doesn't hold the master key.
+func (sys *IdentityAMSys) InitSecretEncryption(ctx context.Context, keyring *kms.Keyring) error {
+	return sys.store.InitSecretEncryption(ctx, keyring)
+}
+
+// SetFederatedTempUser - set temporary user credentials issued to an identity
+// of an external identity provider. Unless a role was assumed, the permissions
+// of the credentials are given by identityPolicy, mapped from the identity's claims.
+func (sys *IdentityAMSys) SetFederatedTempUser(ctx context.Context, cred auth.Credentials, identityPolicy, sessionPolicy *policy.Policy) error {
+	if !IsFederatedUser(cred.ParentUser) {
+		return errInvalidArgument
+	}
+	policies := make(map[string]policy.PolicyDocument)
+	if identityPolicy != nil {
+		policies[federatedPolicyName] = policyDocument(identityPolicy)
+	}
+	if sessionPolicy != nil {
+		policies[sessionPolicyName] = policyDocument(sessionPolicy)
+	}
+	return sys.store.setTempUser(ctx, cred.AccessKey, cred, policies)
+}
+
+// FederatedUser - returns the parent user name of credentials issued to
+// the subject of an external identity provider.
+func FederatedUser(sub string) string {
+	return federatedUserPrefix + sub
+}
+
+// IsFederatedUser - returns whether the user is an external identity.
+func IsFederatedUser(user string) bool {
+	return strings.HasPrefix(user, federatedUserPrefix)
+}
+
 //func (sys *IdentityAMSys) CreateGroup(ctx context.Context, groupName string, version int) error {
 //	err := sys.store.CreateGroup(ctx, groupName, version)
 //	if err != nil {
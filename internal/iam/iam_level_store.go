@@ -4,15 +4,20 @@ import (
 	"context"
 	"fmt"
 	"github.com/yann-y/fds/internal/iam/auth"
+	"github.com/yann-y/fds/internal/iam/kms"
 	"github.com/yann-y/fds/internal/iam/policy"
-	"github.com/yann-y/fds/internal/uleveldb"
+	"github.com/yann-y/fds/internal/kv"
 	"strings"
 )
 
 const (
+	// secretsKeyIDKey records the id of the master key stored secrets are sealed with.
+	secretsKeyIDKey     = "config/iam_secrets_key"
 	userKeyFormat       = "user/%s"
 	policyKeyFormat     = "policy/%s"
 	userPolicyKeyFormat = "user_policy/%s/%s"
+	userPolicyPrefix    = "user_policy/"
+	roleKeyFormat       = "role/%s"
 	groupPrefix         = "group/"
 )
 
@@ -28,9 +33,104 @@ func getUserPolicyKey(username, policyName string) string {
 	return fmt.Sprintf(userPolicyKeyFormat, username, policyName)
 }
 
+func getRoleKey(roleName string) string {
+	return fmt.Sprintf(roleKeyFormat, roleName)
+}
+
 // iamLevelDBStore implements IAMStorageAPI
 type iamLevelDBStore struct {
-	levelDB *uleveldb.ULevelDB
+	levelDB *kv.DB
+	// keyring seals secret keys and session tokens, nil stores them in plaintext
+	keyring *kms.Keyring
+}
+
+// secretsKeyID is saved under secretsKeyIDKey
+type secretsKeyID struct {
+	KeyID string
+}
+
+func (I *iamLevelDBStore) setKeyring(keyring *kms.Keyring) {
+	I.keyring = keyring
+}
+
+// sealCredentials returns cred as stored, with its record version and its
+// secrets sealed, the access key binds the sealed secrets to the user so that
+// they can't be swapped between users.
+func (I *iamLevelDBStore) sealCredentials(cred auth.Credentials) (auth.Credentials, error) {
+	cred.RecordVersion = RecordVersion
+	if I.keyring == nil {
+		return cred, nil
+	}
+	var err error
+	if cred.SecretKey, err = I.keyring.Seal(cred.SecretKey, cred.AccessKey); err != nil {
+		return cred, err
+	}
+	if cred.SessionToken, err = I.keyring.Seal(cred.SessionToken, cred.AccessKey); err != nil {
+		return cred, err
+	}
+	return cred, nil
+}
+
+func (I *iamLevelDBStore) openCredentials(cred *auth.Credentials) error {
+	if I.keyring == nil {
+		if kms.IsSealed(cred.SecretKey) || kms.IsSealed(cred.SessionToken) {
+			return errMasterKeyRequired
+		}
+		return nil
+	}
+	var err error
+	if cred.SecretKey, err = I.keyring.Open(cred.SecretKey, cred.AccessKey); err != nil {
+		return err
+	}
+	if cred.SessionToken, err = I.keyring.Open(cred.SessionToken, cred.AccessKey); err != nil {
+		return err
+	}
+	return nil
+}
+
+// resealSecrets seals the plaintext secrets, and the secrets sealed with a
+// previous master key, with the current master key.
+func (I *iamLevelDBStore) resealSecrets(ctx context.Context) (int, error) {
+	if I.keyring == nil {
+		return 0, errMasterKeyRequired
+	}
+	all, err := I.levelDB.ReadAllChan(ctx, getUserKey(""), "")
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for entry := range all {
+		cred := auth.Credentials{}
+		if err = entry.UnmarshalValue(&cred); err != nil {
+			return n, err
+		}
+		if !I.keyring.NeedsReseal(cred.SecretKey) && !I.keyring.NeedsReseal(cred.SessionToken) {
+			continue
+		}
+		if err = I.openCredentials(&cred); err != nil {
+			return n, fmt.Errorf("open secrets of %s: %w", cred.AccessKey, err)
+		}
+		if cred, err = I.sealCredentials(cred); err != nil {
+			return n, err
+		}
+		if err = I.levelDB.Put(entry.Key, cred); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (I *iamLevelDBStore) loadSecretsKeyID(ctx context.Context) string {
+	var id secretsKeyID
+	if err := I.levelDB.Get(secretsKeyIDKey, &id); err != nil {
+		return ""
+	}
+	return id.KeyID
+}
+
+func (I *iamLevelDBStore) saveSecretsKeyID(ctx context.Context, keyID string) error {
+	return I.levelDB.Put(secretsKeyIDKey, secretsKeyID{KeyID: keyID})
 }
 
 func (I *iamLevelDBStore) loadUser(ctx context.Context, user string, m *auth.Credentials) error {
@@ -38,7 +138,7 @@ func (I *iamLevelDBStore) loadUser(ctx context.Context, user string, m *auth.Cre
 	if err != nil {
 		return err
 	}
-	return nil
+	return I.openCredentials(m)
 }
 
 func (I *iamLevelDBStore) loadUsers(ctx context.Context) (map[string]auth.Credentials, error) {
@@ -53,19 +153,89 @@ func (I *iamLevelDBStore) loadUsers(ctx context.Context) (map[string]auth.Creden
 		if err = entry.UnmarshalValue(&cred); err != nil {
 			continue
 		}
+		if err = I.openCredentials(&cred); err != nil {
+			log.Errorf("open secrets of %s err:%v", cred.AccessKey, err)
+			continue
+		}
 		m[cred.AccessKey] = cred
 	}
 	return m, nil
 }
 
 func (I *iamLevelDBStore) saveUserIdentity(ctx context.Context, u UserIdentity) error {
-	err := I.levelDB.Put(getUserKey(u.Credentials.AccessKey), u.Credentials)
+	cred, err := I.sealCredentials(u.Credentials)
+	if err != nil {
+		return err
+	}
+	err = I.levelDB.Put(getUserKey(cred.AccessKey), cred)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// saveUserWithPolicies saves the identity along with its policies at once.
+func (I *iamLevelDBStore) saveUserWithPolicies(ctx context.Context, u UserIdentity, policies map[string]policy.PolicyDocument) error {
+	cred, err := I.sealCredentials(u.Credentials)
+	if err != nil {
+		return err
+	}
+	return I.levelDB.Update(func(tx *kv.Tx) error {
+		for policyName, policyDocument := range policies {
+			if err := tx.Put(getUserPolicyKey(cred.AccessKey, policyName), policyDocument); err != nil {
+				return err
+			}
+		}
+		return tx.Put(getUserKey(cred.AccessKey), cred)
+	})
+}
+
+// removeUser removes the identity along with its policies at once.
+func (I *iamLevelDBStore) removeUser(ctx context.Context, userName string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	all, err := I.levelDB.ReadAllChan(ctx, getUserPolicyKey(userName, ""), "")
+	if err != nil {
+		return err
+	}
+	return I.levelDB.Update(func(tx *kv.Tx) error {
+		for entry := range all {
+			tx.Delete(entry.Key)
+		}
+		tx.Delete(getUserKey(userName))
+		return nil
+	})
+}
+
+// removeOrphanPolicies removes the policies of the users which don't exist,
+// left by a user saved or removed in several writes, and returns how many
+// were removed.
+func (I *iamLevelDBStore) removeOrphanPolicies(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	all, err := I.levelDB.ReadAllChan(ctx, userPolicyPrefix, "")
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	err = I.levelDB.Update(func(tx *kv.Tx) error {
+		exists := make(map[string]bool)
+		for entry := range all {
+			userName, _, _ := strings.Cut(strings.TrimPrefix(entry.Key, userPolicyPrefix), "/")
+			if _, ok := exists[userName]; !ok {
+				var cred auth.Credentials
+				exists[userName] = I.levelDB.Get(getUserKey(userName), &cred) != kv.ErrNotFound
+			}
+			if !exists[userName] {
+				tx.Delete(entry.Key)
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
 func (I *iamLevelDBStore) removeUserIdentity(ctx context.Context, name string) error {
 	err := I.levelDB.Delete(getUserKey(name))
 	if err != nil {
@@ -82,6 +252,14 @@ func (I *iamLevelDBStore) savePolicy(ctx context.Context, policyName string, pol
 	return nil
 }
 
+func (I *iamLevelDBStore) loadPolicy(ctx context.Context, policyName string, policyDocument *policy.PolicyDocument) error {
+	return I.levelDB.Get(getPolicyKey(policyName), policyDocument)
+}
+
+func (I *iamLevelDBStore) removePolicy(ctx context.Context, policyName string) error {
+	return I.levelDB.Delete(getPolicyKey(policyName))
+}
+
 func (I *iamLevelDBStore) saveUserPolicy(ctx context.Context, userName, policyName string, policyDocument policy.PolicyDocument) error {
 	err := I.levelDB.Put(getUserPolicyKey(userName, policyName), policyDocument)
 	if err != nil {
@@ -142,6 +320,34 @@ func (I *iamLevelDBStore) removeUserAllPolicies(ctx context.Context, userName st
 	return nil
 }
 
+func (I *iamLevelDBStore) saveRole(ctx context.Context, role Role) error {
+	return I.levelDB.Put(getRoleKey(role.RoleName), role)
+}
+
+func (I *iamLevelDBStore) loadRole(ctx context.Context, roleName string, role *Role) error {
+	return I.levelDB.Get(getRoleKey(roleName), role)
+}
+
+func (I *iamLevelDBStore) loadRoles(ctx context.Context) ([]Role, error) {
+	var roles []Role
+	all, err := I.levelDB.ReadAllChan(ctx, getRoleKey(""), "")
+	if err != nil {
+		return nil, err
+	}
+	for entry := range all {
+		var role Role
+		if err = entry.UnmarshalValue(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+func (I *iamLevelDBStore) removeRole(ctx context.Context, roleName string) error {
+	return I.levelDB.Delete(getRoleKey(roleName))
+}
+
 //func (I *iamLevelDBStore) loadGroup(ctx context.Context, group string, m *GroupInfo) error {
 //	//TODO implement me
 //	panic("implement me")
@@ -162,7 +368,7 @@ func (I *iamLevelDBStore) removeUserAllPolicies(ctx context.Context, userName st
 //	panic("implement me")
 //}
 
-func newIAMLevelDBStore(db *uleveldb.ULevelDB) *iamLevelDBStore {
+func newIAMLevelDBStore(db *kv.DB) *iamLevelDBStore {
 	return &iamLevelDBStore{
 		levelDB: db,
 	}
@@ -3,6 +3,9 @@ package iam
 import (
 	"context"
 	"fmt"
+	"github.com/yann-y/fds/internal/iam/auth"
+	"github.com/yann-y/fds/internal/iam/kms"
+	"github.com/yann-y/fds/internal/iam/policy"
 	"github.com/yann-y/fds/internal/uleveldb"
 	"testing"
 )
@@ -40,3 +43,126 @@ func TestLoadUsers(t *testing.T) {
 	//	return
 	//}
 }
+
+func newTestKeyring(t *testing.T, id string, previous ...kms.MasterKey) (*kms.Keyring, kms.MasterKey) {
+	s, err := kms.GenerateMasterKey(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := kms.ParseMasterKey(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring, err := kms.NewKeyring(key, previous...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyring, key
+}
+
+func TestSecretEncryption(t *testing.T) {
+	db, _ := uleveldb.OpenDb(t.TempDir())
+	ctx := context.Background()
+	iamSys := NewIdentityAMSys(db)
+	// entries written before encryption was enabled
+	if err := iamSys.AddUser(ctx, "user1", "user1secret"); err != nil {
+		t.Fatal(err)
+	}
+	sts := newTempCred(t, "user1", "")
+	if err := iamSys.SetTempUser(ctx, sts.AccessKey, sts, nil); err != nil {
+		t.Fatal(err)
+	}
+	raw := func(accessKey string) auth.Credentials {
+		var cred auth.Credentials
+		if err := db.Get(getUserKey(accessKey), &cred); err != nil {
+			t.Fatal(err)
+		}
+		return cred
+	}
+	checkUsers := func(iamSys *IdentityAMSys) {
+		if cred, ok := iamSys.GetUser(ctx, "user1"); !ok || cred.SecretKey != "user1secret" {
+			t.Fatalf("Expected secret key user1secret, but instead found %s", cred.SecretKey)
+		}
+		if cred, ok := iamSys.GetUser(ctx, sts.AccessKey); !ok || cred.SecretKey != sts.SecretKey || cred.SessionToken != sts.SessionToken {
+			t.Fatal("Expected sts secrets to be unchanged")
+		}
+	}
+
+	// plaintext entries are migrated when encryption is enabled
+	keyring1, k1 := newTestKeyring(t, "k1")
+	if err := iamSys.InitSecretEncryption(ctx, keyring1); err != nil {
+		t.Fatal(err)
+	}
+	for _, accessKey := range []string{"user1", sts.AccessKey} {
+		if cred := raw(accessKey); !kms.IsSealed(cred.SecretKey) {
+			t.Fatalf("Expected secret of %s to be sealed", accessKey)
+		}
+	}
+	if cred := raw(sts.AccessKey); !kms.IsSealed(cred.SessionToken) {
+		t.Fatal("Expected session token to be sealed")
+	}
+	checkUsers(iamSys)
+	if err := iamSys.AddUser(ctx, "user2", "user2secret"); err != nil {
+		t.Fatal(err)
+	}
+	if cred := raw("user2"); !kms.IsSealed(cred.SecretKey) {
+		t.Fatal("Expected secret of new user to be sealed")
+	}
+
+	// a restart without the master key must fail
+	if err := NewIdentityAMSys(db).InitSecretEncryption(ctx, nil); err == nil {
+		t.Fatal("Expected error without master key")
+	}
+
+	// rotation re-seals the stored secrets with the new master key
+	keyring2, _ := newTestKeyring(t, "k2", k1)
+	iamSys = NewIdentityAMSys(db)
+	if err := iamSys.InitSecretEncryption(ctx, keyring2); err != nil {
+		t.Fatal(err)
+	}
+	for _, accessKey := range []string{"user1", "user2", sts.AccessKey} {
+		if cred := raw(accessKey); keyring2.NeedsReseal(cred.SecretKey) {
+			t.Fatalf("Expected secret of %s to be sealed with k2", accessKey)
+		}
+	}
+	checkUsers(iamSys)
+}
+
+func TestIdentityAMSys_Recover(t *testing.T) {
+	db, _ := uleveldb.OpenDb(t.TempDir())
+	ctx := context.Background()
+	iamSys := NewIdentityAMSys(db)
+	if err := iamSys.AddUser(ctx, "user1", "user1secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, keys, err := iamSys.store.loadUserAllPolicies(ctx, "user1"); err != nil || len(keys) != 1 {
+		t.Fatalf("Expected the default policy to be saved with the user, but instead found %v, %v", keys, err)
+	}
+	// the policies a crash left behind
+	for _, user := range []string{"user1", "gone", "gone2"} {
+		if err := iamSys.store.saveUserPolicy(ctx, user, "p", policy.PolicyDocument{Version: "2012-10-17"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := iamSys.Recover(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("Expected 2 policies removed, but instead found %d", n)
+	}
+	if _, keys, _ := iamSys.store.loadUserAllPolicies(ctx, "user1"); len(keys) != 2 {
+		t.Errorf("Expected the policies of user1 to be kept, but instead found %v", keys)
+	}
+	if _, keys, _ := iamSys.store.loadUserAllPolicies(ctx, "gone"); len(keys) != 0 {
+		t.Errorf("Expected the orphan policies to be removed, but instead found %v", keys)
+	}
+
+	if err = iamSys.RemoveUser(ctx, "user1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, keys, _ := iamSys.store.loadUserAllPolicies(ctx, "user1"); len(keys) != 0 {
+		t.Errorf("Expected the policies to be removed with the user, but instead found %v", keys)
+	}
+}
@@ -4,13 +4,24 @@ import (
 	"context"
 	"errors"
 	"github.com/yann-y/fds/internal/iam/auth"
+	"github.com/yann-y/fds/internal/iam/kms"
 	"github.com/yann-y/fds/internal/iam/policy"
-	"github.com/yann-y/fds/internal/iam/s3action"
 )
 
 // errInvalidArgument means that input argument is invalid.
 var errInvalidArgument = errors.New("Invalid arguments specified")
 
+// errMasterKeyRequired means that stored secrets are sealed but no master key is configured.
+var errMasterKeyRequired = errors.New("stored secrets are encrypted, a master key is required")
+
+const (
+	// sessionPolicyName is the name the session policy of a temporary user is saved under.
+	sessionPolicyName = "session"
+	// federatedPolicyName is the name the policy mapped from the claims of a
+	// federated temporary user is saved under.
+	federatedPolicyName = "federated"
+)
+
 // iamStoreAPI defines an interface for the IAM persistence layer
 type iamStoreAPI interface {
 	saveUserIdentity(ctx context.Context, u UserIdentity) error
@@ -22,11 +33,24 @@ type iamStoreAPI interface {
 	//saveGroupInfo(ctx context.Context, group string, gi GroupInfo) error
 	//removeGroupInfo(ctx context.Context, name string) error
 	savePolicy(ctx context.Context, policyName string, policyDocument policy.PolicyDocument) error
+	loadPolicy(ctx context.Context, policyName string, policyDocument *policy.PolicyDocument) error
+	removePolicy(ctx context.Context, policyName string) error
 	saveUserPolicy(ctx context.Context, userName, policyName string, policyDocument policy.PolicyDocument) error
 	loadUserPolicy(ctx context.Context, userName, policyName string, policyDocument *policy.PolicyDocument) error
 	loadUserAllPolicies(ctx context.Context, userName string) ([]policy.Policy, []string, error)
 	removeUserPolicy(ctx context.Context, userName, policyName string) error
 	removeUserAllPolicies(ctx context.Context, userName string) error
+	saveUserWithPolicies(ctx context.Context, u UserIdentity, policies map[string]policy.PolicyDocument) error
+	removeUser(ctx context.Context, userName string) error
+	removeOrphanPolicies(ctx context.Context) (int, error)
+	saveRole(ctx context.Context, role Role) error
+	loadRole(ctx context.Context, roleName string, role *Role) error
+	loadRoles(ctx context.Context) ([]Role, error)
+	removeRole(ctx context.Context, roleName string) error
+	setKeyring(keyring *kms.Keyring)
+	resealSecrets(ctx context.Context) (int, error)
+	loadSecretsKeyID(ctx context.Context) string
+	saveSecretsKeyID(ctx context.Context, keyID string) error
 }
 
 // iamStoreSys contains IAMStorageAPI to add higher-level methods on the storage
@@ -36,31 +60,52 @@ type iamStoreSys struct {
 }
 
 // SetTempUser - saves temporary (STS) credential to storage and cache. If a
-// policy name is given, it is associated with the parent user specified in the
-// credential.
-func (store *iamStoreSys) SetTempUser(ctx context.Context, accessKey string, cred auth.Credentials, policyName string) error {
-	if accessKey == "" || !cred.IsTemp() || cred.IsExpired() || cred.ParentUser == "" {
-		return errInvalidArgument
-	}
-	if policyName != "" {
-		//todo policy
+// session policy is given, it is saved along with the credential and restricts
+// the permissions inherited from the parent user or the assumed role.
+func (store *iamStoreSys) SetTempUser(ctx context.Context, accessKey string, cred auth.Credentials, sessionPolicy *policy.Policy) error {
+	policies := make(map[string]policy.PolicyDocument)
+	if sessionPolicy != nil {
+		policies[sessionPolicyName] = policyDocument(sessionPolicy)
 	}
+	return store.setTempUser(ctx, accessKey, cred, policies)
+}
 
-	u := newUserIdentity(cred)
-	err := store.saveUserIdentity(ctx, u)
-	if err != nil {
-		return err
+// setTempUser - saves the temporary credential along with its policies at once.
+func (store *iamStoreSys) setTempUser(ctx context.Context, accessKey string, cred auth.Credentials, policies map[string]policy.PolicyDocument) error {
+	if accessKey == "" || accessKey != cred.AccessKey || !cred.IsTemp() || cred.IsExpired() || cred.ParentUser == "" {
+		return errInvalidArgument
 	}
-	//todo policy name
-	p := policy.CreateUserPolicy(accessKey, []s3action.Action{s3action.AllActions}, "*")
-	err = store.saveUserPolicy(ctx, accessKey, "default", policy.PolicyDocument{
+	return store.saveUserWithPolicies(ctx, newUserIdentity(cred), policies)
+}
+
+// policyDocument - returns the document p is saved as.
+func policyDocument(p *policy.Policy) policy.PolicyDocument {
+	return policy.PolicyDocument{
 		Version:   p.Version,
 		Statement: p.Statements,
-	})
+	}
+}
+
+// InitSecretEncryption - seals the stored secrets with keyring. Plaintext secrets,
+// and secrets sealed with a previous master key, are re-sealed once per master key.
+func (store *iamStoreSys) InitSecretEncryption(ctx context.Context, keyring *kms.Keyring) error {
+	keyID := store.loadSecretsKeyID(ctx)
+	if keyring == nil {
+		if keyID != "" {
+			return errMasterKeyRequired
+		}
+		return nil
+	}
+	store.setKeyring(keyring)
+	if keyID == keyring.KeyID() {
+		return nil
+	}
+	n, err := store.resealSecrets(ctx)
 	if err != nil {
 		return err
 	}
-	return nil
+	log.Infof("sealed %d stored credentials with master key %s", n, keyring.KeyID())
+	return store.saveSecretsKeyID(ctx, keyring.KeyID())
 }
 
 //func (store *iamStoreSys) CreateGroup(ctx context.Context, groupName string, version int) error {
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/yann-y/fds/internal/iam/auth"
 	"github.com/yann-y/fds/internal/iam/policy"
+	"github.com/yann-y/fds/internal/iam/s3action"
 	"github.com/yann-y/fds/internal/uleveldb"
 	"testing"
 )
@@ -145,3 +146,50 @@ func TestIsAllowed(t *testing.T) {
 	})
 	fmt.Println(a)
 }
+
+func TestIdentityAMSys_IsAllowedPolicies(t *testing.T) {
+	db, _ := uleveldb.OpenDb(t.TempDir())
+	iamSys := NewIdentityAMSys(db)
+	ctx := context.Background()
+
+	// the user may read the objects of b1, write those of b2 and not delete
+	// those of b1, each by a policy of its own
+	if err := iamSys.AddUser(ctx, "user1", "user1234"); err != nil {
+		t.Fatal(err)
+	}
+	if err := iamSys.RemoveUserPolicy(ctx, "user1", "default"); err != nil {
+		t.Fatal(err)
+	}
+	policies := map[string]*policy.Policy{
+		"read":  policy.CreateUserPolicy("user1", []s3action.Action{s3action.GetObjectAction, s3action.DeleteObjectAction}, "b1"),
+		"write": policy.CreateUserPolicy("user1", []s3action.Action{s3action.PutObjectAction}, "b2"),
+		"deny":  mustParseIdentityPolicy(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Action":["s3:DeleteObject"],"Resource":["arn:aws:s3:::b1/*"]}]}`),
+	}
+	for name, p := range policies {
+		if err := iamSys.UpdateUserPolicy(ctx, "user1", name, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		action   s3action.Action
+		bucket   string
+		expected bool
+	}{
+		// Test case - 1.
+		{action: s3action.GetObjectAction, bucket: "b1", expected: true},
+		// Test case - 2.
+		{action: s3action.PutObjectAction, bucket: "b2", expected: true},
+		// Test case - 3.
+		{action: s3action.PutObjectAction, bucket: "b1", expected: false},
+		// Test case - 4.
+		// the deny of a policy overrides the allow of another one.
+		{action: s3action.DeleteObjectAction, bucket: "b1", expected: false},
+	}
+	for i, testCase := range testCases {
+		got := iamSys.IsAllowed(ctx, auth.Args{AccountName: "user1", Action: testCase.action, BucketName: testCase.bucket, ObjectName: "a.txt"})
+		if got != testCase.expected {
+			t.Errorf("Test %d: Expected IsAllowed to be %v, but instead found %v", i+1, testCase.expected, got)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Package kms seals secrets stored at rest with a key encryption key (KEK)
+// derived from a configured master key.
+package kms
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// sealedPrefix marks a sealed value, followed by the master key id and
+	// the base64 encoded nonce and ciphertext: fds:kms:v1:<key-id>:<data>
+	sealedPrefix = "fds:kms:v1:"
+
+	masterKeySize = 32
+	kekContext    = "fds iam secret encryption key"
+)
+
+var (
+	errInvalidMasterKey = errors.New("master key must have the format <key-id>:<base64 encoded 32 bytes>")
+	errUnknownKey       = errors.New("value is sealed with an unknown master key")
+	errMalformedSealed  = errors.New("malformed sealed value")
+)
+
+// MasterKey - a named master key, secrets are never sealed with it directly
+// but with a KEK derived from it.
+type MasterKey struct {
+	ID  string
+	key []byte
+}
+
+// ParseMasterKey parses a master key of the format <key-id>:<base64 encoded 32 bytes>.
+func ParseMasterKey(s string) (MasterKey, error) {
+	id, b64, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok || id == "" || strings.Contains(id, ":") {
+		return MasterKey{}, errInvalidMasterKey
+	}
+	key, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil || len(key) != masterKeySize {
+		return MasterKey{}, errInvalidMasterKey
+	}
+	return MasterKey{ID: id, key: key}, nil
+}
+
+// LoadMasterKey returns the master key given in value, or read from file when
+// value is empty. ok is false when neither is set.
+func LoadMasterKey(value, file string) (key MasterKey, ok bool, err error) {
+	if value == "" && file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return key, false, err
+		}
+		value = string(data)
+	}
+	if value == "" {
+		return key, false, nil
+	}
+	key, err = ParseMasterKey(value)
+	return key, err == nil, err
+}
+
+// GenerateMasterKey returns a new random master key with given id, in the
+// format accepted by ParseMasterKey.
+func GenerateMasterKey(id string) (string, error) {
+	key := make([]byte, masterKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return id + ":" + base64.StdEncoding.EncodeToString(key), nil
+}
+
+// Keyring seals values with the KEK of the current master key, and opens
+// values sealed with the current or any previous master key, so that the
+// master key can be rotated by re-sealing stored values.
+type Keyring struct {
+	current string
+	keks    map[string]cipher.AEAD
+}
+
+// NewKeyring creates a keyring sealing with current, previous keys are only
+// used to open values sealed before a rotation.
+func NewKeyring(current MasterKey, previous ...MasterKey) (*Keyring, error) {
+	k := &Keyring{
+		current: current.ID,
+		keks:    make(map[string]cipher.AEAD, len(previous)+1),
+	}
+	for _, key := range append([]MasterKey{current}, previous...) {
+		if _, ok := k.keks[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate master key id %s", key.ID)
+		}
+		aead, err := newKEK(key)
+		if err != nil {
+			return nil, err
+		}
+		k.keks[key.ID] = aead
+	}
+	return k, nil
+}
+
+// newKEK derives the KEK of the master key.
+func newKEK(key MasterKey) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, key.key)
+	mac.Write([]byte(kekContext))
+	mac.Write([]byte(key.ID))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// KeyID returns the id of the master key values are sealed with.
+func (k *Keyring) KeyID() string {
+	return k.current
+}
+
+// Seal encrypts plaintext, associatedData binds the sealed value to its owner
+// and must be given again to open it. Empty values are kept as is.
+func (k *Keyring) Seal(plaintext, associatedData string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	aead := k.keks[k.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	data := aead.Seal(nonce, nonce, []byte(plaintext), []byte(associatedData))
+	return sealedPrefix + k.current + ":" + base64.RawStdEncoding.EncodeToString(data), nil
+}
+
+// Open decrypts a value sealed by Seal, values that are not sealed are
+// returned as is so that plaintext entries written before encryption was
+// enabled stay readable until they are migrated.
+func (k *Keyring) Open(value, associatedData string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+	id, b64, ok := strings.Cut(strings.TrimPrefix(value, sealedPrefix), ":")
+	if !ok {
+		return "", errMalformedSealed
+	}
+	aead, ok := k.keks[id]
+	if !ok {
+		return "", errUnknownKey
+	}
+	data, err := base64.RawStdEncoding.DecodeString(b64)
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", errMalformedSealed
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(associatedData))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// NeedsReseal returns whether value is not sealed with the current master key.
+func (k *Keyring) NeedsReseal(value string) bool {
+	if value == "" {
+		return false
+	}
+	return !strings.HasPrefix(value, sealedPrefix+k.current+":")
+}
+
+// IsSealed returns whether value was sealed by a keyring.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
@@ -0,0 +1,83 @@
+package kms
+
+import (
+	"strings"
+	"testing"
+)
+
+func mustMasterKey(t *testing.T, id string) MasterKey {
+	s, err := GenerateMasterKey(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParseMasterKey(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestParseMasterKey(t *testing.T) {
+	testCases := []struct {
+		key         string
+		expectedErr bool
+	}{
+		{key: "k1:MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2Nzg5MDE=", expectedErr: false},
+		{key: "k1:MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2Nzg5MDE=\n", expectedErr: false},
+		{key: "MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2Nzg5MDE=", expectedErr: true},
+		{key: ":MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2Nzg5MDE=", expectedErr: true},
+		{key: "k1:MDEyMzQ1Njc4OTAx", expectedErr: true},
+		{key: "k1:not base64", expectedErr: true},
+	}
+	for i, testCase := range testCases {
+		if _, err := ParseMasterKey(testCase.key); (err != nil) != testCase.expectedErr {
+			t.Fatalf("Case %d: Expected error %v, but instead found %v", i+1, testCase.expectedErr, err)
+		}
+	}
+}
+
+func TestKeyring_SealOpen(t *testing.T) {
+	k1, k2 := mustMasterKey(t, "k1"), mustMasterKey(t, "k2")
+	keyring, err := NewKeyring(k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := keyring.Seal("secret1234", "user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSealed(sealed) || strings.Contains(sealed, "secret1234") {
+		t.Fatalf("Expected sealed value, but instead found %s", sealed)
+	}
+	if got, err := keyring.Open(sealed, "user1"); err != nil || got != "secret1234" {
+		t.Fatalf("Expected secret1234, but instead found %s, %v", got, err)
+	}
+	if _, err = keyring.Open(sealed, "user2"); err == nil {
+		t.Fatal("Expected open with other associated data to fail")
+	}
+	if got, _ := keyring.Open("plaintext", "user1"); got != "plaintext" {
+		t.Fatalf("Expected plaintext values to be returned as is, but instead found %s", got)
+	}
+	if keyring.NeedsReseal(sealed) || !keyring.NeedsReseal("plaintext") || keyring.NeedsReseal("") {
+		t.Fatal("Unexpected NeedsReseal result")
+	}
+
+	// after a rotation values sealed with the previous key can still be opened
+	rotated, err := NewKeyring(k2, k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := rotated.Open(sealed, "user1"); err != nil || got != "secret1234" {
+		t.Fatalf("Expected secret1234, but instead found %s, %v", got, err)
+	}
+	if !rotated.NeedsReseal(sealed) {
+		t.Fatal("Expected value sealed with the previous key to need a reseal")
+	}
+	onlyK2, _ := NewKeyring(k2)
+	if _, err = onlyK2.Open(sealed, "user1"); err == nil {
+		t.Fatal("Expected open with an unknown key to fail")
+	}
+	if _, err = NewKeyring(k1, k1); err == nil {
+		t.Fatal("Expected duplicate key ids to be rejected")
+	}
+}
@@ -0,0 +1,298 @@
+package openid
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	jwtgo "github.com/golang-jwt/jwt/v4"
+	logging "github.com/ipfs/go-log/v2"
+)
+
+var log = logging.Logger("openid")
+
+const (
+	// DefaultClaimName - default claim carrying the policies of the identity.
+	DefaultClaimName = "policy"
+	// DefaultGroupsClaim - default claim carrying the groups of the identity.
+	DefaultGroupsClaim = "groups"
+
+	// jwksRefreshInterval - JWKS is fetched again at most once per interval
+	// when a token is signed by an unknown key.
+	jwksRefreshInterval = time.Minute
+	jwksFetchTimeout    = 10 * time.Second
+	jwksSizeLimit       = 1 << 20
+)
+
+var (
+	errNoJWKSSource  = errors.New("either a JWKS url or a JWKS file is required")
+	errMissingIssuer = errors.New("openid issuer is required")
+	errUnknownKey    = errors.New("token is signed by an unknown key")
+	errMissingSub    = errors.New("token has no sub claim")
+	errNoProvider    = errors.New("no openid provider is configured")
+)
+
+// Config - configuration of an OpenID provider the STS trusts.
+type Config struct {
+	// Issuer is the expected iss claim of the tokens.
+	Issuer string
+	// ClientID is the expected audience of the tokens, not checked when empty.
+	ClientID string
+	// JWKSURL is where the signing keys are fetched from.
+	JWKSURL string
+	// JWKSFile is a static key set for offline use, it takes precedence over JWKSURL.
+	JWKSFile string
+	// ClaimName is the claim mapping the identity to policies.
+	ClaimName string
+	// GroupsClaim is the claim listing the groups of the identity.
+	GroupsClaim string
+}
+
+// Provider - validates JWTs issued by an OpenID provider.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey
+	lastRefresh time.Time
+}
+
+// NewProvider - creates a provider and loads its signing keys.
+func NewProvider(cfg Config) (*Provider, error) {
+	if cfg.Issuer == "" {
+		return nil, errMissingIssuer
+	}
+	if cfg.JWKSURL == "" && cfg.JWKSFile == "" {
+		return nil, errNoJWKSSource
+	}
+	if cfg.ClaimName == "" {
+		cfg.ClaimName = DefaultClaimName
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = DefaultGroupsClaim
+	}
+	p := &Provider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: jwksFetchTimeout},
+	}
+	if err := p.refreshKeys(context.Background()); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Provider) loadJWKS(ctx context.Context) (jwks JWKS, err error) {
+	var r io.Reader
+	if p.cfg.JWKSFile != "" {
+		f, err := os.Open(p.cfg.JWKSFile)
+		if err != nil {
+			return jwks, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.JWKSURL, nil)
+		if err != nil {
+			return jwks, err
+		}
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return jwks, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return jwks, fmt.Errorf("fetch JWKS from %s: %s", p.cfg.JWKSURL, resp.Status)
+		}
+		r = resp.Body
+	}
+	err = json.NewDecoder(io.LimitReader(r, jwksSizeLimit)).Decode(&jwks)
+	return jwks, err
+}
+
+func (p *Provider) refreshKeys(ctx context.Context) error {
+	jwks, err := p.loadJWKS(ctx)
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, key := range jwks.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		pub, err := key.DecodePublicKey()
+		if err != nil {
+			log.Warnw("skip invalid JWK", "kid", key.Kid, "error", err)
+			continue
+		}
+		keys[key.Kid] = pub
+	}
+	p.mu.Lock()
+	p.keys = keys
+	p.lastRefresh = time.Now()
+	p.mu.Unlock()
+	return nil
+}
+
+// key returns the public key with given kid, the key set is fetched
+// again when kid is unknown and the last fetch is old enough.
+func (p *Provider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.RLock()
+	pub, ok := p.keys[kid]
+	stale := time.Since(p.lastRefresh) > jwksRefreshInterval
+	p.mu.RUnlock()
+	if ok {
+		return pub, nil
+	}
+	if !stale || p.cfg.JWKSFile != "" {
+		return nil, errUnknownKey
+	}
+	if err := p.refreshKeys(ctx); err != nil {
+		log.Errorw("refresh JWKS", "error", err)
+		return nil, errUnknownKey
+	}
+	p.mu.RLock()
+	pub, ok = p.keys[kid]
+	p.mu.RUnlock()
+	if !ok {
+		return nil, errUnknownKey
+	}
+	return pub, nil
+}
+
+// Validate - verifies the signature and the standard claims of token,
+// and returns its claims.
+func (p *Provider) Validate(ctx context.Context, token string) (jwtgo.MapClaims, error) {
+	claims := jwtgo.MapClaims{}
+	_, err := jwtgo.ParseWithClaims(token, claims, func(t *jwtgo.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		pub, err := p.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		switch t.Method.(type) {
+		case *jwtgo.SigningMethodRSA, *jwtgo.SigningMethodRSAPSS:
+			if _, ok := pub.(*rsa.PublicKey); ok {
+				return pub, nil
+			}
+		case *jwtgo.SigningMethodECDSA:
+			if _, ok := pub.(*ecdsa.PublicKey); ok {
+				return pub, nil
+			}
+		}
+		return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+	})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	if !claims.VerifyExpiresAt(now, true) {
+		return nil, errors.New("token is expired or has no exp claim")
+	}
+	if !claims.VerifyIssuer(p.cfg.Issuer, true) {
+		return nil, fmt.Errorf("unexpected issuer %v", claims["iss"])
+	}
+	if p.cfg.ClientID != "" && !claims.VerifyAudience(p.cfg.ClientID, true) {
+		// client credentials grants may carry the client in azp only
+		if azp, _ := claims["azp"].(string); azp != p.cfg.ClientID {
+			return nil, fmt.Errorf("unexpected audience %v", claims["aud"])
+		}
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, errMissingSub
+	}
+	return claims, nil
+}
+
+// Providers - the OpenID providers the STS trusts, the provider validating
+// a token is the one of its issuer.
+type Providers struct {
+	providers map[string]*Provider
+}
+
+// NewProviders - creates a provider for every configuration, the issuers must
+// be distinct.
+func NewProviders(cfgs ...Config) (*Providers, error) {
+	if len(cfgs) == 0 {
+		return nil, errNoProvider
+	}
+	ps := &Providers{providers: make(map[string]*Provider, len(cfgs))}
+	for _, cfg := range cfgs {
+		if _, ok := ps.providers[cfg.Issuer]; ok {
+			return nil, fmt.Errorf("openid issuer %s is configured twice", cfg.Issuer)
+		}
+		p, err := NewProvider(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("openid issuer %s: %w", cfg.Issuer, err)
+		}
+		ps.providers[cfg.Issuer] = p
+	}
+	return ps, nil
+}
+
+// Validate - validates token with the provider of its iss claim, and returns
+// the provider along with the claims of token.
+func (ps *Providers) Validate(ctx context.Context, token string) (*Provider, jwtgo.MapClaims, error) {
+	// the issuer only selects the provider, which verifies the token and its
+	// issuer again
+	claims := jwtgo.MapClaims{}
+	if _, _, err := jwtgo.NewParser().ParseUnverified(token, claims); err != nil {
+		return nil, nil, err
+	}
+	iss, _ := claims["iss"].(string)
+	p, ok := ps.providers[iss]
+	if !ok {
+		return nil, nil, fmt.Errorf("unexpected issuer %v", claims["iss"])
+	}
+	claims, err := p.Validate(ctx, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, claims, nil
+}
+
+// Subject - returns the sub claim.
+func (p *Provider) Subject(claims jwtgo.MapClaims) string {
+	sub, _ := claims["sub"].(string)
+	return sub
+}
+
+// Policies - returns the policy names listed in the policy claim.
+func (p *Provider) Policies(claims jwtgo.MapClaims) []string {
+	return claimValues(claims[p.cfg.ClaimName])
+}
+
+// Groups - returns the group names listed in the groups claim.
+func (p *Provider) Groups(claims jwtgo.MapClaims) []string {
+	return claimValues(claims[p.cfg.GroupsClaim])
+}
+
+// claimValues accepts both a comma separated string and an array of strings.
+func claimValues(v interface{}) []string {
+	var values []string
+	switch v := v.(type) {
+	case string:
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				values = append(values, s)
+			}
+		}
+	case []interface{}:
+		for _, s := range v {
+			if s, ok := s.(string); ok && s != "" {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,208 @@
+package openid
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jwtgo "github.com/golang-jwt/jwt/v4"
+)
+
+const testIssuer = "https://idp.example.com"
+
+func newTestJWKS(t *testing.T, kid string) (*rsa.PrivateKey, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(JWKS{Keys: []JWK{{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, data
+}
+
+func signToken(t *testing.T, key *rsa.PrivateKey, kid string, claims jwtgo.MapClaims) string {
+	token := jwtgo.NewWithClaims(jwtgo.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestProvider_Validate(t *testing.T) {
+	key, jwks := newTestJWKS(t, "k1")
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewProvider(Config{Issuer: testIssuer, ClientID: "fds", JWKSFile: jwksFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, _ := newTestJWKS(t, "k1")
+	exp := time.Now().Add(time.Hour).Unix()
+
+	testCases := []struct {
+		name        string
+		key         *rsa.PrivateKey
+		kid         string
+		claims      jwtgo.MapClaims
+		expectedErr bool
+	}{
+		{name: "valid", key: key, kid: "k1", claims: jwtgo.MapClaims{"iss": testIssuer, "aud": "fds", "sub": "alice", "exp": exp}},
+		{name: "valid azp", key: key, kid: "k1", claims: jwtgo.MapClaims{"iss": testIssuer, "azp": "fds", "sub": "alice", "exp": exp}},
+		{name: "wrong issuer", key: key, kid: "k1", claims: jwtgo.MapClaims{"iss": "https://evil.example.com", "aud": "fds", "sub": "alice", "exp": exp}, expectedErr: true},
+		{name: "wrong audience", key: key, kid: "k1", claims: jwtgo.MapClaims{"iss": testIssuer, "aud": "other", "sub": "alice", "exp": exp}, expectedErr: true},
+		{name: "expired", key: key, kid: "k1", claims: jwtgo.MapClaims{"iss": testIssuer, "aud": "fds", "sub": "alice", "exp": time.Now().Add(-time.Minute).Unix()}, expectedErr: true},
+		{name: "no exp", key: key, kid: "k1", claims: jwtgo.MapClaims{"iss": testIssuer, "aud": "fds", "sub": "alice"}, expectedErr: true},
+		{name: "no sub", key: key, kid: "k1", claims: jwtgo.MapClaims{"iss": testIssuer, "aud": "fds", "exp": exp}, expectedErr: true},
+		{name: "unknown kid", key: key, kid: "k2", claims: jwtgo.MapClaims{"iss": testIssuer, "aud": "fds", "sub": "alice", "exp": exp}, expectedErr: true},
+		{name: "bad signature", key: otherKey, kid: "k1", claims: jwtgo.MapClaims{"iss": testIssuer, "aud": "fds", "sub": "alice", "exp": exp}, expectedErr: true},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			claims, err := p.Validate(context.Background(), signToken(t, testCase.key, testCase.kid, testCase.claims))
+			if (err != nil) != testCase.expectedErr {
+				t.Fatalf("Expected error %v, but instead found %v", testCase.expectedErr, err)
+			}
+			if err == nil && p.Subject(claims) != "alice" {
+				t.Fatalf("Expected subject alice, but instead found %s", p.Subject(claims))
+			}
+		})
+	}
+
+	// HMAC tokens signed with the public key must be rejected
+	hmacToken := jwtgo.NewWithClaims(jwtgo.SigningMethodHS256, jwtgo.MapClaims{"iss": testIssuer, "aud": "fds", "sub": "alice", "exp": exp})
+	hmacToken.Header["kid"] = "k1"
+	s, err := hmacToken.SignedString(key.PublicKey.N.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.Validate(context.Background(), s); err == nil {
+		t.Fatal("Expected HMAC token to be rejected")
+	}
+}
+
+func TestProvider_JWKSURL(t *testing.T) {
+	key, jwks := newTestJWKS(t, "k1")
+	var served atomic.Value
+	served.Store(jwks)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(served.Load().([]byte))
+	}))
+	defer server.Close()
+
+	p, err := NewProvider(Config{Issuer: testIssuer, JWKSURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := jwtgo.MapClaims{"iss": testIssuer, "sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}
+	if _, err = p.Validate(context.Background(), signToken(t, key, "k1", claims)); err != nil {
+		t.Fatal(err)
+	}
+
+	// a rotated key is picked up once the key set is stale
+	rotated, rotatedJWKS := newTestJWKS(t, "k2")
+	served.Store(rotatedJWKS)
+	if _, err = p.Validate(context.Background(), signToken(t, rotated, "k2", claims)); err == nil {
+		t.Fatal("Expected key set not to be refreshed before the refresh interval")
+	}
+	p.lastRefresh = time.Now().Add(-2 * jwksRefreshInterval)
+	if _, err = p.Validate(context.Background(), signToken(t, rotated, "k2", claims)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProvider_Claims(t *testing.T) {
+	p := &Provider{cfg: Config{ClaimName: "roles", GroupsClaim: DefaultGroupsClaim}}
+	claims := jwtgo.MapClaims{
+		"roles":  "readonly, writer,",
+		"groups": []interface{}{"dev", 1, "ops"},
+	}
+	if got := p.Policies(claims); !reflect.DeepEqual(got, []string{"readonly", "writer"}) {
+		t.Fatalf("Expected policies [readonly writer], but instead found %v", got)
+	}
+	if got := p.Groups(claims); !reflect.DeepEqual(got, []string{"dev", "ops"}) {
+		t.Fatalf("Expected groups [dev ops], but instead found %v", got)
+	}
+}
+
+func TestProviders_Validate(t *testing.T) {
+	const otherIssuer = "https://login.example.org"
+	dir := t.TempDir()
+	key, jwks := newTestJWKS(t, "k1")
+	otherKey, otherJWKS := newTestJWKS(t, "k1")
+	jwksFile, otherJWKSFile := filepath.Join(dir, "jwks.json"), filepath.Join(dir, "other.json")
+	if err := os.WriteFile(jwksFile, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(otherJWKSFile, otherJWKS, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ps, err := NewProviders(
+		Config{Issuer: testIssuer, ClientID: "fds", JWKSFile: jwksFile},
+		Config{Issuer: otherIssuer, JWKSFile: otherJWKSFile, ClaimName: "roles"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewProviders(Config{Issuer: testIssuer, JWKSFile: jwksFile}, Config{Issuer: testIssuer, JWKSFile: otherJWKSFile}); err == nil {
+		t.Fatal("Expected an issuer configured twice to be rejected")
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	testCases := []struct {
+		name           string
+		key            *rsa.PrivateKey
+		claims         jwtgo.MapClaims
+		expectedErr    bool
+		expectedIssuer string
+		expectedPolicy []string
+	}{
+		{name: "first issuer", key: key, claims: jwtgo.MapClaims{"iss": testIssuer, "aud": "fds", "sub": "alice", "exp": exp, "policy": "readonly"}, expectedIssuer: testIssuer, expectedPolicy: []string{"readonly"}},
+		{name: "second issuer", key: otherKey, claims: jwtgo.MapClaims{"iss": otherIssuer, "sub": "alice", "exp": exp, "roles": "writer"}, expectedIssuer: otherIssuer, expectedPolicy: []string{"writer"}},
+		{name: "audience of the first issuer", key: key, claims: jwtgo.MapClaims{"iss": testIssuer, "aud": "other", "sub": "alice", "exp": exp}, expectedErr: true},
+		// the key of an issuer does not sign the tokens of another one
+		{name: "key of the other issuer", key: otherKey, claims: jwtgo.MapClaims{"iss": testIssuer, "aud": "fds", "sub": "alice", "exp": exp}, expectedErr: true},
+		{name: "unknown issuer", key: key, claims: jwtgo.MapClaims{"iss": "https://evil.example.com", "aud": "fds", "sub": "alice", "exp": exp}, expectedErr: true},
+		{name: "no issuer", key: key, claims: jwtgo.MapClaims{"aud": "fds", "sub": "alice", "exp": exp}, expectedErr: true},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			p, claims, err := ps.Validate(context.Background(), signToken(t, testCase.key, "k1", testCase.claims))
+			if (err != nil) != testCase.expectedErr {
+				t.Fatalf("Expected error %v, but instead found %v", testCase.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if p.cfg.Issuer != testCase.expectedIssuer {
+				t.Fatalf("Expected the provider of %s, but instead found %s", testCase.expectedIssuer, p.cfg.Issuer)
+			}
+			if got := p.Policies(claims); !reflect.DeepEqual(got, testCase.expectedPolicy) {
+				t.Fatalf("Expected policies %v, but instead found %v", testCase.expectedPolicy, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package condition
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// booleanFunc - Bool condition function. It checks whether the boolean value
+// of Key matches the condition value.
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_policies_elements_condition_operators.html#Conditions_Boolean
+type booleanFunc struct {
+	k     Key
+	value bool
+}
+
+// evaluate() - evaluates to check whether the value of Key is the boolean
+// value of the condition. A missing or non boolean value does not match.
+func (f booleanFunc) evaluate(values map[string][]string) bool {
+	rvalues := getValuesByKey(values, f.k)
+	if len(rvalues) == 0 {
+		return false
+	}
+	value, err := strconv.ParseBool(rvalues[0])
+	if err != nil {
+		return false
+	}
+	return value == f.value
+}
+
+// key() - returns condition key which is used by this condition function.
+func (f booleanFunc) key() Key {
+	return f.k
+}
+
+// name() - returns "Bool" condition name.
+func (f booleanFunc) name() name {
+	return name{name: boolean}
+}
+
+func (f booleanFunc) String() string {
+	return fmt.Sprintf("%v:%v:%v", boolean, f.k, f.value)
+}
+
+// toMap - returns map representation of this function.
+func (f booleanFunc) toMap() map[Key]ValueSet {
+	if !f.k.IsValid() {
+		return nil
+	}
+
+	return map[Key]ValueSet{
+		f.k: NewValueSet(NewBoolValue(f.value)),
+	}
+}
+
+func (f booleanFunc) clone() CondFunction {
+	return &booleanFunc{
+		k:     f.k,
+		value: f.value,
+	}
+}
+
+func newBooleanFunc(key Key, values ValueSet, qualifier string) (CondFunction, error) {
+	if len(values) != 1 {
+		return nil, fmt.Errorf("only one value is allowed for Bool condition")
+	}
+
+	var value bool
+	for v := range values {
+		switch v.GetType() {
+		case reflect.Bool:
+			value, _ = v.GetBool()
+		case reflect.String:
+			var err error
+			s, _ := v.GetString()
+			if value, err = strconv.ParseBool(s); err != nil {
+				return nil, fmt.Errorf("value must be a boolean string for Bool condition")
+			}
+		default:
+			return nil, fmt.Errorf("value must be a boolean for Bool condition")
+		}
+	}
+
+	return &booleanFunc{key, value}, nil
+}
@@ -0,0 +1,77 @@
+package condition
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBooleanFunc_evaluate(t *testing.T) {
+	testCases := []struct {
+		name           string
+		value          Value
+		values         map[string][]string
+		expectedResult bool
+	}{
+		{
+			name:           "match true",
+			value:          NewBoolValue(true),
+			values:         map[string][]string{"SecureTransport": {"true"}},
+			expectedResult: true,
+		},
+		{
+			name:           "mismatch",
+			value:          NewBoolValue(true),
+			values:         map[string][]string{"SecureTransport": {"false"}},
+			expectedResult: false,
+		},
+		{
+			name:           "match string false",
+			value:          NewStringValue("false"),
+			values:         map[string][]string{"SecureTransport": {"false"}},
+			expectedResult: true,
+		},
+		{
+			name:           "missing",
+			value:          NewBoolValue(false),
+			values:         map[string][]string{},
+			expectedResult: false,
+		},
+		{
+			name:           "not a boolean",
+			value:          NewBoolValue(false),
+			values:         map[string][]string{"SecureTransport": {"no"}},
+			expectedResult: false,
+		},
+	}
+	for i, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			c, err := newBooleanFunc(AWSSecureTransport.ToKey(), NewValueSet(testCase.value), "")
+			if err != nil {
+				t.Fatalf("Test %d: Expected no error, but instead found %v", i+1, err)
+			}
+			if result := c.evaluate(testCase.values); result != testCase.expectedResult {
+				t.Errorf("Test %d: Expected %v, but instead found %v", i+1, testCase.expectedResult, result)
+			}
+		})
+	}
+}
+
+func TestBooleanFunc_unmarshal(t *testing.T) {
+	var cs Conditions
+	if err := json.Unmarshal([]byte(`{"Bool":{"aws:SecureTransport":"false"}}`), &cs); err != nil {
+		t.Fatalf("Expected no error, but instead found %v", err)
+	}
+	if len(cs) != 1 {
+		t.Fatalf("Expected 1 condition, but instead found %d", len(cs))
+	}
+	if !cs.Evaluate(map[string][]string{"SecureTransport": {"false"}}) {
+		t.Errorf("Expected a plain HTTP request to match")
+	}
+	if cs.Evaluate(map[string][]string{"SecureTransport": {"true"}}) {
+		t.Errorf("Expected a TLS request not to match")
+	}
+
+	if _, err := newBooleanFunc(AWSSecureTransport.ToKey(), NewValueSet(NewStringValue("yes")), ""); err == nil {
+		t.Errorf("Expected an error for a non boolean value")
+	}
+}
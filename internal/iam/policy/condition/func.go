@@ -165,7 +165,8 @@ var conditionFuncMap = map[string]func(Key, ValueSet, string) (CondFunction, err
 	stringLike:                newStringLikeFunc,
 	stringNotLike:             newStringNotLikeFunc,
 
-	null: newNullFunc,
+	null:    newNullFunc,
+	boolean: newBooleanFunc,
 	// todo Add  conditions
 }
 
@@ -16,6 +16,7 @@ const (
 	stringNotLike             = "StringNotLike"
 	binaryEquals              = "BinaryEquals"
 	null                      = "Null"
+	boolean                   = "Bool"
 )
 
 var names = map[string]struct{}{
@@ -27,6 +28,7 @@ var names = map[string]struct{}{
 	stringLike:                {},
 	stringNotLike:             {},
 	null:                      {},
+	boolean:                   {},
 }
 
 type name struct {
@@ -7,10 +7,17 @@ import (
 	"net/http"
 	"reflect"
 	"strconv"
+	"strings"
 )
 
+// getValuesByKey - returns the values of key in m. The values of the global
+// keys, such as aws:SecureTransport, are set by the gateway under the name of
+// the key without its "aws:" prefix, they are never looked up as a header.
 func getValuesByKey(m map[string][]string, key Key) []string {
 	name := key.Name()
+	if global := strings.TrimPrefix(name, "aws:"); global != name {
+		return m[global]
+	}
 	if values, found := m[http.CanonicalHeaderKey(name)]; found {
 		return values
 	}
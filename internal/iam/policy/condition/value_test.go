@@ -39,6 +39,18 @@ func TestValue_getValuesByKey(t *testing.T) {
 			values:         map[string][]string{S3XAmzCopySource.ToKey().Name(): {"object.txt"}},
 			expectedResult: []string{"object.txt"},
 		},
+		{
+			name:           "test3",
+			key:            AWSSecureTransport,
+			values:         map[string][]string{"SecureTransport": {"true"}},
+			expectedResult: []string{"true"},
+		},
+		{
+			name:           "test3",
+			key:            AWSSecureTransport,
+			values:         map[string][]string{"aws:SecureTransport": {"true"}, "Aws:securetransport": {"true"}},
+			expectedResult: []string{},
+		},
 	}
 	for _, testcase := range testCases {
 		t.Run(testcase.name, func(t *testing.T) {
@@ -83,6 +83,30 @@ func (p Policy) IsAllowed(args auth.Args) bool {
 	return false
 }
 
+// IsDenied - checks whether a deny statement explicitly denies given policy args.
+func (p Policy) IsDenied(args auth.Args) bool {
+	for _, statement := range p.Statements {
+		if statement.Effect == Deny && !statement.IsAllowed(args) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchedStatements - returns the statements applying to given policy args,
+// deny statements first, in the order IsAllowed evaluates them.
+func (p Policy) MatchedStatements(args auth.Args) []Statement {
+	var matched []Statement
+	for _, effect := range []Effect{Deny, Allow} {
+		for _, statement := range p.Statements {
+			if statement.Effect == effect && statement.Match(args) {
+				matched = append(matched, statement)
+			}
+		}
+	}
+	return matched
+}
+
 // ParseConfig - parses data in given reader to Policy.
 func ParseConfig(reader io.Reader, bucketName string) (*Policy, error) {
 	var policy Policy
@@ -97,6 +121,32 @@ func ParseConfig(reader io.Reader, bucketName string) (*Policy, error) {
 	return &policy, err
 }
 
+// ParseIdentityPolicy - parses data in given reader to an identity based Policy,
+// such as a role or session policy. Statements without Principal apply to
+// whoever holds the identity.
+func ParseIdentityPolicy(reader io.Reader) (*Policy, error) {
+	var policy Policy
+
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, xerrors.Errorf("%w", err)
+	}
+	if len(policy.Statements) == 0 {
+		return nil, xerrors.Errorf("policy must contain at least one statement")
+	}
+	for i := range policy.Statements {
+		if !policy.Statements[i].Principal.IsValid() {
+			policy.Statements[i].Principal = NewPrincipal("*")
+		}
+	}
+	if policy.Version == "" {
+		policy.Version = DefaultVersion
+	}
+
+	return &policy, policy.isValid()
+}
+
 // Validate - validates all statements are for given bucket or not.
 func (p Policy) Validate(bucketName string) error {
 	if err := p.isValid(); err != nil {
@@ -270,3 +270,51 @@ func TestPolicy_IsAllowed(t *testing.T) {
 		})
 	}
 }
+
+func TestPolicy_MatchedStatements(t *testing.T) {
+	allow := NewStatement("allow", Allow, NewPrincipal("*"), s3action.NewActionSet(s3action.GetObjectAction),
+		NewResourceSet(NewResource("mybucket", "*")), condition.NewConFunctions())
+	deny := NewStatement("deny", Deny, NewPrincipal("test1"), s3action.NewActionSet(s3action.GetObjectAction),
+		NewResourceSet(NewResource("mybucket", "secret/*")), condition.NewConFunctions())
+	p := Policy{Version: DefaultVersion, Statements: []Statement{allow, deny}}
+	tests := []struct {
+		name   string
+		args   auth.Args
+		want   []ID
+		allows bool
+	}{
+		{
+			name:   "allow only",
+			args:   auth.Args{AccountName: "test1", Action: s3action.GetObjectAction, BucketName: "mybucket", ObjectName: "a.txt"},
+			want:   []ID{"allow"},
+			allows: true,
+		},
+		{
+			name:   "deny first",
+			args:   auth.Args{AccountName: "test1", Action: s3action.GetObjectAction, BucketName: "mybucket", ObjectName: "secret/a.txt"},
+			want:   []ID{"deny", "allow"},
+			allows: false,
+		},
+		{
+			name:   "no match",
+			args:   auth.Args{AccountName: "test1", Action: s3action.PutObjectAction, BucketName: "mybucket", ObjectName: "a.txt"},
+			allows: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := p.MatchedStatements(tt.args)
+			if len(got) != len(tt.want) {
+				t.Fatalf("MatchedStatements() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].SID != tt.want[i] {
+					t.Errorf("MatchedStatements()[%d] = %v, want %v", i, got[i].SID, tt.want[i])
+				}
+			}
+			if p.IsAllowed(tt.args) != tt.allows {
+				t.Errorf("IsAllowed() = %v, want %v", !tt.allows, tt.allows)
+			}
+		})
+	}
+}
@@ -102,34 +102,36 @@ func NewStatement(sid ID, effect Effect, principal Principal, actionSet s3action
 
 // IsAllowed - checks given policy args is allowed to continue the Rest API.
 func (statement Statement) IsAllowed(args auth.Args) bool {
-	check := func() bool {
-		if !statement.Principal.Match(args.AccountName) {
-			return false
-		}
+	return statement.Effect.IsAllowed(statement.Match(args))
+}
 
-		if !statement.Actions.Match(args.Action) {
-			return false
-		}
+// Match - returns whether the statement applies to given policy args,
+// regardless of its effect.
+func (statement Statement) Match(args auth.Args) bool {
+	if !statement.Principal.Match(args.AccountName) {
+		return false
+	}
 
-		resource := args.BucketName
-		if args.ObjectName != "" {
-			if !strings.HasPrefix(args.ObjectName, "/") {
-				resource += "/"
-			}
+	if !statement.Actions.Match(args.Action) {
+		return false
+	}
 
-			resource += args.ObjectName
-		} else {
+	resource := args.BucketName
+	if args.ObjectName != "" {
+		if !strings.HasPrefix(args.ObjectName, "/") {
 			resource += "/"
 		}
 
-		// For admin statements, resource match can be ignored.
-		if !statement.Resources.Match(resource, args.Conditions) {
-			return false
-		}
-		return statement.Conditions.Evaluate(args.Conditions)
+		resource += args.ObjectName
+	} else {
+		resource += "/"
+	}
 
+	// For admin statements, resource match can be ignored.
+	if !statement.Resources.Match(resource, args.Conditions) {
+		return false
 	}
-	return statement.Effect.IsAllowed(check())
+	return statement.Conditions.Evaluate(args.Conditions)
 }
 
 // IsValid - checks whether statement is valid or not.
@@ -0,0 +1,42 @@
+package iam
+
+import (
+	"context"
+	"github.com/yann-y/fds/internal/iam/auth"
+	"github.com/yann-y/fds/internal/kv"
+)
+
+// RecordVersion - the layout of the user records written by this version.
+// The records of every version are read alike, msgpack leaves empty the
+// fields a record lacks and skips those it doesn't know, so that the gateways
+// of a rolling upgrade share the records.
+const RecordVersion = 1
+
+// UpgradeRecords - rewrites in tx the user records written with a layout
+// older than RecordVersion from the key after cursor, until tx holds limit
+// writes, their secrets are kept as they are stored. It returns the key of
+// the last record read, or "" once every record is read.
+func UpgradeRecords(ctx context.Context, db *kv.DB, tx *kv.Tx, cursor string, limit int) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	all, err := db.ReadAllChan(ctx, getUserKey(""), cursor)
+	if err != nil {
+		return "", err
+	}
+	for entry := range all {
+		var cred auth.Credentials
+		if err = entry.UnmarshalValue(&cred); err != nil {
+			return "", err
+		}
+		if cred.RecordVersion < RecordVersion {
+			cred.RecordVersion = RecordVersion
+			if err = tx.Put(entry.Key, cred); err != nil {
+				return "", err
+			}
+		}
+		if tx.Len() >= limit {
+			return entry.Key, nil
+		}
+	}
+	return "", ctx.Err()
+}
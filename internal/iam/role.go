@@ -0,0 +1,180 @@
+package iam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/yann-y/fds/internal/iam/policy"
+	"github.com/yann-y/fds/internal/iam/policy/condition"
+	"github.com/yann-y/fds/internal/iam/set"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// AssumeRoleAction - the action a role trust policy grants.
+	AssumeRoleAction = "sts:AssumeRole"
+
+	roleArnPrefix = "arn:aws:iam:::role/"
+
+	// DefaultSTSDuration - expiry of temporary credentials when DurationSeconds is not given.
+	DefaultSTSDuration = time.Hour
+	// DefaultSTSMinDuration - default lower bound of DurationSeconds.
+	DefaultSTSMinDuration = 15 * time.Minute
+	// DefaultSTSMaxDuration - default upper bound of DurationSeconds.
+	DefaultSTSMaxDuration = 12 * time.Hour
+)
+
+var errNoSuchRole = errors.New("specified role does not exist")
+var errInvalidDuration = errors.New("invalid session duration")
+
+// TrustStatement - a statement of a role trust policy.
+type TrustStatement struct {
+	SID        policy.ID            `json:"Sid,omitempty"`
+	Effect     policy.Effect        `json:"Effect"`
+	Principal  policy.Principal     `json:"Principal"`
+	Actions    set.StringSet        `json:"Action"`
+	Conditions condition.Conditions `json:"Condition,omitempty"`
+}
+
+// TrustPolicy - describes which principals are allowed to assume a role.
+type TrustPolicy struct {
+	Version    string           `json:"Version"`
+	Statements []TrustStatement `json:"Statement"`
+}
+
+// Validate - checks whether the trust policy is valid or not.
+func (tp TrustPolicy) Validate() error {
+	if len(tp.Statements) == 0 {
+		return errors.New("trust policy must contain at least one statement")
+	}
+	for _, st := range tp.Statements {
+		if !st.Effect.IsValid() {
+			return fmt.Errorf("invalid Effect %v", st.Effect)
+		}
+		if !st.Principal.IsValid() {
+			return fmt.Errorf("invalid Principal %v", st.Principal)
+		}
+		if st.Actions.IsEmpty() {
+			return errors.New("Action must not be empty")
+		}
+	}
+	return nil
+}
+
+// IsAllowed - checks whether principal may assume the role.
+func (tp TrustPolicy) IsAllowed(principal string, conditions map[string][]string) bool {
+	match := func(st TrustStatement) bool {
+		if !st.Principal.Match(principal) {
+			return false
+		}
+		if st.Actions.FuncMatch(set.MatchSimple, AssumeRoleAction).IsEmpty() {
+			return false
+		}
+		return st.Conditions.Evaluate(conditions)
+	}
+	for _, st := range tp.Statements {
+		if st.Effect == policy.Deny && match(st) {
+			return false
+		}
+	}
+	for _, st := range tp.Statements {
+		if st.Effect == policy.Allow && match(st) {
+			return true
+		}
+	}
+	return false
+}
+
+// Role - a set of permissions that trusted principals can assume with STS.
+type Role struct {
+	RoleName           string         `json:"roleName"`
+	Arn                string         `json:"arn"`
+	TrustPolicy        TrustPolicy    `json:"trustPolicy"`
+	Policy             *policy.Policy `json:"policy,omitempty"`
+	MaxSessionDuration time.Duration  `json:"maxSessionDuration"`
+	CreateDate         time.Time      `json:"createDate"`
+}
+
+// RoleArn - returns the ARN of the role with given name.
+func RoleArn(roleName string) string {
+	return roleArnPrefix + roleName
+}
+
+// RoleNameFromArn - returns the name of the role the ARN refers to.
+func RoleNameFromArn(arn string) (string, bool) {
+	name := strings.TrimPrefix(arn, roleArnPrefix)
+	if name == arn || name == "" {
+		return "", false
+	}
+	return name, true
+}
+
+// CreateRole create or replace a role
+func (sys *IdentityAMSys) CreateRole(ctx context.Context, role Role) error {
+	if err := role.TrustPolicy.Validate(); err != nil {
+		return err
+	}
+	role.Arn = RoleArn(role.RoleName)
+	role.CreateDate = time.Now().UTC()
+	if err := sys.store.saveRole(ctx, role); err != nil {
+		log.Errorf("save Role err:%v", err)
+		return err
+	}
+	return nil
+}
+
+// GetRole get a role
+func (sys *IdentityAMSys) GetRole(ctx context.Context, roleName string) (Role, error) {
+	var role Role
+	if err := sys.store.loadRole(ctx, roleName, &role); err != nil {
+		return role, errNoSuchRole
+	}
+	return role, nil
+}
+
+// GetRoleList all roles
+func (sys *IdentityAMSys) GetRoleList(ctx context.Context) ([]Role, error) {
+	return sys.store.loadRoles(ctx)
+}
+
+// RemoveRole remove a role
+func (sys *IdentityAMSys) RemoveRole(ctx context.Context, roleName string) error {
+	if err := sys.store.removeRole(ctx, roleName); err != nil {
+		log.Errorf("remove Role err:%v", err)
+		return err
+	}
+	return nil
+}
+
+// SetSTSDurationBounds sets the bounds DurationSeconds of STS requests must be within.
+func (sys *IdentityAMSys) SetSTSDurationBounds(min, max time.Duration) {
+	sys.stsMinDuration = min
+	sys.stsMaxDuration = max
+}
+
+// GetSTSDuration returns the expiry of temporary credentials for the requested
+// DurationSeconds, an empty value selects the default duration. maxDuration further
+// limits the upper bound when it is not zero.
+func (sys *IdentityAMSys) GetSTSDuration(durationSeconds string, maxDuration time.Duration) (time.Duration, error) {
+	upper := sys.stsMaxDuration
+	if maxDuration > 0 && maxDuration < upper {
+		upper = maxDuration
+	}
+	if durationSeconds == "" {
+		if DefaultSTSDuration > upper {
+			return upper, nil
+		}
+		return DefaultSTSDuration, nil
+	}
+	n, err := strconv.ParseUint(durationSeconds, 10, 32)
+	if err != nil {
+		return 0, errInvalidDuration
+	}
+	seconds := time.Duration(n) * time.Second
+	if seconds < sys.stsMinDuration || seconds > upper {
+		return 0, fmt.Errorf("DurationSeconds must be between %d and %d", int64(sys.stsMinDuration.Seconds()), int64(upper.Seconds()))
+	}
+	return seconds, nil
+}
@@ -0,0 +1,303 @@
+package iam
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/yann-y/fds/internal/apierrors"
+	"github.com/yann-y/fds/internal/iam/auth"
+	"github.com/yann-y/fds/internal/iam/policy"
+	"github.com/yann-y/fds/internal/iam/s3action"
+	"github.com/yann-y/fds/internal/uleveldb"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTempCred(t *testing.T, parent, roleName string) auth.Credentials {
+	cred, err := auth.GetNewCredentialsWithMetadata(map[string]interface{}{
+		"exp": time.Now().UTC().Add(time.Hour).Unix(),
+	}, auth.DefaultSecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred.ParentUser = parent
+	cred.RoleName = roleName
+	return cred
+}
+
+func mustParseIdentityPolicy(t *testing.T, s string) *policy.Policy {
+	p, err := policy.ParseIdentityPolicy(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestIdentityAMSys_IsAllowedSTS(t *testing.T) {
+	db, _ := uleveldb.OpenDb(t.TempDir())
+	iamSys := NewIdentityAMSys(db)
+	ctx := context.Background()
+
+	// the parent may only read objects of bucket b1
+	if err := iamSys.AddUser(ctx, "parent1", "parent1234"); err != nil {
+		t.Fatal(err)
+	}
+	if err := iamSys.RemoveUserPolicy(ctx, "parent1", "default"); err != nil {
+		t.Fatal(err)
+	}
+	readOnly := policy.CreateUserPolicy("parent1", []s3action.Action{s3action.GetObjectAction}, "b1")
+	if err := iamSys.UpdateUserPolicy(ctx, "parent1", "read", readOnly); err != nil {
+		t.Fatal(err)
+	}
+
+	var trust TrustPolicy
+	if err := json.Unmarshal([]byte(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":["parent1"]},"Action":"sts:AssumeRole"}]}`), &trust); err != nil {
+		t.Fatal(err)
+	}
+	err := iamSys.CreateRole(ctx, Role{
+		RoleName:    "writer",
+		TrustPolicy: trust,
+		Policy:      mustParseIdentityPolicy(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:PutObject"],"Resource":["arn:aws:s3:::b1/*"]}]}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name          string
+		roleName      string
+		sessionPolicy string
+		action        s3action.Action
+		expected      bool
+	}{
+		{name: "inherit parent allow", action: s3action.GetObjectAction, expected: true},
+		{name: "inherit parent deny", action: s3action.PutObjectAction, expected: false},
+		{
+			name:          "session policy can not exceed parent",
+			sessionPolicy: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:*"],"Resource":["arn:aws:s3:::*"]}]}`,
+			action:        s3action.PutObjectAction,
+			expected:      false,
+		},
+		{
+			name:          "session policy restricts parent",
+			sessionPolicy: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:PutObject"],"Resource":["arn:aws:s3:::b1/*"]}]}`,
+			action:        s3action.GetObjectAction,
+			expected:      false,
+		},
+		{name: "role allow", roleName: "writer", action: s3action.PutObjectAction, expected: true},
+		{name: "role deny", roleName: "writer", action: s3action.GetObjectAction, expected: false},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			cred := newTempCred(t, "parent1", testCase.roleName)
+			var sessionPolicy *policy.Policy
+			if testCase.sessionPolicy != "" {
+				sessionPolicy = mustParseIdentityPolicy(t, testCase.sessionPolicy)
+			}
+			if err := iamSys.SetTempUser(ctx, cred.AccessKey, cred, sessionPolicy); err != nil {
+				t.Fatal(err)
+			}
+			got := iamSys.IsAllowed(ctx, auth.Args{
+				AccountName: cred.AccessKey,
+				Action:      testCase.action,
+				BucketName:  "b1",
+				ObjectName:  "a.txt",
+			})
+			if got != testCase.expected {
+				t.Fatalf("Expected IsAllowed to be %v, but instead found %v", testCase.expected, got)
+			}
+		})
+	}
+
+	// sessions stop working once the parent is disabled
+	cred := newTempCred(t, "parent1", "")
+	if err = iamSys.SetTempUser(ctx, cred.AccessKey, cred, nil); err != nil {
+		t.Fatal(err)
+	}
+	parent, _ := iamSys.GetUser(ctx, "parent1")
+	parent.Status = auth.AccountOff
+	if err = iamSys.UpdateUser(ctx, parent); err != nil {
+		t.Fatal(err)
+	}
+	if iamSys.IsAllowed(ctx, auth.Args{AccountName: cred.AccessKey, Action: s3action.GetObjectAction, BucketName: "b1", ObjectName: "a.txt"}) {
+		t.Fatal("Expected session of a disabled parent to be denied")
+	}
+}
+
+func TestAuthSys_CheckAccessSTS(t *testing.T) {
+	db, _ := uleveldb.OpenDb(t.TempDir())
+	cred, err := auth.CreateCredentials(auth.DefaultAccessKey, auth.DefaultSecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewAuthSys(db, cred)
+	ctx := context.Background()
+
+	// the parent owns bucket b1, the role may read the objects of b2
+	if err = s.Iam.AddUser(ctx, "parent1", "parent1234"); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.PolicySys.bmSys.CreateBucket(ctx, "b1", "", "parent1", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.PolicySys.bmSys.CreateBucket(ctx, "b2", "", "other1", ""); err != nil {
+		t.Fatal(err)
+	}
+	var trust TrustPolicy
+	if err = json.Unmarshal([]byte(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":["parent1"]},"Action":"sts:AssumeRole"}]}`), &trust); err != nil {
+		t.Fatal(err)
+	}
+	err = s.Iam.CreateRole(ctx, Role{
+		RoleName:    "reader",
+		TrustPolicy: trust,
+		Policy:      mustParseIdentityPolicy(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:GetObject"],"Resource":["arn:aws:s3:::b2/*"]}]}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name          string
+		roleName      string
+		sessionPolicy string
+		action        s3action.Action
+		bucket        string
+		expected      apierrors.ErrorCode
+	}{
+		{name: "parent owns the bucket", action: s3action.GetObjectAction, bucket: "b1", expected: apierrors.ErrNone},
+		{name: "parent does not own the bucket", action: s3action.GetObjectAction, bucket: "b2", expected: apierrors.ErrAccessDenied},
+		{
+			name:          "session policy denies an action of the parent",
+			sessionPolicy: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:PutObject"],"Resource":["arn:aws:s3:::b1/*"]}]}`,
+			action:        s3action.GetObjectAction,
+			bucket:        "b1",
+			expected:      apierrors.ErrAccessDenied,
+		},
+		{
+			name:          "session policy allows an action of the parent",
+			sessionPolicy: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:PutObject"],"Resource":["arn:aws:s3:::b1/*"]}]}`,
+			action:        s3action.PutObjectAction,
+			bucket:        "b1",
+			expected:      apierrors.ErrNone,
+		},
+		{name: "role allows", roleName: "reader", action: s3action.GetObjectAction, bucket: "b2", expected: apierrors.ErrNone},
+		{name: "role denies", roleName: "reader", action: s3action.PutObjectAction, bucket: "b2", expected: apierrors.ErrAccessDenied},
+		{name: "role ignores the parent buckets", roleName: "reader", action: s3action.GetObjectAction, bucket: "b1", expected: apierrors.ErrAccessDenied},
+		{name: "no such bucket", action: s3action.GetObjectAction, bucket: "b3", expected: apierrors.ErrNoSuchBucket},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			tempCred := newTempCred(t, "parent1", testCase.roleName)
+			var sessionPolicy *policy.Policy
+			if testCase.sessionPolicy != "" {
+				sessionPolicy = mustParseIdentityPolicy(t, testCase.sessionPolicy)
+			}
+			if err := s.Iam.SetTempUser(ctx, tempCred.AccessKey, tempCred, sessionPolicy); err != nil {
+				t.Fatal(err)
+			}
+			args := auth.Args{
+				AccountName: tempCred.AccessKey,
+				Action:      testCase.action,
+				BucketName:  testCase.bucket,
+				ObjectName:  "a.txt",
+			}
+			if got := s.checkAccess(ctx, args, nil); got != testCase.expected {
+				t.Fatalf("Expected %v, but instead found %v", testCase.expected, got)
+			}
+			trace := s.SimulateAccess(ctx, args)
+			if trace.Allowed != (testCase.expected == apierrors.ErrNone) {
+				t.Fatalf("Expected the simulation to allow %v, but instead found %v", testCase.expected == apierrors.ErrNone, trace.Allowed)
+			}
+			if trace.Allowed && trace.Decision != DecisionSTS {
+				t.Fatalf("Expected the decision %s, but instead found %s", DecisionSTS, trace.Decision)
+			}
+		})
+	}
+}
+
+func TestTrustPolicy_IsAllowed(t *testing.T) {
+	var trust TrustPolicy
+	err := json.Unmarshal([]byte(`{"Version":"2012-10-17","Statement":[
+		{"Effect":"Allow","Principal":{"AWS":["user*"]},"Action":["sts:*"]},
+		{"Effect":"Deny","Principal":{"AWS":["user2"]},"Action":"sts:AssumeRole"}]}`), &trust)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = trust.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		principal string
+		expected  bool
+	}{
+		{principal: "user1", expected: true},
+		{principal: "user2", expected: false},
+		{principal: "admin", expected: false},
+	}
+	for i, testCase := range testCases {
+		if got := trust.IsAllowed(testCase.principal, nil); got != testCase.expected {
+			t.Fatalf("Case %d: Expected %v, but instead found %v", i+1, testCase.expected, got)
+		}
+	}
+}
+
+func TestIdentityAMSys_GetSTSDuration(t *testing.T) {
+	db, _ := uleveldb.OpenDb(t.TempDir())
+	iamSys := NewIdentityAMSys(db)
+	iamSys.SetSTSDurationBounds(15*time.Minute, 2*time.Hour)
+	testCases := []struct {
+		durationSeconds string
+		maxDuration     time.Duration
+		expected        time.Duration
+		expectedErr     bool
+	}{
+		{durationSeconds: "", expected: DefaultSTSDuration},
+		{durationSeconds: "", maxDuration: 30 * time.Minute, expected: 30 * time.Minute},
+		{durationSeconds: "900", expected: 15 * time.Minute},
+		{durationSeconds: "7200", expected: 2 * time.Hour},
+		{durationSeconds: "7201", expectedErr: true},
+		{durationSeconds: "3600", maxDuration: 30 * time.Minute, expectedErr: true},
+		{durationSeconds: "899", expectedErr: true},
+		{durationSeconds: "-1", expectedErr: true},
+		{durationSeconds: "1h", expectedErr: true},
+	}
+	for i, testCase := range testCases {
+		got, err := iamSys.GetSTSDuration(testCase.durationSeconds, testCase.maxDuration)
+		if (err != nil) != testCase.expectedErr {
+			t.Fatalf("Case %d: Expected error %v, but instead found %v", i+1, testCase.expectedErr, err)
+		}
+		if err == nil && got != testCase.expected {
+			t.Fatalf("Case %d: Expected %v, but instead found %v", i+1, testCase.expected, got)
+		}
+	}
+}
+
+func TestIdentityAMSys_IsAllowedFederated(t *testing.T) {
+	db, _ := uleveldb.OpenDb(t.TempDir())
+	iamSys := NewIdentityAMSys(db)
+	ctx := context.Background()
+
+	cred := newTempCred(t, FederatedUser("alice"), "")
+	identityPolicy := mustParseIdentityPolicy(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:GetObject"],"Resource":["arn:aws:s3:::b1/*"]}]}`)
+	if err := iamSys.SetFederatedTempUser(ctx, cred, identityPolicy, nil); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		action   s3action.Action
+		expected bool
+	}{
+		{action: s3action.GetObjectAction, expected: true},
+		{action: s3action.PutObjectAction, expected: false},
+	}
+	for i, testCase := range testCases {
+		got := iamSys.IsAllowed(ctx, auth.Args{AccountName: cred.AccessKey, Action: testCase.action, BucketName: "b1", ObjectName: "a.txt"})
+		if got != testCase.expected {
+			t.Fatalf("Case %d: Expected %v, but instead found %v", i+1, testCase.expected, got)
+		}
+	}
+
+	// regular users can't receive federated credentials
+	if err := iamSys.SetFederatedTempUser(ctx, newTempCred(t, "parent1", ""), identityPolicy, nil); err == nil {
+		t.Fatal("Expected error for a non federated parent")
+	}
+}
@@ -165,6 +165,39 @@ const (
 	// RestoreObjectAction - RestoreObject REST API action
 	RestoreObjectAction = "s3:RestoreObject"
 
+	// GetBucketAclAction - GetBucketAcl REST API action
+	GetBucketAclAction = "s3:GetBucketAcl"
+
+	// PutBucketAclAction - PutBucketAcl REST API action
+	PutBucketAclAction = "s3:PutBucketAcl"
+
+	// GetObjectAclAction - GetObjectAcl REST API action
+	GetObjectAclAction = "s3:GetObjectAcl"
+
+	// PutObjectAclAction - PutObjectAcl REST API action
+	PutObjectAclAction = "s3:PutObjectAcl"
+
+	// GetBucketOwnershipControlsAction - GetBucketOwnershipControls REST API action
+	GetBucketOwnershipControlsAction = "s3:GetBucketOwnershipControls"
+
+	// PutBucketOwnershipControlsAction - PutBucketOwnershipControls and DeleteBucketOwnershipControls REST API action
+	PutBucketOwnershipControlsAction = "s3:PutBucketOwnershipControls"
+
+	// GetBucketCorsAction - GetBucketCors REST API action
+	GetBucketCorsAction = "s3:GetBucketCORS"
+
+	// PutBucketCorsAction - PutBucketCors and DeleteBucketCors REST API action
+	PutBucketCorsAction = "s3:PutBucketCORS"
+
+	// GetBucketWebsiteAction - GetBucketWebsite REST API action
+	GetBucketWebsiteAction = "s3:GetBucketWebsite"
+
+	// PutBucketWebsiteAction - PutBucketWebsite REST API action
+	PutBucketWebsiteAction = "s3:PutBucketWebsite"
+
+	// DeleteBucketWebsiteAction - DeleteBucketWebsite REST API action
+	DeleteBucketWebsiteAction = "s3:DeleteBucketWebsite"
+
 	// AllActions - all API actions
 	AllActions = "s3:*"
 )
@@ -222,6 +255,17 @@ var SupportedActions = map[Action]struct{}{
 	ReplicateDeleteAction:                  {},
 	ReplicateTagsAction:                    {},
 	GetObjectVersionForReplicationAction:   {},
+	GetBucketAclAction:                     {},
+	PutBucketAclAction:                     {},
+	GetObjectAclAction:                     {},
+	PutObjectAclAction:                     {},
+	GetBucketOwnershipControlsAction:       {},
+	PutBucketOwnershipControlsAction:       {},
+	GetBucketCorsAction:                    {},
+	PutBucketCorsAction:                    {},
+	GetBucketWebsiteAction:                 {},
+	PutBucketWebsiteAction:                 {},
+	DeleteBucketWebsiteAction:              {},
 	AllActions:                             {},
 }
 
@@ -255,6 +299,8 @@ var supportedObjectActions = map[Action]struct{}{
 	GetObjectTaggingAction:    {},
 	PutObjectTaggingAction:    {},
 	DeleteObjectTaggingAction: {},
+	GetObjectAclAction:        {},
+	PutObjectAclAction:        {},
 	//GetObjectVersionAction:               {},
 	//GetObjectVersionTaggingAction:        {},
 	//DeleteObjectVersionAction:            {},
@@ -411,6 +457,17 @@ func createActionConditionKeyMap() map[Action]condition.KeySet {
 		ReplicateTagsAction:                  condition.NewKeySet(commonKeys...),
 		GetObjectVersionForReplicationAction: condition.NewKeySet(commonKeys...),
 		RestoreObjectAction:                  condition.NewKeySet(commonKeys...),
+		GetBucketAclAction:                   condition.NewKeySet(commonKeys...),
+		PutBucketAclAction:                   condition.NewKeySet(commonKeys...),
+		GetObjectAclAction:                   condition.NewKeySet(commonKeys...),
+		PutObjectAclAction:                   condition.NewKeySet(commonKeys...),
+		GetBucketOwnershipControlsAction:     condition.NewKeySet(commonKeys...),
+		PutBucketOwnershipControlsAction:     condition.NewKeySet(commonKeys...),
+		GetBucketCorsAction:                  condition.NewKeySet(commonKeys...),
+		PutBucketCorsAction:                  condition.NewKeySet(commonKeys...),
+		GetBucketWebsiteAction:               condition.NewKeySet(commonKeys...),
+		PutBucketWebsiteAction:               condition.NewKeySet(commonKeys...),
+		DeleteBucketWebsiteAction:            condition.NewKeySet(commonKeys...),
 	}
 }
 
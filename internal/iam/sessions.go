@@ -0,0 +1,145 @@
+package iam
+
+import (
+	"context"
+	"errors"
+	"github.com/yann-y/fds/internal/iam/auth"
+	"sort"
+	"time"
+)
+
+// DefaultSessionCleanupInterval - default interval expired STS credentials are removed at.
+const DefaultSessionCleanupInterval = 10 * time.Minute
+
+var errNoSuchSession = errors.New("specified session does not exist")
+
+// SessionInfo - describes an STS session, secrets are left out.
+type SessionInfo struct {
+	AccessKey  string    `json:"accessKey"`
+	ParentUser string    `json:"parentUser"`
+	RoleName   string    `json:"roleName,omitempty"`
+	Expiration time.Time `json:"expiration"`
+}
+
+// ListSessions returns the active sessions of parentUser, or of all users
+// when parentUser is empty, ordered by expiration.
+func (sys *IdentityAMSys) ListSessions(ctx context.Context, parentUser string) ([]SessionInfo, error) {
+	users, err := sys.store.loadUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]SessionInfo, 0)
+	for _, cred := range users {
+		if !cred.IsTemp() || cred.IsExpired() {
+			continue
+		}
+		if parentUser != "" && cred.ParentUser != parentUser {
+			continue
+		}
+		sessions = append(sessions, SessionInfo{
+			AccessKey:  cred.AccessKey,
+			ParentUser: cred.ParentUser,
+			RoleName:   cred.RoleName,
+			Expiration: cred.Expiration,
+		})
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Expiration.Before(sessions[j].Expiration)
+	})
+	return sessions, nil
+}
+
+// GetSession returns the session of the temporary access key.
+func (sys *IdentityAMSys) GetSession(ctx context.Context, accessKey string) (SessionInfo, error) {
+	var cred auth.Credentials
+	if err := sys.store.loadUser(ctx, accessKey, &cred); err != nil || !cred.IsTemp() || cred.IsExpired() {
+		return SessionInfo{}, errNoSuchSession
+	}
+	return SessionInfo{
+		AccessKey:  cred.AccessKey,
+		ParentUser: cred.ParentUser,
+		RoleName:   cred.RoleName,
+		Expiration: cred.Expiration,
+	}, nil
+}
+
+// RevokeSession removes the temporary access key and its policies.
+func (sys *IdentityAMSys) RevokeSession(ctx context.Context, accessKey string) error {
+	var cred auth.Credentials
+	if err := sys.store.loadUser(ctx, accessKey, &cred); err != nil || !cred.IsTemp() {
+		return errNoSuchSession
+	}
+	return sys.removeTempUser(ctx, accessKey)
+}
+
+// RevokeSessions removes all temporary access keys derived from parentUser,
+// and returns how many were removed.
+func (sys *IdentityAMSys) RevokeSessions(ctx context.Context, parentUser string) (int, error) {
+	if parentUser == "" {
+		return 0, errInvalidArgument
+	}
+	users, err := sys.store.loadUsers(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, cred := range users {
+		if !cred.IsTemp() || cred.ParentUser != parentUser {
+			continue
+		}
+		if err = sys.removeTempUser(ctx, cred.AccessKey); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// RemoveExpiredSessions removes the expired temporary access keys and their
+// policies, and returns how many were removed.
+func (sys *IdentityAMSys) RemoveExpiredSessions(ctx context.Context) (int, error) {
+	users, err := sys.store.loadUsers(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, cred := range users {
+		if !cred.IsTemp() || !cred.IsExpired() {
+			continue
+		}
+		if err = sys.removeTempUser(ctx, cred.AccessKey); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// StartSessionReaper removes expired temporary access keys every interval
+// until ctx is done.
+func (sys *IdentityAMSys) StartSessionReaper(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				n, err := sys.RemoveExpiredSessions(ctx)
+				if err != nil {
+					log.Errorf("remove expired sessions err:%v", err)
+					continue
+				}
+				if n > 0 {
+					log.Infof("removed %d expired sessions", n)
+				}
+			}
+		}
+	}()
+}
+
+// removeTempUser removes the temporary access key along with its policies.
+func (sys *IdentityAMSys) removeTempUser(ctx context.Context, accessKey string) error {
+	return sys.store.removeUser(ctx, accessKey)
+}
@@ -0,0 +1,96 @@
+package iam
+
+import (
+	"context"
+	"github.com/yann-y/fds/internal/iam/auth"
+	"github.com/yann-y/fds/internal/uleveldb"
+	"testing"
+	"time"
+)
+
+func TestIdentityAMSys_Sessions(t *testing.T) {
+	db, _ := uleveldb.OpenDb(t.TempDir())
+	iamSys := NewIdentityAMSys(db)
+	ctx := context.Background()
+
+	for _, user := range []string{"parent1", "parent2"} {
+		if err := iamSys.AddUser(ctx, user, user+"1234"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sessionPolicy := mustParseIdentityPolicy(t, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:GetObject"],"Resource":["arn:aws:s3:::b1/*"]}]}`)
+	active1 := newTempCred(t, "parent1", "")
+	active2 := newTempCred(t, "parent1", "")
+	other := newTempCred(t, "parent2", "")
+	for _, cred := range []auth.Credentials{active1, active2, other} {
+		if err := iamSys.SetTempUser(ctx, cred.AccessKey, cred, sessionPolicy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expired := newTempCred(t, "parent1", "")
+	expired.Expiration = time.Now().UTC().Add(-time.Minute)
+	if err := iamSys.store.saveUserIdentity(ctx, newUserIdentity(expired)); err != nil {
+		t.Fatal(err)
+	}
+	if err := iamSys.UpdateUserPolicy(ctx, expired.AccessKey, sessionPolicyName, sessionPolicy); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := iamSys.ListSessions(ctx, "parent1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("Expected 2 active sessions of parent1, but instead found %d", len(sessions))
+	}
+	if sessions, _ = iamSys.ListSessions(ctx, ""); len(sessions) != 3 {
+		t.Fatalf("Expected 3 active sessions, but instead found %d", len(sessions))
+	}
+
+	// the reaper removes the expired identity together with its policies
+	n, err := iamSys.RemoveExpiredSessions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("Expected 1 expired session to be removed, but instead found %d", n)
+	}
+	var cred auth.Credentials
+	if err = iamSys.store.loadUser(ctx, expired.AccessKey, &cred); err == nil {
+		t.Fatal("Expected expired identity to be removed")
+	}
+	if keys, _ := iamSys.GetUserPolices(ctx, expired.AccessKey); len(keys) != 0 {
+		t.Fatalf("Expected policies of expired identity to be removed, but instead found %v", keys)
+	}
+
+	if err = iamSys.RevokeSession(ctx, active1.AccessKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := iamSys.GetUser(ctx, active1.AccessKey); ok {
+		t.Fatal("Expected revoked session to be removed")
+	}
+	if err = iamSys.RevokeSession(ctx, "parent1"); err == nil {
+		t.Fatal("Expected regular users not to be revoked as sessions")
+	}
+
+	// disabling a parent revokes its sessions
+	parent, _ := iamSys.GetUser(ctx, "parent1")
+	parent.Status = auth.AccountOff
+	if err = iamSys.UpdateUser(ctx, parent); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := iamSys.GetUser(ctx, active2.AccessKey); ok {
+		t.Fatal("Expected sessions of a disabled parent to be removed")
+	}
+	if _, ok := iamSys.GetUser(ctx, other.AccessKey); !ok {
+		t.Fatal("Expected sessions of other parents to be kept")
+	}
+
+	// removing a parent revokes its sessions
+	if err = iamSys.RemoveUser(ctx, "parent2"); err != nil {
+		t.Fatal(err)
+	}
+	if sessions, _ = iamSys.ListSessions(ctx, ""); len(sessions) != 0 {
+		t.Fatalf("Expected no active sessions, but instead found %d", len(sessions))
+	}
+}
@@ -26,7 +26,7 @@ import (
 	"github.com/yann-y/fds/internal/apierrors"
 	"github.com/yann-y/fds/internal/consts"
 	"github.com/yann-y/fds/internal/iam/auth"
-	"net"
+	"github.com/yann-y/fds/internal/utils"
 	"net/http"
 	"net/url"
 	"sort"
@@ -173,7 +173,7 @@ func (s *AuthSys) doesPresignV2SignatureMatch(r *http.Request) apierrors.ErrorCo
 		return apierrors.ErrExpiredPresignRequest
 	}
 
-	encodedResource, err = getResource(encodedResource, r.Host)
+	encodedResource, err = getResource(encodedResource, r.Host, s.domains)
 	if err != nil {
 		return apierrors.ErrInvalidRequest
 	}
@@ -269,7 +269,7 @@ func (s *AuthSys) doesSignV2Match(r *http.Request) apierrors.ErrorCode {
 		return apierrors.ErrInvalidQueryParams
 	}
 
-	encodedResource, err = getResource(encodedResource, r.Host)
+	encodedResource, err = getResource(encodedResource, r.Host, s.domains)
 	if err != nil {
 		return apierrors.ErrInvalidRequest
 	}
@@ -415,15 +415,10 @@ func getStringToSignV2(method string, encodedResource, encodedQuery string, head
 }
 
 // Returns "/bucketName/objectName" for path-style or virtual-host-style requests.
-func getResource(path string, host string) (string, error) {
-
+func getResource(path string, host string, domains []string) (string, error) {
 	// If virtual-host-style is enabled construct the "resource" properly.
-	if strings.Contains(host, ":") {
-		// In bucket.mydomain.com:9000, strip out :9000
-		var err error
-		if host, _, err = net.SplitHostPort(host); err != nil {
-			return "", err
-		}
+	if bucket, ok := utils.BucketFromHost(host, domains); ok {
+		return consts.SlashSeparator + bucket + path, nil
 	}
 	return path, nil
 }
@@ -0,0 +1,76 @@
+package iam
+
+import (
+	"github.com/yann-y/fds/internal/apierrors"
+	"github.com/yann-y/fds/internal/consts"
+	"github.com/yann-y/fds/internal/iam/auth"
+	"github.com/yann-y/fds/internal/uleveldb"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGetResource(t *testing.T) {
+	domains := []string{"s3.example.com"}
+	testCases := []struct {
+		path     string
+		host     string
+		domains  []string
+		expected string
+	}{
+		{"/bucket/object", "s3.example.com", domains, "/bucket/object"},
+		{"/object", "bucket.s3.example.com", domains, "/bucket/object"},
+		{"/object", "bucket.s3.example.com:9000", domains, "/bucket/object"},
+		{"/", "bucket.s3.example.com", domains, "/bucket/"},
+		{"/object", "bucket.s3.example.com", nil, "/object"},
+	}
+	for i, testCase := range testCases {
+		resource, err := getResource(testCase.path, testCase.host, testCase.domains)
+		if err != nil {
+			t.Fatalf("Test %d: %v", i+1, err)
+		}
+		if resource != testCase.expected {
+			t.Errorf("Test %d: Expected %s, got %s", i+1, testCase.expected, resource)
+		}
+	}
+}
+
+func TestDoesSignV2MatchVirtualHost(t *testing.T) {
+	db, _ := uleveldb.OpenDb(t.TempDir())
+	cred, err := auth.CreateCredentials(auth.DefaultAccessKey, auth.DefaultSecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authSys := NewAuthSys(db, cred)
+
+	newRequest := func(url, resource string) *http.Request {
+		r, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// r.RequestURI is set by the server for incoming requests.
+		r.RequestURI = r.URL.RequestURI()
+		r.Header.Set(consts.Date, time.Now().UTC().Format(http.TimeFormat))
+		r.Header.Set(consts.Authorization, signV2Algorithm+" "+cred.AccessKey+":"+signatureV2(cred, r.Method, resource, "", r.Header))
+		return r
+	}
+
+	testCases := []struct {
+		name     string
+		domains  []string
+		request  *http.Request
+		expected apierrors.ErrorCode
+	}{
+		{"path-style", nil, newRequest("http://s3.example.com/bucket/object", "/bucket/object"), apierrors.ErrNone},
+		{"virtual-host", []string{"s3.example.com"}, newRequest("http://bucket.s3.example.com:9000/object", "/bucket/object"), apierrors.ErrNone},
+		{"unknown domain", nil, newRequest("http://bucket.s3.example.com/object", "/bucket/object"), apierrors.ErrSignatureDoesNotMatch},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			authSys.SetDomains(testCase.domains)
+			if s3Err := authSys.doesSignV2Match(testCase.request); s3Err != testCase.expected {
+				t.Fatalf("Expected %v, but instead found %v", testCase.expected, s3Err)
+			}
+		})
+	}
+}
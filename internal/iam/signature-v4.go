@@ -21,6 +21,7 @@ import (
 	"crypto/subtle"
 	"github.com/yann-y/fds/internal/apierrors"
 	"github.com/yann-y/fds/internal/consts"
+	"github.com/yann-y/fds/internal/iam/auth"
 	"github.com/yann-y/fds/internal/iam/set"
 	"github.com/yann-y/fds/internal/utils"
 	"net/http"
@@ -54,6 +55,41 @@ func compareSignatureV4(sig1, sig2 string) bool {
 	return subtle.ConstantTimeCompare([]byte(sig1), []byte(sig2)) == 1
 }
 
+// doesPolicySignatureV4Match - Verify query headers with post policy
+//   - http://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-HTTPPOSTConstructPolicy.html
+//
+// returns apierrors.ErrNone if the signature matches.
+func (s *AuthSys) doesPolicySignatureV4Match(formValues http.Header) (auth.Credentials, apierrors.ErrorCode) {
+	// Server region.
+	region := ""
+
+	// Parse credential tag.
+	credHeader, s3Err := parseCredentialHeader("Credential="+formValues.Get(consts.AmzCredential), region, ServiceS3)
+	if s3Err != apierrors.ErrNone {
+		return auth.Credentials{}, s3Err
+	}
+
+	r := &http.Request{Header: formValues}
+	cred, _, s3Err := s.checkKeyValid(r, credHeader.accessKey)
+	if s3Err != apierrors.ErrNone {
+		return cred, s3Err
+	}
+
+	// Get signing key.
+	signingKey := utils.GetSigningKey(cred.SecretKey, credHeader.scope.date, credHeader.scope.region, string(ServiceS3))
+
+	// Get signature.
+	newSignature := utils.GetSignature(signingKey, formValues.Get("Policy"))
+
+	// Verify signature.
+	if !compareSignatureV4(newSignature, formValues.Get(consts.AmzSignature)) {
+		return cred, apierrors.ErrSignatureDoesNotMatch
+	}
+
+	// Success.
+	return cred, apierrors.ErrNone
+}
+
 // doesPresignedSignatureMatch - Verify query headers with presigned signature
 //   - http://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-query-string-auth.html
 //
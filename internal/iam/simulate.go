@@ -0,0 +1,170 @@
+package iam
+
+import (
+	"context"
+	"github.com/yann-y/fds/internal/apierrors"
+	"github.com/yann-y/fds/internal/iam/auth"
+	"github.com/yann-y/fds/internal/iam/policy"
+	"github.com/yann-y/fds/internal/iam/s3action"
+)
+
+// Sources of the statements reported in an AccessTrace.
+const (
+	SourceBucketPolicy = "bucket-policy"
+	SourceBucketACL    = "bucket-acl"
+	SourceUserPolicy   = "user-policy"
+	SourceRolePolicy   = "role-policy"
+	// SourceSessionPolicy - the inline policy given when the temporary credential was issued.
+	SourceSessionPolicy = "session-policy"
+	// SourceFederatedPolicy - the policy mapped from the claims of an external identity.
+	SourceFederatedPolicy = "federated-policy"
+)
+
+// Decisions reported in an AccessTrace.
+const (
+	DecisionOwner        = "owner"
+	DecisionBucketPolicy = "bucket-policy"
+	DecisionACLGrant     = "acl-grant"
+	DecisionUserPolicy   = "user-policy"
+	DecisionSTS          = "sts"
+	DecisionExplicitDeny = "explicit-deny"
+	DecisionImplicitDeny = "implicit-deny"
+	DecisionNoSuchBucket = "no-such-bucket"
+)
+
+// TraceStatement is a policy statement matching the evaluated request.
+type TraceStatement struct {
+	Source string `json:"source"`
+	// Name is the bucket name for bucket sources, the policy name for user policies.
+	Name      string           `json:"name"`
+	User      string           `json:"user,omitempty"`
+	Action    s3action.Action  `json:"action"`
+	Statement policy.Statement `json:"statement"`
+}
+
+// AccessTrace is the result of evaluating a request against bucket policy,
+// bucket ACL and IAM policies, together with the statements that matched.
+type AccessTrace struct {
+	AccountName string           `json:"accountName"`
+	ParentUser  string           `json:"parentUser,omitempty"`
+	Action      s3action.Action  `json:"action"`
+	Bucket      string           `json:"bucket,omitempty"`
+	Object      string           `json:"object,omitempty"`
+	Allowed     bool             `json:"allowed"`
+	Decision    string           `json:"decision"`
+	Statements  []TraceStatement `json:"statements"`
+}
+
+// SimulateAccess evaluates args through the same path as
+// CheckRequestAuthTypeCredential does for an authenticated request,
+// and reports the decision and the statements that led to it.
+func (s *AuthSys) SimulateAccess(ctx context.Context, args auth.Args) AccessTrace {
+	trace := AccessTrace{
+		AccountName: args.AccountName,
+		Action:      args.Action,
+		Bucket:      args.BucketName,
+		Object:      args.ObjectName,
+		Statements:  []TraceStatement{},
+	}
+	s3Err := s.checkAccess(ctx, args, &trace)
+	trace.Allowed = s3Err == apierrors.ErrNone
+	switch {
+	case trace.Allowed:
+	case s3Err == apierrors.ErrNoSuchBucket:
+		trace.Decision = DecisionNoSuchBucket
+	case trace.hasDeny():
+		trace.Decision = DecisionExplicitDeny
+	default:
+		trace.Decision = DecisionImplicitDeny
+	}
+	return trace
+}
+
+func (t *AccessTrace) setDecision(decision string) {
+	if t != nil {
+		t.Decision = decision
+	}
+}
+
+func (t *AccessTrace) hasDeny() bool {
+	for _, st := range t.Statements {
+		if st.Statement.Effect == policy.Deny {
+			return true
+		}
+	}
+	return false
+}
+
+// traceBucketPolicy records the bucket policy statements matching args.
+// Statements generated from the canned bucket ACL are reported as such.
+func (s *AuthSys) traceBucketPolicy(ctx context.Context, args auth.Args, trace *AccessTrace) {
+	if trace == nil || args.BucketName == "" {
+		return
+	}
+	meta, err := s.PolicySys.bmSys.GetBucketMeta(ctx, args.BucketName)
+	if err != nil || meta.PolicyConfig == nil {
+		return
+	}
+	aclPolicy := policy.CreateBucketPolicy(meta.Name, meta.Owner, meta.Acl)
+	for _, st := range meta.PolicyConfig.MatchedStatements(args) {
+		source := SourceBucketPolicy
+		for _, aclSt := range aclPolicy.Statements {
+			if st.Equals(aclSt) {
+				source = SourceBucketACL
+				break
+			}
+		}
+		trace.addStatements(source, args.BucketName, "", args, []policy.Statement{st})
+	}
+}
+
+// traceUserPolicy records the IAM policy statements matching args. For
+// temporary credentials the policies of the assumed role or of the parent
+// user are recorded too, as the session can not exceed them.
+func (s *AuthSys) traceUserPolicy(ctx context.Context, args auth.Args, trace *AccessTrace) {
+	if trace == nil || args.AccountName == "" || args.IsOwner {
+		return
+	}
+	cred, err := s.Iam.GetUserInfo(ctx, args.AccountName)
+	if err != nil {
+		return
+	}
+	if cred.IsTemp() {
+		trace.ParentUser = cred.ParentUser
+		if cred.RoleName != "" {
+			if role, err := s.Iam.GetRole(ctx, cred.RoleName); err == nil && role.Policy != nil {
+				trace.addStatements(SourceRolePolicy, cred.RoleName, "", args, role.Policy.MatchedStatements(args))
+			}
+		} else if cred.ParentUser != s.AdminCred.AccessKey && !IsFederatedUser(cred.ParentUser) {
+			parentArgs := args
+			parentArgs.AccountName = cred.ParentUser
+			s.traceUserPolicy(ctx, parentArgs, trace)
+			trace.ParentUser = cred.ParentUser
+		}
+	}
+	ps, names, err := s.Iam.store.loadUserAllPolicies(ctx, args.AccountName)
+	if err != nil {
+		return
+	}
+	for i, p := range ps {
+		source := SourceUserPolicy
+		if cred.IsTemp() && names[i] == sessionPolicyName {
+			source = SourceSessionPolicy
+		} else if cred.IsTemp() && names[i] == federatedPolicyName {
+			source = SourceFederatedPolicy
+		}
+		trace.addStatements(source, names[i], args.AccountName, args, p.MatchedStatements(args))
+	}
+}
+
+func (t *AccessTrace) addStatements(source, name, user string, args auth.Args, statements []policy.Statement) {
+	for _, st := range statements {
+		t.Statements = append(t.Statements, TraceStatement{
+			Source:    source,
+			Name:      name,
+			User:      user,
+			Action:    args.Action,
+			Statement: st,
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/yann-y/fds/internal/iam"
 	"github.com/yann-y/fds/internal/response"
+	"github.com/yann-y/fds/internal/store"
 	"net/http"
 )
 
@@ -12,15 +13,20 @@ var log = logging.Logger("iamsever")
 
 // iamApiServer the IamApi Server
 type iamApiServer struct {
-	authSys   *iam.AuthSys
-	cleanData func(accessKey string)
+	authSys *iam.AuthSys
+	// purger deletes the buckets of the removed users, nil keeps them
+	purger *store.BucketPurger
+	// quotaSys keeps the quotas and the usage, nil when they are not enforced
+	quotaSys *store.QuotaSys
 }
 
-// NewIamApiServer New iamApiServer
-func NewIamApiServer(router *mux.Router, authSys *iam.AuthSys, cleanData func(accessKey string)) {
+// NewIamApiServer New iamApiServer, purger may be nil when the buckets are
+// never force deleted, and quotaSys when the quotas are not enforced.
+func NewIamApiServer(router *mux.Router, authSys *iam.AuthSys, purger *store.BucketPurger, quotaSys *store.QuotaSys) {
 	iamApiSer := &iamApiServer{
-		authSys:   authSys,
-		cleanData: cleanData,
+		authSys:  authSys,
+		purger:   purger,
+		quotaSys: quotaSys,
 	}
 	iamApiSer.registerRouter(router)
 
@@ -47,7 +53,42 @@ func (iamApi *iamApiServer) registerRouter(router *mux.Router) {
 	apiRouter.Methods(http.MethodGet).Path("/list-sub-user-policy").HandlerFunc(iamApi.ListUserPolicies).Queries("userName", "{userName:.*}")
 	apiRouter.Methods(http.MethodPost).Path("/remove-sub-user-policy").HandlerFunc(iamApi.DeleteUserPolicy).Queries("userName", "{userName:.*}", "policyName", "{policyName:.*}")
 
-	//apiRouter.Methods(http.MethodPost).Path("/creat-policy").HandlerFunc(iamApi.CreatePolicy).Queries("policyName", "{policyName:.*}", "policyDocument", "{policyDocument:.*}")
+	//role
+	apiRouter.Methods(http.MethodPost).Path("/create-role").HandlerFunc(iamApi.CreateRole).Queries("roleName", "{roleName:.*}", "trustPolicy", "{trustPolicy:.*}")
+	apiRouter.Methods(http.MethodGet).Path("/get-role").HandlerFunc(iamApi.GetRole).Queries("roleName", "{roleName:.*}")
+	apiRouter.Methods(http.MethodGet).Path("/list-roles").HandlerFunc(iamApi.ListRoles)
+	apiRouter.Methods(http.MethodPost).Path("/remove-role").HandlerFunc(iamApi.DeleteRole).Queries("roleName", "{roleName:.*}")
+
+	//sts session
+	apiRouter.Methods(http.MethodGet).Path("/list-sessions").HandlerFunc(iamApi.ListSessions)
+	apiRouter.Methods(http.MethodPost).Path("/revoke-session").HandlerFunc(iamApi.RevokeSession).Queries("accessKey", "{accessKey:.*}")
+	apiRouter.Methods(http.MethodPost).Path("/revoke-sessions").HandlerFunc(iamApi.RevokeSessions).Queries("parentUser", "{parentUser:.*}")
+
+	apiRouter.Methods(http.MethodGet).Path("/simulate-access").HandlerFunc(iamApi.SimulateAccess).Queries("accessKey", "{accessKey:.*}", "action", "{action:.*}")
+
+	//managed policy
+	apiRouter.Methods(http.MethodPost).Path("/create-policy").HandlerFunc(iamApi.CreatePolicy).Queries("policyName", "{policyName:.*}", "policyDocument", "{policyDocument:.*}")
+	apiRouter.Methods(http.MethodGet).Path("/get-policy").HandlerFunc(iamApi.GetPolicy).Queries("policyName", "{policyName:.*}")
+	apiRouter.Methods(http.MethodPost).Path("/remove-policy").HandlerFunc(iamApi.DeletePolicy).Queries("policyName", "{policyName:.*}")
+
+	//bucket force deletion
+	if iamApi.purger != nil {
+		apiRouter.Methods(http.MethodPost).Path("/force-delete-bucket").HandlerFunc(iamApi.ForceDeleteBucket).Queries("bucket", "{bucket:.*}")
+		apiRouter.Methods(http.MethodGet).Path("/force-delete-bucket-status").HandlerFunc(iamApi.GetForceDeleteBucketStatus).Queries("bucket", "{bucket:.*}")
+		apiRouter.Methods(http.MethodGet).Path("/list-force-delete-jobs").HandlerFunc(iamApi.ListForceDeleteJobs)
+	}
+
+	//quotas and usage
+	if iamApi.quotaSys != nil {
+		apiRouter.Methods(http.MethodPost).Path("/set-bucket-quota").HandlerFunc(iamApi.SetBucketQuota).Queries("bucket", "{bucket:.*}")
+		apiRouter.Methods(http.MethodGet).Path("/get-bucket-quota").HandlerFunc(iamApi.GetBucketQuota).Queries("bucket", "{bucket:.*}")
+		apiRouter.Methods(http.MethodPost).Path("/set-user-quota").HandlerFunc(iamApi.SetUserQuota).Queries("accessKey", "{accessKey:.*}")
+		apiRouter.Methods(http.MethodGet).Path("/get-user-quota").HandlerFunc(iamApi.GetUserQuota).Queries("accessKey", "{accessKey:.*}")
+		apiRouter.Methods(http.MethodGet).Path("/bucket-usage").HandlerFunc(iamApi.GetBucketUsage).Queries("bucket", "{bucket:.*}")
+		apiRouter.Methods(http.MethodGet).Path("/user-usage").HandlerFunc(iamApi.GetUserUsage).Queries("accessKey", "{accessKey:.*}")
+		apiRouter.Methods(http.MethodPost).Path("/recompute-bucket-usage").HandlerFunc(iamApi.RecomputeBucketUsage).Queries("bucket", "{bucket:.*}")
+		apiRouter.Methods(http.MethodPost).Path("/recompute-user-usage").HandlerFunc(iamApi.RecomputeUserUsage).Queries("accessKey", "{accessKey:.*}")
+	}
 
 	//apiRouter.Methods(http.MethodPost).Path("/creat-group").HandlerFunc(iamApi.CreatGroup).Queries("groupName", "{groupName:.*}", "version", "{version:.*}")
 	//apiRouter.Methods(http.MethodGet).Path("/get_group").HandlerFunc(iamApi.GetGroup).Queries("groupName", "{groupName:.*}", "version", "{version:.*}")
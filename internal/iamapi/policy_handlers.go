@@ -0,0 +1,90 @@
+package iamapi
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/yann-y/fds/internal/apierrors"
+	"github.com/yann-y/fds/internal/iam/policy"
+	"github.com/yann-y/fds/internal/response"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CreatePolicy create or replace a managed policy, federated identities are
+// mapped to managed policies by the claims of their tokens
+// https://docs.aws.amazon.com/IAM/latest/APIReference/API_CreatePolicy.html
+func (iamApi *iamApiServer) CreatePolicy(w http.ResponseWriter, r *http.Request) {
+	_, owner, s3err := iamApi.authSys.CheckRequestAuthTypeCredential(r.Context(), r, "", "", "")
+	if s3err != apierrors.ErrNone || !owner {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	var resp CreatePolicyResponse
+	vars := mux.Vars(r)
+	policyName := vars[PolicyName]
+	if !validAccessKey.MatchString(policyName) {
+		response.WriteErrorResponse(w, r, apierrors.ErrInvalidQueryParams)
+		return
+	}
+	p, err := policy.ParseIdentityPolicy(strings.NewReader(vars[PolicyDocument]))
+	if err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ErrMalformedPolicy)
+		return
+	}
+	err = iamApi.authSys.Iam.CreatePolicy(r.Context(), policyName, policy.PolicyDocument{
+		Version:   p.Version,
+		Statement: p.Statements,
+	})
+	if err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ErrInternalError)
+		return
+	}
+	arn := "arn:aws:iam:::policy/" + policyName
+	now := time.Now().UTC()
+	resp.CreatePolicyResult.Policy.PolicyName = &policyName
+	resp.CreatePolicyResult.Policy.Arn = &arn
+	resp.CreatePolicyResult.Policy.CreateDate = &now
+	response.WriteXMLResponse(w, r, http.StatusOK, resp)
+}
+
+// GetPolicy get a managed policy
+func (iamApi *iamApiServer) GetPolicy(w http.ResponseWriter, r *http.Request) {
+	_, owner, s3err := iamApi.authSys.CheckRequestAuthTypeCredential(r.Context(), r, "", "", "")
+	if s3err != apierrors.ErrNone || !owner {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	p, err := iamApi.authSys.Iam.GetPolicy(r.Context(), r.FormValue(PolicyName))
+	if err != nil {
+		response.WriteErrorResponseJSON(w, apierrors.GetAPIError(apierrors.ErrNoSuchPolicy), r.URL, r.Host)
+		return
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		response.WriteErrorResponseJSON(w, apierrors.GetAPIError(apierrors.ErrInternalError), r.URL, r.Host)
+		return
+	}
+	response.WriteSuccessResponseJSON(w, data)
+}
+
+// DeletePolicy remove a managed policy
+// https://docs.aws.amazon.com/IAM/latest/APIReference/API_DeletePolicy.html
+func (iamApi *iamApiServer) DeletePolicy(w http.ResponseWriter, r *http.Request) {
+	_, owner, s3err := iamApi.authSys.CheckRequestAuthTypeCredential(r.Context(), r, "", "", "")
+	if s3err != apierrors.ErrNone || !owner {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	var resp DeletePolicyResponse
+	policyName := r.FormValue(PolicyName)
+	if _, err := iamApi.authSys.Iam.GetPolicy(r.Context(), policyName); err != nil {
+		response.WriteErrorResponseJSON(w, apierrors.GetAPIError(apierrors.ErrNoSuchPolicy), r.URL, r.Host)
+		return
+	}
+	if err := iamApi.authSys.Iam.RemovePolicy(r.Context(), policyName); err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ErrInternalError)
+		return
+	}
+	response.WriteXMLResponse(w, r, http.StatusOK, resp)
+}
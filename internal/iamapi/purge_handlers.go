@@ -0,0 +1,86 @@
+package iamapi
+
+import (
+	"encoding/json"
+	"github.com/yann-y/fds/internal/apierrors"
+	"github.com/yann-y/fds/internal/iam/s3action"
+	"github.com/yann-y/fds/internal/response"
+	"github.com/yann-y/fds/internal/store"
+	"net/http"
+)
+
+const (
+	// bucketName - the form value naming the bucket of the purge and quota calls.
+	bucketName = "bucket"
+)
+
+// writePurgeJobs writes jobs as json.
+func writePurgeJobs(w http.ResponseWriter, r *http.Request, jobs interface{}) {
+	data, err := json.Marshal(jobs)
+	if err != nil {
+		response.WriteErrorResponseJSON(w, apierrors.GetAPIError(apierrors.ErrInternalError), r.URL, r.Host)
+		return
+	}
+	response.WriteSuccessResponseJSON(w, data)
+}
+
+// ForceDeleteBucket starts the deletion of a bucket along with its objects,
+// or returns the job deleting it
+func (iamApi *iamApiServer) ForceDeleteBucket(w http.ResponseWriter, r *http.Request) {
+	bucket := r.FormValue(bucketName)
+	_, _, s3err := iamApi.authSys.CheckRequestAuthTypeCredential(r.Context(), r, s3action.ForceDeleteBucketAction, bucket, "")
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	job, err := iamApi.purger.Start(r.Context(), bucket)
+	if err != nil {
+		response.WriteErrorResponseJSON(w, apierrors.GetAPIError(apierrors.ToApiError(r.Context(), err)), r.URL, r.Host)
+		return
+	}
+	writePurgeJobs(w, r, job)
+}
+
+// GetForceDeleteBucketStatus returns the progress of the deletion of a bucket
+func (iamApi *iamApiServer) GetForceDeleteBucketStatus(w http.ResponseWriter, r *http.Request) {
+	bucket := r.FormValue(bucketName)
+	cred, owner, s3err := iamApi.authSys.CheckRequestAuthTypeCredential(r.Context(), r, s3action.ForceDeleteBucketAction, bucket, "")
+	if s3err != apierrors.ErrNone && s3err != apierrors.ErrNoSuchBucket {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	job, err := iamApi.purger.Job(r.Context(), bucket)
+	if err != nil && err != store.ErrPurgeJobNotFound {
+		response.WriteErrorResponseJSON(w, apierrors.GetAPIError(apierrors.ErrInternalError), r.URL, r.Host)
+		return
+	}
+	// the bucket is gone once its deletion is done, whose status the root
+	// owner and the owner of the bucket read
+	if s3err == apierrors.ErrNoSuchBucket && !owner && (err != nil || job.Owner == "" || job.Owner != cred.AccessKey) {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	if err == store.ErrPurgeJobNotFound {
+		response.WriteErrorResponseJSON(w, apierrors.GetAPIError(apierrors.ErrNoSuchBucket), r.URL, r.Host)
+		return
+	}
+	writePurgeJobs(w, r, job)
+}
+
+// ListForceDeleteJobs lists the deletions of all buckets, for the owner only
+func (iamApi *iamApiServer) ListForceDeleteJobs(w http.ResponseWriter, r *http.Request) {
+	_, owner, s3err := iamApi.authSys.CheckRequestAuthTypeCredential(r.Context(), r, "", "", "")
+	if s3err != apierrors.ErrNone || !owner {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	jobs, err := iamApi.purger.Jobs(r.Context())
+	if err != nil {
+		response.WriteErrorResponseJSON(w, apierrors.GetAPIError(apierrors.ErrInternalError), r.URL, r.Host)
+		return
+	}
+	if jobs == nil {
+		jobs = []store.PurgeJob{}
+	}
+	writePurgeJobs(w, r, jobs)
+}
@@ -0,0 +1,162 @@
+package iamapi
+
+import (
+	"encoding/json"
+	"github.com/yann-y/fds/internal/apierrors"
+	"github.com/yann-y/fds/internal/iam/s3action"
+	"github.com/yann-y/fds/internal/response"
+	"github.com/yann-y/fds/internal/store"
+	"net/http"
+	"strconv"
+)
+
+const (
+	HardQuota = "hard"
+	SoftQuota = "soft"
+)
+
+// writeQuotaResponse writes v as json, or the api error of err.
+func writeQuotaResponse(w http.ResponseWriter, r *http.Request, v interface{}, err error) {
+	if err != nil {
+		log.Errorf("quota request %s err:%v", r.URL.Path, err)
+		response.WriteErrorResponseJSON(w, apierrors.GetAPIError(apierrors.ToApiError(r.Context(), err)), r.URL, r.Host)
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		response.WriteErrorResponseJSON(w, apierrors.GetAPIError(apierrors.ErrInternalError), r.URL, r.Host)
+		return
+	}
+	response.WriteSuccessResponseJSON(w, data)
+}
+
+// parseQuotaLimit parses a limit of the request in bytes, an omitted limit
+// is unlimited.
+func parseQuotaLimit(r *http.Request, name string) (int64, error) {
+	v := r.FormValue(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, store.ErrInvalidQuota
+	}
+	return n, nil
+}
+
+// parseQuota parses the hard and soft limits of the request.
+func parseQuota(r *http.Request) (quota store.Quota, err error) {
+	if quota.Hard, err = parseQuotaLimit(r, HardQuota); err != nil {
+		return store.Quota{}, err
+	}
+	if quota.Soft, err = parseQuotaLimit(r, SoftQuota); err != nil {
+		return store.Quota{}, err
+	}
+	return quota, quota.Validate()
+}
+
+// isOwnerRequest returns whether the request is authenticated by the owner
+func (iamApi *iamApiServer) isOwnerRequest(r *http.Request) bool {
+	_, owner, s3err := iamApi.authSys.CheckRequestAuthTypeCredential(r.Context(), r, "", "", "")
+	return s3err == apierrors.ErrNone && owner
+}
+
+// SetBucketQuota sets the quota of a bucket, for the owner only
+func (iamApi *iamApiServer) SetBucketQuota(w http.ResponseWriter, r *http.Request) {
+	if !iamApi.isOwnerRequest(r) {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	bucket := r.FormValue(bucketName)
+	quota, err := parseQuota(r)
+	if err == nil {
+		err = iamApi.quotaSys.SetBucketQuota(r.Context(), bucket, quota)
+	}
+	writeQuotaResponse(w, r, quota, err)
+}
+
+// GetBucketQuota returns the quota of a bucket, for the owner only
+func (iamApi *iamApiServer) GetBucketQuota(w http.ResponseWriter, r *http.Request) {
+	if !iamApi.isOwnerRequest(r) {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	quota, err := iamApi.quotaSys.GetBucketQuota(r.Context(), r.FormValue(bucketName))
+	writeQuotaResponse(w, r, quota, err)
+}
+
+// SetUserQuota sets the quota of a user, for the owner only
+func (iamApi *iamApiServer) SetUserQuota(w http.ResponseWriter, r *http.Request) {
+	if !iamApi.isOwnerRequest(r) {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	accessKey := r.FormValue(AccessKey)
+	if _, err := iamApi.authSys.Iam.GetUserInfo(r.Context(), accessKey); err != nil {
+		response.WriteErrorResponseJSON(w, apierrors.GetAPIError(apierrors.ErrNoSuchUser), r.URL, r.Host)
+		return
+	}
+	quota, err := parseQuota(r)
+	if err == nil {
+		err = iamApi.quotaSys.SetUserQuota(r.Context(), accessKey, quota)
+	}
+	writeQuotaResponse(w, r, quota, err)
+}
+
+// GetUserQuota returns the quota of a user, for the owner only
+func (iamApi *iamApiServer) GetUserQuota(w http.ResponseWriter, r *http.Request) {
+	if !iamApi.isOwnerRequest(r) {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	quota, err := iamApi.quotaSys.GetUserQuota(r.Context(), r.FormValue(AccessKey))
+	writeQuotaResponse(w, r, quota, err)
+}
+
+// GetBucketUsage returns the usage of a bucket, for the users allowed to
+// list it
+func (iamApi *iamApiServer) GetBucketUsage(w http.ResponseWriter, r *http.Request) {
+	bucket := r.FormValue(bucketName)
+	_, _, s3err := iamApi.authSys.CheckRequestAuthTypeCredential(r.Context(), r, s3action.ListBucketAction, bucket, "")
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	report, err := iamApi.quotaSys.BucketUsage(r.Context(), bucket)
+	writeQuotaResponse(w, r, report, err)
+}
+
+// GetUserUsage returns the usage of the buckets of a user, for the owner and
+// the user
+func (iamApi *iamApiServer) GetUserUsage(w http.ResponseWriter, r *http.Request) {
+	accessKey := r.FormValue(AccessKey)
+	cred, owner, s3err := iamApi.authSys.CheckRequestAuthTypeCredential(r.Context(), r, "", "", "")
+	if s3err != apierrors.ErrNone || !(owner || (!cred.IsTemp() && cred.AccessKey == accessKey)) {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	report, err := iamApi.quotaSys.UserUsage(r.Context(), accessKey)
+	writeQuotaResponse(w, r, report, err)
+}
+
+// RecomputeBucketUsage counts the usage of a bucket from scratch, for the
+// owner only
+func (iamApi *iamApiServer) RecomputeBucketUsage(w http.ResponseWriter, r *http.Request) {
+	if !iamApi.isOwnerRequest(r) {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	report, err := iamApi.quotaSys.RecomputeBucketUsage(r.Context(), r.FormValue(bucketName))
+	writeQuotaResponse(w, r, report, err)
+}
+
+// RecomputeUserUsage counts the usage of the buckets of a user from scratch,
+// for the owner only
+func (iamApi *iamApiServer) RecomputeUserUsage(w http.ResponseWriter, r *http.Request) {
+	if !iamApi.isOwnerRequest(r) {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	report, err := iamApi.quotaSys.RecomputeUserUsage(r.Context(), r.FormValue(AccessKey))
+	writeQuotaResponse(w, r, report, err)
+}
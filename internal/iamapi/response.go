@@ -45,6 +45,11 @@ type CreatePolicyResponse struct {
 	} `xml:"CreatePolicyResult"`
 }
 
+type DeletePolicyResponse struct {
+	CommonResponse
+	XMLName xml.Name `xml:"https://iam.amazonaws.com/doc/2010-05-08/ DeletePolicyResponse"`
+}
+
 type CreateUserResponse struct {
 	CommonResponse
 	XMLName          xml.Name `xml:"https://iam.amazonaws.com/doc/2010-05-08/ CreateUserResponse"`
@@ -53,6 +58,19 @@ type CreateUserResponse struct {
 	} `xml:"CreateUserResult"`
 }
 
+type CreateRoleResponse struct {
+	CommonResponse
+	XMLName          xml.Name `xml:"https://iam.amazonaws.com/doc/2010-05-08/ CreateRoleResponse"`
+	CreateRoleResult struct {
+		Role iam.Role `xml:"Role"`
+	} `xml:"CreateRoleResult"`
+}
+
+type DeleteRoleResponse struct {
+	CommonResponse
+	XMLName xml.Name `xml:"https://iam.amazonaws.com/doc/2010-05-08/ DeleteRoleResponse"`
+}
+
 type DeleteUserResponse struct {
 	CommonResponse
 	XMLName xml.Name `xml:"https://iam.amazonaws.com/doc/2010-05-08/ DeleteUserResponse"`
@@ -0,0 +1,128 @@
+package iamapi
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/yann-y/fds/internal/apierrors"
+	"github.com/yann-y/fds/internal/iam"
+	"github.com/yann-y/fds/internal/iam/policy"
+	"github.com/yann-y/fds/internal/response"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RoleName           = "roleName"
+	TrustPolicy        = "trustPolicy"
+	PolicyDocument     = "policyDocument"
+	MaxSessionDuration = "maxSessionDuration"
+)
+
+// CreateRole create or replace a role that can be assumed with STS AssumeRole
+// https://docs.aws.amazon.com/IAM/latest/APIReference/API_CreateRole.html
+func (iamApi *iamApiServer) CreateRole(w http.ResponseWriter, r *http.Request) {
+	_, owner, s3err := iamApi.authSys.CheckRequestAuthTypeCredential(r.Context(), r, "", "", "")
+	if s3err != apierrors.ErrNone || !owner {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	var resp CreateRoleResponse
+	vars := mux.Vars(r)
+	roleName := vars[RoleName]
+	if !validAccessKey.MatchString(roleName) {
+		response.WriteErrorResponse(w, r, apierrors.ErrInvalidQueryParams)
+		return
+	}
+	role := iam.Role{RoleName: roleName}
+	if err := json.Unmarshal([]byte(vars[TrustPolicy]), &role.TrustPolicy); err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ErrMalformedPolicy)
+		return
+	}
+	if policyDocument := r.FormValue(PolicyDocument); policyDocument != "" {
+		p, err := policy.ParseIdentityPolicy(strings.NewReader(policyDocument))
+		if err != nil {
+			response.WriteErrorResponse(w, r, apierrors.ErrMalformedPolicy)
+			return
+		}
+		role.Policy = p
+	}
+	if maxSessionDuration := r.FormValue(MaxSessionDuration); maxSessionDuration != "" {
+		seconds, err := strconv.ParseUint(maxSessionDuration, 10, 32)
+		if err != nil {
+			response.WriteErrorResponse(w, r, apierrors.ErrInvalidQueryParams)
+			return
+		}
+		role.MaxSessionDuration = time.Duration(seconds) * time.Second
+	}
+	if err := iamApi.authSys.Iam.CreateRole(r.Context(), role); err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ErrMalformedPolicy)
+		return
+	}
+	arn := iam.RoleArn(roleName)
+	resp.CreateRoleResult.Role.RoleName = &roleName
+	resp.CreateRoleResult.Role.Arn = &arn
+	response.WriteXMLResponse(w, r, http.StatusOK, resp)
+}
+
+// GetRole get a role
+func (iamApi *iamApiServer) GetRole(w http.ResponseWriter, r *http.Request) {
+	_, owner, s3err := iamApi.authSys.CheckRequestAuthTypeCredential(r.Context(), r, "", "", "")
+	if s3err != apierrors.ErrNone || !owner {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	role, err := iamApi.authSys.Iam.GetRole(r.Context(), r.FormValue(RoleName))
+	if err != nil {
+		response.WriteErrorResponseJSON(w, apierrors.GetAPIError(apierrors.ErrNoSuchRole), r.URL, r.Host)
+		return
+	}
+	data, err := json.Marshal(role)
+	if err != nil {
+		response.WriteErrorResponseJSON(w, apierrors.GetAPIError(apierrors.ErrInternalError), r.URL, r.Host)
+		return
+	}
+	response.WriteSuccessResponseJSON(w, data)
+}
+
+// ListRoles get all roles
+func (iamApi *iamApiServer) ListRoles(w http.ResponseWriter, r *http.Request) {
+	_, owner, s3err := iamApi.authSys.CheckRequestAuthTypeCredential(r.Context(), r, "", "", "")
+	if s3err != apierrors.ErrNone || !owner {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	roles, err := iamApi.authSys.Iam.GetRoleList(r.Context())
+	if err != nil {
+		response.WriteErrorResponseJSON(w, apierrors.GetAPIError(apierrors.ErrInternalError), r.URL, r.Host)
+		return
+	}
+	data, err := json.Marshal(roles)
+	if err != nil {
+		response.WriteErrorResponseJSON(w, apierrors.GetAPIError(apierrors.ErrInternalError), r.URL, r.Host)
+		return
+	}
+	response.WriteSuccessResponseJSON(w, data)
+}
+
+// DeleteRole remove a role, sessions of the role lose all permissions
+// https://docs.aws.amazon.com/IAM/latest/APIReference/API_DeleteRole.html
+func (iamApi *iamApiServer) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	_, owner, s3err := iamApi.authSys.CheckRequestAuthTypeCredential(r.Context(), r, "", "", "")
+	if s3err != apierrors.ErrNone || !owner {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	var resp DeleteRoleResponse
+	roleName := r.FormValue(RoleName)
+	if _, err := iamApi.authSys.Iam.GetRole(r.Context(), roleName); err != nil {
+		response.WriteErrorResponseJSON(w, apierrors.GetAPIError(apierrors.ErrNoSuchRole), r.URL, r.Host)
+		return
+	}
+	if err := iamApi.authSys.Iam.RemoveRole(r.Context(), roleName); err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ErrInternalError)
+		return
+	}
+	response.WriteXMLResponse(w, r, http.StatusOK, resp)
+}
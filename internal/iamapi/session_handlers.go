@@ -0,0 +1,115 @@
+package iamapi
+
+import (
+	"encoding/json"
+	"github.com/yann-y/fds/internal/apierrors"
+	"github.com/yann-y/fds/internal/iam/auth"
+	"github.com/yann-y/fds/internal/response"
+	"net/http"
+)
+
+const ParentUser = "parentUser"
+
+// RevokeSessionsResult is returned by revoke-sessions
+type RevokeSessionsResult struct {
+	ParentUser string `json:"parentUser"`
+	Revoked    int    `json:"revoked"`
+}
+
+// canManageSessions returns whether cred may list and revoke the sessions derived
+// from parentUser: the owner manages all sessions, a user manages its own sessions
+// and the sessions of its sub users.
+func (iamApi *iamApiServer) canManageSessions(r *http.Request, cred auth.Credentials, owner bool, parentUser string) bool {
+	if owner {
+		return true
+	}
+	if cred.IsTemp() {
+		return false
+	}
+	if parentUser == cred.AccessKey {
+		return true
+	}
+	c, err := iamApi.authSys.Iam.GetUserInfo(r.Context(), parentUser)
+	return err == nil && c.ParentUser == cred.AccessKey
+}
+
+// ListSessions list the active STS sessions of a parent user, the owner lists
+// the sessions of all users when no parent user is given
+func (iamApi *iamApiServer) ListSessions(w http.ResponseWriter, r *http.Request) {
+	cred, owner, s3err := iamApi.authSys.CheckRequestAuthTypeCredential(r.Context(), r, "", "", "")
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	parentUser := r.FormValue(ParentUser)
+	if parentUser == "" && !owner {
+		parentUser = cred.AccessKey
+	}
+	if parentUser != "" && !iamApi.canManageSessions(r, cred, owner, parentUser) {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	sessions, err := iamApi.authSys.Iam.ListSessions(r.Context(), parentUser)
+	if err != nil {
+		response.WriteErrorResponseJSON(w, apierrors.GetAPIError(apierrors.ErrInternalError), r.URL, r.Host)
+		return
+	}
+	data, err := json.Marshal(sessions)
+	if err != nil {
+		response.WriteErrorResponseJSON(w, apierrors.GetAPIError(apierrors.ErrInternalError), r.URL, r.Host)
+		return
+	}
+	response.WriteSuccessResponseJSON(w, data)
+}
+
+// RevokeSession revoke a STS session, its access key stops working immediately
+func (iamApi *iamApiServer) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	cred, owner, s3err := iamApi.authSys.CheckRequestAuthTypeCredential(r.Context(), r, "", "", "")
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	session, err := iamApi.authSys.Iam.GetSession(r.Context(), r.FormValue(AccessKey))
+	if err != nil {
+		response.WriteErrorResponseJSON(w, apierrors.GetAPIError(apierrors.ErrNoSuchUser), r.URL, r.Host)
+		return
+	}
+	if !iamApi.canManageSessions(r, cred, owner, session.ParentUser) {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	if err = iamApi.authSys.Iam.RevokeSession(r.Context(), session.AccessKey); err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ErrInternalError)
+		return
+	}
+	response.WriteSuccessResponseHeadersOnly(w, r)
+}
+
+// RevokeSessions revoke all STS sessions of a parent user
+func (iamApi *iamApiServer) RevokeSessions(w http.ResponseWriter, r *http.Request) {
+	cred, owner, s3err := iamApi.authSys.CheckRequestAuthTypeCredential(r.Context(), r, "", "", "")
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	parentUser := r.FormValue(ParentUser)
+	if parentUser == "" {
+		response.WriteErrorResponse(w, r, apierrors.ErrInvalidQueryParams)
+		return
+	}
+	if !iamApi.canManageSessions(r, cred, owner, parentUser) {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	n, err := iamApi.authSys.Iam.RevokeSessions(r.Context(), parentUser)
+	if err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ErrInternalError)
+		return
+	}
+	data, err := json.Marshal(RevokeSessionsResult{ParentUser: parentUser, Revoked: n})
+	if err != nil {
+		response.WriteErrorResponseJSON(w, apierrors.GetAPIError(apierrors.ErrInternalError), r.URL, r.Host)
+		return
+	}
+	response.WriteSuccessResponseJSON(w, data)
+}
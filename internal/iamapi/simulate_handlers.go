@@ -0,0 +1,76 @@
+package iamapi
+
+import (
+	"encoding/json"
+	"github.com/yann-y/fds/internal/apierrors"
+	"github.com/yann-y/fds/internal/iam/auth"
+	"github.com/yann-y/fds/internal/iam/s3action"
+	"github.com/yann-y/fds/internal/response"
+	"net/http"
+	"strings"
+)
+
+const (
+	SimulateAction  = "action"
+	SimulateBucket  = "bucket"
+	SimulateObject  = "object"
+	SimulateContext = "context"
+)
+
+// SimulateAccess evaluates whether a principal may perform an action on a resource,
+// and returns the decision together with the matching statements and their sources.
+// Context keys are passed as repeated `context=key=value` query parameters.
+func (iamApi *iamApiServer) SimulateAccess(w http.ResponseWriter, r *http.Request) {
+	cred, owner, s3err := iamApi.authSys.CheckRequestAuthTypeCredential(r.Context(), r, "", "", "")
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+	accessKey := r.FormValue(AccessKey)
+	action := s3action.Action(r.FormValue(SimulateAction))
+	if !action.IsValid() {
+		response.WriteErrorResponse(w, r, apierrors.ErrInvalidQueryParams)
+		return
+	}
+	isOwner := accessKey == iamApi.authSys.AdminCred.AccessKey
+	if accessKey != "" && !isOwner {
+		c, err := iamApi.authSys.Iam.GetUserInfo(r.Context(), accessKey)
+		if err != nil {
+			response.WriteErrorResponseJSON(w, apierrors.GetAPIError(apierrors.ErrNoSuchUser), r.URL, r.Host)
+			return
+		}
+		// a user may simulate its own access and the access of its sub users
+		if !owner && c.AccessKey != cred.AccessKey && c.ParentUser != cred.AccessKey {
+			response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+			return
+		}
+	} else if !owner {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+		return
+	}
+
+	conditions := make(map[string][]string)
+	for _, kv := range r.Form[SimulateContext] {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			response.WriteErrorResponse(w, r, apierrors.ErrInvalidQueryParams)
+			return
+		}
+		conditions[k] = append(conditions[k], v)
+	}
+
+	trace := iamApi.authSys.SimulateAccess(r.Context(), auth.Args{
+		AccountName: accessKey,
+		Action:      action,
+		BucketName:  r.FormValue(SimulateBucket),
+		Conditions:  conditions,
+		ObjectName:  r.FormValue(SimulateObject),
+		IsOwner:     isOwner,
+	})
+	data, err := json.Marshal(trace)
+	if err != nil {
+		response.WriteErrorResponseJSON(w, apierrors.GetAPIError(apierrors.ErrInternalError), r.URL, r.Host)
+		return
+	}
+	response.WriteSuccessResponseJSON(w, data)
+}
@@ -0,0 +1,79 @@
+package iamapi
+
+import (
+	"encoding/json"
+	"github.com/yann-y/fds/internal/iam"
+	"github.com/yann-y/fds/internal/utils"
+	"net/http"
+	"testing"
+)
+
+func TestIamApiServer_SimulateAccess(t *testing.T) {
+	addUrl := "http://127.0.0.1:9985/admin/v1/add-user"
+	simulateUrl := "http://127.0.0.1:9985/admin/v1/simulate-access"
+	reqPutUser := utils.MustNewSignedV4Request(http.MethodPost, addUrl+"?accessKey=simTest1&secretKey=simTest1", 0, nil, "s3", DefaultTestAccessKey, DefaultTestSecretKey, t)
+	if result := reqTest(reqPutUser); result.Code != http.StatusOK {
+		t.Fatalf("add user: Expected the response status to be `%d`, but instead found `%d`", http.StatusOK, result.Code)
+	}
+	testCases := []struct {
+		query string
+		// expected output.
+		expectedRespStatus int
+		expectedAllowed    bool
+		expectedDecision   string
+	}{
+		// Test case - 1.
+		// user default policy allows listing buckets.
+		{
+			query:              "?accessKey=simTest1&action=s3:ListAllMyBuckets",
+			expectedRespStatus: http.StatusOK,
+			expectedAllowed:    true,
+			expectedDecision:   iam.DecisionUserPolicy,
+		},
+		// Test case - 2.
+		// admin is allowed as owner.
+		{
+			query:              "?accessKey=" + DefaultTestAccessKey + "&action=s3:CreateBucket&bucket=simbucket",
+			expectedRespStatus: http.StatusOK,
+			expectedAllowed:    true,
+			expectedDecision:   iam.DecisionOwner,
+		},
+		// Test case - 3.
+		// bucket does not exist.
+		{
+			query:              "?accessKey=simTest1&action=s3:GetObject&bucket=simbucket&object=a.txt",
+			expectedRespStatus: http.StatusOK,
+			expectedAllowed:    false,
+			expectedDecision:   iam.DecisionNoSuchBucket,
+		},
+		// Test case - 4.
+		// The specified user does not exist
+		{
+			query:              "?accessKey=simTest2&action=s3:GetObject",
+			expectedRespStatus: http.StatusConflict,
+		},
+		// Test case - 5.
+		// invalid action.
+		{
+			query:              "?accessKey=simTest1&action=s3:Unknown",
+			expectedRespStatus: http.StatusBadRequest,
+		},
+	}
+	for i, testCase := range testCases {
+		req := utils.MustNewSignedV4Request(http.MethodGet, simulateUrl+testCase.query, 0, nil, "s3", DefaultTestAccessKey, DefaultTestSecretKey, t)
+		result := reqTest(req)
+		if result.Code != testCase.expectedRespStatus {
+			t.Fatalf("Case %d: Expected the response status to be `%d`, but instead found `%d`", i+1, testCase.expectedRespStatus, result.Code)
+		}
+		if result.Code != http.StatusOK {
+			continue
+		}
+		var trace iam.AccessTrace
+		if err := json.Unmarshal(result.Body.Bytes(), &trace); err != nil {
+			t.Fatalf("Case %d: unmarshal trace: %v", i+1, err)
+		}
+		if trace.Allowed != testCase.expectedAllowed || trace.Decision != testCase.expectedDecision {
+			t.Fatalf("Case %d: Expected allowed=%v decision=%s, but instead found allowed=%v decision=%s", i+1, testCase.expectedAllowed, testCase.expectedDecision, trace.Allowed, trace.Decision)
+		}
+	}
+}
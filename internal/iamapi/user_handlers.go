@@ -80,11 +80,18 @@ func (iamApi *iamApiServer) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		response.WriteErrorResponse(w, r, apierrors.ErrInternalError)
 		return
 	}
-	// clean removed user's bucket
-	// TODO: If the deletion fails, try again
-	go func() {
-		iamApi.cleanData(accessKey)
-	}()
+	// clean removed user's bucket, the jobs resume after a restart and
+	// report their progress through list-force-delete-jobs
+	if iamApi.purger != nil {
+		if _, err = iamApi.purger.StartUser(r.Context(), accessKey); err != nil {
+			log.Errorf("force delete buckets of %s err:%v", accessKey, err)
+		}
+	}
+	if iamApi.quotaSys != nil {
+		if err = iamApi.quotaSys.DeleteUserQuota(r.Context(), accessKey); err != nil {
+			log.Errorf("delete quota of %s err:%v", accessKey, err)
+		}
+	}
 
 	response.WriteXMLResponse(w, r, http.StatusOK, resp)
 }
@@ -403,32 +410,3 @@ func GetPolicyDocument(policyD *string) (policyDocument policy.PolicyDocument, e
 	}
 	return policyDocument, err
 }
-
-/*//CreatePolicy Create Policy
-func (iamApi *iamApiServer) CreatePolicy(w http.ResponseWriter, r *http.Request) {
-	_, _, s3err := iamApi.authSys.CheckRequestAuthTypeCredential(r.Context(), r, "", "", "")
-	if s3err != apierrors.ErrNone {
-		response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
-		return
-	}
-	var resp CreatePolicyResponse
-	policyName := r.FormValue("policyName")
-	policyDocumentString := r.FormValue("policyDocument")
-	policyDocument, err := GetPolicyDocument(&policyDocumentString)
-	if err != nil {
-		response.WriteErrorResponse(w, r, apierrors.ErrInternalError)
-	}
-	policyId := Hash(&policyDocumentString)
-	arn := fmt.Sprintf("arn:aws:iam:::policy/%s", policyName)
-	resp.CreatePolicyResult.Policy.PolicyName = &policyName
-	resp.CreatePolicyResult.Policy.Arn = &arn
-	resp.CreatePolicyResult.Policy.PolicyId = &policyId
-	policyLock.Lock()
-	defer policyLock.Unlock()
-	err = iamApi.authSys.Iam.CreatePolicy(r.Context(), policyName, policyDocument)
-	if err != nil {
-		response.WriteErrorResponse(w, r, apierrors.ErrNoSuchBucketPolicy)
-		return
-	}
-	response.WriteXMLResponse(w, r, http.StatusOK, resp)
-}*/
@@ -0,0 +1,240 @@
+package kv
+
+import (
+	"context"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var log = logging.Logger("kv")
+
+// DB - the msgpack values of the metadata over a store. With a replicator,
+// Get and ReadAllChan read the local store, which holds every write
+// committed on any node once Sync returns: the gateway syncs once per
+// request, and Update once per tx.
+type DB struct {
+	store Store
+	// replicator, when set, applies the writes to the db of every node
+	replicator Replicator
+}
+
+// Replicator - orders the writes of a db replicated on several nodes.
+type Replicator interface {
+	// Apply applies the ops to the db of every node, it returns once they
+	// are applied to the local db.
+	Apply(ops []Op) error
+	// Sync waits until the local db reflects every write committed before
+	// the call.
+	Sync(ctx context.Context) error
+}
+
+// NewDB returns the db of store.
+func NewDB(store Store) *DB {
+	return &DB{store: store}
+}
+
+// Store - returns the store of the db.
+func (db *DB) Store() Store {
+	return db.store
+}
+
+// SetReplicator - replicates the writes through r, and makes Sync wait for
+// the writes committed on any node.
+func (db *DB) SetReplicator(r Replicator) {
+	db.replicator = r
+}
+
+// Sync - waits until the reads see every write committed before the call,
+// at once without a replicator.
+func (db *DB) Sync(ctx context.Context) error {
+	if db.replicator == nil {
+		return nil
+	}
+	return db.replicator.Sync(ctx)
+}
+
+// Close - closes the store.
+func (db *DB) Close() error {
+	return db.store.Close()
+}
+
+// Put - sets key to the msgpack encoding of value.
+func (db *DB) Put(key string, value interface{}) error {
+	result, err := msgpack.Marshal(value)
+	if err != nil {
+		log.Errorf("marshal error%v", err)
+		return err
+	}
+	if db.replicator != nil {
+		return db.replicator.Apply([]Op{{Key: key, Value: result}})
+	}
+	return db.store.Put([]byte(key), result)
+}
+
+// Get - decodes the value of key into value, ErrNotFound when it does not
+// exist.
+func (db *DB) Get(key string, value interface{}) error {
+	get, err := db.store.Get([]byte(key))
+	if err != nil {
+		return err
+	}
+	return msgpack.Unmarshal(get, value)
+}
+
+// Delete - removes key.
+func (db *DB) Delete(key string) error {
+	if db.replicator != nil {
+		return db.replicator.Apply([]Op{{Key: key, Delete: true}})
+	}
+	return db.store.Delete([]byte(key))
+}
+
+// Write - applies the ops to the local store in a single batch, regardless
+// of the replicator.
+func (db *DB) Write(ops []Op) error {
+	return db.store.Write(NewBatch(ops...))
+}
+
+// Update - runs fn and applies the writes of its tx at once, none of them
+// when fn fails. Without a replicator, the tx is a transaction of the store:
+// fn runs while the other writes wait, so its reads and writes commit
+// together. With a replicator, the writes are applied at once on every node
+// but fn is not isolated from the writes of the other nodes, the callers
+// hold the locks of the keys they write.
+func (db *DB) Update(fn func(tx *Tx) error) error {
+	// the reads of fn see the writes committed before the tx
+	if err := db.Sync(context.Background()); err != nil {
+		return err
+	}
+	tx := &Tx{db: db, writes: make(map[string]int)}
+	if db.replicator == nil {
+		txn, err := db.store.NewTxn()
+		if err != nil {
+			return err
+		}
+		defer txn.Discard()
+		tx.txn = txn
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if tx.err != nil {
+		return tx.err
+	}
+	if len(tx.ops) == 0 {
+		return nil
+	}
+	if db.replicator != nil {
+		return db.replicator.Apply(tx.ops)
+	}
+	return tx.txn.Commit()
+}
+
+// Tx - the msgpack writes of an Update, its reads see its own writes.
+type Tx struct {
+	db  *DB
+	ops []Op
+	// writes is the index in ops of the last write of a key
+	writes map[string]int
+	// txn, when set, is the transaction of the store the tx writes to
+	txn Txn
+	// err is the first write to txn which failed
+	err error
+}
+
+// Get - decodes the value of key into value, as written by the tx or else
+// as in the db.
+func (tx *Tx) Get(key string, value interface{}) error {
+	if tx.txn != nil {
+		get, err := tx.txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		return msgpack.Unmarshal(get, value)
+	}
+	i, ok := tx.writes[key]
+	if !ok {
+		return tx.db.Get(key, value)
+	}
+	if tx.ops[i].Delete {
+		return ErrNotFound
+	}
+	return msgpack.Unmarshal(tx.ops[i].Value, value)
+}
+
+// Put - sets key to the msgpack encoding of value on Update.
+func (tx *Tx) Put(key string, value interface{}) error {
+	result, err := msgpack.Marshal(value)
+	if err != nil {
+		log.Errorf("marshal error%v", err)
+		return err
+	}
+	return tx.add(Op{Key: key, Value: result})
+}
+
+// Delete - removes key on Update.
+func (tx *Tx) Delete(key string) {
+	if err := tx.add(Op{Key: key, Delete: true}); err != nil && tx.err == nil {
+		tx.err = err
+	}
+}
+
+// Len - returns the number of writes of the tx.
+func (tx *Tx) Len() int {
+	return len(tx.ops)
+}
+
+func (tx *Tx) add(op Op) error {
+	tx.writes[op.Key] = len(tx.ops)
+	tx.ops = append(tx.ops, op)
+	if tx.txn == nil {
+		return nil
+	}
+	if op.Delete {
+		return tx.txn.Delete([]byte(op.Key))
+	}
+	return tx.txn.Put([]byte(op.Key), op.Value)
+}
+
+type entry struct {
+	Key   string
+	Value []byte
+}
+
+func (e *entry) UnmarshalValue(value interface{}) error {
+	return msgpack.Unmarshal(e.Value, value)
+}
+
+// ReadAllChan read all key value with prefix after seekKey, none when seekKey
+// is past the keys with prefix
+func (db *DB) ReadAllChan(ctx context.Context, prefix string, seekKey string) (<-chan *entry, error) {
+	ch := make(chan *entry)
+	if end := PrefixEnd([]byte(prefix)); end != nil && seekKey >= string(end) {
+		close(ch)
+		return ch, nil
+	}
+	iter := db.store.NewIterator([]byte(prefix), []byte(seekKey))
+	go func() {
+		defer func() {
+			iter.Release()
+			close(ch)
+		}()
+		for iter.Next() {
+			if seekKey != "" && string(iter.Key()) == seekKey {
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- &entry{
+				Key:   string(iter.Key()),
+				Value: append([]byte(nil), iter.Value()...),
+			}:
+			}
+		}
+		if err := iter.Error(); err != nil {
+			log.Errorf("iterate %q err:%v", prefix, err)
+		}
+	}()
+	return ch, nil
+}
@@ -0,0 +1,133 @@
+// Package kv defines the ordered key-value store the metadata is kept in,
+// implemented by several engines, and DB, the msgpack values over a store
+// used by the metadata subsystems.
+package kv
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrNotFound - the key does not exist.
+var ErrNotFound = errors.New("kv: not found")
+
+// Reader - reads keys in byte order.
+type Reader interface {
+	// Get returns the value of key, ErrNotFound when it does not exist.
+	Get(key []byte) ([]byte, error)
+	// NewIterator returns an iterator over the keys with prefix, starting at
+	// seek when it is after prefix.
+	NewIterator(prefix, seek []byte) Iterator
+}
+
+// Writer - writes keys.
+type Writer interface {
+	Put(key, value []byte) error
+	// Delete removes key, deleting a key which does not exist is no error.
+	Delete(key []byte) error
+}
+
+// Store - an ordered key-value store.
+type Store interface {
+	Reader
+	Writer
+	// Write applies every op of the batch, or none.
+	Write(batch *Batch) error
+	// NewSnapshot returns a consistent view of the store at the time of the
+	// call, unaffected by the writes that follow.
+	NewSnapshot() (Snapshot, error)
+	// NewTxn starts a transaction: its reads see its own writes, which are
+	// applied at once on Commit. Transactions are serialized, writes outside
+	// of a transaction may wait until it ends.
+	NewTxn() (Txn, error)
+	Close() error
+}
+
+// Snapshot - a consistent view of a store.
+type Snapshot interface {
+	Reader
+	Release()
+}
+
+// Txn - a transaction of a store.
+type Txn interface {
+	Reader
+	Writer
+	Commit() error
+	// Discard drops the writes of the transaction, it is a no-op after
+	// Commit.
+	Discard()
+}
+
+// Iterator - iterates over keys in byte order, the key and the value are
+// only valid until the next call to Next.
+type Iterator interface {
+	Next() bool
+	Key() []byte
+	Value() []byte
+	Error() error
+	Release()
+}
+
+// Op - a write of a batch, a delete when Delete is set.
+type Op struct {
+	Key    string
+	Value  []byte
+	Delete bool
+}
+
+// Batch - writes applied at once.
+type Batch struct {
+	ops []Op
+}
+
+// NewBatch returns a batch of ops.
+func NewBatch(ops ...Op) *Batch {
+	return &Batch{ops: ops}
+}
+
+// Put - adds a put of key to the batch.
+func (b *Batch) Put(key, value []byte) {
+	b.ops = append(b.ops, Op{Key: string(key), Value: value})
+}
+
+// Delete - adds a delete of key to the batch.
+func (b *Batch) Delete(key []byte) {
+	b.ops = append(b.ops, Op{Key: string(key), Delete: true})
+}
+
+// Ops - returns the writes of the batch in order.
+func (b *Batch) Ops() []Op {
+	return b.ops
+}
+
+// Len - returns the number of writes of the batch.
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Reset - removes every write of the batch.
+func (b *Batch) Reset() {
+	b.ops = b.ops[:0]
+}
+
+// IteratorStart returns the first key of an iteration over prefix from seek.
+func IteratorStart(prefix, seek []byte) []byte {
+	if bytes.Compare(seek, prefix) > 0 {
+		return seek
+	}
+	return prefix
+}
+
+// PrefixEnd returns the first key after every key with prefix, nil when
+// there is none.
+func PrefixEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
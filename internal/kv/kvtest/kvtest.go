@@ -0,0 +1,242 @@
+// Package kvtest is the conformance suite every kv.Store must pass.
+package kvtest
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/yann-y/fds/internal/kv"
+	"testing"
+)
+
+// OpenFunc - opens an empty store in dir.
+type OpenFunc func(dir string) (kv.Store, error)
+
+// Run - runs the conformance suite against the stores opened by open.
+func Run(t *testing.T, open OpenFunc) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store kv.Store)
+	}{
+		{"GetPutDelete", testGetPutDelete},
+		{"Batch", testBatch},
+		{"Iterator", testIterator},
+		{"Snapshot", testSnapshot},
+		{"Txn", testTxn},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			store, err := open(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			test.fn(t, store)
+		})
+	}
+	t.Run("Reopen", func(t *testing.T) {
+		testReopen(t, open)
+	})
+}
+
+func testGetPutDelete(t *testing.T, store kv.Store) {
+	if _, err := store.Get([]byte("a")); err != kv.ErrNotFound {
+		t.Fatalf("Expected %v, but instead found %v", kv.ErrNotFound, err)
+	}
+	mustPut(t, store, "a", "1")
+	mustPut(t, store, "a", "2")
+	mustPut(t, store, "empty", "")
+	expectValue(t, store, "a", "2")
+	expectValue(t, store, "empty", "")
+	if err := store.Delete([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete([]byte("missing")); err != nil {
+		t.Fatalf("Expected deleting a missing key to succeed, but instead found %v", err)
+	}
+	if _, err := store.Get([]byte("a")); err != kv.ErrNotFound {
+		t.Fatalf("Expected %v, but instead found %v", kv.ErrNotFound, err)
+	}
+}
+
+func testBatch(t *testing.T, store kv.Store) {
+	mustPut(t, store, "b", "old")
+	batch := kv.NewBatch()
+	batch.Put([]byte("a"), []byte("1"))
+	batch.Delete([]byte("b"))
+	batch.Put([]byte("c"), []byte("1"))
+	batch.Put([]byte("c"), []byte("2"))
+	if batch.Len() != 4 {
+		t.Fatalf("Expected 4 ops, but instead found %d", batch.Len())
+	}
+	if err := store.Write(batch); err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, store, "a", "1")
+	expectValue(t, store, "c", "2")
+	if _, err := store.Get([]byte("b")); err != kv.ErrNotFound {
+		t.Fatalf("Expected %v, but instead found %v", kv.ErrNotFound, err)
+	}
+	batch.Reset()
+	if err := store.Write(batch); err != nil {
+		t.Fatalf("Expected an empty batch to succeed, but instead found %v", err)
+	}
+}
+
+func testIterator(t *testing.T, store kv.Store) {
+	for _, key := range []string{"a", "p/1", "p/2", "p/3", "p\xff", "q", "\xff", "\xff\xff"} {
+		mustPut(t, store, key, "v"+key)
+	}
+	testCases := []struct {
+		prefix string
+		seek   string
+		keys   []string
+	}{
+		{"p/", "", []string{"p/1", "p/2", "p/3"}},
+		{"p/", "p/2", []string{"p/2", "p/3"}},
+		{"p/", "p/25", []string{"p/3"}},
+		{"p/", "a", []string{"p/1", "p/2", "p/3"}},
+		{"p/", "q", nil},
+		{"p", "", []string{"p/1", "p/2", "p/3", "p\xff"}},
+		{"\xff", "", []string{"\xff", "\xff\xff"}},
+		{"", "q", []string{"q", "\xff", "\xff\xff"}},
+		{"", "", []string{"a", "p/1", "p/2", "p/3", "p\xff", "q", "\xff", "\xff\xff"}},
+		{"z", "", nil},
+	}
+	for i, testCase := range testCases {
+		keys := collect(t, store.NewIterator([]byte(testCase.prefix), []byte(testCase.seek)), true)
+		if fmt.Sprint(keys) != fmt.Sprint(testCase.keys) {
+			t.Errorf("Test %d: Expected %q, but instead found %q", i+1, testCase.keys, keys)
+		}
+	}
+}
+
+func testSnapshot(t *testing.T, store kv.Store) {
+	mustPut(t, store, "p/1", "1")
+	mustPut(t, store, "p/2", "1")
+	snap, err := store.NewSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Release()
+	mustPut(t, store, "p/1", "2")
+	mustPut(t, store, "p/3", "2")
+	if err = store.Delete([]byte("p/2")); err != nil {
+		t.Fatal(err)
+	}
+
+	expectValue(t, snap, "p/1", "1")
+	expectValue(t, snap, "p/2", "1")
+	if _, err = snap.Get([]byte("p/3")); err != kv.ErrNotFound {
+		t.Errorf("Expected %v, but instead found %v", kv.ErrNotFound, err)
+	}
+	if keys := collect(t, snap.NewIterator([]byte("p/"), nil), false); fmt.Sprint(keys) != "[p/1 p/2]" {
+		t.Errorf("Expected [p/1 p/2], but instead found %q", keys)
+	}
+	if keys := collect(t, store.NewIterator([]byte("p/"), nil), false); fmt.Sprint(keys) != "[p/1 p/3]" {
+		t.Errorf("Expected [p/1 p/3], but instead found %q", keys)
+	}
+}
+
+func testTxn(t *testing.T, store kv.Store) {
+	mustPut(t, store, "a", "1")
+	mustPut(t, store, "b", "1")
+
+	txn, err := store.NewTxn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = txn.Put([]byte("a"), []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if err = txn.Delete([]byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if err = txn.Put([]byte("c"), []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, txn, "a", "2")
+	if _, err = txn.Get([]byte("b")); err != kv.ErrNotFound {
+		t.Errorf("Expected %v, but instead found %v", kv.ErrNotFound, err)
+	}
+	if keys := collect(t, txn.NewIterator(nil, nil), false); fmt.Sprint(keys) != "[a c]" {
+		t.Errorf("Expected [a c], but instead found %q", keys)
+	}
+	if err = txn.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	txn.Discard()
+	expectValue(t, store, "a", "2")
+	expectValue(t, store, "c", "2")
+	if _, err = store.Get([]byte("b")); err != kv.ErrNotFound {
+		t.Errorf("Expected %v, but instead found %v", kv.ErrNotFound, err)
+	}
+
+	txn, err = store.NewTxn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = txn.Put([]byte("a"), []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	txn.Discard()
+	expectValue(t, store, "a", "2")
+
+	// a write outside of the transactions must not be lost once they end
+	mustPut(t, store, "d", "1")
+	expectValue(t, store, "d", "1")
+}
+
+func testReopen(t *testing.T, open OpenFunc) {
+	dir := t.TempDir()
+	store, err := open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustPut(t, store, "a", "1")
+	if err = store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if store, err = open(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	expectValue(t, store, "a", "1")
+}
+
+func mustPut(t *testing.T, store kv.Store, key, value string) {
+	t.Helper()
+	if err := store.Put([]byte(key), []byte(value)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectValue(t *testing.T, r kv.Reader, key, expected string) {
+	t.Helper()
+	value, err := r.Get([]byte(key))
+	if err != nil {
+		t.Fatalf("Expected %q to exist, but instead found %v", key, err)
+	}
+	if !bytes.Equal(value, []byte(expected)) {
+		t.Errorf("Expected %q to be %q, but instead found %q", key, expected, value)
+	}
+}
+
+// collect - returns the keys of iter, checking the values when checkValues
+// is set.
+func collect(t *testing.T, iter kv.Iterator, checkValues bool) []string {
+	t.Helper()
+	defer iter.Release()
+	var keys []string
+	for iter.Next() {
+		key := string(iter.Key())
+		if checkValues && string(iter.Value()) != "v"+key {
+			t.Errorf("Expected %q to be %q, but instead found %q", key, "v"+key, iter.Value())
+		}
+		keys = append(keys, key)
+	}
+	if err := iter.Error(); err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
@@ -0,0 +1,200 @@
+// Package pebblekv implements kv.Store with Pebble.
+package pebblekv
+
+import (
+	"github.com/cockroachdb/pebble"
+	"github.com/yann-y/fds/internal/kv"
+	"io"
+	"sync"
+)
+
+// Store - the Pebble implementation of kv.Store.
+type Store struct {
+	db *pebble.DB
+	// writeMu serializes the transactions with the other writes
+	writeMu sync.Mutex
+}
+
+// Open opens the Pebble store at path.
+func Open(path string) (*Store, error) {
+	db, err := pebble.Open(path, &pebble.Options{})
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Get - returns the value of key.
+func (s *Store) Get(key []byte) ([]byte, error) {
+	return get(s.db.Get(key))
+}
+
+// Put - sets the value of key.
+func (s *Store) Put(key, value []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.db.Set(key, value, pebble.Sync)
+}
+
+// Delete - removes key.
+func (s *Store) Delete(key []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.db.Delete(key, pebble.Sync)
+}
+
+// Write - applies the batch atomically.
+func (s *Store) Write(batch *kv.Batch) error {
+	b := s.db.NewBatch()
+	defer b.Close()
+	for _, op := range batch.Ops() {
+		var err error
+		if op.Delete {
+			err = b.Delete([]byte(op.Key), nil)
+		} else {
+			err = b.Set([]byte(op.Key), op.Value, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return b.Commit(pebble.Sync)
+}
+
+// NewIterator - iterates over the keys with prefix from seek.
+func (s *Store) NewIterator(prefix, seek []byte) kv.Iterator {
+	return newIterator(s.db, prefix, seek)
+}
+
+// NewSnapshot - returns a snapshot of the store.
+func (s *Store) NewSnapshot() (kv.Snapshot, error) {
+	return &snapshot{snap: s.db.NewSnapshot()}, nil
+}
+
+// NewTxn - opens a transaction over an indexed batch, which blocks the other
+// writes until it ends.
+func (s *Store) NewTxn() (kv.Txn, error) {
+	s.writeMu.Lock()
+	return &txn{store: s, batch: s.db.NewIndexedBatch()}, nil
+}
+
+// Close - closes the store.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+type snapshot struct {
+	snap *pebble.Snapshot
+}
+
+func (s *snapshot) Get(key []byte) ([]byte, error) {
+	return get(s.snap.Get(key))
+}
+
+func (s *snapshot) NewIterator(prefix, seek []byte) kv.Iterator {
+	return newIterator(s.snap, prefix, seek)
+}
+
+func (s *snapshot) Release() {
+	s.snap.Close()
+}
+
+type txn struct {
+	store *Store
+	batch *pebble.Batch
+	done  bool
+}
+
+func (t *txn) Get(key []byte) ([]byte, error) {
+	return get(t.batch.Get(key))
+}
+
+func (t *txn) NewIterator(prefix, seek []byte) kv.Iterator {
+	return newIterator(t.batch, prefix, seek)
+}
+
+func (t *txn) Put(key, value []byte) error {
+	return t.batch.Set(key, value, nil)
+}
+
+func (t *txn) Delete(key []byte) error {
+	return t.batch.Delete(key, nil)
+}
+
+func (t *txn) Commit() error {
+	if t.done {
+		return pebble.ErrClosed
+	}
+	defer t.end()
+	return t.batch.Commit(pebble.Sync)
+}
+
+func (t *txn) Discard() {
+	if !t.done {
+		t.end()
+	}
+}
+
+// end - closes the batch and unblocks the writes.
+func (t *txn) end() {
+	t.done = true
+	t.batch.Close()
+	t.store.writeMu.Unlock()
+}
+
+// get - copies the value out of pebble, which owns it until closer is
+// closed.
+func get(value []byte, closer io.Closer, err error) ([]byte, error) {
+	if err == pebble.ErrNotFound {
+		return nil, kv.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	return append([]byte{}, value...), nil
+}
+
+type reader interface {
+	NewIter(o *pebble.IterOptions) *pebble.Iterator
+}
+
+// iterator - adapts a pebble iterator, which must be positioned first, to
+// kv.Iterator.
+type iterator struct {
+	iter    *pebble.Iterator
+	started bool
+}
+
+func newIterator(r reader, prefix, seek []byte) kv.Iterator {
+	return &iterator{iter: r.NewIter(&pebble.IterOptions{
+		LowerBound: kv.IteratorStart(prefix, seek),
+		UpperBound: kv.PrefixEnd(prefix),
+	})}
+}
+
+func (it *iterator) Next() bool {
+	if !it.started {
+		it.started = true
+		return it.iter.First()
+	}
+	return it.iter.Next()
+}
+
+func (it *iterator) Key() []byte {
+	return it.iter.Key()
+}
+
+func (it *iterator) Value() []byte {
+	return it.iter.Value()
+}
+
+func (it *iterator) Error() error {
+	return it.iter.Error()
+}
+
+func (it *iterator) Release() {
+	it.iter.Close()
+}
@@ -0,0 +1,13 @@
+package pebblekv
+
+import (
+	"github.com/yann-y/fds/internal/kv"
+	"github.com/yann-y/fds/internal/kv/kvtest"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	kvtest.Run(t, func(dir string) (kv.Store, error) {
+		return Open(dir)
+	})
+}
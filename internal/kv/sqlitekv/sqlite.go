@@ -0,0 +1,262 @@
+// Package sqlitekv implements kv.Store with SQLite, keeping the keys in a
+// single table ordered by their bytes.
+package sqlitekv
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/yann-y/fds/internal/kv"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileName - the name of the database file in the directory of the store.
+const FileName = "kv.sqlite"
+
+const schema = `CREATE TABLE IF NOT EXISTS kv (
+	key BLOB NOT NULL PRIMARY KEY,
+	value BLOB NOT NULL
+) WITHOUT ROWID`
+
+// Store - the SQLite implementation of kv.Store.
+type Store struct {
+	// writer is the single connection the writes and the transactions go
+	// through, reader the connections of the reads and the snapshots
+	writer *sql.DB
+	reader *sql.DB
+}
+
+// Open opens the SQLite store in the directory path.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return nil, err
+	}
+	dsn := "file:" + filepath.Join(path, FileName) + "?_journal_mode=WAL&_busy_timeout=10000&_synchronous=FULL"
+	writer, err := sql.Open("sqlite3", dsn+"&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+	writer.SetMaxOpenConns(1)
+	if _, err = writer.Exec(schema); err != nil {
+		writer.Close()
+		return nil, err
+	}
+	reader, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		writer.Close()
+		return nil, err
+	}
+	return &Store{writer: writer, reader: reader}, nil
+}
+
+// Get - returns the value of key.
+func (s *Store) Get(key []byte) ([]byte, error) {
+	return get(s.reader, key)
+}
+
+// Put - sets the value of key.
+func (s *Store) Put(key, value []byte) error {
+	return put(s.writer, key, value)
+}
+
+// Delete - removes key.
+func (s *Store) Delete(key []byte) error {
+	return del(s.writer, key)
+}
+
+// Write - applies the batch in a transaction.
+func (s *Store) Write(batch *kv.Batch) error {
+	tx, err := s.writer.Begin()
+	if err != nil {
+		return err
+	}
+	for _, op := range batch.Ops() {
+		if op.Delete {
+			err = del(tx, []byte(op.Key))
+		} else {
+			err = put(tx, []byte(op.Key), op.Value)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// NewIterator - iterates over the keys with prefix from seek.
+func (s *Store) NewIterator(prefix, seek []byte) kv.Iterator {
+	return newIterator(s.reader, prefix, seek)
+}
+
+// NewSnapshot - returns a snapshot of the store, a read transaction which
+// sees the store as of its first read.
+func (s *Store) NewSnapshot() (kv.Snapshot, error) {
+	tx, err := s.reader.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	var n int
+	if err = tx.QueryRow("SELECT count(*) FROM (SELECT 1 FROM kv LIMIT 1)").Scan(&n); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return &snapshot{tx: tx}, nil
+}
+
+// NewTxn - opens a transaction holding the write lock until it ends.
+func (s *Store) NewTxn() (kv.Txn, error) {
+	tx, err := s.writer.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &txn{tx: tx}, nil
+}
+
+// Close - closes the store.
+func (s *Store) Close() error {
+	err := s.reader.Close()
+	if werr := s.writer.Close(); err == nil {
+		err = werr
+	}
+	return err
+}
+
+type snapshot struct {
+	tx *sql.Tx
+}
+
+func (s *snapshot) Get(key []byte) ([]byte, error) {
+	return get(s.tx, key)
+}
+
+func (s *snapshot) NewIterator(prefix, seek []byte) kv.Iterator {
+	return newIterator(s.tx, prefix, seek)
+}
+
+func (s *snapshot) Release() {
+	s.tx.Rollback()
+}
+
+type txn struct {
+	tx *sql.Tx
+}
+
+func (t *txn) Get(key []byte) ([]byte, error) {
+	return get(t.tx, key)
+}
+
+func (t *txn) NewIterator(prefix, seek []byte) kv.Iterator {
+	return newIterator(t.tx, prefix, seek)
+}
+
+func (t *txn) Put(key, value []byte) error {
+	return put(t.tx, key, value)
+}
+
+func (t *txn) Delete(key []byte) error {
+	return del(t.tx, key)
+}
+
+func (t *txn) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *txn) Discard() {
+	t.tx.Rollback()
+}
+
+// querier - the methods shared by sql.DB and sql.Tx.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func get(q querier, key []byte) ([]byte, error) {
+	var value []byte
+	err := q.QueryRow("SELECT value FROM kv WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, kv.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	return value, nil
+}
+
+func put(q querier, key, value []byte) error {
+	if value == nil {
+		value = []byte{}
+	}
+	_, err := q.Exec("INSERT OR REPLACE INTO kv (key, value) VALUES (?, ?)", key, value)
+	return err
+}
+
+func del(q querier, key []byte) error {
+	_, err := q.Exec("DELETE FROM kv WHERE key = ?", key)
+	return err
+}
+
+// iterator - iterates over the rows of a range query.
+type iterator struct {
+	rows       *sql.Rows
+	key, value []byte
+	err        error
+}
+
+func newIterator(q querier, prefix, seek []byte) kv.Iterator {
+	var conds []string
+	var args []interface{}
+	if start := kv.IteratorStart(prefix, seek); len(start) > 0 {
+		conds, args = append(conds, "key >= ?"), append(args, start)
+	}
+	if end := kv.PrefixEnd(prefix); end != nil {
+		conds, args = append(conds, "key < ?"), append(args, end)
+	}
+	query := "SELECT key, value FROM kv"
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	rows, err := q.Query(query+" ORDER BY key", args...)
+	if err != nil {
+		return &iterator{err: fmt.Errorf("iterate kv: %w", err)}
+	}
+	return &iterator{rows: rows}
+}
+
+func (it *iterator) Next() bool {
+	if it.rows == nil || it.err != nil {
+		return false
+	}
+	if !it.rows.Next() {
+		it.err = it.rows.Err()
+		return false
+	}
+	it.err = it.rows.Scan(&it.key, &it.value)
+	return it.err == nil
+}
+
+func (it *iterator) Key() []byte {
+	return it.key
+}
+
+func (it *iterator) Value() []byte {
+	return it.value
+}
+
+func (it *iterator) Error() error {
+	return it.err
+}
+
+func (it *iterator) Release() {
+	if it.rows != nil {
+		it.rows.Close()
+	}
+}
@@ -0,0 +1,217 @@
+// Package dsync provides namespace locks shared by the gateways of a
+// cluster: a lock is taken once a quorum of the gateways granted it, and
+// held as long as its lease is refreshed on a quorum of them.
+package dsync
+
+import (
+	"context"
+	"github.com/google/uuid"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/yann-y/fds/internal/lock"
+	"github.com/yann-y/fds/internal/metrics"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+var log = logging.Logger("dsync")
+
+const (
+	// DefaultRefreshInterval - the interval the lease of a lock held is
+	// refreshed at.
+	DefaultRefreshInterval = 10 * time.Second
+	// callTimeout - the timeout of a single call to a locker.
+	callTimeout = 5 * time.Second
+	// lockRetryInterval - the maximum time waited before a lock which did
+	// not reach its quorum is tried again.
+	lockRetryInterval = 250 * time.Millisecond
+)
+
+// Dsync - the lock provider of the lockers of a cluster, one per gateway.
+type Dsync struct {
+	lockers         []NetLocker
+	refreshInterval time.Duration
+}
+
+// New returns the lock provider of lockers, refreshing the leases of the
+// locks held every refreshInterval.
+func New(lockers []NetLocker, refreshInterval time.Duration) *Dsync {
+	if refreshInterval <= 0 {
+		refreshInterval = DefaultRefreshInterval
+	}
+	return &Dsync{lockers: lockers, refreshInterval: refreshInterval}
+}
+
+// NewNSLock - returns a lock instance for a given volume and paths.
+func (ds *Dsync) NewNSLock(volume string, paths ...string) lock.RWLocker {
+	resources := make([]string, 0, len(paths))
+	for _, path := range paths {
+		resources = append(resources, lock.PathJoin(volume, path))
+	}
+	sort.Strings(resources)
+	return &distLockInstance{ds: ds, resources: resources}
+}
+
+// quorum - the number of lockers a lock must be granted by, more than half
+// of them for a write lock so that two writers never both reach it.
+func (ds *Dsync) quorum(readLock bool) int {
+	tolerance := len(ds.lockers) / 2
+	quorum := len(ds.lockers) - tolerance
+	if !readLock && quorum == tolerance {
+		quorum++
+	}
+	return quorum
+}
+
+// call - calls fn on every locker in parallel, returns whether each locker
+// answered true.
+func (ds *Dsync) call(ctx context.Context, fn func(ctx context.Context, locker NetLocker) (bool, error)) []bool {
+	results := make([]bool, len(ds.lockers))
+	var wg sync.WaitGroup
+	for i, locker := range ds.lockers {
+		wg.Add(1)
+		go func(i int, locker NetLocker) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, callTimeout)
+			defer cancel()
+			ok, err := fn(ctx, locker)
+			if err != nil {
+				log.Debugf("lock call to %s err:%v", locker, err)
+			}
+			results[i] = ok && err == nil
+		}(i, locker)
+	}
+	wg.Wait()
+	return results
+}
+
+// distLockInstance - a lock of resources on the lockers of a cluster.
+type distLockInstance struct {
+	ds        *Dsync
+	resources []string
+	uid       string
+}
+
+// GetLock - block until write lock is taken or timeout has occurred.
+func (li *distLockInstance) GetLock(ctx context.Context, timeout time.Duration) (lock.LockContext, error) {
+	const readLock = false
+	return li.lock(ctx, timeout, readLock)
+}
+
+// Unlock - releases the write lock.
+func (li *distLockInstance) Unlock(cancel context.CancelFunc) {
+	const readLock = false
+	li.unlock(cancel, readLock)
+}
+
+// GetRLock - block until read lock is taken or timeout has occurred.
+func (li *distLockInstance) GetRLock(ctx context.Context, timeout time.Duration) (lock.LockContext, error) {
+	const readLock = true
+	return li.lock(ctx, timeout, readLock)
+}
+
+// RUnlock - releases the read lock.
+func (li *distLockInstance) RUnlock(cancel context.CancelFunc) {
+	const readLock = true
+	li.unlock(cancel, readLock)
+}
+
+func (li *distLockInstance) args() LockArgs {
+	return LockArgs{UID: li.uid, Resources: li.resources}
+}
+
+// lock - tries to take the lock on a quorum of lockers until timeout, the
+// context returned is canceled once the lock is lost.
+func (li *distLockInstance) lock(ctx context.Context, timeout time.Duration, readLock bool) (lock.LockContext, error) {
+	start := time.Now()
+	retryCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for {
+		li.uid = uuid.NewString()
+		if li.tryLock(retryCtx, readLock) {
+			metrics.ObserveLockWait(readLock, true, time.Since(start))
+			lkCtx, lkCancel := context.WithCancel(ctx)
+			go li.refresh(lkCtx, lkCancel, li.args(), readLock)
+			return lock.NewLockContext(lkCtx, lkCancel), nil
+		}
+		select {
+		case <-retryCtx.Done():
+			metrics.ObserveLockWait(readLock, false, time.Since(start))
+			return lock.LockContext{}, lock.OperationTimedOut{}
+		case <-time.After(time.Duration(r.Float64() * float64(lockRetryInterval))):
+		}
+	}
+}
+
+// tryLock - takes the lock on every locker, releasing it when it is not
+// granted by a quorum.
+func (li *distLockInstance) tryLock(ctx context.Context, readLock bool) bool {
+	args := li.args()
+	granted := li.ds.call(ctx, func(ctx context.Context, locker NetLocker) (bool, error) {
+		if readLock {
+			return locker.RLock(ctx, args)
+		}
+		return locker.Lock(ctx, args)
+	})
+	if count(granted) >= li.ds.quorum(readLock) {
+		return true
+	}
+	// every locker, a grant may have been lost to a timeout
+	go li.release(args, readLock)
+	return false
+}
+
+// refresh - refreshes the lease of the lock until ctx is done, cancels ctx
+// when the lock is no longer held by a quorum.
+func (li *distLockInstance) refresh(ctx context.Context, cancel context.CancelFunc, args LockArgs, readLock bool) {
+	ticker := time.NewTicker(li.ds.refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			refreshed := li.ds.call(ctx, func(ctx context.Context, locker NetLocker) (bool, error) {
+				return locker.Refresh(ctx, args)
+			})
+			if ctx.Err() != nil {
+				return
+			}
+			if count(refreshed) < li.ds.quorum(readLock) {
+				log.Errorf("lock %v lost, refreshed by %d of %d lockers", args.Resources, count(refreshed), len(li.ds.lockers))
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// unlock - stops refreshing the lock and releases it.
+func (li *distLockInstance) unlock(cancel context.CancelFunc, readLock bool) {
+	if cancel != nil {
+		cancel()
+	}
+	li.release(li.args(), readLock)
+}
+
+// release - releases the lock of args on every locker.
+func (li *distLockInstance) release(args LockArgs, readLock bool) {
+	li.ds.call(context.Background(), func(ctx context.Context, locker NetLocker) (bool, error) {
+		if readLock {
+			return locker.RUnlock(ctx, args)
+		}
+		return locker.Unlock(ctx, args)
+	})
+}
+
+func count(results []bool) int {
+	n := 0
+	for _, ok := range results {
+		if ok {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,257 @@
+package dsync
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/yann-y/fds/internal/lock"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testSecret = "secret"
+
+// testCluster - gateways on localhost ports, each with its local locker and
+// the lockers of its peers.
+type testCluster struct {
+	lockers []*LocalLocker
+	servers []*httptest.Server
+	nodes   []*Dsync
+}
+
+func newTestCluster(t *testing.T, n int, validity, refreshInterval time.Duration) *testCluster {
+	c := &testCluster{}
+	for i := 0; i < n; i++ {
+		locker := NewLocalLocker(validity)
+		router := mux.NewRouter()
+		RegisterLockServer(router, locker, testSecret)
+		c.lockers = append(c.lockers, locker)
+		c.servers = append(c.servers, httptest.NewServer(router))
+	}
+	t.Cleanup(func() {
+		for _, server := range c.servers {
+			server.Close()
+		}
+	})
+	for i := 0; i < n; i++ {
+		lockers := []NetLocker{c.lockers[i]}
+		for j, server := range c.servers {
+			if j == i {
+				continue
+			}
+			peer, err := NewRestLocker(server.URL, testSecret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lockers = append(lockers, peer)
+		}
+		c.nodes = append(c.nodes, New(lockers, refreshInterval))
+	}
+	return c
+}
+
+func TestLocalLocker(t *testing.T) {
+	l := NewLocalLocker(time.Minute)
+	ctx := context.Background()
+	a := LockArgs{UID: "a", Resources: []string{"bucket/x", "bucket/y"}}
+	b := LockArgs{UID: "b", Resources: []string{"bucket/y"}}
+	c := LockArgs{UID: "c", Resources: []string{"bucket/y"}}
+
+	testCases := []struct {
+		name     string
+		fn       func(ctx context.Context, args LockArgs) (bool, error)
+		args     LockArgs
+		expected bool
+	}{
+		{"lock a", l.Lock, a, true},
+		{"lock b", l.Lock, b, false},
+		{"rlock b", l.RLock, b, false},
+		{"runlock a", l.RUnlock, a, false},
+		{"refresh a", l.Refresh, a, true},
+		{"refresh b", l.Refresh, b, false},
+		{"unlock a", l.Unlock, a, true},
+		{"rlock b", l.RLock, b, true},
+		{"rlock c", l.RLock, c, true},
+		{"lock a", l.Lock, a, false},
+		{"runlock b", l.RUnlock, b, true},
+		{"runlock b", l.RUnlock, b, false},
+		{"runlock c", l.RUnlock, c, true},
+		{"lock a", l.Lock, a, true},
+	}
+	for i, testCase := range testCases {
+		ok, err := testCase.fn(ctx, testCase.args)
+		if err != nil {
+			t.Fatalf("Test %d: %s failed with %v", i+1, testCase.name, err)
+		}
+		if ok != testCase.expected {
+			t.Errorf("Test %d: Expected %s to return %v, but instead found %v", i+1, testCase.name, testCase.expected, ok)
+		}
+	}
+
+	if n := l.expire(time.Now().Add(2 * time.Minute)); n != 2 {
+		t.Errorf("Expected 2 locks expired, but instead found %d", n)
+	}
+	if ok, _ := l.Lock(ctx, b); !ok {
+		t.Error("Expected the expired lock to be taken")
+	}
+}
+
+func TestQuorum(t *testing.T) {
+	testCases := []struct {
+		lockers  int
+		readLock bool
+		expected int
+	}{
+		{1, false, 1},
+		{1, true, 1},
+		{2, false, 2},
+		{2, true, 1},
+		{3, false, 2},
+		{3, true, 2},
+		{4, false, 3},
+		{4, true, 2},
+		{5, false, 3},
+		{5, true, 3},
+	}
+	for i, testCase := range testCases {
+		ds := New(make([]NetLocker, testCase.lockers), 0)
+		if quorum := ds.quorum(testCase.readLock); quorum != testCase.expected {
+			t.Errorf("Test %d: Expected quorum %d, but instead found %d", i+1, testCase.expected, quorum)
+		}
+	}
+}
+
+func TestDsyncMutualExclusion(t *testing.T) {
+	c := newTestCluster(t, 3, time.Minute, time.Minute)
+	ctx := context.Background()
+
+	a := c.nodes[0].NewNSLock("bucket", "object")
+	lkctx, err := a.GetLock(ctx, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := c.nodes[1].NewNSLock("bucket", "object")
+	if _, err = b.GetLock(ctx, 300*time.Millisecond); !errors.Is(err, lock.OperationTimedOut{}) {
+		t.Fatalf("Expected the write lock to be held by another gateway, but instead found %v", err)
+	}
+	if _, err = b.GetRLock(ctx, 300*time.Millisecond); !errors.Is(err, lock.OperationTimedOut{}) {
+		t.Fatalf("Expected the read lock to wait for the write lock, but instead found %v", err)
+	}
+	other := c.nodes[2].NewNSLock("bucket", "other")
+	otherCtx, err := other.GetLock(ctx, time.Second)
+	if err != nil {
+		t.Fatalf("Expected another object to be locked, but instead found %v", err)
+	}
+	other.Unlock(otherCtx.Cancel)
+
+	a.Unlock(lkctx.Cancel)
+	if lkctx.Context().Err() == nil {
+		t.Error("Expected the lock context to be canceled on unlock")
+	}
+	rlkctx, err := b.GetRLock(ctx, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := c.nodes[2].NewNSLock("bucket", "object")
+	rlkctx2, err := r.GetRLock(ctx, time.Second)
+	if err != nil {
+		t.Fatalf("Expected read locks to be shared, but instead found %v", err)
+	}
+	if _, err = c.nodes[0].NewNSLock("bucket", "object").GetLock(ctx, 300*time.Millisecond); err == nil {
+		t.Fatal("Expected the write lock to wait for the read locks")
+	}
+	b.RUnlock(rlkctx.Cancel)
+	r.RUnlock(rlkctx2.Cancel)
+	w := c.nodes[0].NewNSLock("bucket", "object")
+	wlkctx, err := w.GetLock(ctx, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Unlock(wlkctx.Cancel)
+}
+
+func TestDsyncQuorumLoss(t *testing.T) {
+	c := newTestCluster(t, 3, time.Minute, time.Minute)
+	ctx := context.Background()
+
+	c.servers[2].Close()
+	lk := c.nodes[0].NewNSLock("bucket", "object")
+	lkctx, err := lk.GetLock(ctx, time.Second)
+	if err != nil {
+		t.Fatalf("Expected the lock to reach its quorum with a peer down, but instead found %v", err)
+	}
+	lk.Unlock(lkctx.Cancel)
+
+	c.servers[1].Close()
+	if _, err = lk.GetLock(ctx, 300*time.Millisecond); err == nil {
+		t.Fatal("Expected the lock to fail without a quorum")
+	}
+	if _, err = lk.GetRLock(ctx, 300*time.Millisecond); err == nil {
+		t.Fatal("Expected the read lock to fail without a quorum")
+	}
+}
+
+func TestDsyncLease(t *testing.T) {
+	const validity = 200 * time.Millisecond
+	c := newTestCluster(t, 3, validity, 50*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, locker := range c.lockers {
+		locker.Start(ctx)
+	}
+
+	// a refreshed lock outlives its validity
+	lk := c.nodes[0].NewNSLock("bucket", "object")
+	lkctx, err := lk.GetLock(ctx, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(3 * validity)
+	if _, err = c.nodes[1].NewNSLock("bucket", "object").GetLock(ctx, 100*time.Millisecond); err == nil {
+		t.Fatal("Expected the refreshed lock to be held")
+	}
+	lk.Unlock(lkctx.Cancel)
+
+	// the lock of a crashed gateway, never refreshed, expires
+	crashed := LockArgs{UID: "crashed", Resources: []string{"bucket/object"}}
+	for _, locker := range c.lockers {
+		if ok, _ := locker.Lock(ctx, crashed); !ok {
+			t.Fatal("Expected the lock to be granted")
+		}
+	}
+	lkctx, err = c.nodes[1].NewNSLock("bucket", "object").GetLock(ctx, 3*validity)
+	if err != nil {
+		t.Fatalf("Expected the stale lock to expire, but instead found %v", err)
+	}
+	lkctx.Cancel()
+
+	// a lock no longer held by a quorum is lost
+	lk = c.nodes[2].NewNSLock("bucket", "lost")
+	lkctx, err = lk.GetLock(ctx, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lost := LockArgs{UID: lk.(*distLockInstance).uid, Resources: []string{"bucket/lost"}}
+	c.lockers[0].Unlock(ctx, lost)
+	c.lockers[1].Unlock(ctx, lost)
+	select {
+	case <-lkctx.Context().Done():
+	case <-time.After(time.Second):
+		t.Error("Expected the lost lock context to be canceled")
+	}
+}
+
+func TestRestLockerAuth(t *testing.T) {
+	c := newTestCluster(t, 1, time.Minute, time.Minute)
+	peer, err := NewRestLocker(c.servers[0].URL, "wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = peer.Lock(context.Background(), LockArgs{UID: "a", Resources: []string{"r"}}); err == nil {
+		t.Error("Expected a wrong secret to be rejected")
+	}
+	if _, err = NewRestLocker("ftp://host", testSecret); err == nil {
+		t.Error("Expected an invalid peer to fail")
+	}
+}
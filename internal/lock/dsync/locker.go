@@ -0,0 +1,196 @@
+package dsync
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultLockValidity - the time a lock is held without being refreshed
+// before it is taken for the lock of a crashed gateway and expired.
+const DefaultLockValidity = time.Minute
+
+// LockArgs - the arguments of a lock call.
+type LockArgs struct {
+	// UID identifies the lock instance, the same on every locker.
+	UID       string   `json:"uid"`
+	Resources []string `json:"resources"`
+}
+
+// NetLocker - a locker of a gateway, either the local one or a peer reached
+// over the network.
+type NetLocker interface {
+	// Lock takes a write lock on every resource, or none.
+	Lock(ctx context.Context, args LockArgs) (bool, error)
+	// RLock takes a read lock on every resource, or none.
+	RLock(ctx context.Context, args LockArgs) (bool, error)
+	Unlock(ctx context.Context, args LockArgs) (bool, error)
+	RUnlock(ctx context.Context, args LockArgs) (bool, error)
+	// Refresh extends the lease of the locks of args.UID, false when the
+	// locker no longer holds them.
+	Refresh(ctx context.Context, args LockArgs) (bool, error)
+	// String identifies the locker in logs.
+	String() string
+}
+
+// lockRequesterInfo - a lock granted on a resource.
+type lockRequesterInfo struct {
+	uid         string
+	writer      bool
+	lastRefresh time.Time
+}
+
+// LocalLocker - the lock table of a gateway, serving its own locks and
+// those of its peers.
+type LocalLocker struct {
+	mu       sync.Mutex
+	lockMap  map[string][]lockRequesterInfo
+	validity time.Duration
+}
+
+// NewLocalLocker returns a locker expiring the locks not refreshed for
+// validity.
+func NewLocalLocker(validity time.Duration) *LocalLocker {
+	if validity <= 0 {
+		validity = DefaultLockValidity
+	}
+	return &LocalLocker{
+		lockMap:  make(map[string][]lockRequesterInfo),
+		validity: validity,
+	}
+}
+
+// Start - expires the stale locks until ctx is done.
+func (l *LocalLocker) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(l.validity / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if n := l.expire(time.Now()); n > 0 {
+					log.Warnf("%d stale locks expired", n)
+				}
+			}
+		}
+	}()
+}
+
+// Lock - takes a write lock on every resource none is locked.
+func (l *LocalLocker) Lock(ctx context.Context, args LockArgs) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, resource := range args.Resources {
+		if len(l.lockMap[resource]) > 0 {
+			return false, nil
+		}
+	}
+	now := time.Now()
+	for _, resource := range args.Resources {
+		l.lockMap[resource] = []lockRequesterInfo{{uid: args.UID, writer: true, lastRefresh: now}}
+	}
+	return true, nil
+}
+
+// RLock - takes a read lock on every resource when none is write locked.
+func (l *LocalLocker) RLock(ctx context.Context, args LockArgs) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, resource := range args.Resources {
+		if lri := l.lockMap[resource]; len(lri) > 0 && lri[0].writer {
+			return false, nil
+		}
+	}
+	now := time.Now()
+	for _, resource := range args.Resources {
+		l.lockMap[resource] = append(l.lockMap[resource], lockRequesterInfo{uid: args.UID, lastRefresh: now})
+	}
+	return true, nil
+}
+
+// Unlock - releases the write locks of args.UID.
+func (l *LocalLocker) Unlock(ctx context.Context, args LockArgs) (bool, error) {
+	const writer = true
+	return l.release(args, writer), nil
+}
+
+// RUnlock - releases the read locks of args.UID.
+func (l *LocalLocker) RUnlock(ctx context.Context, args LockArgs) (bool, error) {
+	const writer = false
+	return l.release(args, writer), nil
+}
+
+// Refresh - extends the lease of the locks of args.UID.
+func (l *LocalLocker) Refresh(ctx context.Context, args LockArgs) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	refreshed := true
+	for _, resource := range args.Resources {
+		found := false
+		for i := range l.lockMap[resource] {
+			if l.lockMap[resource][i].uid == args.UID {
+				l.lockMap[resource][i].lastRefresh = now
+				found = true
+			}
+		}
+		refreshed = refreshed && found
+	}
+	return refreshed, nil
+}
+
+// String - identifies the local locker.
+func (l *LocalLocker) String() string {
+	return "local"
+}
+
+// release - removes a lock of args.UID from every resource, true when each
+// resource had one.
+func (l *LocalLocker) release(args LockArgs, writer bool) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	released := true
+	for _, resource := range args.Resources {
+		lri := l.lockMap[resource]
+		i := 0
+		for i < len(lri) && (lri[i].uid != args.UID || lri[i].writer != writer) {
+			i++
+		}
+		if i == len(lri) {
+			released = false
+			continue
+		}
+		if lri = append(lri[:i], lri[i+1:]...); len(lri) == 0 {
+			delete(l.lockMap, resource)
+		} else {
+			l.lockMap[resource] = lri
+		}
+	}
+	return released
+}
+
+// expire - removes the locks not refreshed since now minus the validity,
+// returns the number of locks removed.
+func (l *LocalLocker) expire(now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	expired := 0
+	for resource, lri := range l.lockMap {
+		kept := lri[:0]
+		for _, info := range lri {
+			if now.Sub(info.lastRefresh) > l.validity {
+				expired++
+				continue
+			}
+			kept = append(kept, info)
+		}
+		if len(kept) == 0 {
+			delete(l.lockMap, resource)
+		} else {
+			l.lockMap[resource] = kept
+		}
+	}
+	return expired
+}
@@ -0,0 +1,143 @@
+package dsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/yann-y/fds/internal/consts"
+	"github.com/yann-y/fds/internal/utils"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// LockPathPrefix - the path prefix of the lock calls served to peers.
+const LockPathPrefix = "/cluster/v1/lock"
+
+// lockResponse - the answer of a lock call.
+type lockResponse struct {
+	Success bool `json:"success"`
+}
+
+// lockServer - serves the calls of the peers to the local locker.
+type lockServer struct {
+	locker *LocalLocker
+	secret string
+}
+
+// RegisterLockServer serves the calls of the peers to locker on router, the
+// peers authenticate with secret as bearer token.
+func RegisterLockServer(router *mux.Router, locker *LocalLocker, secret string) {
+	s := &lockServer{locker: locker, secret: secret}
+	lockRouter := router.PathPrefix(LockPathPrefix).Subrouter()
+	lockRouter.Methods(http.MethodPost).Path("/lock").HandlerFunc(s.handle(locker.Lock))
+	lockRouter.Methods(http.MethodPost).Path("/rlock").HandlerFunc(s.handle(locker.RLock))
+	lockRouter.Methods(http.MethodPost).Path("/unlock").HandlerFunc(s.handle(locker.Unlock))
+	lockRouter.Methods(http.MethodPost).Path("/runlock").HandlerFunc(s.handle(locker.RUnlock))
+	lockRouter.Methods(http.MethodPost).Path("/refresh").HandlerFunc(s.handle(locker.Refresh))
+}
+
+func (s *lockServer) handle(fn func(ctx context.Context, args LockArgs) (bool, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !utils.BearerTokenMatches(r, s.secret) {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		var args LockArgs
+		if err := json.NewDecoder(r.Body).Decode(&args); err != nil || args.UID == "" || len(args.Resources) == 0 {
+			http.Error(w, "invalid lock arguments", http.StatusBadRequest)
+			return
+		}
+		ok, err := fn(r.Context(), args)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(consts.ContentType, "application/json")
+		json.NewEncoder(w).Encode(lockResponse{Success: ok})
+	}
+}
+
+// RestLocker - the locker of a peer, called over HTTP.
+type RestLocker struct {
+	endpoint string
+	secret   string
+	client   *http.Client
+}
+
+// NewRestLocker returns the locker of the peer at endpoint, such as
+// http://10.0.0.2:9985.
+func NewRestLocker(endpoint, secret string) (*RestLocker, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid cluster peer %q", u.Redacted())
+	}
+	return &RestLocker{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		secret:   secret,
+		client:   &http.Client{},
+	}, nil
+}
+
+// Lock - takes a write lock on the peer.
+func (l *RestLocker) Lock(ctx context.Context, args LockArgs) (bool, error) {
+	return l.call(ctx, "lock", args)
+}
+
+// RLock - takes a read lock on the peer.
+func (l *RestLocker) RLock(ctx context.Context, args LockArgs) (bool, error) {
+	return l.call(ctx, "rlock", args)
+}
+
+// Unlock - releases a write lock on the peer.
+func (l *RestLocker) Unlock(ctx context.Context, args LockArgs) (bool, error) {
+	return l.call(ctx, "unlock", args)
+}
+
+// RUnlock - releases a read lock on the peer.
+func (l *RestLocker) RUnlock(ctx context.Context, args LockArgs) (bool, error) {
+	return l.call(ctx, "runlock", args)
+}
+
+// Refresh - extends the lease of a lock on the peer.
+func (l *RestLocker) Refresh(ctx context.Context, args LockArgs) (bool, error) {
+	return l.call(ctx, "refresh", args)
+}
+
+// String - returns the endpoint of the peer.
+func (l *RestLocker) String() string {
+	return l.endpoint
+}
+
+func (l *RestLocker) call(ctx context.Context, method string, args LockArgs) (bool, error) {
+	body, err := json.Marshal(args)
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.endpoint+LockPathPrefix+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set(consts.Authorization, "Bearer "+l.secret)
+	req.Header.Set(consts.ContentType, "application/json")
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return false, fmt.Errorf("lock %s on %s returned %s", method, l.endpoint, resp.Status)
+	}
+	var result lockResponse
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, err
+	}
+	return result.Success, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	logging "github.com/ipfs/go-log/v2"
+	"github.com/yann-y/fds/internal/metrics"
 	"path"
 	"sort"
 	"strings"
@@ -28,12 +29,23 @@ type RWLocker interface {
 	RUnlock(cancel context.CancelFunc)
 }
 
+// Provider - provides the namespace locks of volume and paths, such as the
+// in-process NsLockMap or the locks shared by the gateways of a cluster.
+type Provider interface {
+	NewNSLock(volume string, paths ...string) RWLocker
+}
+
 // LockContext lock context holds the lock backed context and canceler for the context.
 type LockContext struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 }
 
+// NewLockContext returns the lock context of ctx, canceled by cancel.
+func NewLockContext(ctx context.Context, cancel context.CancelFunc) LockContext {
+	return LockContext{ctx: ctx, cancel: cancel}
+}
+
 // Context returns lock context
 func (l LockContext) Context() context.Context {
 	return l.ctx
@@ -82,11 +94,13 @@ func (n *NsLockMap) lock(ctx context.Context, volume string, path string, readLo
 	n.lockMapMutex.Unlock()
 
 	// Locking here will block (until timeout).
+	start := time.Now()
 	if readLock {
 		locked = nsLk.GetRLock(ctx, timeout)
 	} else {
 		locked = nsLk.GetLock(ctx, timeout)
 	}
+	metrics.ObserveLockWait(readLock, locked, time.Since(start))
 
 	if !locked { // We failed to get the lock
 		// Decrement ref count since we failed to get the lock
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/yann-y/fds/internal/reqinfo"
+	"github.com/yann-y/fds/internal/utils"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Handler records the API metrics of every request served by h, the API name
+// and the bucket are those of the route recorded by reqinfo.SetRoute. The
+// bytes of a bucket are recorded for the requests which succeed only.
+func Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		apiRequestsInFlight.Inc()
+		defer apiRequestsInFlight.Dec()
+
+		info := reqinfo.Serve(h, w, r)
+
+		apiRequestsTotal.WithLabelValues(info.API, strconv.Itoa(info.StatusCode)).Inc()
+		apiRequestDuration.WithLabelValues(info.API).Observe(time.Since(start).Seconds())
+		// the failed requests may name any bucket, the labels are kept to
+		// those which exist
+		if info.Bucket != "" && info.StatusCode < http.StatusBadRequest {
+			bucketRxBytes.WithLabelValues(info.Bucket).Add(float64(info.InputBytes))
+			bucketTxBytes.WithLabelValues(info.Bucket).Add(float64(info.OutputBytes))
+		}
+	})
+}
+
+// NewEndpoint returns the handler serving the metrics in the Prometheus
+// format, requests must carry token as bearer token unless token is empty.
+func NewEndpoint(token string) http.Handler {
+	h := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	if token == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !utils.BearerTokenMatches(r, token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,201 @@
+// Package metrics exports Prometheus metrics of the API, the storage and the
+// IPFS pool.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"time"
+)
+
+const namespace = "fds"
+
+// Registry - the registry of every metric exported.
+var Registry = prometheus.NewRegistry()
+
+var (
+	apiRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "api",
+		Name:      "requests_total",
+		Help:      "Total number of API requests by API and status code.",
+	}, []string{"api", "status"})
+	apiRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "api",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of API requests by API.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"api"})
+	apiRequestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "api",
+		Name:      "requests_in_flight",
+		Help:      "Number of API requests being served.",
+	})
+	bucketRxBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "bucket",
+		Name:      "rx_bytes_total",
+		Help:      "Total number of request body bytes received by bucket.",
+	}, []string{"bucket"})
+	bucketTxBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "bucket",
+		Name:      "tx_bytes_total",
+		Help:      "Total number of response body bytes sent by bucket.",
+	}, []string{"bucket"})
+
+	lockWaitDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "lock",
+		Name:      "wait_seconds",
+		Help:      "Time spent waiting for namespace locks by lock type.",
+		Buckets:   []float64{.0001, .001, .01, .05, .1, .5, 1, 5, 10, 30},
+	}, []string{"type"})
+	lockTimeoutsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "lock",
+		Name:      "timeouts_total",
+		Help:      "Total number of namespace locks not acquired in time by lock type.",
+	}, []string{"type"})
+
+	gcRunsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "gc",
+		Name:      "runs_total",
+		Help:      "Total number of object GC runs.",
+	})
+	gcErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "gc",
+		Name:      "errors_total",
+		Help:      "Total number of object GC runs stopped by an error.",
+	})
+	gcObjectsRemovedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "gc",
+		Name:      "objects_removed_total",
+		Help:      "Total number of deleted object DAGs removed by the object GC.",
+	})
+	gcDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "gc",
+		Name:      "duration_seconds",
+		Help:      "Duration of object GC runs.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 4, 8),
+	})
+
+	ipfsRPCDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "ipfs",
+		Name:      "rpc_duration_seconds",
+		Help:      "Latency of kubo RPC calls by node and method.",
+		Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"node", "method"})
+	ipfsRPCErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ipfs",
+		Name:      "rpc_errors_total",
+		Help:      "Total number of failed kubo RPC calls by node and method.",
+	}, []string{"node", "method"})
+
+	rateLimitRejectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ratelimit",
+		Name:      "rejected_total",
+		Help:      "Total number of requests rejected with SlowDown by scope and limit.",
+	}, []string{"scope", "limit"})
+	rateLimitThrottledSeconds = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ratelimit",
+		Name:      "throttled_seconds_total",
+		Help:      "Total time request and response bodies were slowed down by the bytes limits.",
+	})
+	rateLimitLimiters = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "ratelimit",
+		Name:      "limiters",
+		Help:      "Number of access keys and buckets whose limits are partly used by scope.",
+	}, []string{"scope"})
+	rateLimitInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "ratelimit",
+		Name:      "in_flight",
+		Help:      "Number of requests counted against the in-flight limit of their access key.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		apiRequestsTotal,
+		apiRequestDuration,
+		apiRequestsInFlight,
+		bucketRxBytes,
+		bucketTxBytes,
+		lockWaitDuration,
+		lockTimeoutsTotal,
+		gcRunsTotal,
+		gcErrorsTotal,
+		gcObjectsRemovedTotal,
+		gcDuration,
+		ipfsRPCDuration,
+		ipfsRPCErrorsTotal,
+		rateLimitRejectedTotal,
+		rateLimitThrottledSeconds,
+		rateLimitLimiters,
+		rateLimitInFlight,
+	)
+}
+
+// ObserveLockWait records the time waited for a namespace lock and whether
+// it was acquired.
+func ObserveLockWait(readLock, locked bool, d time.Duration) {
+	lockType := "write"
+	if readLock {
+		lockType = "read"
+	}
+	lockWaitDuration.WithLabelValues(lockType).Observe(d.Seconds())
+	if !locked {
+		lockTimeoutsTotal.WithLabelValues(lockType).Inc()
+	}
+}
+
+// ObserveGC records an object GC run which removed the DAGs of removed
+// objects, failed tells whether it was stopped by an error.
+func ObserveGC(removed int, failed bool, d time.Duration) {
+	gcRunsTotal.Inc()
+	if failed {
+		gcErrorsTotal.Inc()
+	}
+	gcObjectsRemovedTotal.Add(float64(removed))
+	gcDuration.Observe(d.Seconds())
+}
+
+// ObserveIPFSRPC records a kubo RPC call of method to node started at start.
+func ObserveIPFSRPC(node, method string, start time.Time, err error) {
+	ipfsRPCDuration.WithLabelValues(node, method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		ipfsRPCErrorsTotal.WithLabelValues(node, method).Inc()
+	}
+}
+
+// ObserveRateLimited records a request rejected by the limit of scope.
+func ObserveRateLimited(scope, limit string) {
+	rateLimitRejectedTotal.WithLabelValues(scope, limit).Inc()
+}
+
+// ObserveThrottled records the time a body was slowed down for.
+func ObserveThrottled(d time.Duration) {
+	rateLimitThrottledSeconds.Add(d.Seconds())
+}
+
+// SetRateLimitState records the number of access keys and buckets whose
+// limits are partly used, and the requests counted in flight.
+func SetRateLimitState(keys, buckets, inFlight int) {
+	rateLimitLimiters.WithLabelValues("key").Set(float64(keys))
+	rateLimitLimiters.WithLabelValues("bucket").Set(float64(buckets))
+	rateLimitInFlight.Set(float64(inFlight))
+}
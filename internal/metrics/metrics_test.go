@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/yann-y/fds/internal/reqinfo"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testServer struct{}
+
+func (testServer) PutObjectHandler(w http.ResponseWriter, r *http.Request) {
+	if _, err := io.Copy(io.Discard, r.Body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+// errReader - a request body which fails once read.
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func (testServer) GetObjectHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func TestHandler(t *testing.T) {
+	var s testServer
+	router := mux.NewRouter()
+	bucket := router.PathPrefix("/{bucket}").Subrouter()
+	bucket.Methods(http.MethodPut).Path("/{object:.+}").HandlerFunc(s.PutObjectHandler)
+	bucket.Methods(http.MethodGet).Path("/{object:.+}").HandlerFunc(s.GetObjectHandler)
+	router.Use(reqinfo.SetRoute)
+	handler := Handler(router)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/test-handler/a", strings.NewReader("hello")))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/test-handler/b", strings.NewReader("hi")))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test-handler/a", nil))
+	// the failed requests add no bucket label
+	series := testutil.CollectAndCount(bucketRxBytes)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/test-handler/a", errReader{}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test-handler-missing/a", nil))
+	if n := testutil.CollectAndCount(bucketRxBytes); n != series {
+		t.Errorf("Expected %d bucket labels, but instead found %d", series, n)
+	}
+
+	testCases := []struct {
+		name     string
+		value    float64
+		expected float64
+	}{
+		{"put requests", testutil.ToFloat64(apiRequestsTotal.WithLabelValues("PutObject", "200")), 2},
+		{"failed put requests", testutil.ToFloat64(apiRequestsTotal.WithLabelValues("PutObject", "400")), 1},
+		{"get requests", testutil.ToFloat64(apiRequestsTotal.WithLabelValues("GetObject", "404")), 2},
+		{"rx bytes", testutil.ToFloat64(bucketRxBytes.WithLabelValues("test-handler")), 7},
+		{"tx bytes", testutil.ToFloat64(bucketTxBytes.WithLabelValues("test-handler")), 4},
+		{"in flight", testutil.ToFloat64(apiRequestsInFlight), 0},
+	}
+	for i, testCase := range testCases {
+		if testCase.value != testCase.expected {
+			t.Errorf("Test %d: Expected %s to be %v, but instead found %v", i+1, testCase.name, testCase.expected, testCase.value)
+		}
+	}
+}
+
+func TestObserve(t *testing.T) {
+	ObserveLockWait(true, true, time.Millisecond)
+	ObserveLockWait(false, false, time.Second)
+	ObserveGC(3, false, time.Second)
+	ObserveGC(1, true, time.Second)
+	ObserveIPFSRPC("test-node", "block/put", time.Now(), nil)
+	ObserveIPFSRPC("test-node", "block/put", time.Now(), errors.New("down"))
+	ObserveRateLimited("key", "requests")
+	ObserveThrottled(2 * time.Second)
+	SetRateLimitState(3, 1, 5)
+
+	testCases := []struct {
+		name     string
+		value    float64
+		expected float64
+	}{
+		{"read lock timeouts", testutil.ToFloat64(lockTimeoutsTotal.WithLabelValues("read")), 0},
+		{"write lock timeouts", testutil.ToFloat64(lockTimeoutsTotal.WithLabelValues("write")), 1},
+		{"gc runs", testutil.ToFloat64(gcRunsTotal), 2},
+		{"gc errors", testutil.ToFloat64(gcErrorsTotal), 1},
+		{"gc objects removed", testutil.ToFloat64(gcObjectsRemovedTotal), 4},
+		{"rpc errors", testutil.ToFloat64(ipfsRPCErrorsTotal.WithLabelValues("test-node", "block/put")), 1},
+		{"rate limited", testutil.ToFloat64(rateLimitRejectedTotal.WithLabelValues("key", "requests")), 1},
+		{"throttled", testutil.ToFloat64(rateLimitThrottledSeconds), 2},
+		{"key limiters", testutil.ToFloat64(rateLimitLimiters.WithLabelValues("key")), 3},
+		{"rate limit in flight", testutil.ToFloat64(rateLimitInFlight), 5},
+	}
+	for i, testCase := range testCases {
+		if testCase.value != testCase.expected {
+			t.Errorf("Test %d: Expected %s to be %v, but instead found %v", i+1, testCase.name, testCase.expected, testCase.value)
+		}
+	}
+}
+
+func TestNewEndpoint(t *testing.T) {
+	testCases := []struct {
+		token         string
+		authorization string
+		expectedCode  int
+	}{
+		{"", "", http.StatusOK},
+		{"secret", "Bearer secret", http.StatusOK},
+		{"secret", "", http.StatusUnauthorized},
+		{"secret", "Bearer other", http.StatusUnauthorized},
+		{"secret", "secret", http.StatusUnauthorized},
+	}
+	for i, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if testCase.authorization != "" {
+			req.Header.Set("Authorization", testCase.authorization)
+		}
+		w := httptest.NewRecorder()
+		NewEndpoint(testCase.token).ServeHTTP(w, req)
+		if w.Code != testCase.expectedCode {
+			t.Errorf("Test %d: Expected status %d, but instead found %d", i+1, testCase.expectedCode, w.Code)
+		}
+		if w.Code == http.StatusOK && !strings.Contains(w.Body.String(), "fds_api_requests_in_flight") {
+			t.Errorf("Test %d: Expected the API metrics to be exported", i+1)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Package migrate versions the schema of the metadata db and runs the
+// migrations which bring an older db to the current schema.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/yann-y/fds/internal/kv"
+	"github.com/yann-y/fds/internal/lock"
+	"time"
+)
+
+var log = logging.Logger("migrate")
+
+const (
+	// VersionKey - the key the schema version of the db is stored under.
+	VersionKey = "config/schema_version"
+	// ProgressKey - the key the cursor of a migration interrupted between
+	// its pages is stored under.
+	ProgressKey = "config/schema_progress"
+	// defaultPageSize - the writes of a page of a migration, far below the
+	// size of a raft entry.
+	defaultPageSize = 1000
+	// migrateTimeout - the time waited for the lock of the migrations.
+	migrateTimeout = 10 * time.Minute
+)
+
+// errDryRun - aborts the update of a dry run.
+var errDryRun = errors.New("dry run")
+
+// schemaVersion - the record stored under VersionKey.
+type schemaVersion struct {
+	Version int
+	Updated time.Time
+}
+
+// progress - the record stored under ProgressKey.
+type progress struct {
+	Version int
+	Cursor  string
+}
+
+// Migration - brings the db from the schema version before it to Version.
+type Migration struct {
+	Version int
+	Name    string
+	// Up writes to tx the changes of the records after the key cursor, until
+	// tx holds limit writes, and returns the key of the last record it read,
+	// or "" once every record is read. The pages are applied one at a time
+	// along with their cursor, the last one along with the new schema
+	// version.
+	Up func(ctx context.Context, db *kv.DB, tx *kv.Tx, cursor string, limit int) (string, error)
+}
+
+// Result - the outcome of a migration.
+type Result struct {
+	Version int
+	Name    string
+	// Writes is the number of keys written or deleted
+	Writes int
+}
+
+// Migrator - runs the migrations of a db in order.
+type Migrator struct {
+	db         *kv.DB
+	migrations []Migration
+	nsLock     lock.Provider
+	backup     func(ctx context.Context) error
+	pageSize   int
+}
+
+// New returns the migrator of db, the versions of the migrations start at 1
+// and follow each other.
+func New(db *kv.DB, migrations ...Migration) (*Migrator, error) {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %q has version %d, expected %d", m.Name, m.Version, i+1)
+		}
+	}
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+		nsLock:     lock.NewNSLock(),
+		pageSize:   defaultPageSize,
+	}, nil
+}
+
+// SetLockProvider - sets the provider of the lock which serializes the
+// migrations of the gateways sharing the db, the in-process locks unless set.
+func (m *Migrator) SetLockProvider(provider lock.Provider) {
+	m.nsLock = provider
+}
+
+// SetBackup - sets the backup of the db taken before the migrations.
+func (m *Migrator) SetBackup(backup func(ctx context.Context) error) {
+	m.backup = backup
+}
+
+// Latest - returns the schema version of the last migration.
+func (m *Migrator) Latest() int {
+	return len(m.migrations)
+}
+
+// Version - returns the schema version of the db, 0 before any migration.
+func (m *Migrator) Version() (int, error) {
+	var v schemaVersion
+	if err := m.db.Get(VersionKey, &v); err != nil && err != kv.ErrNotFound {
+		return 0, err
+	}
+	return v.Version, nil
+}
+
+// Run - runs the migrations after the version of the db in order, each one
+// applied page by page and resumed after the last page applied when it was
+// interrupted. A dry run returns what the migrations would write, each one as
+// if the previous ones were applied while none is.
+func (m *Migrator) Run(ctx context.Context, dryRun bool) ([]Result, error) {
+	lk := m.nsLock.NewNSLock("migrate", "schema")
+	lkctx, err := lk.GetLock(ctx, migrateTimeout)
+	if err != nil {
+		return nil, err
+	}
+	ctx = lkctx.Context()
+	defer lk.Unlock(lkctx.Cancel)
+
+	// read under the lock, another gateway may have migrated the db
+	version, err := m.Version()
+	if err != nil {
+		return nil, err
+	}
+	if version > m.Latest() {
+		log.Warnf("metadata schema version %d is newer than the version %d of this gateway", version, m.Latest())
+		return nil, nil
+	}
+	pending := m.migrations[version:]
+	if len(pending) == 0 {
+		return nil, nil
+	}
+	if !dryRun && m.backup != nil {
+		if err = m.backup(ctx); err != nil {
+			return nil, fmt.Errorf("backup before migration: %w", err)
+		}
+	}
+	var p progress
+	if err = m.db.Get(ProgressKey, &p); err != nil && err != kv.ErrNotFound {
+		return nil, err
+	}
+	var results []Result
+	for _, migration := range pending {
+		var cursor string
+		if !dryRun && p.Version == migration.Version {
+			cursor = p.Cursor
+			log.Infof("resume migration %d (%s) after %q", migration.Version, migration.Name, cursor)
+		}
+		result, err := m.run(ctx, migration, cursor, dryRun)
+		if err != nil {
+			return results, fmt.Errorf("migration %d %q: %w", migration.Version, migration.Name, err)
+		}
+		if !dryRun {
+			log.Infof("migrated metadata schema to version %d (%s), %d keys written", migration.Version, migration.Name, result.Writes)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// run - applies the pages of the migration after cursor, each one along with
+// the cursor after it, and the last one along with the version of the
+// migration. A dry run applies none.
+func (m *Migrator) run(ctx context.Context, migration Migration, cursor string, dryRun bool) (Result, error) {
+	result := Result{Version: migration.Version, Name: migration.Name}
+	for {
+		var next string
+		err := m.db.Update(func(tx *kv.Tx) error {
+			var err error
+			if next, err = migration.Up(ctx, m.db, tx, cursor, m.pageSize); err != nil {
+				return err
+			}
+			if next != "" && next == cursor {
+				return fmt.Errorf("page after %q read no record", cursor)
+			}
+			result.Writes += tx.Len()
+			if dryRun {
+				return errDryRun
+			}
+			if next != "" {
+				return tx.Put(ProgressKey, progress{Version: migration.Version, Cursor: next})
+			}
+			tx.Delete(ProgressKey)
+			return tx.Put(VersionKey, schemaVersion{Version: migration.Version, Updated: time.Now().UTC()})
+		})
+		if err != nil && err != errDryRun {
+			return result, err
+		}
+		if next == "" {
+			return result, nil
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,263 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"github.com/yann-y/fds/internal/iam/auth"
+	"github.com/yann-y/fds/internal/kv"
+	"github.com/yann-y/fds/internal/store"
+	"github.com/yann-y/fds/internal/uleveldb"
+	"strings"
+	"testing"
+)
+
+func putMigration(version int, key string) Migration {
+	return Migration{
+		Version: version,
+		Name:    key,
+		Up: func(ctx context.Context, db *kv.DB, tx *kv.Tx, cursor string, limit int) (string, error) {
+			return "", tx.Put(key, version)
+		},
+	}
+}
+
+func TestNew(t *testing.T) {
+	testCases := []struct {
+		versions []int
+		valid    bool
+	}{
+		{nil, true},
+		{[]int{1}, true},
+		{[]int{1, 2, 3}, true},
+		{[]int{0}, false},
+		{[]int{2}, false},
+		{[]int{1, 3}, false},
+		{[]int{2, 1}, false},
+	}
+	for i, testCase := range testCases {
+		var migrations []Migration
+		for _, version := range testCase.versions {
+			migrations = append(migrations, putMigration(version, "key"))
+		}
+		_, err := New(nil, migrations...)
+		if valid := err == nil; valid != testCase.valid {
+			t.Errorf("Test %d: Expected valid %v, but instead found error %v", i+1, testCase.valid, err)
+		}
+	}
+}
+
+func TestMigrator_Run(t *testing.T) {
+	db, err := uleveldb.OpenDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	m, err := New(db, putMigration(1, "a"), putMigration(2, "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backups := 0
+	m.SetBackup(func(ctx context.Context) error {
+		backups++
+		return nil
+	})
+
+	results, err := m.Run(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Writes != 1 || results[1].Writes != 1 {
+		t.Fatalf("Expected 2 migrations writing 1 key, but instead found %+v", results)
+	}
+	var v int
+	if err = db.Get("a", &v); err != kv.ErrNotFound {
+		t.Fatalf("Expected the dry run to write nothing, but instead found %v", err)
+	}
+	if version, _ := m.Version(); version != 0 || backups != 0 {
+		t.Fatalf("Expected version 0 and no backup after the dry run, but instead found version %d and %d backups", version, backups)
+	}
+
+	if results, err = m.Run(ctx, false); err != nil || len(results) != 2 {
+		t.Fatalf("Expected 2 migrations, but instead found %+v, %v", results, err)
+	}
+	if version, _ := m.Version(); version != 2 || backups != 1 {
+		t.Fatalf("Expected version 2 and 1 backup, but instead found version %d and %d backups", version, backups)
+	}
+	if err = db.Get("b", &v); err != nil || v != 2 {
+		t.Fatalf("Expected b to be 2, but instead found %d, %v", v, err)
+	}
+	if results, err = m.Run(ctx, false); err != nil || len(results) != 0 || backups != 1 {
+		t.Fatalf("Expected nothing to migrate, but instead found %+v, %v", results, err)
+	}
+
+	// a failed migration leaves the db at the version before it
+	failing := Migration{Version: 3, Name: "failing", Up: func(ctx context.Context, db *kv.DB, tx *kv.Tx, cursor string, limit int) (string, error) {
+		if err := tx.Put("c", 3); err != nil {
+			return "", err
+		}
+		return "", errors.New("failed")
+	}}
+	m, _ = New(db, putMigration(1, "a"), putMigration(2, "b"), failing, putMigration(4, "d"))
+	if _, err = m.Run(ctx, false); err == nil {
+		t.Fatal("Expected the failed migration to fail the run")
+	}
+	if version, _ := m.Version(); version != 2 {
+		t.Fatalf("Expected version 2, but instead found %d", version)
+	}
+	if err = db.Get("c", &v); err != kv.ErrNotFound {
+		t.Fatalf("Expected the failed migration to write nothing, but instead found %v", err)
+	}
+
+	// an older gateway leaves the db of a newer one as it is
+	m, _ = New(db, putMigration(1, "a"))
+	if results, err = m.Run(ctx, false); err != nil || len(results) != 0 {
+		t.Fatalf("Expected nothing to migrate, but instead found %+v, %v", results, err)
+	}
+}
+
+func TestMigrator_RunPages(t *testing.T) {
+	db, err := uleveldb.OpenDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	for _, key := range []string{"rec/a", "rec/b", "rec/c", "rec/d", "rec/e"} {
+		if err = db.Put(key, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// sets the records to 1, and fails once after failAfter
+	var failAfter string
+	var cursors []string
+	paged := Migration{Version: 1, Name: "paged", Up: func(ctx context.Context, db *kv.DB, tx *kv.Tx, cursor string, limit int) (string, error) {
+		cursors = append(cursors, cursor)
+		if cursor != "" && cursor == failAfter {
+			failAfter = ""
+			return "", errors.New("interrupted")
+		}
+		all, err := db.ReadAllChan(ctx, "rec/", cursor)
+		if err != nil {
+			return "", err
+		}
+		for entry := range all {
+			if err = tx.Put(entry.Key, 1); err != nil {
+				return "", err
+			}
+			if tx.Len() >= limit {
+				return entry.Key, nil
+			}
+		}
+		return "", nil
+	}}
+	m, err := New(db, paged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.pageSize = 2
+
+	results, err := m.Run(ctx, true)
+	if err != nil || len(results) != 1 || results[0].Writes != 5 {
+		t.Fatalf("Expected a dry run of 5 writes, but instead found %+v, %v", results, err)
+	}
+	if err = db.Get(ProgressKey, &progress{}); err != kv.ErrNotFound {
+		t.Fatalf("Expected the dry run to leave no cursor, but instead found %v", err)
+	}
+
+	// the pages before the failed one are applied along with their cursor
+	failAfter, cursors = "rec/d", nil
+	if _, err = m.Run(ctx, false); err == nil {
+		t.Fatal("Expected the interrupted migration to fail the run")
+	}
+	var p progress
+	if err = db.Get(ProgressKey, &p); err != nil || p != (progress{Version: 1, Cursor: "rec/d"}) {
+		t.Fatalf("Expected the cursor of the second page, but instead found %+v, %v", p, err)
+	}
+	if version, _ := m.Version(); version != 0 {
+		t.Fatalf("Expected version 0 until the last page, but instead found %d", version)
+	}
+	var v int
+	for key, expected := range map[string]int{"rec/a": 1, "rec/d": 1, "rec/e": 0} {
+		if err = db.Get(key, &v); err != nil || v != expected {
+			t.Errorf("Expected %s to be %d, but instead found %d, %v", key, expected, v, err)
+		}
+	}
+
+	// the run resumes after the last page applied
+	if results, err = m.Run(ctx, false); err != nil || len(results) != 1 || results[0].Writes != 1 {
+		t.Fatalf("Expected the write left, but instead found %+v, %v", results, err)
+	}
+	expectedCursors := []string{"", "rec/b", "rec/d", "rec/d"}
+	if strings.Join(cursors, ",") != strings.Join(expectedCursors, ",") {
+		t.Errorf("Expected the cursors %q, but instead found %q", expectedCursors, cursors)
+	}
+	if version, _ := m.Version(); version != 1 {
+		t.Errorf("Expected version 1, but instead found %d", version)
+	}
+	if err = db.Get(ProgressKey, &p); err != kv.ErrNotFound {
+		t.Errorf("Expected the cursor deleted with the last page, but instead found %+v, %v", p, err)
+	}
+	if err = db.Get("rec/e", &v); err != nil || v != 1 {
+		t.Errorf("Expected rec/e to be 1, but instead found %d, %v", v, err)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	db, err := uleveldb.OpenDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	legacy := map[string]interface{}{
+		"obj/bucket/object":       store.ObjectInfo{Bucket: "bucket", Name: "object", Cid: "cid", Size: 10},
+		"uploadObj/bucket/obj/1":  store.MultipartInfo{Bucket: "bucket", Object: "obj", UploadID: "1"},
+		"bkt/bucket":              store.BucketMetadata{Name: "bucket"},
+		"user/user":               auth.Credentials{AccessKey: "user", SecretKey: "secret"},
+		"obj/bucket/current":      store.ObjectInfo{Bucket: "bucket", Name: "current", Size: 5, RecordVersion: store.RecordVersion},
+		"config/iam_secrets_key":  "key",
+		"notification/queue/item": "event",
+	}
+	for key, value := range legacy {
+		if err = db.Put(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := New(db, Migrations...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a page of a write, the cursor goes through the records of the store and
+	// of the users
+	m.pageSize = 1
+	results, err := m.Run(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the 4 legacy records, then the usage of the bucket
+	if len(results) != 2 || results[0].Writes != 4 || results[1].Writes != 2 {
+		t.Fatalf("Expected 4 and 2 writes, but instead found %+v", results)
+	}
+	var oi store.ObjectInfo
+	if err = db.Get("obj/bucket/object", &oi); err != nil || oi.RecordVersion != store.RecordVersion || oi.Cid != "cid" {
+		t.Errorf("Expected the object tagged with its version, but instead found %+v, %v", oi, err)
+	}
+	var mi store.MultipartInfo
+	if err = db.Get("uploadObj/bucket/obj/1", &mi); err != nil || mi.RecordVersion != store.RecordVersion {
+		t.Errorf("Expected the upload tagged with its version, but instead found %+v, %v", mi, err)
+	}
+	var meta store.BucketMetadata
+	if err = db.Get("bkt/bucket", &meta); err != nil || meta.RecordVersion != store.RecordVersion {
+		t.Errorf("Expected the bucket tagged with its version, but instead found %+v, %v", meta, err)
+	}
+	var cred auth.Credentials
+	if err = db.Get("user/user", &cred); err != nil || cred.RecordVersion == 0 || cred.SecretKey != "secret" {
+		t.Errorf("Expected the user tagged with its version, but instead found %+v, %v", cred, err)
+	}
+	usage, err := (&store.StorageSys{Db: db}).BucketUsage(context.Background(), "bucket")
+	if expected := (store.Usage{Bytes: 15, Objects: 2}); err != nil || usage != expected {
+		t.Errorf("Expected the usage %+v, but instead found %+v, %v", expected, usage, err)
+	}
+}
@@ -0,0 +1,30 @@
+package migrate
+
+import (
+	"context"
+	"github.com/yann-y/fds/internal/iam"
+	"github.com/yann-y/fds/internal/kv"
+	"github.com/yann-y/fds/internal/store"
+)
+
+// Migrations - the migrations of the metadata schema in order, a migration
+// is appended with the next version and never changed once released.
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "tag records with their layout version",
+		// the cursor follows the keys, those of the users after the others
+		Up: func(ctx context.Context, db *kv.DB, tx *kv.Tx, cursor string, limit int) (string, error) {
+			next, err := store.UpgradeRecords(ctx, db, tx, cursor, limit)
+			if err != nil || next != "" {
+				return next, err
+			}
+			return iam.UpgradeRecords(ctx, db, tx, cursor, limit)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "count the usage of the buckets",
+		Up:      store.ComputeUsage,
+	},
+}
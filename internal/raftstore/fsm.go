@@ -0,0 +1,113 @@
+package raftstore
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/yann-y/fds/internal/kv"
+	"io"
+)
+
+// restoreBatchSize - the number of keys written at once by a restore.
+const restoreBatchSize = 1000
+
+// fsm - the state machine applying the committed batches to the metadata db.
+type fsm struct {
+	db *kv.DB
+}
+
+// Apply - applies a batch, the error returned is the response of the apply.
+func (f *fsm) Apply(log *raft.Log) interface{} {
+	var ops []kv.Op
+	if err := msgpack.Unmarshal(log.Data, &ops); err != nil {
+		return err
+	}
+	return f.db.Write(ops)
+}
+
+// Snapshot - returns a snapshot of the db, persisted while writes go on.
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	snap, err := f.db.Store().NewSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &fsmSnapshot{snap: snap}, nil
+}
+
+// Restore - replaces the content of the db by that of a snapshot, deleting
+// the keys and writing those of the snapshot restoreBatchSize at once. A
+// restore interrupted by a crash is run again, raft restoring the latest
+// snapshot as the node starts.
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	store := f.db.Store()
+	if err := clearStore(store); err != nil {
+		return err
+	}
+	batch := kv.NewBatch()
+	dec := msgpack.NewDecoder(rc)
+	for {
+		var op kv.Op
+		if err := dec.Decode(&op); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		batch.Put([]byte(op.Key), op.Value)
+		if batch.Len() >= restoreBatchSize {
+			if err := store.Write(batch); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	return store.Write(batch)
+}
+
+// clearStore - deletes every key of store, restoreBatchSize at once.
+func clearStore(store kv.Store) error {
+	for {
+		batch := kv.NewBatch()
+		iter := store.NewIterator(nil, nil)
+		for batch.Len() < restoreBatchSize && iter.Next() {
+			batch.Delete(append([]byte(nil), iter.Key()...))
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return err
+		}
+		if batch.Len() == 0 {
+			return nil
+		}
+		if err := store.Write(batch); err != nil {
+			return err
+		}
+	}
+}
+
+// fsmSnapshot - a point in time view of the db.
+type fsmSnapshot struct {
+	snap kv.Snapshot
+}
+
+// Persist - writes every key of the snapshot as a put op.
+func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	iter := s.snap.NewIterator(nil, nil)
+	defer iter.Release()
+	enc := msgpack.NewEncoder(sink)
+	for iter.Next() {
+		if err := enc.Encode(kv.Op{Key: string(iter.Key()), Value: iter.Value()}); err != nil {
+			sink.Cancel()
+			return err
+		}
+	}
+	if err := iter.Error(); err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+// Release - releases the snapshot.
+func (s *fsmSnapshot) Release() {
+	s.snap.Release()
+}
@@ -0,0 +1,138 @@
+package raftstore
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/raft"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/yann-y/fds/internal/apierrors"
+	"github.com/yann-y/fds/internal/consts"
+	"github.com/yann-y/fds/internal/kv"
+	"github.com/yann-y/fds/internal/response"
+	"github.com/yann-y/fds/internal/utils"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxApplySize - the maximum size of a forwarded batch.
+const maxApplySize = 64 << 20
+
+// RegisterHandlers serves the calls of the other nodes to n on router, the
+// nodes authenticate with the cluster secret as bearer token.
+func RegisterHandlers(router *mux.Router, n *Node) {
+	raftRouter := router.PathPrefix(PathPrefix).Subrouter()
+	raftRouter.Methods(http.MethodPost).Path("/apply").HandlerFunc(n.authorized(n.applyHandler))
+	raftRouter.Methods(http.MethodGet).Path("/read-index").HandlerFunc(n.authorized(n.readIndexHandler))
+	raftRouter.Methods(http.MethodPost).Path("/join").HandlerFunc(n.authorized(n.joinHandler))
+	raftRouter.Methods(http.MethodPost).Path("/remove").HandlerFunc(n.authorized(n.removeHandler))
+	raftRouter.Methods(http.MethodGet).Path("/status").HandlerFunc(n.authorized(n.statusHandler))
+}
+
+// SyncHandler - syncs the db once per request served by h, so that its
+// reads see every write committed before it came. The calls between the
+// nodes, under the path prefix of the cluster, are served as they come.
+func (n *Node) SyncHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, clusterPathPrefix) {
+			if err := n.Sync(r.Context()); err != nil {
+				log.Errorw("sync metadata", "error", err)
+				response.WriteErrorResponse(w, r, apierrors.ErrBusy)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (n *Node) authorized(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !utils.BearerTokenMatches(r, n.cfg.Secret) {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// applyHandler - applies a batch forwarded by a follower.
+func (n *Node) applyHandler(w http.ResponseWriter, r *http.Request) {
+	if n.raft.State() != raft.Leader {
+		http.Error(w, raft.ErrNotLeader.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxApplySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var ops []kv.Op
+	if err = msgpack.Unmarshal(data, &ops); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	index, err := n.apply(ops)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, indexResponse{Index: index})
+}
+
+// readIndexHandler - returns the index a follower must reach to serve a
+// linearizable read.
+func (n *Node) readIndexHandler(w http.ResponseWriter, r *http.Request) {
+	if n.raft.State() != raft.Leader {
+		http.Error(w, raft.ErrNotLeader.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	index, err := n.readIndex()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, indexResponse{Index: index})
+}
+
+// joinHandler - adds the member of the request to the cluster.
+func (n *Node) joinHandler(w http.ResponseWriter, r *http.Request) {
+	var member Member
+	if err := json.NewDecoder(r.Body).Decode(&member); err != nil || member.ID == "" || member.Address == "" || member.Endpoint == "" {
+		http.Error(w, "invalid raft member", http.StatusBadRequest)
+		return
+	}
+	if err := n.AddMember(r.Context(), member); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, struct{}{})
+}
+
+// removeHandler - removes the member of the id query from the cluster.
+func (n *Node) removeHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "missing raft member id", http.StatusBadRequest)
+		return
+	}
+	if err := n.RemoveMember(r.Context(), id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, struct{}{})
+}
+
+// statusHandler - returns the view of the cluster of the node.
+func (n *Node) statusHandler(w http.ResponseWriter, r *http.Request) {
+	status, err := n.Status()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, status)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set(consts.ContentType, "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,146 @@
+package raftstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/hashicorp/raft"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var (
+	logPrefix    = []byte("log/")
+	stablePrefix = []byte("stable/")
+)
+
+// syncWrites - the log and the stable keys are on disk once written, raft
+// relies on the entries it acknowledged and the term and the vote it
+// recorded surviving a crash.
+var syncWrites = &opt.WriteOptions{Sync: true}
+
+// errKeyNotFound - the error the raft library expects for a missing stable
+// key.
+var errKeyNotFound = errors.New("not found")
+
+// logStore - the raft log and stable store in a LevelDB of its own.
+type logStore struct {
+	db *leveldb.DB
+}
+
+func newLogStore(path string) (*logStore, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &logStore{db: db}, nil
+}
+
+func (s *logStore) Close() error {
+	return s.db.Close()
+}
+
+func logKey(index uint64) []byte {
+	key := make([]byte, len(logPrefix)+8)
+	copy(key, logPrefix)
+	binary.BigEndian.PutUint64(key[len(logPrefix):], index)
+	return key
+}
+
+// FirstIndex - returns the first index written, 0 for no entries.
+func (s *logStore) FirstIndex() (uint64, error) {
+	iter := s.db.NewIterator(util.BytesPrefix(logPrefix), nil)
+	defer iter.Release()
+	if !iter.First() {
+		return 0, iter.Error()
+	}
+	return binary.BigEndian.Uint64(iter.Key()[len(logPrefix):]), nil
+}
+
+// LastIndex - returns the last index written, 0 for no entries.
+func (s *logStore) LastIndex() (uint64, error) {
+	iter := s.db.NewIterator(util.BytesPrefix(logPrefix), nil)
+	defer iter.Release()
+	if !iter.Last() {
+		return 0, iter.Error()
+	}
+	return binary.BigEndian.Uint64(iter.Key()[len(logPrefix):]), nil
+}
+
+// GetLog - gets the log entry at index.
+func (s *logStore) GetLog(index uint64, log *raft.Log) error {
+	data, err := s.db.Get(logKey(index), nil)
+	if err == leveldb.ErrNotFound {
+		return raft.ErrLogNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return msgpack.Unmarshal(data, log)
+}
+
+// StoreLog - stores a log entry.
+func (s *logStore) StoreLog(log *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{log})
+}
+
+// StoreLogs - stores multiple log entries in a single batch.
+func (s *logStore) StoreLogs(logs []*raft.Log) error {
+	batch := new(leveldb.Batch)
+	for _, log := range logs {
+		data, err := msgpack.Marshal(log)
+		if err != nil {
+			return err
+		}
+		batch.Put(logKey(log.Index), data)
+	}
+	return s.db.Write(batch, syncWrites)
+}
+
+// DeleteRange - deletes the log entries from min to max, inclusive.
+func (s *logStore) DeleteRange(min, max uint64) error {
+	batch := new(leveldb.Batch)
+	iter := s.db.NewIterator(&util.Range{Start: logKey(min), Limit: logKey(max + 1)}, nil)
+	for iter.Next() {
+		batch.Delete(append([]byte(nil), iter.Key()...))
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	return s.db.Write(batch, syncWrites)
+}
+
+// Set - sets a stable key.
+func (s *logStore) Set(key []byte, val []byte) error {
+	return s.db.Put(append(append([]byte(nil), stablePrefix...), key...), val, syncWrites)
+}
+
+// Get - returns the value of a stable key, errKeyNotFound when unset.
+func (s *logStore) Get(key []byte) ([]byte, error) {
+	val, err := s.db.Get(append(append([]byte(nil), stablePrefix...), key...), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, errKeyNotFound
+	}
+	return val, err
+}
+
+// SetUint64 - sets a stable key to an integer.
+func (s *logStore) SetUint64(key []byte, val uint64) error {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, val)
+	return s.Set(key, buf)
+}
+
+// GetUint64 - returns the integer of a stable key, 0 when unset.
+func (s *logStore) GetUint64(key []byte) (uint64, error) {
+	val, err := s.Get(key)
+	if err == errKeyNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(val), nil
+}
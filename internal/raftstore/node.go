@@ -0,0 +1,416 @@
+// Package raftstore replicates the metadata db on the gateways of a cluster
+// through a Raft log: the writes of every node are ordered by the leader and
+// applied as batches to the LevelDB of each node.
+package raftstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/yann-y/fds/internal/consts"
+	"github.com/yann-y/fds/internal/kv"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var log = logging.Logger("raftstore")
+
+const (
+	// PathPrefix - the path prefix of the calls between the nodes.
+	PathPrefix = "/cluster/v1/raft"
+	// clusterPathPrefix - the path prefix of every call between the
+	// gateways, those of raft and of the locks.
+	clusterPathPrefix = "/cluster/"
+
+	// memberKeyFormat - the key of the HTTP endpoint of a member, replicated
+	// with the metadata so that any node can reach the leader.
+	memberKeyFormat = "raftMember/%s"
+
+	applyTimeout   = 10 * time.Second
+	syncTimeout    = 10 * time.Second
+	requestTimeout = 15 * time.Second
+	retainSnapshot = 2
+	maxPool        = 3
+)
+
+// ErrNoLeader - the cluster has no leader, such as during an election.
+var ErrNoLeader = errors.New("raft cluster has no leader")
+
+// Config - the configuration of a node.
+type Config struct {
+	// ID identifies the node in the cluster.
+	ID string
+	// BindAddr is the address the Raft transport listens on, and the address
+	// the other nodes reach it at.
+	BindAddr string
+	// Endpoint is the HTTP endpoint of the gateway, such as
+	// http://10.0.0.1:9985, the calls of the other nodes are sent to.
+	Endpoint string
+	// Dir holds the Raft log and snapshots.
+	Dir string
+	// Bootstrap starts a new cluster with this node as only member.
+	Bootstrap bool
+	// Secret authenticates the calls between the nodes.
+	Secret string
+
+	// raft overrides the timing of the raft library, for tests.
+	raft func(*raft.Config)
+}
+
+// Node - a member of the cluster replicating a metadata db.
+type Node struct {
+	cfg    Config
+	db     *kv.DB
+	raft   *raft.Raft
+	trans  *raft.NetworkTransport
+	logs   *logStore
+	client *http.Client
+	done   chan struct{}
+}
+
+// NewNode starts the node of cfg replicating db, the writes of db go
+// through the cluster once the node is started.
+func NewNode(cfg Config, db *kv.DB) (*Node, error) {
+	if cfg.ID == "" || cfg.BindAddr == "" || cfg.Endpoint == "" || cfg.Dir == "" {
+		return nil, errors.New("raft node requires an id, a bind address, an endpoint and a dir")
+	}
+	if cfg.Secret == "" {
+		return nil, errors.New("raft node requires a cluster secret")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	logger := hclog.New(&hclog.LoggerOptions{Name: "raft", Level: hclog.Info, Output: os.Stderr})
+	conf := raft.DefaultConfig()
+	conf.LocalID = raft.ServerID(cfg.ID)
+	conf.Logger = logger
+	if cfg.raft != nil {
+		cfg.raft(conf)
+	}
+
+	addr, err := net.ResolveTCPAddr("tcp", cfg.BindAddr)
+	if err != nil {
+		return nil, err
+	}
+	trans, err := raft.NewTCPTransportWithLogger(cfg.BindAddr, addr, maxPool, applyTimeout, logger)
+	if err != nil {
+		return nil, err
+	}
+	snaps, err := raft.NewFileSnapshotStoreWithLogger(cfg.Dir, retainSnapshot, logger)
+	if err != nil {
+		trans.Close()
+		return nil, err
+	}
+	logs, err := newLogStore(filepath.Join(cfg.Dir, "log"))
+	if err != nil {
+		trans.Close()
+		return nil, err
+	}
+	r, err := raft.NewRaft(conf, &fsm{db: db}, logs, logs, snaps, trans)
+	if err != nil {
+		trans.Close()
+		logs.Close()
+		return nil, err
+	}
+	n := &Node{
+		cfg:    cfg,
+		db:     db,
+		raft:   r,
+		trans:  trans,
+		logs:   logs,
+		client: &http.Client{Timeout: requestTimeout},
+		done:   make(chan struct{}),
+	}
+	if cfg.Bootstrap {
+		hasState, err := raft.HasExistingState(logs, logs, snaps)
+		if err != nil {
+			n.Shutdown()
+			return nil, err
+		}
+		if !hasState {
+			err = r.BootstrapCluster(raft.Configuration{Servers: []raft.Server{{
+				ID:      conf.LocalID,
+				Address: trans.LocalAddr(),
+			}}}).Error()
+			if err != nil {
+				n.Shutdown()
+				return nil, err
+			}
+		}
+	}
+	go n.registerOnLeadership()
+	db.SetReplicator(n)
+	return n, nil
+}
+
+// registerOnLeadership - records the endpoint of the node each time it
+// becomes the leader, so that the endpoint of the first node is known.
+func (n *Node) registerOnLeadership() {
+	for {
+		select {
+		case <-n.done:
+			return
+		case leader := <-n.raft.LeaderCh():
+			if !leader {
+				continue
+			}
+			if _, err := n.apply([]kv.Op{n.memberOp(n.cfg.ID, n.cfg.Endpoint)}); err != nil {
+				log.Errorf("register raft member %s err:%v", n.cfg.ID, err)
+			}
+		}
+	}
+}
+
+// Shutdown - stops the node.
+func (n *Node) Shutdown() error {
+	close(n.done)
+	err := n.raft.Shutdown().Error()
+	n.trans.Close()
+	if cerr := n.logs.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Apply - applies the ops through the leader, it returns once they are
+// applied to the local db.
+func (n *Node) Apply(ops []kv.Op) error {
+	if n.raft.State() == raft.Leader {
+		_, err := n.apply(ops)
+		return err
+	}
+	data, err := msgpack.Marshal(ops)
+	if err != nil {
+		return err
+	}
+	var resp indexResponse
+	if err = n.forward(context.Background(), http.MethodPost, "/apply", data, &resp); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+	defer cancel()
+	return n.waitApplied(ctx, resp.Index)
+}
+
+// apply - applies the ops on the leader, returns the index of the batch.
+func (n *Node) apply(ops []kv.Op) (uint64, error) {
+	data, err := msgpack.Marshal(ops)
+	if err != nil {
+		return 0, err
+	}
+	f := n.raft.Apply(data, applyTimeout)
+	if err = f.Error(); err != nil {
+		return 0, err
+	}
+	if err, ok := f.Response().(error); ok && err != nil {
+		return 0, err
+	}
+	return f.Index(), nil
+}
+
+// Sync - waits until the local db reflects every write committed before the
+// call, the index read from the leader after it confirmed its leadership.
+func (n *Node) Sync(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, syncTimeout)
+	defer cancel()
+	var index uint64
+	if n.raft.State() == raft.Leader {
+		var err error
+		if index, err = n.readIndex(); err != nil {
+			return err
+		}
+	} else {
+		var resp indexResponse
+		if err := n.forward(ctx, http.MethodGet, "/read-index", nil, &resp); err != nil {
+			return err
+		}
+		index = resp.Index
+	}
+	return n.waitApplied(ctx, index)
+}
+
+// readIndex - returns an index including every committed write, once the
+// node confirmed it is still the leader.
+func (n *Node) readIndex() (uint64, error) {
+	index := n.raft.LastIndex()
+	if err := n.raft.VerifyLeader().Error(); err != nil {
+		return 0, err
+	}
+	return index, nil
+}
+
+func (n *Node) waitApplied(ctx context.Context, index uint64) error {
+	for n.raft.AppliedIndex() < index {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	return nil
+}
+
+// WaitForLeader - waits until the node knows a leader and its endpoint.
+func (n *Node) WaitForLeader(ctx context.Context) error {
+	for {
+		if _, leader := n.raft.LeaderWithID(); leader != "" {
+			if _, err := n.memberEndpoint(string(leader)); err == nil {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// Join - asks the member at endpoint to add this node to its cluster.
+func (n *Node) Join(ctx context.Context, endpoint string) error {
+	body, err := json.Marshal(Member{ID: n.cfg.ID, Address: n.cfg.BindAddr, Endpoint: n.cfg.Endpoint})
+	if err != nil {
+		return err
+	}
+	return n.call(ctx, endpoint, http.MethodPost, "/join", body, nil)
+}
+
+// AddMember - adds a voter to the cluster through the leader.
+func (n *Node) AddMember(ctx context.Context, member Member) error {
+	if n.raft.State() != raft.Leader {
+		body, err := json.Marshal(member)
+		if err != nil {
+			return err
+		}
+		return n.forward(ctx, http.MethodPost, "/join", body, nil)
+	}
+	err := n.raft.AddVoter(raft.ServerID(member.ID), raft.ServerAddress(member.Address), 0, applyTimeout).Error()
+	if err != nil {
+		return err
+	}
+	_, err = n.apply([]kv.Op{n.memberOp(member.ID, member.Endpoint)})
+	return err
+}
+
+// RemoveMember - removes a member from the cluster through the leader.
+func (n *Node) RemoveMember(ctx context.Context, id string) error {
+	if n.raft.State() != raft.Leader {
+		return n.forward(ctx, http.MethodPost, "/remove?id="+url.QueryEscape(id), nil, nil)
+	}
+	if err := n.raft.RemoveServer(raft.ServerID(id), 0, applyTimeout).Error(); err != nil {
+		return err
+	}
+	_, err := n.apply([]kv.Op{{Key: fmt.Sprintf(memberKeyFormat, id), Delete: true}})
+	return err
+}
+
+// Member - a member of the cluster.
+type Member struct {
+	ID       string `json:"id"`
+	Address  string `json:"address"`
+	Endpoint string `json:"endpoint,omitempty"`
+	Leader   bool   `json:"leader,omitempty"`
+}
+
+// Status - the view of the cluster of a node.
+type Status struct {
+	ID           string   `json:"id"`
+	State        string   `json:"state"`
+	Leader       string   `json:"leader,omitempty"`
+	AppliedIndex uint64   `json:"appliedIndex"`
+	Members      []Member `json:"members"`
+}
+
+// Status - returns the view of the cluster of the node.
+func (n *Node) Status() (Status, error) {
+	f := n.raft.GetConfiguration()
+	if err := f.Error(); err != nil {
+		return Status{}, err
+	}
+	_, leader := n.raft.LeaderWithID()
+	status := Status{
+		ID:           n.cfg.ID,
+		State:        n.raft.State().String(),
+		Leader:       string(leader),
+		AppliedIndex: n.raft.AppliedIndex(),
+	}
+	for _, server := range f.Configuration().Servers {
+		endpoint, _ := n.memberEndpoint(string(server.ID))
+		status.Members = append(status.Members, Member{
+			ID:       string(server.ID),
+			Address:  string(server.Address),
+			Endpoint: endpoint,
+			Leader:   server.ID == leader,
+		})
+	}
+	return status, nil
+}
+
+func (n *Node) memberOp(id, endpoint string) kv.Op {
+	value, _ := msgpack.Marshal(endpoint)
+	return kv.Op{Key: fmt.Sprintf(memberKeyFormat, id), Value: value}
+}
+
+// memberEndpoint - returns the endpoint of a member from the local db.
+func (n *Node) memberEndpoint(id string) (string, error) {
+	data, err := n.db.Store().Get([]byte(fmt.Sprintf(memberKeyFormat, id)))
+	if err != nil {
+		return "", err
+	}
+	var endpoint string
+	err = msgpack.Unmarshal(data, &endpoint)
+	return endpoint, err
+}
+
+// indexResponse - the answer of the calls returning a log index.
+type indexResponse struct {
+	Index uint64 `json:"index"`
+}
+
+// forward - sends a call to the leader.
+func (n *Node) forward(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	_, leader := n.raft.LeaderWithID()
+	if leader == "" {
+		return ErrNoLeader
+	}
+	endpoint, err := n.memberEndpoint(string(leader))
+	if err != nil {
+		return fmt.Errorf("endpoint of raft leader %s: %w", leader, err)
+	}
+	return n.call(ctx, endpoint, method, path, body, out)
+}
+
+// call - sends a call to the node at endpoint, decoding the JSON answer
+// into out.
+func (n *Node) call(ctx context.Context, endpoint, method, path string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(endpoint, "/")+PathPrefix+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(consts.Authorization, "Bearer "+n.cfg.Secret)
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("raft %s on %s returned %s: %s", path, endpoint, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
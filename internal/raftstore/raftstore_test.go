@@ -0,0 +1,293 @@
+package raftstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/raft"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/yann-y/fds/internal/kv"
+	"github.com/yann-y/fds/internal/uleveldb"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testSecret = "secret"
+
+type testNode struct {
+	*Node
+	db     *kv.DB
+	server *httptest.Server
+}
+
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// newTestNode starts a node on localhost ports, its gateway serving only
+// the raft calls.
+func newTestNode(t *testing.T, id string, bootstrap bool) *testNode {
+	db, err := uleveldb.OpenDb(filepath.Join(t.TempDir(), "meta"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	server := httptest.NewServer(router)
+	n, err := NewNode(Config{
+		ID:        id,
+		BindAddr:  freeAddr(t),
+		Endpoint:  server.URL,
+		Dir:       filepath.Join(t.TempDir(), "raft"),
+		Bootstrap: bootstrap,
+		Secret:    testSecret,
+		raft: func(conf *raft.Config) {
+			conf.HeartbeatTimeout = 100 * time.Millisecond
+			conf.ElectionTimeout = 100 * time.Millisecond
+			conf.LeaderLeaseTimeout = 50 * time.Millisecond
+			conf.CommitTimeout = 5 * time.Millisecond
+			conf.TrailingLogs = 1
+		},
+	}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterHandlers(router, n)
+	t.Cleanup(func() {
+		server.Close()
+		n.Shutdown()
+		db.Close()
+	})
+	return &testNode{Node: n, db: db, server: server}
+}
+
+func TestCluster(t *testing.T) {
+	ctx := context.Background()
+	leader := newTestNode(t, "node0", true)
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := leader.WaitForLeader(waitCtx); err != nil {
+		t.Fatal(err)
+	}
+	followers := []*testNode{newTestNode(t, "node1", false), newTestNode(t, "node2", false)}
+	for _, follower := range followers {
+		if err := follower.Join(ctx, leader.server.URL); err != nil {
+			t.Fatal(err)
+		}
+		if err := follower.WaitForLeader(waitCtx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// writes on a follower are forwarded, reads on any node see them
+	if err := followers[0].db.Put("bucket/a", "value-a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := leader.db.Put("bucket/b", "value-b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := followers[1].db.Delete("bucket/b"); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		key      string
+		expected string
+	}{
+		{"bucket/a", "value-a"},
+		{"bucket/b", ""},
+	}
+	for _, node := range append(followers, leader) {
+		if err := node.db.Sync(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, testCase := range testCases {
+		for _, node := range append(followers, leader) {
+			var value string
+			err := node.db.Get(testCase.key, &value)
+			if testCase.expected == "" {
+				if err != kv.ErrNotFound {
+					t.Errorf("Test %d: Expected %s to be deleted on %s, but instead found %v", i+1, testCase.key, node.cfg.ID, err)
+				}
+				continue
+			}
+			if err != nil || value != testCase.expected {
+				t.Errorf("Test %d: Expected %s on %s, but instead found %q %v", i+1, testCase.expected, node.cfg.ID, value, err)
+			}
+		}
+	}
+
+	// a request reads the writes committed before it on any node
+	if err := leader.db.Put("bucket/c", "value-c"); err != nil {
+		t.Fatal(err)
+	}
+	handler := followers[1].SyncHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var value string
+		if err := followers[1].db.Get("bucket/c", &value); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/bucket/c", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected the write of the leader to be read, but instead found %d", w.Code)
+	}
+
+	status, err := followers[1].Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Members) != 3 || status.Leader != "node0" {
+		t.Fatalf("Unexpected status %+v", status)
+	}
+	for _, member := range status.Members {
+		if member.Endpoint == "" {
+			t.Errorf("Expected the endpoint of %s to be replicated", member.ID)
+		}
+	}
+
+	// a node joining after the log is compacted is restored from a snapshot
+	for i := 0; i < 10; i++ {
+		if err = leader.db.Put(fmt.Sprintf("bucket/%d", i), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = leader.raft.Snapshot().Error(); err != nil {
+		t.Fatal(err)
+	}
+	late := newTestNode(t, "node3", false)
+	if err = late.Join(ctx, followers[0].server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if err = late.WaitForLeader(waitCtx); err != nil {
+		t.Fatal(err)
+	}
+	if err = late.db.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var value int
+	if err = late.db.Get("bucket/9", &value); err != nil || value != 9 {
+		t.Errorf("Expected the snapshot to be restored, but instead found %d %v", value, err)
+	}
+
+	if err = followers[0].RemoveMember(ctx, "node3"); err != nil {
+		t.Fatal(err)
+	}
+	if status, err = leader.Status(); err != nil || len(status.Members) != 3 {
+		t.Errorf("Expected 3 members after a removal, but instead found %+v %v", status, err)
+	}
+}
+
+func TestLogStore(t *testing.T) {
+	s, err := newLogStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var logs []*raft.Log
+	for i := uint64(1); i <= 5; i++ {
+		logs = append(logs, &raft.Log{Index: i, Term: 1, Data: []byte{byte(i)}})
+	}
+	if err = s.StoreLogs(logs); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.DeleteRange(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := s.FirstIndex()
+	last, _ := s.LastIndex()
+	if first != 3 || last != 5 {
+		t.Errorf("Expected indexes 3 to 5, but instead found %d to %d", first, last)
+	}
+	var log raft.Log
+	if err = s.GetLog(4, &log); err != nil || log.Data[0] != 4 {
+		t.Errorf("Unexpected log %+v %v", log, err)
+	}
+	if err = s.GetLog(1, &log); err != raft.ErrLogNotFound {
+		t.Errorf("Expected a deleted log to be not found, but instead found %v", err)
+	}
+	if err = s.SetUint64([]byte("term"), 7); err != nil {
+		t.Fatal(err)
+	}
+	if term, _ := s.GetUint64([]byte("term")); term != 7 {
+		t.Errorf("Expected term 7, but instead found %d", term)
+	}
+	if _, err = s.Get([]byte("missing")); err != errKeyNotFound {
+		t.Errorf("Expected a missing key to be not found, but instead found %v", err)
+	}
+}
+
+// batchStore - records the size of the largest batch written.
+type batchStore struct {
+	kv.Store
+	maxBatch int
+}
+
+func (s *batchStore) Write(batch *kv.Batch) error {
+	if batch.Len() > s.maxBatch {
+		s.maxBatch = batch.Len()
+	}
+	return s.Store.Write(batch)
+}
+
+func TestFSM_Restore(t *testing.T) {
+	store, err := uleveldb.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs := &batchStore{Store: store}
+	db := kv.NewDB(bs)
+	defer db.Close()
+	for i := 0; i < restoreBatchSize*2+10; i++ {
+		if err = db.Put(fmt.Sprintf("old/%05d", i), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var snap bytes.Buffer
+	enc := msgpack.NewEncoder(&snap)
+	for i := 0; i < restoreBatchSize+10; i++ {
+		value, _ := msgpack.Marshal(i)
+		if err = enc.Encode(kv.Op{Key: fmt.Sprintf("new/%05d", i), Value: value}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = (&fsm{db: db}).Restore(io.NopCloser(&snap)); err != nil {
+		t.Fatal(err)
+	}
+	if bs.maxBatch > restoreBatchSize {
+		t.Errorf("Expected batches of at most %d writes, but instead found %d", restoreBatchSize, bs.maxBatch)
+	}
+	testCases := []struct {
+		prefix   string
+		expected int
+	}{
+		// Test case - 1.
+		{prefix: "old/", expected: 0},
+		// Test case - 2.
+		{prefix: "new/", expected: restoreBatchSize + 10},
+	}
+	for i, testCase := range testCases {
+		all, err := db.ReadAllChan(context.Background(), testCase.prefix, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for range all {
+			n++
+		}
+		if n != testCase.expected {
+			t.Errorf("Test %d: Expected %d keys under %s, but instead found %d", i+1, testCase.expected, testCase.prefix, n)
+		}
+	}
+}
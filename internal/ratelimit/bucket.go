@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// tokenBucket - a token bucket refilled at rate tokens per second up to one
+// second of tokens. The tokens go negative when more is taken than is left,
+// the debt is paid back before new takes succeed.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, now time.Time) *tokenBucket {
+	burst := math.Max(rate, 1)
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+}
+
+// delay - returns the time until n tokens are available, 0 when they are.
+func (b *tokenBucket) delay(now time.Time, n float64) time.Duration {
+	b.refill(now)
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+// take - takes n tokens, and returns the time until the debt it leaves is
+// paid back.
+func (b *tokenBucket) take(now time.Time, n float64) time.Duration {
+	b.refill(now)
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// full - reports whether the bucket is full, it is then dropped as it
+// behaves as a new one.
+func (b *tokenBucket) full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
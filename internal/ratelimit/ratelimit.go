@@ -0,0 +1,395 @@
+// Package ratelimit limits the requests and the bytes per second of every
+// access key, of every bucket and of the whole gateway, along with the
+// requests an access key has in flight.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/mux"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/yann-y/fds/internal/apierrors"
+	"github.com/yann-y/fds/internal/consts"
+	"github.com/yann-y/fds/internal/metrics"
+	"github.com/yann-y/fds/internal/response"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var log = logging.Logger("ratelimit")
+
+// The scopes and the limits a request is rejected by.
+const (
+	ScopeKey    = "key"
+	ScopeBucket = "bucket"
+	ScopeGlobal = "global"
+
+	LimitRequests = "requests"
+	LimitBytes    = "bytes"
+	LimitInFlight = "inflight"
+)
+
+// anonymousKeyPrefix - the prefix of the keys of the requests whose
+// signature does not verify, which are limited by their source address.
+const anonymousKeyPrefix = "anonymous/"
+
+// stateInterval - the interval the unused limiters are dropped and the
+// metrics updated at.
+const stateInterval = 10 * time.Second
+
+// Config - the limits, 0 is unlimited. A rate allows bursts of one second of
+// requests or bytes.
+type Config struct {
+	// KeyRequests, KeyBytes - the requests and the bytes per second of an
+	// access key, the temporary credentials count against their parent user
+	// and the requests whose signature does not verify against their source
+	// address.
+	KeyRequests float64
+	KeyBytes    float64
+	// BucketRequests, BucketBytes - the requests and the bytes per second of
+	// a bucket.
+	BucketRequests float64
+	BucketBytes    float64
+	// GlobalRequests, GlobalBytes - the requests and the bytes per second of
+	// the gateway.
+	GlobalRequests float64
+	GlobalBytes    float64
+	// KeyInFlight - the requests of an access key served at once.
+	KeyInFlight int
+}
+
+// Validate - checks that no limit is negative.
+func (c Config) Validate() error {
+	for _, limit := range []float64{c.KeyRequests, c.KeyBytes, c.BucketRequests, c.BucketBytes, c.GlobalRequests, c.GlobalBytes, float64(c.KeyInFlight)} {
+		if limit < 0 || math.IsNaN(limit) || math.IsInf(limit, 0) {
+			return errors.New("rate limits must be positive, or 0 for unlimited")
+		}
+	}
+	return nil
+}
+
+// Enabled - reports whether any limit is set.
+func (c Config) Enabled() bool {
+	return c != Config{}
+}
+
+func (c Config) limitsBytes() bool {
+	return c.KeyBytes > 0 || c.BucketBytes > 0 || c.GlobalBytes > 0
+}
+
+// limits - the token buckets of the requests and of the bytes of a scope,
+// nil when unlimited.
+type limits struct {
+	requests *tokenBucket
+	bytes    *tokenBucket
+}
+
+func newLimits(requests, bytes float64, now time.Time) *limits {
+	l := &limits{}
+	if requests > 0 {
+		l.requests = newTokenBucket(requests, now)
+	}
+	if bytes > 0 {
+		l.bytes = newTokenBucket(bytes, now)
+	}
+	return l
+}
+
+func (l *limits) full(now time.Time) bool {
+	return (l.requests == nil || l.requests.full(now)) && (l.bytes == nil || l.bytes.full(now))
+}
+
+// rejection - a request over a limit, which may be retried after retryAfter.
+type rejection struct {
+	scope      string
+	limit      string
+	retryAfter time.Duration
+}
+
+// Limiter - admits the requests within the limits, and slows down their
+// bodies to the bytes limits.
+type Limiter struct {
+	config    Config
+	accessKey func(r *http.Request) (accessKey, parentUser string)
+	// exempt - the path templates of the routes never limited
+	exempt []string
+
+	mu       sync.Mutex
+	global   *limits
+	keys     map[string]*limits
+	buckets  map[string]*limits
+	inFlight map[string]int
+}
+
+// NewLimiter returns the limiter of config, accessKey returns the access key
+// of a request whose signature verifies, or an empty key.
+func NewLimiter(config Config, accessKey func(r *http.Request) (accessKey, parentUser string)) *Limiter {
+	return &Limiter{
+		config:    config,
+		accessKey: accessKey,
+		global:    newLimits(config.GlobalRequests, config.GlobalBytes, time.Now()),
+		keys:      make(map[string]*limits),
+		buckets:   make(map[string]*limits),
+		inFlight:  make(map[string]int),
+	}
+}
+
+// SetExempt - sets the prefixes of the path templates of the routes which
+// are never limited, such as those of the cluster.
+func (l *Limiter) SetExempt(prefixes ...string) {
+	l.exempt = prefixes
+}
+
+// Start - drops the limiters back to full and updates the metrics until ctx
+// is done.
+func (l *Limiter) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(stateInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				l.cleanup(time.Now())
+			}
+		}
+	}()
+}
+
+func (l *Limiter) cleanup(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, m := range []map[string]*limits{l.keys, l.buckets} {
+		for name, lim := range m {
+			if lim.full(now) {
+				delete(m, name)
+			}
+		}
+	}
+	inFlight := 0
+	for _, n := range l.inFlight {
+		inFlight += n
+	}
+	metrics.SetRateLimitState(len(l.keys), len(l.buckets), inFlight)
+}
+
+// limitsOf - returns the limits of name in m, created on first use.
+func limitsOf(m map[string]*limits, name string, requests, bytes float64, now time.Time) *limits {
+	lim, ok := m[name]
+	if !ok {
+		lim = newLimits(requests, bytes, now)
+		m[name] = lim
+	}
+	return lim
+}
+
+// admit - takes a request from every limit of the request, and returns the
+// limits its bytes are counted against, or the limit it exceeds.
+func (l *Limiter) admit(now time.Time, key, bucket string) ([]*limits, *rejection) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.config.KeyInFlight > 0 && l.inFlight[key] >= l.config.KeyInFlight {
+		return nil, &rejection{scope: ScopeKey, limit: LimitInFlight, retryAfter: time.Second}
+	}
+	scopes := []string{ScopeGlobal}
+	lims := []*limits{l.global}
+	if l.config.KeyRequests > 0 || l.config.KeyBytes > 0 {
+		scopes = append(scopes, ScopeKey)
+		lims = append(lims, limitsOf(l.keys, key, l.config.KeyRequests, l.config.KeyBytes, now))
+	}
+	if bucket != "" && (l.config.BucketRequests > 0 || l.config.BucketBytes > 0) {
+		scopes = append(scopes, ScopeBucket)
+		lims = append(lims, limitsOf(l.buckets, bucket, l.config.BucketRequests, l.config.BucketBytes, now))
+	}
+	for i, lim := range lims {
+		if lim.requests != nil {
+			if d := lim.requests.delay(now, 1); d > 0 {
+				return nil, &rejection{scope: scopes[i], limit: LimitRequests, retryAfter: d}
+			}
+		}
+		// the bytes of the requests served already are paid back first
+		if lim.bytes != nil {
+			if d := lim.bytes.delay(now, 0); d > 0 {
+				return nil, &rejection{scope: scopes[i], limit: LimitBytes, retryAfter: d}
+			}
+		}
+	}
+	for _, lim := range lims {
+		if lim.requests != nil {
+			lim.requests.take(now, 1)
+		}
+	}
+	if l.config.KeyInFlight > 0 {
+		l.inFlight[key]++
+	}
+	return lims, nil
+}
+
+// release - ends a request admitted.
+func (l *Limiter) release(key string) {
+	if l.config.KeyInFlight <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight[key]--; l.inFlight[key] <= 0 {
+		delete(l.inFlight, key)
+	}
+}
+
+// charge - counts n bytes against lims, and returns the time the transfer
+// is to wait for the debt to be paid back.
+func (l *Limiter) charge(lims []*limits, n int) time.Duration {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var wait time.Duration
+	for _, lim := range lims {
+		if lim.bytes != nil {
+			if d := lim.bytes.take(now, float64(n)); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait
+}
+
+func (l *Limiter) isExempt(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return false
+	}
+	for _, prefix := range l.exempt {
+		if strings.HasPrefix(template, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware is a mux middleware rejecting the requests over a limit with
+// SlowDown and Retry-After, and slowing down the bodies of the others to the
+// bytes limits.
+func (l *Limiter) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.isExempt(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		key := requestKey(r, l.accessKey)
+		bucket := mux.Vars(r)["bucket"]
+		lims, rej := l.admit(time.Now(), key, bucket)
+		if rej != nil {
+			log.Debugw("request rate limited", "accessKey", key, "bucket", bucket, "scope", rej.scope, "limit", rej.limit, "retryAfter", rej.retryAfter)
+			metrics.ObserveRateLimited(rej.scope, rej.limit)
+			w.Header().Set(consts.RetryAfter, strconv.Itoa(retryAfterSeconds(rej.retryAfter)))
+			response.WriteErrorResponse(w, r, apierrors.ErrSlowDown)
+			return
+		}
+		defer l.release(key)
+
+		if !l.config.limitsBytes() {
+			h.ServeHTTP(w, r)
+			return
+		}
+		charge := func(n int) {
+			if d := l.charge(lims, n); d > 0 {
+				metrics.ObserveThrottled(d)
+				sleep(r.Context(), d)
+			}
+		}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = &throttledReader{ReadCloser: r.Body, charge: charge}
+		}
+		h.ServeHTTP(&throttledWriter{ResponseWriter: w, charge: charge}, r)
+	})
+}
+
+// requestKey - returns the key the request is limited by: its access key
+// when its signature verifies, the temporary credentials counting against
+// their parent user, or else its source address so that a request naming
+// the access key of another user is not counted against it.
+func requestKey(r *http.Request, accessKey func(r *http.Request) (accessKey, parentUser string)) string {
+	key, parentUser := accessKey(r)
+	if parentUser != "" {
+		return parentUser
+	}
+	if key != "" {
+		return key
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return anonymousKeyPrefix + host
+}
+
+// retryAfterSeconds - returns the whole seconds of Retry-After, at least 1.
+func retryAfterSeconds(d time.Duration) int {
+	if seconds := int(math.Ceil(d.Seconds())); seconds > 1 {
+		return seconds
+	}
+	return 1
+}
+
+// sleep - waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// throttledReader - counts the bytes of a request body against the limits.
+type throttledReader struct {
+	io.ReadCloser
+	charge func(n int)
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.charge(n)
+	}
+	return n, err
+}
+
+// throttledWriter - counts the bytes of a response body against the limits.
+type throttledWriter struct {
+	http.ResponseWriter
+	charge func(n int)
+}
+
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	if n > 0 {
+		w.charge(n)
+	}
+	return n, err
+}
+
+// Unwrap - returns the writer wrapped.
+func (w *throttledWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush - flushes the response when the underlying writer supports it.
+func (w *throttledWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
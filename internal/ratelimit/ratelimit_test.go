@@ -0,0 +1,195 @@
+package ratelimit
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/yann-y/fds/internal/consts"
+	"github.com/yann-y/fds/internal/iam"
+	"github.com/yann-y/fds/internal/iam/auth"
+	"github.com/yann-y/fds/internal/uleveldb"
+	"github.com/yann-y/fds/internal/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(2, now)
+	testCases := []struct {
+		elapsed  time.Duration
+		take     float64
+		expected time.Duration
+	}{
+		// Test case - 1.
+		// a burst of one second.
+		{elapsed: 0, take: 2, expected: 0},
+		// Test case - 2.
+		// a debt of half a token.
+		{elapsed: 0, take: 0.5, expected: 250 * time.Millisecond},
+		// Test case - 3.
+		// the debt paid back and a token refilled.
+		{elapsed: 750 * time.Millisecond, take: 1, expected: 0},
+		// Test case - 4.
+		// the refill stops at the burst.
+		{elapsed: time.Hour, take: 4, expected: time.Second},
+	}
+	for i, testCase := range testCases {
+		now = now.Add(testCase.elapsed)
+		if d := b.take(now, testCase.take); d != testCase.expected {
+			t.Errorf("Test %d: Expected a delay of %v, but instead found %v", i+1, testCase.expected, d)
+		}
+	}
+	if d := b.delay(now, 1); d != 1500*time.Millisecond {
+		t.Errorf("Expected a token in 1.5s, but instead found %v", d)
+	}
+}
+
+func TestLimiter_admit(t *testing.T) {
+	testCases := []struct {
+		config   Config
+		admitted int
+		scope    string
+		limit    string
+	}{
+		// Test case - 1.
+		{config: Config{KeyRequests: 3}, admitted: 3, scope: ScopeKey, limit: LimitRequests},
+		// Test case - 2.
+		{config: Config{BucketRequests: 2, KeyRequests: 3}, admitted: 2, scope: ScopeBucket, limit: LimitRequests},
+		// Test case - 3.
+		{config: Config{GlobalRequests: 1, KeyRequests: 3}, admitted: 1, scope: ScopeGlobal, limit: LimitRequests},
+		// Test case - 4.
+		// the requests are not released.
+		{config: Config{KeyInFlight: 4}, admitted: 4, scope: ScopeKey, limit: LimitInFlight},
+	}
+	now := time.Now()
+	for i, testCase := range testCases {
+		l := NewLimiter(testCase.config, nil)
+		for n := 0; n < testCase.admitted; n++ {
+			if _, rej := l.admit(now, "key", "bucket"); rej != nil {
+				t.Fatalf("Test %d: Expected request %d to be admitted, but instead found %+v", i+1, n+1, rej)
+			}
+		}
+		_, rej := l.admit(now, "key", "bucket")
+		if rej == nil || rej.scope != testCase.scope || rej.limit != testCase.limit || rej.retryAfter <= 0 {
+			t.Errorf("Test %d: Expected the %s %s limit, but instead found %+v", i+1, testCase.scope, testCase.limit, rej)
+		}
+		// another key and another bucket are limited apart
+		if testCase.scope != ScopeGlobal {
+			if _, rej = l.admit(now, "other", "other"); rej != nil {
+				t.Errorf("Test %d: Expected another key to be admitted, but instead found %+v", i+1, rej)
+			}
+		}
+	}
+}
+
+func TestLimiter_charge(t *testing.T) {
+	l := NewLimiter(Config{KeyBytes: 1000}, nil)
+	now := time.Now()
+	lims, rej := l.admit(now, "key", "")
+	if rej != nil {
+		t.Fatal(rej)
+	}
+	if d := l.charge(lims, 500); d != 0 {
+		t.Fatalf("Expected no delay within the burst, but instead found %v", d)
+	}
+	if d := l.charge(lims, 1500); d <= 0 || d > time.Second {
+		t.Fatalf("Expected a delay of about 1s, but instead found %v", d)
+	}
+	// the debt is paid back before another request of the key is admitted
+	if _, rej = l.admit(time.Now(), "key", ""); rej == nil || rej.limit != LimitBytes {
+		t.Errorf("Expected the bytes limit, but instead found %+v", rej)
+	}
+	l.release("key")
+
+	l.cleanup(time.Now().Add(time.Hour))
+	if len(l.keys) != 0 {
+		t.Errorf("Expected the full limiters to be dropped, but instead found %d", len(l.keys))
+	}
+}
+
+func TestLimiter_Middleware(t *testing.T) {
+	l := NewLimiter(Config{KeyRequests: 1}, func(r *http.Request) (string, string) {
+		return r.Header.Get("X-Test-Key"), ""
+	})
+	l.SetExempt("/status")
+	router := mux.NewRouter()
+	router.Methods(http.MethodGet).Path("/status").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	router.Methods(http.MethodGet).Path("/{bucket}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	router.Use(l.Middleware)
+
+	testCases := []struct {
+		path       string
+		key        string
+		statusCode int
+	}{
+		// Test case - 1.
+		{path: "/bucket", key: "key", statusCode: http.StatusOK},
+		// Test case - 2.
+		{path: "/bucket", key: "key", statusCode: http.StatusServiceUnavailable},
+		// Test case - 3.
+		{path: "/bucket", key: "other", statusCode: http.StatusOK},
+		// Test case - 4.
+		// the exempt routes are never limited.
+		{path: "/status", key: "key", statusCode: http.StatusOK},
+	}
+	for i, testCase := range testCases {
+		r := httptest.NewRequest(http.MethodGet, testCase.path, nil)
+		r.Header.Set("X-Test-Key", testCase.key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != testCase.statusCode {
+			t.Errorf("Test %d: Expected the status %d, but instead found %d", i+1, testCase.statusCode, w.Code)
+		}
+		if retryAfter := w.Header().Get(consts.RetryAfter); (w.Code == http.StatusServiceUnavailable) != (retryAfter == "1") {
+			t.Errorf("Test %d: Expected Retry-After with the SlowDown only, but instead found %q", i+1, retryAfter)
+		}
+	}
+}
+
+func TestLimiter_ForgedKey(t *testing.T) {
+	db, err := uleveldb.OpenDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	cred, err := auth.CreateCredentials(auth.DefaultAccessKey, auth.DefaultSecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authSys := iam.NewAuthSys(db, cred)
+
+	l := NewLimiter(Config{KeyRequests: 1, KeyInFlight: 1}, authSys.VerifiedAccessKey)
+	router := mux.NewRouter()
+	router.Methods(http.MethodGet).Path("/{bucket}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	router.Use(l.Middleware)
+
+	testCases := []struct {
+		secretKey  string
+		remoteAddr string
+		statusCode int
+	}{
+		// Test case - 1.
+		// a request naming the access key with a forged signature.
+		{secretKey: "forged-secret", remoteAddr: "192.0.2.1:1234", statusCode: http.StatusOK},
+		// Test case - 2.
+		// the forged requests are limited by their source address.
+		{secretKey: "forged-secret", remoteAddr: "192.0.2.1:1234", statusCode: http.StatusServiceUnavailable},
+		// Test case - 3.
+		// the requests signed by the access key are not.
+		{secretKey: auth.DefaultSecretKey, remoteAddr: "192.0.2.1:1234", statusCode: http.StatusOK},
+		// Test case - 4.
+		{secretKey: auth.DefaultSecretKey, remoteAddr: "192.0.2.2:1234", statusCode: http.StatusServiceUnavailable},
+		// Test case - 5.
+		{secretKey: "forged-secret", remoteAddr: "192.0.2.3:1234", statusCode: http.StatusOK},
+	}
+	for i, testCase := range testCases {
+		r := utils.MustNewSignedV4Request(http.MethodGet, "http://127.0.0.1:9000/bucket", 0, nil, "s3", auth.DefaultAccessKey, testCase.secretKey, t)
+		r.RemoteAddr = testCase.remoteAddr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != testCase.statusCode {
+			t.Errorf("Test %d: Expected the status %d, but instead found %d", i+1, testCase.statusCode, w.Code)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+// Package replication replicates the objects of a bucket to a bucket of a
+// remote S3 compatible endpoint, as configured by the replication
+// configuration of the bucket, through a work queue persisted in LevelDB.
+package replication
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+)
+
+const (
+	// Enabled - the status of an enabled rule or delete marker replication.
+	Enabled = "Enabled"
+	// Disabled - the status of a disabled rule or delete marker replication.
+	Disabled = "Disabled"
+
+	maxRules  = 1000
+	maxIDSize = 255
+
+	// arnPrefix - destinations are arn:fds:replication::<target>:<bucket>.
+	arnPrefix = "arn:fds:replication::"
+)
+
+var (
+	errNoRules                 = errors.New("replication configuration must have at least one rule")
+	errTooManyRules            = errors.New("replication configuration allows a maximum of 1000 rules")
+	errInvalidRuleID           = errors.New("rule ID must not exceed 255 characters")
+	errDuplicateRuleID         = errors.New("rule ID must be unique")
+	errDuplicatePriority       = errors.New("rule priority must be unique")
+	errInvalidRuleStatus       = errors.New("rule status must be Enabled or Disabled")
+	errInvalidDeleteMarker     = errors.New("delete marker replication status must be Enabled or Disabled")
+	errInvalidFilter           = errors.New("filter must have only one of Prefix, Tag or And")
+	errInvalidTag              = errors.New("tag key must not be empty")
+	errDuplicateTagKey         = errors.New("tag keys of a filter must be unique")
+	errDestinationNotSupported = errors.New("destination storage class is not supported")
+)
+
+// ErrInvalidARN - a destination ARN not of the form arn:fds:replication::<target>:<bucket>.
+type ErrInvalidARN struct {
+	ARN string
+}
+
+func (e ErrInvalidARN) Error() string {
+	return "invalid destination ARN '" + e.ARN + "'"
+}
+
+// ErrTargetNotFound - a destination ARN naming no configured target.
+type ErrTargetNotFound struct {
+	Target string
+}
+
+func (e ErrTargetNotFound) Error() string {
+	return "replication target '" + e.Target + "' not found"
+}
+
+// Config - ReplicationConfiguration of a bucket as per
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketReplication.html
+// The Bucket of a destination is the ARN of a bucket on a configured target.
+type Config struct {
+	XMLName xml.Name `xml:"ReplicationConfiguration"`
+	XMLNS   string   `xml:"xmlns,attr,omitempty"`
+	Role    string   `xml:"Role,omitempty"`
+	Rules   []Rule   `xml:"Rule"`
+}
+
+// Rule - the objects replicated to a destination.
+type Rule struct {
+	ID                      string                   `xml:"ID,omitempty"`
+	Status                  string                   `xml:"Status"`
+	Priority                int                      `xml:"Priority,omitempty"`
+	Filter                  Filter                   `xml:"Filter"`
+	DeleteMarkerReplication *DeleteMarkerReplication `xml:"DeleteMarkerReplication,omitempty"`
+	Destination             Destination              `xml:"Destination"`
+}
+
+// Filter - the prefix and the tags of the objects a rule applies to.
+type Filter struct {
+	Prefix string `xml:"Prefix,omitempty"`
+	Tag    *Tag   `xml:"Tag,omitempty"`
+	And    *And   `xml:"And,omitempty"`
+}
+
+// And - a prefix and tags all matched by the objects.
+type And struct {
+	Prefix string `xml:"Prefix,omitempty"`
+	Tags   []Tag  `xml:"Tag,omitempty"`
+}
+
+// Tag - an object tag.
+type Tag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+// DeleteMarkerReplication - whether deletes are replicated.
+type DeleteMarkerReplication struct {
+	Status string `xml:"Status"`
+}
+
+// Destination - the bucket objects are replicated to.
+type Destination struct {
+	Bucket       string `xml:"Bucket"`
+	StorageClass string `xml:"StorageClass,omitempty"`
+}
+
+// ARN - a destination bucket on a target.
+type ARN struct {
+	Target string
+	Bucket string
+}
+
+// String - returns the arn:fds:replication::<target>:<bucket> representation.
+func (arn ARN) String() string {
+	return arnPrefix + arn.Target + ":" + arn.Bucket
+}
+
+// ParseARN - parses an arn:fds:replication::<target>:<bucket> ARN.
+func ParseARN(s string) (ARN, error) {
+	if !strings.HasPrefix(s, arnPrefix) {
+		return ARN{}, ErrInvalidARN{ARN: s}
+	}
+	target, bucket, ok := strings.Cut(strings.TrimPrefix(s, arnPrefix), ":")
+	if !ok || target == "" || bucket == "" || strings.Contains(bucket, ":") {
+		return ARN{}, ErrInvalidARN{ARN: s}
+	}
+	return ARN{Target: target, Bucket: bucket}, nil
+}
+
+// ParseConfig parses and validates a ReplicationConfiguration, targetExists
+// tells whether a target is configured.
+func ParseConfig(reader io.Reader, targetExists func(string) bool) (*Config, error) {
+	var config Config
+	if err := xml.NewDecoder(reader).Decode(&config); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(targetExists); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Validate - checks the rules and that their destinations are configured targets.
+func (c Config) Validate(targetExists func(string) bool) error {
+	if len(c.Rules) == 0 {
+		return errNoRules
+	}
+	if len(c.Rules) > maxRules {
+		return errTooManyRules
+	}
+	ids := make(map[string]struct{})
+	priorities := make(map[int]struct{})
+	for _, rule := range c.Rules {
+		if err := rule.Validate(targetExists); err != nil {
+			return err
+		}
+		if rule.ID != "" {
+			if _, ok := ids[rule.ID]; ok {
+				return errDuplicateRuleID
+			}
+			ids[rule.ID] = struct{}{}
+		}
+		if len(c.Rules) > 1 {
+			if _, ok := priorities[rule.Priority]; ok {
+				return errDuplicatePriority
+			}
+			priorities[rule.Priority] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// Validate - checks the status, the filter and the destination of the rule.
+func (r Rule) Validate(targetExists func(string) bool) error {
+	if len(r.ID) > maxIDSize {
+		return errInvalidRuleID
+	}
+	if r.Status != Enabled && r.Status != Disabled {
+		return errInvalidRuleStatus
+	}
+	if r.DeleteMarkerReplication != nil && r.DeleteMarkerReplication.Status != Enabled && r.DeleteMarkerReplication.Status != Disabled {
+		return errInvalidDeleteMarker
+	}
+	if err := r.Filter.Validate(); err != nil {
+		return err
+	}
+	if r.Destination.StorageClass != "" && r.Destination.StorageClass != "STANDARD" {
+		return errDestinationNotSupported
+	}
+	arn, err := ParseARN(r.Destination.Bucket)
+	if err != nil {
+		return err
+	}
+	if !targetExists(arn.Target) {
+		return ErrTargetNotFound{Target: arn.Target}
+	}
+	return nil
+}
+
+// Validate - checks the filter has only one of a prefix, a tag or an And.
+func (f Filter) Validate() error {
+	n := 0
+	if f.Prefix != "" {
+		n++
+	}
+	if f.Tag != nil {
+		n++
+		if f.Tag.Key == "" {
+			return errInvalidTag
+		}
+	}
+	if f.And != nil {
+		n++
+		keys := make(map[string]struct{})
+		for _, tag := range f.And.Tags {
+			if tag.Key == "" {
+				return errInvalidTag
+			}
+			if _, ok := keys[tag.Key]; ok {
+				return errDuplicateTagKey
+			}
+			keys[tag.Key] = struct{}{}
+		}
+	}
+	if n > 1 {
+		return errInvalidFilter
+	}
+	return nil
+}
+
+// matches - checks the object name and its tags, given as the URL encoded
+// query of the x-amz-tagging header, pass the filter.
+func (f Filter) matches(object string, tags url.Values) bool {
+	prefix := f.Prefix
+	var filterTags []Tag
+	if f.Tag != nil {
+		filterTags = append(filterTags, *f.Tag)
+	}
+	if f.And != nil {
+		prefix = f.And.Prefix
+		filterTags = append(filterTags, f.And.Tags...)
+	}
+	if !strings.HasPrefix(object, prefix) {
+		return false
+	}
+	for _, tag := range filterTags {
+		if tags.Get(tag.Key) != tag.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// Match returns the enabled rule of the highest priority the object is
+// replicated by, deletes are only replicated by the rules with delete
+// marker replication enabled.
+func (c Config) Match(object, userTags string, isDelete bool) (Rule, bool) {
+	tags, _ := url.ParseQuery(userTags)
+	var matched Rule
+	found := false
+	for _, rule := range c.Rules {
+		if rule.Status != Enabled || !rule.Filter.matches(object, tags) {
+			continue
+		}
+		if isDelete && (rule.DeleteMarkerReplication == nil || rule.DeleteMarkerReplication.Status != Enabled) {
+			continue
+		}
+		if !found || rule.Priority > matched.Priority {
+			matched, found = rule, true
+		}
+	}
+	return matched, found
+}
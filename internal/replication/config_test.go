@@ -0,0 +1,108 @@
+package replication
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	targetExists := func(id string) bool {
+		return id == "backup"
+	}
+	testCases := []struct {
+		config  string
+		success bool
+	}{
+		{`<ReplicationConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Rule><ID>all</ID><Status>Enabled</Status><Priority>1</Priority><Filter><Prefix>images/</Prefix></Filter><DeleteMarkerReplication><Status>Enabled</Status></DeleteMarkerReplication><Destination><Bucket>arn:fds:replication::backup:images</Bucket></Destination></Rule></ReplicationConfiguration>`, true},
+		{`<ReplicationConfiguration><Rule><Status>Disabled</Status><Filter><And><Prefix>a</Prefix><Tag><Key>k</Key><Value>v</Value></Tag></And></Filter><Destination><Bucket>arn:fds:replication::backup:b</Bucket></Destination></Rule></ReplicationConfiguration>`, true},
+		{`<ReplicationConfiguration></ReplicationConfiguration>`, false},
+		{`<ReplicationConfiguration><Rule><Status>On</Status><Destination><Bucket>arn:fds:replication::backup:b</Bucket></Destination></Rule></ReplicationConfiguration>`, false},
+		{`<ReplicationConfiguration><Rule><Status>Enabled</Status><Destination><Bucket>arn:fds:replication::other:b</Bucket></Destination></Rule></ReplicationConfiguration>`, false},
+		{`<ReplicationConfiguration><Rule><Status>Enabled</Status><Destination><Bucket>arn:aws:s3:::b</Bucket></Destination></Rule></ReplicationConfiguration>`, false},
+		{`<ReplicationConfiguration><Rule><Status>Enabled</Status><Filter><Prefix>a</Prefix><Tag><Key>k</Key><Value>v</Value></Tag></Filter><Destination><Bucket>arn:fds:replication::backup:b</Bucket></Destination></Rule></ReplicationConfiguration>`, false},
+		{`<ReplicationConfiguration><Rule><Status>Enabled</Status><Filter><And><Tag><Key>k</Key><Value>v</Value></Tag><Tag><Key>k</Key><Value>w</Value></Tag></And></Filter><Destination><Bucket>arn:fds:replication::backup:b</Bucket></Destination></Rule></ReplicationConfiguration>`, false},
+		{`<ReplicationConfiguration><Rule><Status>Enabled</Status><Priority>1</Priority><Destination><Bucket>arn:fds:replication::backup:b</Bucket></Destination></Rule><Rule><Status>Enabled</Status><Priority>1</Priority><Destination><Bucket>arn:fds:replication::backup:c</Bucket></Destination></Rule></ReplicationConfiguration>`, false},
+		{`<ReplicationConfiguration><Rule><Status>Enabled</Status><DeleteMarkerReplication><Status>Yes</Status></DeleteMarkerReplication><Destination><Bucket>arn:fds:replication::backup:b</Bucket></Destination></Rule></ReplicationConfiguration>`, false},
+		{`<ReplicationConfiguration><Rule>`, false},
+	}
+	for i, testCase := range testCases {
+		_, err := ParseConfig(strings.NewReader(testCase.config), targetExists)
+		if testCase.success && err != nil {
+			t.Errorf("Test %d: Expected success, but instead found %v", i+1, err)
+		}
+		if !testCase.success && err == nil {
+			t.Errorf("Test %d: Expected failure, but instead succeeded", i+1)
+		}
+	}
+}
+
+func TestConfigMatch(t *testing.T) {
+	config := Config{Rules: []Rule{
+		{
+			ID:                      "images",
+			Status:                  Enabled,
+			Priority:                2,
+			Filter:                  Filter{Prefix: "images/"},
+			DeleteMarkerReplication: &DeleteMarkerReplication{Status: Enabled},
+			Destination:             Destination{Bucket: "arn:fds:replication::backup:images"},
+		},
+		{
+			ID:          "tagged",
+			Status:      Enabled,
+			Priority:    1,
+			Filter:      Filter{Tag: &Tag{Key: "replicate", Value: "true"}},
+			Destination: Destination{Bucket: "arn:fds:replication::backup:tagged"},
+		},
+		{
+			ID:          "disabled",
+			Status:      Disabled,
+			Priority:    3,
+			Destination: Destination{Bucket: "arn:fds:replication::backup:all"},
+		},
+	}}
+	testCases := []struct {
+		object   string
+		userTags string
+		isDelete bool
+		ruleID   string
+	}{
+		{"images/a.jpg", "", false, "images"},
+		{"images/a.jpg", "replicate=true", false, "images"},
+		{"docs/a.txt", "replicate=true&other=1", false, "tagged"},
+		{"docs/a.txt", "replicate=false", false, ""},
+		{"docs/a.txt", "", false, ""},
+		{"images/a.jpg", "", true, "images"},
+		{"docs/a.txt", "replicate=true", true, ""},
+	}
+	for i, testCase := range testCases {
+		rule, ok := config.Match(testCase.object, testCase.userTags, testCase.isDelete)
+		if ok != (testCase.ruleID != "") || rule.ID != testCase.ruleID {
+			t.Errorf("Test %d: Expected rule %q, but instead found %q", i+1, testCase.ruleID, rule.ID)
+		}
+	}
+}
+
+func TestParseARN(t *testing.T) {
+	testCases := []struct {
+		arn     string
+		success bool
+	}{
+		{"arn:fds:replication::backup:bucket", true},
+		{"arn:fds:replication::backup:", false},
+		{"arn:fds:replication:::bucket", false},
+		{"arn:fds:replication::backup:a:b", false},
+		{"arn:aws:s3:::bucket", false},
+	}
+	for i, testCase := range testCases {
+		arn, err := ParseARN(testCase.arn)
+		if testCase.success && err != nil {
+			t.Errorf("Test %d: Expected success, but instead found %v", i+1, err)
+		}
+		if !testCase.success && err == nil {
+			t.Errorf("Test %d: Expected failure, but instead succeeded", i+1)
+		}
+		if err == nil && arn.String() != testCase.arn {
+			t.Errorf("Test %d: Expected %s, but instead found %s", i+1, testCase.arn, arn)
+		}
+	}
+}
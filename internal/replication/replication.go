@@ -0,0 +1,360 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/yann-y/fds/internal/kv"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var log = logging.Logger("replication")
+
+const (
+	// queueKeyFormat - jobs are keyed by enqueue time and a sequence number
+	// so that they are dispatched in order.
+	queueKeyFormat = "replQueue/%020d-%010d"
+	queuePrefix    = "replQueue/"
+
+	// DefaultRetryInterval - the default delay before the first retry of a
+	// failed replication, doubled at every attempt.
+	DefaultRetryInterval = 10 * time.Second
+	// maxRetryInterval - the cap of the delay between retries.
+	maxRetryInterval = 30 * time.Minute
+	// DefaultMaxAttempts - the default attempts after which a replication
+	// is marked failed, until the bucket is resynced.
+	DefaultMaxAttempts = 10
+	// scanInterval - the interval the queue is scanned for due retries.
+	scanInterval = time.Second
+)
+
+// StatusType - the replication status of an object, returned as
+// x-amz-replication-status.
+type StatusType string
+
+const (
+	// StatusPending - the object is queued for replication.
+	StatusPending StatusType = "PENDING"
+	// StatusCompleted - the object is replicated.
+	StatusCompleted StatusType = "COMPLETED"
+	// StatusFailed - the replication failed after every attempt.
+	StatusFailed StatusType = "FAILED"
+	// StatusReplica - the object is a replica written by another endpoint.
+	StatusReplica StatusType = "REPLICA"
+)
+
+// ErrObjectNotFound - returned by the object layer for objects that do not exist.
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectInfo - the attributes of an object replicated.
+type ObjectInfo struct {
+	Bucket          string
+	Name            string
+	Size            int64
+	ETag            string
+	ContentType     string
+	ContentEncoding string
+	// UserTags is the URL encoded query of the x-amz-tagging header.
+	UserTags          string
+	ReplicationStatus StatusType
+}
+
+// ObjectLayer - the local objects replicated.
+type ObjectLayer interface {
+	// GetReplicationObject returns ErrObjectNotFound for objects that do not exist.
+	GetReplicationObject(ctx context.Context, bucket, object string) (ObjectInfo, io.ReadCloser, error)
+	// SetReplicationStatus sets the status of the object when its ETag is etag.
+	SetReplicationStatus(ctx context.Context, bucket, object, etag string, status StatusType) error
+	// WalkReplicationObjects calls fn for every object of the bucket.
+	WalkReplicationObjects(ctx context.Context, bucket string, fn func(ObjectInfo) error) error
+}
+
+// queuedJob - a job and its key in the queue.
+type queuedJob struct {
+	key string
+	job job
+}
+
+// job - a queued replication of an object.
+type job struct {
+	Bucket      string
+	Object      string
+	ETag        string
+	Delete      bool
+	Destination string
+	Attempts    int
+	NextAttempt time.Time
+}
+
+// ReplicationSys - replicates the objects queued by Enqueue to their
+// destination, retrying with an exponential backoff.
+type ReplicationSys struct {
+	db            *kv.DB
+	objects       ObjectLayer
+	targets       map[string]*Target
+	workers       int
+	retryInterval time.Duration
+	maxAttempts   int
+	seq           uint64
+
+	wake chan struct{}
+	mu   sync.Mutex
+	// inFlight holds the bucket/object of the jobs being replicated, the
+	// jobs of an object are replicated one at a time in order.
+	inFlight map[string]struct{}
+}
+
+// NewReplicationSys returns a replication sys queuing jobs in db, replicated
+// by workers goroutines.
+func NewReplicationSys(db *kv.DB, objects ObjectLayer, workers int, retryInterval time.Duration, maxAttempts int) *ReplicationSys {
+	if workers <= 0 {
+		workers = 1
+	}
+	if retryInterval <= 0 {
+		retryInterval = DefaultRetryInterval
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	return &ReplicationSys{
+		db:            db,
+		objects:       objects,
+		targets:       make(map[string]*Target),
+		workers:       workers,
+		retryInterval: retryInterval,
+		maxAttempts:   maxAttempts,
+		wake:          make(chan struct{}, 1),
+		inFlight:      make(map[string]struct{}),
+	}
+}
+
+// AddTarget - registers a target.
+func (sys *ReplicationSys) AddTarget(target *Target) error {
+	if _, ok := sys.targets[target.ID()]; ok {
+		return fmt.Errorf("duplicate replication target %s", target.ID())
+	}
+	sys.targets[target.ID()] = target
+	return nil
+}
+
+// HasTarget - checks whether the target is registered.
+func (sys *ReplicationSys) HasTarget(id string) bool {
+	if sys == nil {
+		return false
+	}
+	_, ok := sys.targets[id]
+	return ok
+}
+
+// Start - replicates the queued jobs, including those left by a previous
+// run, until ctx is done.
+func (sys *ReplicationSys) Start(ctx context.Context) {
+	jobs := make(chan queuedJob)
+	for i := 0; i < sys.workers; i++ {
+		go func() {
+			for qj := range jobs {
+				sys.process(ctx, qj.key, qj.job)
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		ticker := time.NewTicker(scanInterval)
+		defer ticker.Stop()
+		for {
+			sys.dispatch(ctx, jobs)
+			select {
+			case <-ctx.Done():
+				return
+			case <-sys.wake:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Enqueue - queues the replication of the object, or of its delete, when
+// a rule of config matches it. Replicas are not replicated again.
+func (sys *ReplicationSys) Enqueue(ctx context.Context, config *Config, info ObjectInfo, isDelete bool) {
+	if sys == nil || config == nil || info.ReplicationStatus == StatusReplica {
+		return
+	}
+	rule, ok := config.Match(info.Name, info.UserTags, isDelete)
+	if !ok {
+		return
+	}
+	j := job{
+		Bucket:      info.Bucket,
+		Object:      info.Name,
+		Delete:      isDelete,
+		Destination: rule.Destination.Bucket,
+	}
+	if !isDelete {
+		j.ETag = info.ETag
+		if err := sys.objects.SetReplicationStatus(ctx, info.Bucket, info.Name, info.ETag, StatusPending); err != nil {
+			log.Errorf("set replication status of %s/%s err:%v", info.Bucket, info.Name, err)
+		}
+	}
+	key := fmt.Sprintf(queueKeyFormat, time.Now().UnixNano(), atomic.AddUint64(&sys.seq, 1))
+	if err := sys.db.Put(key, j); err != nil {
+		log.Errorf("queue replication of %s/%s err:%v", info.Bucket, info.Name, err)
+		return
+	}
+	select {
+	case sys.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Resync - queues the replication of every object of the bucket matching
+// config, such as objects written before replication was configured, and
+// returns the number of objects queued.
+func (sys *ReplicationSys) Resync(ctx context.Context, bucket string, config *Config) (int, error) {
+	n := 0
+	err := sys.objects.WalkReplicationObjects(ctx, bucket, func(info ObjectInfo) error {
+		if info.ReplicationStatus == StatusReplica {
+			return nil
+		}
+		if _, ok := config.Match(info.Name, info.UserTags, false); !ok {
+			return nil
+		}
+		sys.Enqueue(ctx, config, info, false)
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// dispatch - sends the due jobs whose object has no job in flight to the workers.
+func (sys *ReplicationSys) dispatch(ctx context.Context, jobs chan<- queuedJob) {
+	all, err := sys.db.ReadAllChan(ctx, queuePrefix, "")
+	if err != nil {
+		log.Errorf("list replication queue err:%v", err)
+		return
+	}
+	now := time.Now()
+	blocked := make(map[string]struct{})
+	for entry := range all {
+		var j job
+		if err = entry.UnmarshalValue(&j); err != nil {
+			log.Errorf("drop replication job %s, unmarshal err:%v", entry.Key, err)
+			sys.db.Delete(entry.Key)
+			continue
+		}
+		name := j.Bucket + "/" + j.Object
+		if _, ok := blocked[name]; ok {
+			continue
+		}
+		// later jobs of the object wait for this one
+		blocked[name] = struct{}{}
+		if j.NextAttempt.After(now) {
+			continue
+		}
+		sys.mu.Lock()
+		_, busy := sys.inFlight[name]
+		if !busy {
+			sys.inFlight[name] = struct{}{}
+		}
+		sys.mu.Unlock()
+		if busy {
+			continue
+		}
+		select {
+		case jobs <- queuedJob{key: entry.Key, job: j}:
+		case <-ctx.Done():
+			sys.mu.Lock()
+			delete(sys.inFlight, name)
+			sys.mu.Unlock()
+			return
+		}
+	}
+}
+
+// process - replicates the job of key, then deletes it or schedules a retry.
+func (sys *ReplicationSys) process(ctx context.Context, key string, j job) {
+	defer func() {
+		sys.mu.Lock()
+		delete(sys.inFlight, j.Bucket+"/"+j.Object)
+		sys.mu.Unlock()
+	}()
+
+	err := sys.replicate(ctx, j)
+	if err == nil {
+		if !j.Delete {
+			sys.setStatus(ctx, j, StatusCompleted)
+		}
+		if err = sys.db.Delete(key); err != nil {
+			log.Errorf("delete replication job %s err:%v", key, err)
+		}
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	j.Attempts++
+	if j.Attempts >= sys.maxAttempts {
+		log.Errorf("replication of %s/%s to %s failed after %d attempts: %v", j.Bucket, j.Object, j.Destination, j.Attempts, err)
+		if !j.Delete {
+			sys.setStatus(ctx, j, StatusFailed)
+		}
+		if err = sys.db.Delete(key); err != nil {
+			log.Errorf("delete replication job %s err:%v", key, err)
+		}
+		return
+	}
+	backoff := sys.retryInterval << (j.Attempts - 1)
+	if backoff <= 0 || backoff > maxRetryInterval {
+		backoff = maxRetryInterval
+	}
+	log.Warnf("replication of %s/%s to %s failed, retry in %v: %v", j.Bucket, j.Object, j.Destination, backoff, err)
+	j.NextAttempt = time.Now().Add(backoff)
+	if err = sys.db.Put(key, j); err != nil {
+		log.Errorf("update replication job %s err:%v", key, err)
+	}
+}
+
+// replicate - copies the current object to the destination, or deletes it
+// there. Jobs outdated by a later write or delete of the object are done.
+func (sys *ReplicationSys) replicate(ctx context.Context, j job) error {
+	arn, err := ParseARN(j.Destination)
+	if err != nil {
+		return err
+	}
+	target, ok := sys.targets[arn.Target]
+	if !ok {
+		return ErrTargetNotFound{Target: arn.Target}
+	}
+	info, reader, err := sys.objects.GetReplicationObject(ctx, j.Bucket, j.Object)
+	if j.Delete {
+		if err == nil {
+			reader.Close()
+			// written again after the delete
+			return nil
+		}
+		if !errors.Is(err, ErrObjectNotFound) {
+			return err
+		}
+		return target.RemoveObject(ctx, arn.Bucket, j.Object)
+	}
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	if info.ETag != j.ETag {
+		return nil
+	}
+	return target.PutObject(ctx, arn.Bucket, info, reader)
+}
+
+func (sys *ReplicationSys) setStatus(ctx context.Context, j job, status StatusType) {
+	if err := sys.objects.SetReplicationStatus(ctx, j.Bucket, j.Object, j.ETag, status); err != nil {
+		log.Errorf("set replication status of %s/%s err:%v", j.Bucket, j.Object, err)
+	}
+}
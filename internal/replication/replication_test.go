@@ -0,0 +1,274 @@
+package replication
+
+import (
+	"bytes"
+	"context"
+	"github.com/yann-y/fds/internal/consts"
+	"github.com/yann-y/fds/internal/uleveldb"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// remoteStandIn - a local HTTP stand-in of the PUT and DELETE object APIs
+// of a remote endpoint, failing while down is set.
+type remoteStandIn struct {
+	mu       sync.Mutex
+	down     bool
+	objects  map[string][]byte
+	replicas map[string]string
+}
+
+func newRemoteStandIn() *remoteStandIn {
+	return &remoteStandIn{objects: make(map[string][]byte), replicas: make(map[string]string)}
+}
+
+func (s *remoteStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.objects[name] = data
+		s.replicas[name] = r.Header.Get(consts.AmzBucketReplicationStatus)
+		w.Header().Set(consts.ETag, `"etag"`)
+	case http.MethodDelete:
+		delete(s.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *remoteStandIn) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+func (s *remoteStandIn) object(name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[name]
+	return data, ok
+}
+
+func (s *remoteStandIn) replicaStatus(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.replicas[name]
+}
+
+// memObjects - an in-memory object layer.
+type memObjects struct {
+	mu    sync.Mutex
+	infos map[string]ObjectInfo
+	data  map[string][]byte
+}
+
+func newMemObjects() *memObjects {
+	return &memObjects{infos: make(map[string]ObjectInfo), data: make(map[string][]byte)}
+}
+
+func (m *memObjects) put(bucket, object, data, userTags string) ObjectInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	info := ObjectInfo{Bucket: bucket, Name: object, Size: int64(len(data)), ETag: data, UserTags: userTags}
+	m.infos[bucket+"/"+object] = info
+	m.data[bucket+"/"+object] = []byte(data)
+	return info
+}
+
+func (m *memObjects) remove(bucket, object string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.infos, bucket+"/"+object)
+	delete(m.data, bucket+"/"+object)
+}
+
+func (m *memObjects) status(bucket, object string) StatusType {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.infos[bucket+"/"+object].ReplicationStatus
+}
+
+func (m *memObjects) GetReplicationObject(ctx context.Context, bucket, object string) (ObjectInfo, io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	info, ok := m.infos[bucket+"/"+object]
+	if !ok {
+		return ObjectInfo{}, nil, ErrObjectNotFound
+	}
+	return info, io.NopCloser(bytes.NewReader(m.data[bucket+"/"+object])), nil
+}
+
+func (m *memObjects) SetReplicationStatus(ctx context.Context, bucket, object, etag string, status StatusType) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	info, ok := m.infos[bucket+"/"+object]
+	if !ok || info.ETag != etag {
+		return nil
+	}
+	info.ReplicationStatus = status
+	m.infos[bucket+"/"+object] = info
+	return nil
+}
+
+func (m *memObjects) WalkReplicationObjects(ctx context.Context, bucket string, fn func(ObjectInfo) error) error {
+	m.mu.Lock()
+	var infos []ObjectInfo
+	for _, info := range m.infos {
+		if info.Bucket == bucket {
+			infos = append(infos, info)
+		}
+	}
+	m.mu.Unlock()
+	for _, info := range infos {
+		if err := fn(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func testConfig() *Config {
+	return &Config{Rules: []Rule{{
+		Status:                  Enabled,
+		Filter:                  Filter{Prefix: "images/"},
+		DeleteMarkerReplication: &DeleteMarkerReplication{Status: Enabled},
+		Destination:             Destination{Bucket: "arn:fds:replication::backup:dest"},
+	}}}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Expected %s", what)
+}
+
+func newTestSys(t *testing.T, objects ObjectLayer, endpoint string, maxAttempts int) *ReplicationSys {
+	db, err := uleveldb.OpenDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	sys := NewReplicationSys(db, objects, 2, 20*time.Millisecond, maxAttempts)
+	target, err := NewTarget("backup", strings.Replace(endpoint, "http://", "http://access:secret@", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sys.AddTarget(target); err != nil {
+		t.Fatal(err)
+	}
+	return sys
+}
+
+func TestReplicationSys(t *testing.T) {
+	remote := newRemoteStandIn()
+	server := httptest.NewServer(remote)
+	defer server.Close()
+	objects := newMemObjects()
+	sys := newTestSys(t, objects, server.URL, DefaultMaxAttempts)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sys.Start(ctx)
+
+	remote.setDown(true)
+	info := objects.put("src", "images/a.jpg", "hello", "")
+	sys.Enqueue(ctx, testConfig(), info, false)
+	sys.Enqueue(ctx, testConfig(), objects.put("src", "docs/a.txt", "skipped", ""), false)
+	if status := objects.status("src", "images/a.jpg"); status != StatusPending {
+		t.Fatalf("Expected %s, but instead found %s", StatusPending, status)
+	}
+
+	// retried once the remote is back
+	time.Sleep(50 * time.Millisecond)
+	remote.setDown(false)
+	waitFor(t, "the object replicated", func() bool {
+		return objects.status("src", "images/a.jpg") == StatusCompleted
+	})
+	if data, _ := remote.object("dest/images/a.jpg"); string(data) != "hello" {
+		t.Errorf("Expected the replica hello, but instead found %q", data)
+	}
+	if remote.replicaStatus("dest/images/a.jpg") != string(StatusReplica) {
+		t.Errorf("Expected the replica to be marked %s", StatusReplica)
+	}
+	if _, ok := remote.object("dest/docs/a.txt"); ok {
+		t.Error("Expected the object out of the rule not to be replicated")
+	}
+
+	objects.remove("src", "images/a.jpg")
+	sys.Enqueue(ctx, testConfig(), info, true)
+	waitFor(t, "the delete replicated", func() bool {
+		_, ok := remote.object("dest/images/a.jpg")
+		return !ok
+	})
+
+	// replicas are not replicated again
+	replica := objects.put("src", "images/b.jpg", "replica", "")
+	objects.SetReplicationStatus(ctx, "src", "images/b.jpg", replica.ETag, StatusReplica)
+	replica.ReplicationStatus = StatusReplica
+	sys.Enqueue(ctx, testConfig(), replica, false)
+
+	// resync queues the existing objects
+	objects.put("src", "images/c.jpg", "existing", "")
+	n, err := sys.Resync(ctx, "src", testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 object resynced, but instead found %d", n)
+	}
+	waitFor(t, "the existing objects replicated", func() bool {
+		_, ok := remote.object("dest/images/c.jpg")
+		return ok
+	})
+	if _, ok := remote.object("dest/images/b.jpg"); ok {
+		t.Error("Expected the replica not to be replicated")
+	}
+}
+
+func TestReplicationSysFailed(t *testing.T) {
+	remote := newRemoteStandIn()
+	remote.setDown(true)
+	server := httptest.NewServer(remote)
+	defer server.Close()
+	objects := newMemObjects()
+	sys := newTestSys(t, objects, server.URL, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// queued before the sys starts, as after a restart
+	sys.Enqueue(ctx, testConfig(), objects.put("src", "images/a.jpg", "hello", ""), false)
+	sys.Start(ctx)
+	waitFor(t, "the replication to fail", func() bool {
+		return objects.status("src", "images/a.jpg") == StatusFailed
+	})
+
+	remote.setDown(false)
+	if _, err := sys.Resync(ctx, "src", testConfig()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the failed object replicated by resync", func() bool {
+		return objects.status("src", "images/a.jpg") == StatusCompleted
+	})
+}
@@ -0,0 +1,129 @@
+// Package reqinfo records what is learnt of a request as it is served, the
+// route it matched, the bytes of its body and of its response and the status
+// and the error code of its response, for the audit log and the metrics.
+package reqinfo
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/yann-y/fds/internal/utils"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+type contextKey struct{}
+
+// Info - a request served by Serve.
+type Info struct {
+	// API, Bucket, Object - the route matched, recorded by SetRoute. The API
+	// name is the name of the route handler without its Handler suffix.
+	API    string
+	Bucket string
+	Object string
+	// StatusCode, ErrorCode - the response, the error code recorded by
+	// SetErrorCode.
+	StatusCode int
+	ErrorCode  string
+	// InputBytes, OutputBytes - the bytes of the request body read and of the
+	// response written.
+	InputBytes  int64
+	OutputBytes int64
+}
+
+// Serve - serves r with h, and returns the Info of r once served. The
+// requests served by an outer Serve share its Info, so that the handlers
+// nested count a request once.
+func Serve(h http.Handler, w http.ResponseWriter, r *http.Request) *Info {
+	if info, ok := r.Context().Value(contextKey{}).(*Info); ok {
+		h.ServeHTTP(w, r)
+		return info
+	}
+	info := &Info{StatusCode: http.StatusOK}
+	if r.Body != nil {
+		r.Body = &countingReader{ReadCloser: r.Body, n: &info.InputBytes}
+	}
+	h.ServeHTTP(&responseWriter{ResponseWriter: w, info: info}, r.WithContext(context.WithValue(r.Context(), contextKey{}, info)))
+	return info
+}
+
+// SetRoute is a mux middleware recording the API name, the bucket and the
+// object of the route matched in the Info of the request.
+func SetRoute(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info, ok := r.Context().Value(contextKey{}).(*Info); ok {
+			if route := mux.CurrentRoute(r); route != nil {
+				info.API = utils.APIName(route.GetHandler())
+			}
+			vars := mux.Vars(r)
+			info.Bucket = vars["bucket"]
+			info.Object = vars["object"]
+			if object, err := url.PathUnescape(info.Object); err == nil {
+				info.Object = object
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// SetErrorCode records the error code of the response written to w, w may
+// wrap the writer of Serve when it has an Unwrap method.
+func SetErrorCode(w http.ResponseWriter, code string) {
+	for {
+		switch rw := w.(type) {
+		case *responseWriter:
+			rw.info.ErrorCode = code
+			return
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return
+		}
+	}
+}
+
+// countingReader - counts the bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	*r.n += int64(n)
+	return n, err
+}
+
+// responseWriter - records the status and the bytes written.
+type responseWriter struct {
+	http.ResponseWriter
+	info        *Info
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.info.StatusCode = statusCode
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(p)
+	w.info.OutputBytes += int64(n)
+	return n, err
+}
+
+// Unwrap - returns the writer wrapped.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush - flushes the response when the underlying writer supports it.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,51 @@
+package reqinfo
+
+import (
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// wrapper - a writer wrapping another one, as those of the middlewares.
+type wrapper struct {
+	http.ResponseWriter
+}
+
+func (w *wrapper) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func TestServe(t *testing.T) {
+	router := mux.NewRouter()
+	router.Methods(http.MethodPut).Path("/{bucket}/{object:.+}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		SetErrorCode(&wrapper{ResponseWriter: w}, "SlowDown")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("slow"))
+	})
+	router.Use(SetRoute)
+
+	var inner *Info
+	// the handlers nested share the info of the outer one
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner = Serve(router, w, r)
+	})
+	w := httptest.NewRecorder()
+	info := Serve(handler, w, httptest.NewRequest(http.MethodPut, "/bucket/dir/a%20b.txt", strings.NewReader("hello")))
+
+	if inner != info {
+		t.Fatal("Expected the nested handlers to share the info")
+	}
+	// the API name of a func literal is not checked
+	info.API = ""
+	expected := Info{Bucket: "bucket", Object: "dir/a b.txt", StatusCode: http.StatusServiceUnavailable, ErrorCode: "SlowDown", InputBytes: 5, OutputBytes: 4}
+	if *info != expected {
+		t.Errorf("Expected %+v, but instead found %+v", expected, *info)
+	}
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != "slow" {
+		t.Errorf("Expected the response written through, but instead found %d %q", w.Code, w.Body.String())
+	}
+}
@@ -1,5 +1,10 @@
 package response
 
+import (
+	"encoding/xml"
+	"github.com/yann-y/fds/internal/iam/acl"
+)
+
 type accessControlList struct {
 	Grant []Grant `xml:"Grant,omitempty"`
 }
@@ -27,25 +32,47 @@ type canonicalUser struct {
 //
 // </AccessControlPolicy>
 type AccessControlPolicy struct {
+	XMLName           xml.Name          `xml:"AccessControlPolicy" json:"-"`
+	XMLNS             string            `xml:"xmlns,attr,omitempty" json:"-"`
 	Owner             canonicalUser     `xml:"Owner"`
 	AccessControlList accessControlList `xml:"AccessControlList"`
 }
 
 // Grant grant
-type Grant struct {
-	Grantee    Grantee    `xml:"Grantee"`
-	Permission Permission `xml:"Permission"`
-}
+type Grant = acl.Grant
 
 // Grantee grant
-type Grantee struct {
-	XMLNS       string `xml:"xmlns:xsi,attr"`
-	XMLXSI      string `xml:"xsi:type,attr"`
-	Type        string `xml:"Type"`
-	ID          string `xml:"ID,omitempty"`
-	DisplayName string `xml:"DisplayName,omitempty"`
-	URI         string `xml:"URI,omitempty"`
-}
+type Grantee = acl.Grantee
 
 // Permission May be one of READ, WRITE, READ_ACP, WRITE_ACP, FULL_CONTROL
-type Permission string
+type Permission = acl.Permission
+
+// GenerateAccessControlPolicy returns the AccessControlPolicy of the ACL.
+func GenerateAccessControlPolicy(a acl.ACL) AccessControlPolicy {
+	resp := AccessControlPolicy{
+		XMLNS: "http://s3.amazonaws.com/doc/2006-03-01/",
+		Owner: canonicalUser{ID: a.Owner, DisplayName: a.Owner},
+	}
+	resp.AccessControlList.Grant = append(resp.AccessControlList.Grant, a.Grants...)
+	return resp
+}
+
+// ToACL returns the ACL described by the AccessControlPolicy.
+func (p AccessControlPolicy) ToACL() acl.ACL {
+	return acl.ACL{
+		Owner:  p.Owner.ID,
+		Grants: p.AccessControlList.Grant,
+	}
+}
+
+// OwnershipControls - format for bucket ownership controls.
+type OwnershipControls struct {
+	XMLName xml.Name                `xml:"OwnershipControls" json:"-"`
+	XMLNS   string                  `xml:"xmlns,attr,omitempty" json:"-"`
+	Rules   []OwnershipControlsRule `xml:"Rule"`
+}
+
+// OwnershipControlsRule - the object ownership of the bucket.
+type OwnershipControlsRule struct {
+	ObjectOwnership string `xml:"ObjectOwnership"`
+}
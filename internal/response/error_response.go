@@ -4,12 +4,15 @@ import (
 	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/yann-y/fds/internal/apierrors"
+	"github.com/yann-y/fds/internal/reqinfo"
 	"net/http"
 	"time"
 )
 
 func WriteErrorResponseHeadersOnly(w http.ResponseWriter, r *http.Request, err apierrors.ErrorCode) {
-	writeResponse(w, r, apierrors.GetAPIError(err).HTTPStatusCode, nil, mimeNone)
+	apiError := apierrors.GetAPIError(err)
+	reqinfo.SetErrorCode(w, apiError.Code)
+	writeResponse(w, r, apiError.HTTPStatusCode, nil, mimeNone)
 }
 
 // WriteErrorResponse write ErrorResponse
@@ -19,6 +22,7 @@ func WriteErrorResponse(w http.ResponseWriter, r *http.Request, errorCode apierr
 	object := vars["object"]
 
 	apiError := apierrors.GetAPIError(errorCode)
+	reqinfo.SetErrorCode(w, apiError.Code)
 	errorResponse := getRESTErrorResponse(apiError, r.URL.Path, bucket, object)
 	WriteXMLResponse(w, r, apiError.HTTPStatusCode, errorResponse)
 }
@@ -0,0 +1,82 @@
+package response
+
+import (
+	"encoding/xml"
+	"github.com/yann-y/fds/internal/consts"
+	"github.com/yann-y/fds/internal/datatypes"
+	"net/http"
+)
+
+// multiDeleteFlushEvery - the number of results written between flushes.
+const multiDeleteFlushEvery = 100
+
+// MultiDeleteWriter streams the DeleteResult of a multi-object delete, each
+// result is written as soon as it is known instead of all of them at the
+// end, which keeps the memory of the response constant and the connection
+// busy while the objects are deleted.
+type MultiDeleteWriter struct {
+	w       http.ResponseWriter
+	enc     *xml.Encoder
+	quiet   bool
+	written int
+	err     error
+}
+
+// NewMultiDeleteWriter writes the headers of the response and opens its
+// DeleteResult, the deleted objects are left out when quiet.
+func NewMultiDeleteWriter(w http.ResponseWriter, r *http.Request, quiet bool) *MultiDeleteWriter {
+	setCommonHeaders(w, r)
+	w.Header().Set(consts.ContentType, string(mimeXML))
+	w.WriteHeader(http.StatusOK)
+	mw := &MultiDeleteWriter{w: w, enc: xml.NewEncoder(w), quiet: quiet}
+	if _, mw.err = w.Write([]byte(xml.Header)); mw.err == nil {
+		mw.err = mw.enc.EncodeToken(xml.StartElement{Name: xml.Name{Space: "http://s3.amazonaws.com/doc/2006-03-01/", Local: "DeleteResult"}})
+	}
+	return mw
+}
+
+// Deleted writes a deleted object.
+func (mw *MultiDeleteWriter) Deleted(obj datatypes.DeletedObject) {
+	if mw.quiet {
+		return
+	}
+	mw.encode(obj, "Deleted")
+}
+
+// Error writes the error of an object.
+func (mw *MultiDeleteWriter) Error(err DeleteError) {
+	mw.encode(err, "Error")
+}
+
+func (mw *MultiDeleteWriter) encode(v interface{}, name string) {
+	if mw.err != nil {
+		return
+	}
+	if mw.err = mw.enc.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: name}}); mw.err != nil {
+		return
+	}
+	if mw.written++; mw.written%multiDeleteFlushEvery == 0 {
+		mw.flush()
+	}
+}
+
+func (mw *MultiDeleteWriter) flush() {
+	if mw.err = mw.enc.Flush(); mw.err != nil {
+		return
+	}
+	if flusher, ok := mw.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close closes the DeleteResult and returns the first error writing the
+// response.
+func (mw *MultiDeleteWriter) Close() error {
+	if mw.err == nil {
+		mw.err = mw.enc.EncodeToken(xml.EndElement{Name: xml.Name{Space: "http://s3.amazonaws.com/doc/2006-03-01/", Local: "DeleteResult"}})
+	}
+	if mw.err == nil {
+		mw.flush()
+	}
+	return mw.err
+}
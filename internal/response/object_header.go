@@ -38,6 +38,10 @@ func SetObjectHeaders(w http.ResponseWriter, r *http.Request, objInfo store.Obje
 	// Set content length
 	w.Header().Set(consts.ContentLength, strconv.FormatInt(objInfo.Size, 10))
 
+	if objInfo.ReplicationStatus != "" {
+		w.Header().Set(consts.AmzBucketReplicationStatus, objInfo.ReplicationStatus)
+	}
+
 	// Set the relevant version ID as part of the response header.
 	if objInfo.VersionID != "" {
 		w.Header()[consts.AmzVersionID] = []string{objInfo.VersionID}
@@ -12,6 +12,7 @@ import (
 	"github.com/yann-y/fds/internal/apierrors"
 	"github.com/yann-y/fds/internal/consts"
 	"github.com/yann-y/fds/internal/datatypes"
+	"github.com/yann-y/fds/internal/reqinfo"
 	"github.com/yann-y/fds/internal/store"
 	"github.com/yann-y/fds/internal/utils"
 	"net/http"
@@ -93,6 +94,7 @@ func encodeXMLResponse(response interface{}) []byte {
 // useful for admin APIs.
 func WriteErrorResponseJSON(w http.ResponseWriter, err apierrors.APIError, reqURL *url.URL, host string) {
 	// Generate error response.
+	reqinfo.SetErrorCode(w, err.Code)
 	errorResponse := getAPIErrorResponse(err, reqURL.Path, w.Header().Get(consts.AmzRequestID), host)
 	encodedErrorResponse := encodeResponseJSON(errorResponse)
 	writeResponseSimple(w, err.HTTPStatusCode, encodedErrorResponse, mimeJSON)
@@ -140,6 +142,12 @@ func WriteSuccessNoContent(w http.ResponseWriter) {
 	writeResponseSimple(w, http.StatusNoContent, nil, mimeNone)
 }
 
+// WriteAccepted writes success headers with http status 202, the request
+// goes on in the background.
+func WriteAccepted(w http.ResponseWriter) {
+	writeResponseSimple(w, http.StatusAccepted, nil, mimeNone)
+}
+
 // ListAllMyBucketsResult  List All Buckets Result
 type ListAllMyBucketsResult struct {
 	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListAllMyBucketsResult"`
@@ -428,6 +436,16 @@ type CompleteMultipartUploadResponse struct {
 	ChecksumSHA256 string
 }
 
+// PostResponse container for POST object request when success_action_status is set to 201
+type PostResponse struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ PostResponse" json:"-"`
+
+	Location string
+	Bucket   string
+	Key      string
+	ETag     string
+}
+
 // Part container for part metadata.
 type Part struct {
 	PartNumber   int
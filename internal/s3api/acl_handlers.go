@@ -1,8 +1,11 @@
 package s3api
 
 import (
+	"context"
+	"errors"
 	"github.com/yann-y/fds/internal/apierrors"
 	"github.com/yann-y/fds/internal/consts"
+	"github.com/yann-y/fds/internal/iam/acl"
 	"github.com/yann-y/fds/internal/iam/policy"
 	"github.com/yann-y/fds/internal/iam/s3action"
 	"github.com/yann-y/fds/internal/response"
@@ -10,35 +13,97 @@ import (
 	"github.com/yann-y/fds/pkg/s3utils"
 	"io"
 	"net/http"
+	"strings"
 )
 
-func checkPermissionType(s string) bool {
-	switch s {
-	case policy.PublicRead:
-		return true
-	case policy.PublicReadWrite:
-		return true
-	case policy.Private:
-		return true
-	case policy.Default:
-		return true
-	}
-	return false
+// grantErrorCode returns the error code of an invalid grant.
+func grantErrorCode(err error) apierrors.ErrorCode {
+	if errors.Is(err, acl.ErrUnsupportedEmail) {
+		return apierrors.ErrUnresolvableGrantByEmailAddress
+	}
+	return apierrors.ErrMalformedACLError
 }
 
-// 上传对象时设置object ACL，目前只支持private | public-read | public-read-write | default
-// 如果传其他的，默认default
-func checkPutObjectACL(acl string) string {
-	switch acl {
-	case policy.PublicRead:
-		return acl
-	case policy.PublicReadWrite:
-		return acl
-	case policy.Private:
-		return acl
-	default:
-		return policy.Default
+// parseACLRequest returns the ACL of a PUT acl request, either a canned ACL
+// given by x-amz-acl, or the grants given by the x-amz-grant-* headers or by
+// an AccessControlPolicy body. owner is the owner of the bucket or object.
+func parseACLRequest(r *http.Request, owner string) (canned string, grants []acl.Grant, s3Err apierrors.ErrorCode) {
+	canned = r.Header.Get(consts.AmzACL)
+	hasGrants := acl.HasGrantHeaders(r.Header)
+	switch {
+	case canned != "" && hasGrants:
+		return "", nil, apierrors.ErrInvalidRequest
+	case canned != "":
+		if !acl.IsValidCanned(canned) {
+			return "", nil, apierrors.ErrNotImplemented
+		}
+		return canned, nil, apierrors.ErrNone
+	case hasGrants:
+		grants, err := acl.ParseGrantHeaders(r.Header)
+		if err != nil {
+			return "", nil, grantErrorCode(err)
+		}
+		return "", grants, apierrors.ErrNone
+	}
+
+	accessControlPolicy := &response.AccessControlPolicy{}
+	if err := utils.XmlDecoder(r.Body, accessControlPolicy, r.ContentLength); err != nil {
+		if err == io.EOF {
+			return "", nil, apierrors.ErrMissingSecurityHeader
+		}
+		return "", nil, apierrors.ErrMalformedACLError
+	}
+	a := accessControlPolicy.ToACL()
+	if a.Owner != "" && a.Owner != owner {
+		return "", nil, apierrors.ErrAccessDenied
+	}
+	if err := a.Validate(); err != nil {
+		return "", nil, grantErrorCode(err)
+	}
+	return "", a.Grants, apierrors.ErrNone
+}
+
+// setObjectACLMetadata sets the owner and the ACL of an object written by
+// accessKey in metadata, from the x-amz-acl and x-amz-grant-* headers.
+// Objects belong to the bucket owner when the bucket enforces ownership, or
+// prefers it and the writer gives it full control.
+func (s3a *s3ApiServer) setObjectACLMetadata(ctx context.Context, h http.Header, bucket, accessKey string, metadata map[string]string) apierrors.ErrorCode {
+	meta, err := s3a.bmSys.GetBucketMeta(ctx, bucket)
+	if err != nil {
+		return apierrors.ToApiError(ctx, err)
+	}
+	canned := h.Get(consts.AmzACL)
+	hasGrants := acl.HasGrantHeaders(h)
+	if canned != "" && hasGrants {
+		return apierrors.ErrInvalidRequest
 	}
+	if !meta.ACLsEnabled() {
+		if hasGrants || (canned != "" && canned != acl.BucketOwnerFullControl) {
+			return apierrors.ErrAccessControlListNotSupported
+		}
+		metadata[consts.AmzACL] = policy.Default
+		return apierrors.ErrNone
+	}
+	if !acl.IsValidCanned(canned) {
+		canned = policy.Default
+	}
+	if hasGrants {
+		if _, err = acl.ParseGrantHeaders(h); err != nil {
+			return grantErrorCode(err)
+		}
+		for _, header := range []string{acl.AmzGrantRead, acl.AmzGrantWrite, acl.AmzGrantReadACP, acl.AmzGrantWriteACP, acl.AmzGrantFullControl} {
+			if v := h.Values(header); len(v) > 0 {
+				metadata[strings.ToLower(header)] = strings.Join(v, ",")
+			}
+		}
+	}
+	owner := accessKey
+	if owner == meta.Owner || (meta.ObjectOwnership == acl.BucketOwnerPreferred && canned == acl.BucketOwnerFullControl) {
+		owner = ""
+	}
+	metadata[consts.AmzACL] = canned
+	metadata[consts.AmzObjectOwner] = owner
+	return apierrors.ErrNone
 }
 
 // GetBucketAclHandler Get Bucket ACL
@@ -47,89 +112,50 @@ func (s3a *s3ApiServer) GetBucketAclHandler(w http.ResponseWriter, r *http.Reque
 	// collect parameters
 	bucket, _, _ := getBucketAndObject(r)
 	log.Infof("GetBucketAclHandler %s", bucket)
-	cred, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(r.Context(), r, s3action.GetBucketPolicyAction, bucket, "")
+	_, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(r.Context(), r, s3action.GetBucketAclAction, bucket, "")
 	if s3err != apierrors.ErrNone {
 		response.WriteErrorResponse(w, r, s3err)
 		return
 	}
 	ctx := r.Context()
-	if !s3a.bmSys.HasBucket(ctx, bucket) {
-		response.WriteErrorResponseHeadersOnly(w, r, apierrors.ErrNoSuchBucket)
-		return
-	}
-	acl, err := s3a.bmSys.GetBucketAcl(ctx, bucket)
+	a, err := s3a.bmSys.GetBucketAcl(ctx, bucket)
 	if err != nil {
 		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
 		return
 	}
-	// 校验桶ACL类型，公共读(PublicRead)，公共读写(PublicReadWrite)，私有(Private)
-	if acl == "" {
-		acl = "private"
-	}
-	resp := response.AccessControlPolicy{}
-	id := cred.AccessKey
-	if resp.Owner.DisplayName == "" {
-		resp.Owner.DisplayName = cred.AccessKey
-		resp.Owner.ID = id
-	}
-	resp.AccessControlList.Grant = append(resp.AccessControlList.Grant, response.Grant{
-		Grantee: response.Grantee{
-			ID:          id,
-			DisplayName: cred.AccessKey,
-			Type:        "CanonicalUser",
-			XMLXSI:      "CanonicalUser",
-			XMLNS:       "http://www.w3.org/2001/XMLSchema-instance"},
-		Permission: response.Permission(acl), //todo change
-	})
-	response.WriteSuccessResponseXML(w, r, resp)
+	response.WriteSuccessResponseXML(w, r, response.GenerateAccessControlPolicy(a))
 }
 
 // PutBucketAclHandler Put bucket ACL
 // https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketAcl.html
 func (s3a *s3ApiServer) PutBucketAclHandler(w http.ResponseWriter, r *http.Request) {
 	bucket, _, _ := getBucketAndObject(r)
-
-	// Allow putBucketACL if policy action is set, since this is a dummy call
-	// we are simply re-purposing the bucketPolicyAction.
-	cred, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(r.Context(), r, s3action.PutBucketPolicyAction, bucket, "")
+	log.Infof("PutBucketAclHandler %s", bucket)
+	_, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(r.Context(), r, s3action.PutBucketAclAction, bucket, "")
 	if s3err != apierrors.ErrNone {
 		response.WriteErrorResponse(w, r, s3err)
 		return
 	}
-
-	aclHeader := r.Header.Get(consts.AmzACL)
-	if aclHeader == "" {
-		acl := &response.AccessControlPolicy{}
-		if errc := utils.XmlDecoder(r.Body, acl, r.ContentLength); errc != nil {
-			if errc == io.EOF {
-				response.WriteErrorResponse(w, r, apierrors.ErrMissingSecurityHeader)
-				return
-			}
-			response.WriteErrorResponse(w, r, apierrors.ErrInternalError)
-			return
-		}
-
-		if len(acl.AccessControlList.Grant) == 0 {
-			response.WriteErrorResponse(w, r, apierrors.ErrNotImplemented)
-			return
-		}
-
-		if acl.AccessControlList.Grant[0].Permission != "FULL_CONTROL" {
-			response.WriteErrorResponse(w, r, apierrors.ErrNotImplemented)
-			return
-		}
+	ctx := r.Context()
+	meta, err := s3a.bmSys.GetBucketMeta(ctx, bucket)
+	if err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
+		return
 	}
-
-	if !checkPermissionType(aclHeader) {
-		response.WriteErrorResponse(w, r, apierrors.ErrNotImplemented)
+	canned, grants, s3err := parseACLRequest(r, meta.Owner)
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
 		return
 	}
-	ctx := r.Context()
-	err := s3a.bmSys.UpdateBucketAcl(ctx, bucket, aclHeader, cred.AccessKey)
+	if canned == policy.Default {
+		canned = policy.Private
+	}
+	err = s3a.bmSys.UpdateBucketAcl(ctx, bucket, canned, grants)
 	if err != nil {
 		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
 		return
 	}
+	response.WriteSuccessResponseHeadersOnly(w, r)
 }
 
 // object ACL：包括private（私有）、public-read（公开读）、public-read-write（公开读写）、default（默认），
@@ -138,62 +164,47 @@ func (s3a *s3ApiServer) PutBucketAclHandler(w http.ResponseWriter, r *http.Reque
 // public-read（公开读）:	该ACL表明某个Object是公共读资源，即非Object Owner只有该Object的读权限，而Object Owner拥有该Object的读写权限。
 // public-read-write（公开读写）:该ACL表明某个Object是公共读写资源，即所有用户拥有对该Object的读写权限。
 // default（默认）:该ACL表明某个Object是遵循Bucket读写权限的资源，即Bucket是什么权限，Object就是什么权限。
+// 也可以通过 x-amz-grant-* 请求头或 AccessControlPolicy 请求体授予指定用户或用户组权限。
 
 // PutObjectAclHandler - PUT Object ACL
 // -----------------
 // This operation uses the ACL subresource
-// to set ACL for a bucket, this is a dummy call
-// only responds success if the ACL is private.
+// to set ACL for an object, the ACL is given by a canned ACL,
+// grant headers or an AccessControlPolicy body.
 func (s3a *s3ApiServer) PutObjectAclHandler(w http.ResponseWriter, r *http.Request) {
 	bucket, object, _ := getBucketAndObject(r)
-
-	// Allow putBucketACL if policy action is set, since this is a dummy call
-	// we are simply re-purposing the bucketPolicyAction.
-	_, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(r.Context(), r, s3action.PutBucketPolicyAction, bucket, "")
+	log.Infof("PutObjectAclHandler %s %s", bucket, object)
+	_, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(r.Context(), r, s3action.PutObjectAclAction, bucket, object)
 	if s3err != apierrors.ErrNone {
 		response.WriteErrorResponse(w, r, s3err)
 		return
 	}
-
-	aclHeader := r.Header.Get(consts.AmzACL)
-	if aclHeader == "" {
-		acl := &response.AccessControlPolicy{}
-		if errc := utils.XmlDecoder(r.Body, acl, r.ContentLength); errc != nil {
-			if errc == io.EOF {
-				response.WriteErrorResponse(w, r, apierrors.ErrMissingSecurityHeader)
-				return
-			}
-			response.WriteErrorResponse(w, r, apierrors.ErrInternalError)
-			return
-		}
-
-		if len(acl.AccessControlList.Grant) == 0 {
-			response.WriteErrorResponse(w, r, apierrors.ErrNotImplemented)
-			return
-		}
-
-		if acl.AccessControlList.Grant[0].Permission != "FULL_CONTROL" {
-			response.WriteErrorResponse(w, r, apierrors.ErrNotImplemented)
-			return
-		}
-	}
-
-	if !checkPermissionType(aclHeader) {
-		response.WriteErrorResponse(w, r, apierrors.ErrNotImplemented)
+	ctx := r.Context()
+	meta, err := s3a.bmSys.GetBucketMeta(ctx, bucket)
+	if err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
 		return
 	}
-	ctx := r.Context()
 	objectInfo, err := s3a.store.GetObjectInfo(ctx, bucket, object)
 	if err != nil {
 		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
 		return
 	}
-	objectInfo.Acl = aclHeader
+	objectInfo.Acl, objectInfo.Grants, s3err = parseACLRequest(r, objectInfo.ACL(meta.Owner).Owner)
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+	if !meta.ACLsEnabled() && !objectInfo.ACL(meta.Owner).IsPrivate() {
+		response.WriteErrorResponse(w, r, apierrors.ErrAccessControlListNotSupported)
+		return
+	}
 	err = s3a.store.PutObjectInfo(ctx, objectInfo)
 	if err != nil {
 		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
 		return
 	}
+	response.WriteSuccessResponseHeadersOnly(w, r)
 }
 
 // GetObjectACLHandler - GET Object ACL
@@ -208,7 +219,7 @@ func (s3a *s3ApiServer) GetObjectACLHandler(w http.ResponseWriter, r *http.Reque
 		response.WriteErrorResponseHeadersOnly(w, r, apierrors.ToApiError(ctx, err))
 		return
 	}
-	log.Infof("HeadObjectHandler %s %s", bucket, object)
+	log.Infof("GetObjectACLHandler %s %s", bucket, object)
 	if err := s3utils.CheckGetObjArgs(ctx, bucket, object); err != nil {
 		response.WriteErrorResponseHeadersOnly(w, r, apierrors.ToApiError(ctx, err))
 		return
@@ -216,13 +227,14 @@ func (s3a *s3ApiServer) GetObjectACLHandler(w http.ResponseWriter, r *http.Reque
 
 	// Check for auth type to return S3 compatible error.
 	// type to return the correct error (NoSuchKey vs AccessDenied)
-	cred, _, s3Error := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.GetBucketPolicyAction, bucket, object)
+	_, _, s3Error := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.GetObjectAclAction, bucket, object)
 	if s3Error != apierrors.ErrNone {
 		response.WriteErrorResponseHeadersOnly(w, r, s3Error)
 		return
 	}
-	if !s3a.bmSys.HasBucket(ctx, bucket) {
-		response.WriteErrorResponseHeadersOnly(w, r, apierrors.ErrNoSuchBucket)
+	meta, err := s3a.bmSys.GetBucketMeta(ctx, bucket)
+	if err != nil {
+		response.WriteErrorResponseHeadersOnly(w, r, apierrors.ToApiError(ctx, err))
 		return
 	}
 	objInfo, err := s3a.store.GetObjectInfo(ctx, bucket, object)
@@ -230,21 +242,76 @@ func (s3a *s3ApiServer) GetObjectACLHandler(w http.ResponseWriter, r *http.Reque
 		response.WriteErrorResponseHeadersOnly(w, r, apierrors.ToApiError(ctx, err))
 		return
 	}
-	acl := checkPutObjectACL(objInfo.Acl)
-	resp := response.AccessControlPolicy{}
-	id := cred.AccessKey
-	if resp.Owner.DisplayName == "" {
-		resp.Owner.DisplayName = cred.AccessKey
-		resp.Owner.ID = id
-	}
-	resp.AccessControlList.Grant = append(resp.AccessControlList.Grant, response.Grant{
-		Grantee: response.Grantee{
-			ID:          id,
-			DisplayName: cred.AccessKey,
-			Type:        "CanonicalUser",
-			XMLXSI:      "CanonicalUser",
-			XMLNS:       "http://www.w3.org/2001/XMLSchema-instance"},
-		Permission: response.Permission(acl), //todo change
+	a := objInfo.ACL(meta.Owner)
+	if !meta.ACLsEnabled() {
+		a, _ = acl.Canned(policy.Private, meta.Owner, meta.Owner)
+	}
+	response.WriteSuccessResponseXML(w, r, response.GenerateAccessControlPolicy(a))
+}
+
+// PutBucketOwnershipControlsHandler - PUT Bucket ownership controls
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketOwnershipControls.html
+func (s3a *s3ApiServer) PutBucketOwnershipControlsHandler(w http.ResponseWriter, r *http.Request) {
+	bucket, _, _ := getBucketAndObject(r)
+	log.Infof("PutBucketOwnershipControlsHandler %s", bucket)
+	_, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(r.Context(), r, s3action.PutBucketOwnershipControlsAction, bucket, "")
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+	controls := &response.OwnershipControls{}
+	if err := utils.XmlDecoder(r.Body, controls, r.ContentLength); err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ErrMalformedXML)
+		return
+	}
+	if len(controls.Rules) != 1 || !acl.IsValidOwnership(controls.Rules[0].ObjectOwnership) {
+		response.WriteErrorResponse(w, r, apierrors.ErrMalformedXML)
+		return
+	}
+	ctx := r.Context()
+	if err := s3a.bmSys.UpdateBucketOwnership(ctx, bucket, controls.Rules[0].ObjectOwnership); err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
+		return
+	}
+	response.WriteSuccessResponseHeadersOnly(w, r)
+}
+
+// GetBucketOwnershipControlsHandler - GET Bucket ownership controls
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetBucketOwnershipControls.html
+func (s3a *s3ApiServer) GetBucketOwnershipControlsHandler(w http.ResponseWriter, r *http.Request) {
+	bucket, _, _ := getBucketAndObject(r)
+	log.Infof("GetBucketOwnershipControlsHandler %s", bucket)
+	_, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(r.Context(), r, s3action.GetBucketOwnershipControlsAction, bucket, "")
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+	ctx := r.Context()
+	ownership, err := s3a.bmSys.GetBucketOwnership(ctx, bucket)
+	if err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
+		return
+	}
+	response.WriteSuccessResponseXML(w, r, response.OwnershipControls{
+		XMLNS: "http://s3.amazonaws.com/doc/2006-03-01/",
+		Rules: []response.OwnershipControlsRule{{ObjectOwnership: ownership}},
 	})
-	response.WriteSuccessResponseXML(w, r, resp)
+}
+
+// DeleteBucketOwnershipControlsHandler - DELETE Bucket ownership controls
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_DeleteBucketOwnershipControls.html
+func (s3a *s3ApiServer) DeleteBucketOwnershipControlsHandler(w http.ResponseWriter, r *http.Request) {
+	bucket, _, _ := getBucketAndObject(r)
+	log.Infof("DeleteBucketOwnershipControlsHandler %s", bucket)
+	_, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(r.Context(), r, s3action.PutBucketOwnershipControlsAction, bucket, "")
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+	ctx := r.Context()
+	if err := s3a.bmSys.UpdateBucketOwnership(ctx, bucket, ""); err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
+		return
+	}
+	response.WriteSuccessNoContent(w)
 }
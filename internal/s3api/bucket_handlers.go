@@ -7,6 +7,8 @@ import (
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/yann-y/fds/internal/apierrors"
 	"github.com/yann-y/fds/internal/consts"
+	"github.com/yann-y/fds/internal/cors"
+	"github.com/yann-y/fds/internal/iam/acl"
 	"github.com/yann-y/fds/internal/iam/policy"
 	"github.com/yann-y/fds/internal/iam/s3action"
 	"github.com/yann-y/fds/internal/response"
@@ -16,10 +18,14 @@ import (
 	"io"
 	"net/http"
 	"path"
+	"strconv"
 )
 
 var log = logging.Logger("server")
 
+// maxCorsConfigSize - the maximum size of a CORS configuration.
+const maxCorsConfigSize = 64 << 10
+
 // ListBucketsHandler ListBuckets Handler
 // https://docs.aws.amazon.com/AmazonS3/latest/API/API_ListBuckets.html
 func (s3a *s3ApiServer) ListBucketsHandler(w http.ResponseWriter, r *http.Request) {
@@ -104,15 +110,31 @@ func (s3a *s3ApiServer) PutBucketHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	aclHeader := r.Header.Get(consts.AmzACL)
-	if !checkPermissionType(aclHeader) {
+	hasGrants := acl.HasGrantHeaders(r.Header)
+	if aclHeader != "" && hasGrants {
+		response.WriteErrorResponse(w, r, apierrors.ErrInvalidRequest)
+		return
+	}
+	grants, err := acl.ParseGrantHeaders(r.Header)
+	if err != nil {
+		response.WriteErrorResponse(w, r, grantErrorCode(err))
+		return
+	}
+	if !acl.IsValidCanned(aclHeader) || aclHeader == policy.Default {
 		aclHeader = policy.Private
 	}
-	err := s3a.bmSys.CreateBucket(ctx, bucket, region, cred.AccessKey, aclHeader)
+	err = s3a.bmSys.CreateBucket(ctx, bucket, region, cred.AccessKey, aclHeader)
 	if err != nil {
 		log.Errorf("PutBucketHandler create bucket error:%v", s3err)
 		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
 		return
 	}
+	if hasGrants {
+		if err = s3a.bmSys.UpdateBucketAcl(ctx, bucket, "", grants); err != nil {
+			response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
+			return
+		}
+	}
 
 	// Make sure to add Location information here only for bucket
 	if cp := pathClean(r.URL.Path); cp != "" {
@@ -153,6 +175,10 @@ func (s3a *s3ApiServer) DeleteBucketHandler(w http.ResponseWriter, r *http.Reque
 	bucket, _, _ := getBucketAndObject(r)
 	ctx := r.Context()
 	log.Infof("DeleteBucketHandler %s", bucket)
+	if force, _ := strconv.ParseBool(r.Header.Get(consts.ForceDelete)); force {
+		s3a.forceDeleteBucket(w, r, bucket)
+		return
+	}
 	_, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.DeleteBucketAction, bucket, "")
 	if s3err != apierrors.ErrNone {
 		response.WriteErrorResponse(w, r, s3err)
@@ -167,22 +193,92 @@ func (s3a *s3ApiServer) DeleteBucketHandler(w http.ResponseWriter, r *http.Reque
 	response.WriteSuccessNoContent(w)
 }
 
+// forceDeleteBucket starts the deletion of the bucket along with its objects,
+// whose progress is reported by the admin API.
+func (s3a *s3ApiServer) forceDeleteBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	ctx := r.Context()
+	_, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.ForceDeleteBucketAction, bucket, "")
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+	if s3a.purger == nil {
+		response.WriteErrorResponse(w, r, apierrors.ErrNotImplemented)
+		return
+	}
+	if _, err := s3a.purger.Start(ctx, bucket); err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
+		return
+	}
+	response.WriteAccepted(w)
+}
+
 // GetBucketCorsHandler Get bucket CORS
 // https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetBucketCors.html
 func (s3a *s3ApiServer) GetBucketCorsHandler(w http.ResponseWriter, r *http.Request) {
-	response.WriteErrorResponse(w, r, apierrors.ErrNoSuchCORSConfiguration)
+	bucket, _, _ := getBucketAndObject(r)
+	ctx := r.Context()
+	log.Infof("GetBucketCorsHandler %s", bucket)
+	_, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.GetBucketCorsAction, bucket, "")
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+
+	config, err := s3a.bmSys.GetCorsConfig(ctx, bucket)
+	if err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
+		return
+	}
+	response.WriteSuccessResponseXML(w, r, config)
 }
 
 // PutBucketCorsHandler Put bucket CORS
 // https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketCors.html
 func (s3a *s3ApiServer) PutBucketCorsHandler(w http.ResponseWriter, r *http.Request) {
-	response.WriteErrorResponse(w, r, apierrors.ErrNotImplemented)
+	bucket, _, _ := getBucketAndObject(r)
+	ctx := r.Context()
+	log.Infof("PutBucketCorsHandler %s", bucket)
+	_, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.PutBucketCorsAction, bucket, "")
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+
+	config, err := cors.ParseConfig(io.LimitReader(r.Body, maxCorsConfigSize))
+	if err != nil {
+		log.Errorf("PutBucketCorsHandler ParseConfig err:%v", err)
+		response.WriteErrorResponse(w, r, apierrors.ErrMalformedXML)
+		return
+	}
+	config.XMLNS = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+	if err = s3a.bmSys.UpdateBucketCors(ctx, bucket, config); err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
+		return
+	}
+
+	// Write success response.
+	response.WriteSuccessResponseHeadersOnly(w, r)
 }
 
 // DeleteBucketCorsHandler Delete bucket CORS
 // https://docs.aws.amazon.com/AmazonS3/latest/API/API_DeleteBucketCors.html
 func (s3a *s3ApiServer) DeleteBucketCorsHandler(w http.ResponseWriter, r *http.Request) {
-	response.WriteErrorResponse(w, r, http.StatusNoContent)
+	bucket, _, _ := getBucketAndObject(r)
+	ctx := r.Context()
+	log.Infof("DeleteBucketCorsHandler %s", bucket)
+	_, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.PutBucketCorsAction, bucket, "")
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+
+	if err := s3a.bmSys.DeleteBucketCors(ctx, bucket); err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
+		return
+	}
+	response.WriteSuccessNoContent(w)
 }
 
 // PutBucketTaggingHandler
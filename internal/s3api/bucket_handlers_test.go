@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/gorilla/mux"
 	dagpool "github.com/yann-y/fds/dag/pool/ipfs"
+	"github.com/yann-y/fds/internal/event"
 	"github.com/yann-y/fds/internal/iam"
 	"github.com/yann-y/fds/internal/iam/auth"
 	"github.com/yann-y/fds/internal/iam/policy"
@@ -43,24 +44,11 @@ func TestMain(m *testing.M) {
 	storageSys.SetNewBucketNSLock(bmSys.NewNSLock)
 	storageSys.SetHasBucket(bmSys.HasBucket)
 	bmSys.SetEmptyBucket(storageSys.EmptyBucket)
-	cleanData := func(accessKey string) {
-		ctx := context.Background()
-		bkts, err := bmSys.GetAllBucketsOfUser(ctx, accessKey)
-		if err != nil {
-			log.Errorf("GetAllBucketsOfUser error: %v", err)
-		}
-		for _, bkt := range bkts {
-			if err = storageSys.CleanObjectsInBucket(ctx, bkt.Name); err != nil {
-				log.Errorf("CleanObjectsInBucket error: %v", err)
-				continue
-			}
-			if err = bmSys.DeleteBucket(ctx, bkt.Name); err != nil {
-				log.Errorf("DeleteBucket error: %v", err)
-			}
-		}
-	}
-	iamapi.NewIamApiServer(router, authSys, cleanData)
-	NewS3Server(router, authSys, bmSys, storageSys)
+	bmSys.SetCleanBucket(storageSys.CleanBucket)
+	purger := store.NewBucketPurger(context.TODO(), storageSys, bmSys, store.DefaultPurgeWorkers)
+	quotaSys := store.NewQuotaSys(storageSys, bmSys)
+	iamapi.NewIamApiServer(router, authSys, purger, quotaSys)
+	NewS3Server(router, authSys, bmSys, storageSys, nil, nil, event.NewBus(), nil, purger, quotaSys)
 	os.Exit(m.Run())
 }
 func reqTest(r *http.Request) *httptest.ResponseRecorder {
@@ -161,6 +149,43 @@ func TestS3ApiServer_HeadBucketHandler(t *testing.T) {
 	}
 
 }
+func TestBucketFromRequest(t *testing.T) {
+	domains := []string{"s3.example.com"}
+	testCases := []struct {
+		method   string
+		url      string
+		expected string
+	}{
+		// Test case - 1.
+		{method: http.MethodGet, url: "http://127.0.0.1:9000/bucket/a.txt", expected: "bucket"},
+		// Test case - 2.
+		{method: http.MethodGet, url: "http://bucket.s3.example.com/a.txt", expected: "bucket"},
+		// Test case - 3.
+		// a bucket named as a route with objects of its own.
+		{method: http.MethodGet, url: "http://127.0.0.1:9000/metrics/a.txt", expected: "metrics"},
+		// Test case - 4.
+		// the routes served alongside the S3 API name no bucket.
+		{method: http.MethodGet, url: "http://127.0.0.1:9000/metrics", expected: ""},
+		// Test case - 5.
+		{method: http.MethodGet, url: "http://127.0.0.1:9000/status", expected: ""},
+		// Test case - 6.
+		{method: http.MethodPost, url: "http://127.0.0.1:9000/admin/v1/add-user", expected: ""},
+		// Test case - 7.
+		{method: http.MethodPost, url: "http://127.0.0.1:9000/cluster/v1/lock/lock", expected: ""},
+		// Test case - 8.
+		{method: http.MethodGet, url: "http://bucket.s3.example.com/metrics", expected: ""},
+		// Test case - 9.
+		// STS is served on the root.
+		{method: http.MethodPost, url: "http://127.0.0.1:9000/", expected: ""},
+	}
+	for i, testCase := range testCases {
+		r := httptest.NewRequest(testCase.method, testCase.url, nil)
+		if bucket := bucketFromRequest(r, domains); bucket != testCase.expected {
+			t.Errorf("Test %d: Expected the bucket %q, but instead found %q", i+1, testCase.expected, bucket)
+		}
+	}
+}
+
 func TestS3ApiServer_ListBucketHandler(t *testing.T) {
 	bucketName := "/testbucketlist"
 	// test cases with inputs and expected result for Bucket.
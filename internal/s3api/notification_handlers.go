@@ -0,0 +1,224 @@
+package s3api
+
+import (
+	"encoding/json"
+	"github.com/yann-y/fds/internal/apierrors"
+	"github.com/yann-y/fds/internal/consts"
+	"github.com/yann-y/fds/internal/event"
+	"github.com/yann-y/fds/internal/iam/s3action"
+	"github.com/yann-y/fds/internal/response"
+	"github.com/yann-y/fds/internal/store"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxNotificationConfigSize - the maximum size of a notification configuration.
+	maxNotificationConfigSize = 1 << 20
+
+	// query parameters of ListenBucketNotification
+	listenEvents = "events"
+	listenPrefix = "prefix"
+	listenSuffix = "suffix"
+	listenPing   = "ping"
+
+	defaultListenPing = 10 * time.Second
+	// listenBufferSize - the events buffered for a slow listener before
+	// its events are dropped.
+	listenBufferSize = 1000
+)
+
+// PutBucketNotificationHandler Put bucket notification
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketNotificationConfiguration.html
+func (s3a *s3ApiServer) PutBucketNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	bucket, _, _ := getBucketAndObject(r)
+	ctx := r.Context()
+	log.Infof("PutBucketNotificationHandler %s", bucket)
+	_, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.PutBucketNotificationAction, bucket, "")
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+
+	meta, err := s3a.bmSys.GetBucketMeta(ctx, bucket)
+	if err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
+		return
+	}
+	config, err := event.ParseConfig(io.LimitReader(r.Body, maxNotificationConfigSize), meta.Region, s3a.notificationSys.HasTarget)
+	if err != nil {
+		log.Errorf("PutBucketNotificationHandler ParseConfig err:%v", err)
+		s3err = apierrors.ToApiError(ctx, err)
+		if s3err == apierrors.ErrInternalError {
+			// not a validation error, the body is no configuration
+			s3err = apierrors.ErrMalformedXML
+		}
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+	config.XMLNS = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+	if err = s3a.bmSys.UpdateBucketNotification(ctx, bucket, config); err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
+		return
+	}
+
+	// Write success response.
+	response.WriteSuccessResponseHeadersOnly(w, r)
+}
+
+// GetBucketNotificationHandler Get bucket notification
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetBucketNotificationConfiguration.html
+func (s3a *s3ApiServer) GetBucketNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	bucket, _, _ := getBucketAndObject(r)
+	ctx := r.Context()
+	log.Infof("GetBucketNotificationHandler %s", bucket)
+	_, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.GetBucketNotificationAction, bucket, "")
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+
+	config, err := s3a.bmSys.GetNotificationConfig(ctx, bucket)
+	if err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
+		return
+	}
+	config.XMLNS = "http://s3.amazonaws.com/doc/2006-03-01/"
+	response.WriteSuccessResponseXML(w, r, config)
+}
+
+// sendEvent publishes the event of an object operation on the event bus and
+// queues it for the notification targets of its bucket, it is called once
+// the response is written so that the request id is known.
+func (s3a *s3ApiServer) sendEvent(w http.ResponseWriter, r *http.Request, name event.Name, objInfo store.ObjectInfo, accessKey string) {
+	if s3a.notificationSys == nil && !s3a.eventBus.HasSubscribers() {
+		return
+	}
+	meta, err := s3a.bmSys.GetBucketMeta(r.Context(), objInfo.Bucket)
+	if err != nil {
+		return
+	}
+	sourceIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		sourceIP = r.RemoteAddr
+	}
+	args := event.Args{
+		EventName:   name,
+		BucketName:  objInfo.Bucket,
+		BucketOwner: meta.Owner,
+		Region:      meta.Region,
+		Object: event.Object{
+			Key:         objInfo.Name,
+			Size:        objInfo.Size,
+			ETag:        objInfo.ETag,
+			ContentType: objInfo.ContentType,
+			VersionID:   objInfo.VersionID,
+		},
+		AccessKey: accessKey,
+		SourceIP:  sourceIP,
+		RequestID: w.Header().Get(consts.AmzRequestID),
+	}
+	s3a.eventBus.Publish(args)
+	s3a.notificationSys.Send(meta.NotificationConfig, args)
+}
+
+// ListenBucketNotificationHandler streams the events of the objects of a
+// bucket as JSON lines until the client disconnects, keeping the connection
+// alive with a space every ping seconds.
+// GET /{bucket}?events=s3:ObjectCreated:*&prefix=&suffix=&ping=10
+func (s3a *s3ApiServer) ListenBucketNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	bucket, _, _ := getBucketAndObject(r)
+	ctx := r.Context()
+	log.Infof("ListenBucketNotificationHandler %s", bucket)
+	_, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.ListenBucketNotificationAction, bucket, "")
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+	if s3a.eventBus == nil {
+		response.WriteErrorResponse(w, r, apierrors.ErrNotImplemented)
+		return
+	}
+	if !s3a.bmSys.HasBucket(ctx, bucket) {
+		response.WriteErrorResponse(w, r, apierrors.ErrNoSuchBucket)
+		return
+	}
+
+	values := r.URL.Query()
+	var names []event.Name
+	for _, s := range values[listenEvents] {
+		for _, n := range strings.Split(s, ",") {
+			name := event.Name(n)
+			if !name.IsValid() {
+				response.WriteErrorResponse(w, r, apierrors.ErrEventNotification)
+				return
+			}
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		names = []event.Name{event.ObjectCreatedAll, event.ObjectRemovedAll}
+	}
+	prefix, suffix := values.Get(listenPrefix), values.Get(listenSuffix)
+	ping := defaultListenPing
+	if s := values.Get(listenPing); s != "" {
+		seconds, err := strconv.Atoi(s)
+		if err != nil || seconds <= 0 {
+			response.WriteErrorResponse(w, r, apierrors.ErrInvalidQueryParams)
+			return
+		}
+		ping = time.Duration(seconds) * time.Second
+	}
+
+	events := s3a.eventBus.Subscribe(ctx, listenBufferSize, func(args event.Args) bool {
+		if args.BucketName != bucket || !strings.HasPrefix(args.Object.Key, prefix) || !strings.HasSuffix(args.Object.Key, suffix) {
+			return false
+		}
+		for _, name := range names {
+			if name.Matches(args.EventName) {
+				return true
+			}
+		}
+		return false
+	})
+
+	w.Header().Set(consts.ContentType, "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	flush()
+	enc := json.NewEncoder(w)
+	keepAlive := time.NewTicker(ping)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case args, ok := <-events:
+			if !ok {
+				return
+			}
+			eventLog := event.Log{
+				EventName: args.EventName,
+				Key:       args.BucketName + "/" + args.Object.Key,
+				Records:   []event.Event{args.ToEvent("", time.Now())},
+			}
+			if err := enc.Encode(eventLog); err != nil {
+				return
+			}
+			flush()
+		case <-keepAlive.C:
+			if _, err := w.Write([]byte(" ")); err != nil {
+				return
+			}
+			flush()
+		}
+	}
+}
@@ -2,13 +2,14 @@ package s3api
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"github.com/gorilla/mux"
 	"github.com/yann-y/fds/internal/apierrors"
 	"github.com/yann-y/fds/internal/consts"
 	"github.com/yann-y/fds/internal/datatypes"
+	"github.com/yann-y/fds/internal/event"
 	"github.com/yann-y/fds/internal/iam"
-	"github.com/yann-y/fds/internal/iam/policy"
 	"github.com/yann-y/fds/internal/iam/s3action"
 	"github.com/yann-y/fds/internal/response"
 	"github.com/yann-y/fds/internal/store"
@@ -25,6 +26,10 @@ import (
 	"strings"
 )
 
+// multiDeleteWorkers - the number of objects of a multi-object delete deleted
+// at once.
+const multiDeleteWorkers = 16
+
 // PutObjectHandler Put ObjectHandler
 // https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutObject.html
 func (s3a *s3ApiServer) PutObjectHandler(w http.ResponseWriter, r *http.Request) {
@@ -142,11 +147,23 @@ func (s3a *s3ApiServer) PutObjectHandler(w http.ResponseWriter, r *http.Request)
 		response.WriteErrorResponse(w, r, apierrors.ErrInvalidRequest)
 		return
 	}
-	aclHeader := r.Header.Get(consts.AmzACL)
-	if !checkPermissionType(aclHeader) {
-		aclHeader = policy.Default
+	cred, _, s3err := s3a.authSys.GetCredential(r)
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+	if s3err = s3a.setObjectACLMetadata(ctx, r.Header, bucket, cred.AccessKey, metadata); s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+	if s3err = s3a.setReplicaMetadata(r, bucket, object, metadata); s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+	if s3err = s3a.checkQuota(ctx, bucket, size); s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
 	}
-	metadata[consts.AmzACL] = aclHeader
 	objInfo, err := s3a.store.StoreObject(ctx, bucket, object, hashReader, size, metadata)
 	if err != nil {
 		log.Errorf("PutObjectHandler StoreObject err:%v", err)
@@ -156,6 +173,8 @@ func (s3a *s3ApiServer) PutObjectHandler(w http.ResponseWriter, r *http.Request)
 
 	setPutObjHeaders(w, objInfo, false)
 	response.WriteSuccessResponseHeadersOnly(w, r)
+	s3a.sendEvent(w, r, event.ObjectCreatedPut, objInfo, cred.AccessKey)
+	s3a.queueReplication(r, objInfo, false)
 }
 
 // GetObjectHandler - GET Object
@@ -268,7 +287,12 @@ func (s3a *s3ApiServer) DeleteObjectHandler(w http.ResponseWriter, r *http.Reque
 
 	// Check for auth type to return S3 compatible error.
 	// type to return the correct error (NoSuchKey vs AccessDenied)
-	_, _, s3Error := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.DeleteObjectAction, bucket, object)
+	cred, _, s3Error := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.DeleteObjectAction, bucket, object)
+	if s3Error != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3Error)
+		return
+	}
+	replica, s3Error := s3a.isReplicaRequest(r, s3action.ReplicateDeleteAction, bucket, object)
 	if s3Error != apierrors.ErrNone {
 		response.WriteErrorResponse(w, r, s3Error)
 		return
@@ -290,6 +314,10 @@ func (s3a *s3ApiServer) DeleteObjectHandler(w http.ResponseWriter, r *http.Reque
 	}
 	setPutObjHeaders(w, objInfo, true)
 	response.WriteSuccessNoContent(w)
+	s3a.sendEvent(w, r, event.ObjectRemovedDelete, objInfo, cred.AccessKey)
+	if !replica {
+		s3a.queueReplication(r, objInfo, true)
+	}
 }
 
 // DeleteMultipleObjectsHandler - Delete multiple objects
@@ -321,14 +349,19 @@ func (s3a *s3ApiServer) DeleteMultipleObjectsHandler(w http.ResponseWriter, r *h
 		return
 	}
 
-	objects := make([]datatypes.ObjectV, len(deleteObjectsReq.Objects))
 	// Convert object name delete objects if it has `/` in the beginning.
 	for i := range deleteObjectsReq.Objects {
 		deleteObjectsReq.Objects[i].ObjectName = trimLeadingSlash(deleteObjectsReq.Objects[i].ObjectName)
-		objects[i] = deleteObjectsReq.Objects[i].ObjectV
 	}
 
-	_, _, s3Error := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.DeleteObjectAction, bucket, "")
+	// The signature is verified once, the access to each object is checked
+	// with the credentials it authenticated.
+	cred, owner, s3Error := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.DeleteObjectAction, bucket, "")
+	if s3Error != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3Error)
+		return
+	}
+	replica, s3Error := s3a.isReplicaRequest(r, s3action.ReplicateDeleteAction, bucket, "")
 	if s3Error != apierrors.ErrNone {
 		response.WriteErrorResponse(w, r, s3Error)
 		return
@@ -346,104 +379,61 @@ func (s3a *s3ApiServer) DeleteMultipleObjectsHandler(w http.ResponseWriter, r *h
 		return
 	}
 
-	objectsToDelete := map[datatypes.ObjectToDelete]int{}
-
-	type deleteResult struct {
-		delInfo datatypes.DeletedObject
-		errInfo response.DeleteError
-	}
-
-	deleteResults := make([]deleteResult, len(deleteObjectsReq.Objects))
-
-	for index, object := range deleteObjectsReq.Objects {
-		_, _, s3Error = s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.DeleteObjectAction, bucket, object.ObjectName)
-		if s3Error != apierrors.ErrNone {
-			if s3Error == apierrors.ErrSignatureDoesNotMatch || s3Error == apierrors.ErrInvalidAccessKeyID {
-				response.WriteErrorResponse(w, r, s3Error)
-				return
-			}
-			apiErr := apierrors.GetAPIError(s3Error)
-			deleteResults[index].errInfo = response.DeleteError{
-				Code:      apiErr.Code,
-				Message:   apiErr.Description,
-				Key:       object.ObjectName,
-				VersionID: object.VersionID,
-			}
-			continue
-		}
-
-		// Avoid duplicate objects, we use map to filter them out.
-		if _, ok := objectsToDelete[object]; !ok {
-			objectsToDelete[object] = index
-		}
-	}
-
-	toNames := func(input map[datatypes.ObjectToDelete]int) (output []datatypes.ObjectToDelete) {
-		output = make([]datatypes.ObjectToDelete, len(input))
-		idx := 0
-		for obj := range input {
-			output[idx] = obj
-			idx++
+	// Avoid duplicate objects, we use map to filter them out.
+	seen := make(map[datatypes.ObjectToDelete]bool, len(deleteObjectsReq.Objects))
+	deleteList := make([]datatypes.ObjectToDelete, 0, len(deleteObjectsReq.Objects))
+	for _, object := range deleteObjectsReq.Objects {
+		if !seen[object] {
+			seen[object] = true
+			deleteList = append(deleteList, object)
 		}
-		return
 	}
 
 	// Disable timeouts and cancellation
 	ctx = utils.BgContext(ctx)
 
-	deleteList := toNames(objectsToDelete)
-	dObjects := make([]datatypes.DeletedObject, len(deleteList))
-	errs := make([]error, len(deleteList))
-	for i, obj := range deleteList {
-		if errs[i] = s3utils.CheckDelObjArgs(ctx, bucket, obj.ObjectName); errs[i] != nil {
-			continue
+	// The results are streamed in the order the objects are deleted.
+	mw := response.NewMultiDeleteWriter(w, r, deleteObjectsReq.Quiet)
+	errCodes := make([]apierrors.ErrorCode, len(deleteList))
+	utils.Parallel(len(deleteList), multiDeleteWorkers, func(i int) error {
+		obj := deleteList[i]
+		if errCodes[i] = s3a.authSys.CheckCredentialAccess(ctx, r, cred, owner, s3action.DeleteObjectAction, bucket, obj.ObjectName); errCodes[i] != apierrors.ErrNone {
+			return nil
 		}
-		errs[i] = s3a.store.DeleteObject(ctx, bucket, obj.ObjectName)
-		if errs[i] == nil || xerrors.Is(errs[i], store.ErrObjectNotFound) {
-			dObjects[i] = datatypes.DeletedObject{
-				ObjectName: obj.ObjectName,
-			}
-			errs[i] = nil
+		if err := s3utils.CheckDelObjArgs(ctx, bucket, obj.ObjectName); err != nil {
+			return err
 		}
-	}
-
-	for i := range errs {
-		objToDel := datatypes.ObjectToDelete{
-			ObjectV: datatypes.ObjectV{
-				ObjectName: dObjects[i].ObjectName,
-				VersionID:  dObjects[i].VersionID,
-			},
+		err := s3a.store.DeleteObject(ctx, bucket, obj.ObjectName)
+		if xerrors.Is(err, store.ErrObjectNotFound) {
+			return nil
 		}
-		dindex := objectsToDelete[objToDel]
-		if errs[i] == nil {
-			deleteResults[dindex].delInfo = dObjects[i]
-			continue
+		return err
+	}, func(i int, err error) {
+		obj := deleteList[i]
+		if err != nil {
+			errCodes[i] = apierrors.ToApiError(ctx, err)
 		}
-		apiErrCode := apierrors.ToApiError(ctx, errs[i])
-		apiErr := apierrors.GetAPIError(apiErrCode)
-		deleteResults[dindex].errInfo = response.DeleteError{
-			Code:      apiErr.Code,
-			Message:   apiErr.Description,
-			Key:       deleteList[i].ObjectName,
-			VersionID: deleteList[i].VersionID,
+		if errCodes[i] != apierrors.ErrNone {
+			apiErr := apierrors.GetAPIError(errCodes[i])
+			mw.Error(response.DeleteError{
+				Code:      apiErr.Code,
+				Message:   apiErr.Description,
+				Key:       obj.ObjectName,
+				VersionID: obj.VersionID,
+			})
+			return
 		}
-	}
+		mw.Deleted(datatypes.DeletedObject{ObjectName: obj.ObjectName, VersionID: obj.VersionID})
 
-	// Generate response
-	deleteErrors := make([]response.DeleteError, 0, len(deleteObjectsReq.Objects))
-	deletedObjects := make([]datatypes.DeletedObject, 0, len(deleteObjectsReq.Objects))
-	for _, deleteResult := range deleteResults {
-		if deleteResult.errInfo.Code != "" {
-			deleteErrors = append(deleteErrors, deleteResult.errInfo)
-		} else {
-			deletedObjects = append(deletedObjects, deleteResult.delInfo)
+		objInfo := store.ObjectInfo{Bucket: bucket, Name: obj.ObjectName}
+		s3a.sendEvent(w, r, event.ObjectRemovedDelete, objInfo, cred.AccessKey)
+		if !replica {
+			s3a.queueReplication(r, objInfo, true)
 		}
+	})
+	if err := mw.Close(); err != nil {
+		log.Errorf("DeleteMultipleObjectsHandler write response err:%v", err)
 	}
-
-	resp := response.GenerateMultiDeleteResponse(deleteObjectsReq.Quiet, dObjects, deleteErrors)
-
-	// Write success response.
-	response.WriteSuccessResponseXML(w, r, resp)
 }
 
 // CopyObjectHandler - Copy Object
@@ -467,7 +457,7 @@ func (s3a *s3ApiServer) CopyObjectHandler(w http.ResponseWriter, r *http.Request
 		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
 		return
 	}
-	_, _, s3Error := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.PutObjectAction, dstBucket, dstObject)
+	cred, _, s3Error := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.PutObjectAction, dstBucket, dstObject)
 	if s3Error != apierrors.ErrNone {
 		response.WriteErrorResponse(w, r, s3Error)
 		return
@@ -527,12 +517,18 @@ func (s3a *s3ApiServer) CopyObjectHandler(w http.ResponseWriter, r *http.Request
 			metadata[key] = val
 		}
 	}
+	// a copy is a new object rather than a replica
+	delete(metadata, strings.ToLower(consts.AmzBucketReplicationStatus))
 	//hashReader, err := hash.NewReader(srcReader, srcObjInfo.Size, "", "", srcObjInfo.Size)
 	//if err != nil {
 	//	log.Errorf("PutObjectHandler NewReader err:%v", err)
 	//	response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
 	//	return
 	//}
+	if s3err := s3a.checkQuota(ctx, dstBucket, srcObjInfo.Size); s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
 	obj, err := s3a.store.CopyObject(ctx, dstBucket, dstObject, srcObjInfo, srcObjInfo.Size, metadata)
 	if err != nil {
 		log.Errorf("PutObjectHandler StoreObject err:%v", err)
@@ -548,6 +544,8 @@ func (s3a *s3ApiServer) CopyObjectHandler(w http.ResponseWriter, r *http.Request
 	setPutObjHeaders(w, obj, false)
 
 	response.WriteSuccessResponseXML(w, r, resp)
+	s3a.sendEvent(w, r, event.ObjectCreatedCopy, obj, cred.AccessKey)
+	s3a.queueReplication(r, obj, false)
 }
 
 func (s3a *s3ApiServer) ListObjectsV1Handler(w http.ResponseWriter, r *http.Request) {
@@ -816,3 +814,16 @@ func mimeDetect(r *http.Request, dataReader io.Reader) io.ReadCloser {
 	}
 	return io.NopCloser(dataReader)
 }
+
+// checkQuota checks that writing size bytes to the bucket keeps it and its
+// owner within their quotas, when the quotas are enforced.
+func (s3a *s3ApiServer) checkQuota(ctx context.Context, bucket string, size int64) apierrors.ErrorCode {
+	if s3a.quotaSys == nil {
+		return apierrors.ErrNone
+	}
+	if err := s3a.quotaSys.CheckQuota(ctx, bucket, size); err != nil {
+		log.Errorf("checkQuota bucket %s err:%v", bucket, err)
+		return apierrors.ToApiError(ctx, err)
+	}
+	return apierrors.ErrNone
+}
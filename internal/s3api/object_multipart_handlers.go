@@ -4,6 +4,7 @@ import (
 	"github.com/yann-y/fds/internal/apierrors"
 	"github.com/yann-y/fds/internal/consts"
 	"github.com/yann-y/fds/internal/datatypes"
+	"github.com/yann-y/fds/internal/event"
 	"github.com/yann-y/fds/internal/iam"
 	"github.com/yann-y/fds/internal/iam/s3action"
 	"github.com/yann-y/fds/internal/response"
@@ -52,6 +53,10 @@ func (s3a *s3ApiServer) NewMultipartUploadHandler(w http.ResponseWriter, r *http
 		response.WriteErrorResponse(w, r, apierrors.ErrInvalidRequest)
 		return
 	}
+	if s3err = s3a.setReplicaMetadata(r, bucket, object, metadata); s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
 
 	info, err := s3a.store.NewMultipartUpload(ctx, bucket, object, metadata)
 	if err != nil {
@@ -180,6 +185,11 @@ func (s3a *s3ApiServer) PutObjectPartHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if s3err = s3a.checkQuota(ctx, bucket, size); s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+
 	hashReader, err := hash.NewReader(reader, size, md5hex, sha256hex, size)
 	if err != nil {
 		log.Errorf("PutObjectHandler NewReader err:%v", err)
@@ -220,7 +230,7 @@ func (s3a *s3ApiServer) CompleteMultipartUploadHandler(w http.ResponseWriter, r
 		return
 	}
 
-	_, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.PutObjectAction, bucket, object)
+	cred, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.PutObjectAction, bucket, object)
 	if s3err != apierrors.ErrNone {
 		response.WriteErrorResponse(w, r, s3err)
 		return
@@ -278,6 +288,8 @@ func (s3a *s3ApiServer) CompleteMultipartUploadHandler(w http.ResponseWriter, r
 	resp := response.GenerateCompleteMultpartUploadResponse(bucket, object, bucketMetas.Region, objInfo)
 	setPutObjHeaders(w, objInfo, false)
 	response.WriteSuccessResponseXML(w, r, resp)
+	s3a.sendEvent(w, r, event.ObjectCreatedCompleteMultipartUpload, objInfo, cred.AccessKey)
+	s3a.queueReplication(r, objInfo, false)
 }
 
 // AbortMultipartUploadHandler - Aborts multipart upload.
@@ -0,0 +1,244 @@
+package s3api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// startWithConds - map which indicates if a given condition supports starts-with policy operator
+var startsWithConds = map[string]bool{
+	"$acl":                     true,
+	"$bucket":                  false,
+	"$cache-control":           true,
+	"$content-type":            true,
+	"$content-disposition":     true,
+	"$content-encoding":        true,
+	"$expires":                 true,
+	"$key":                     true,
+	"$success_action_redirect": true,
+	"$redirect":                true,
+	"$success_action_status":   false,
+	"$x-amz-algorithm":         false,
+	"$x-amz-credential":        false,
+	"$x-amz-date":              false,
+}
+
+// Add policy conditionals.
+const (
+	policyCondEqual         = "eq"
+	policyCondStartsWith    = "starts-with"
+	policyCondContentLength = "content-length-range"
+)
+
+// ignoredFormKeys are the form fields that don't need to appear in the policy
+// conditions, fields with the x-ignore- prefix are ignored too.
+var ignoredFormKeys = map[string]bool{
+	"policy":          true,
+	"x-amz-signature": true,
+	"signature":       true,
+	"awsaccesskeyid":  true,
+	"file":            true,
+	"bucket":          true,
+}
+
+// contentLengthRange - policy content-length-range field.
+type contentLengthRange struct {
+	Min   int64
+	Max   int64
+	Valid bool // If content-length-range was part of policy
+}
+
+// postPolicyCondition - a condition of a POST policy.
+type postPolicyCondition struct {
+	Operator string
+	Key      string
+	Value    string
+}
+
+// postPolicyForm provides strict static type conversion and validation for Amazon S3's POST policy JSON string.
+type postPolicyForm struct {
+	Expiration time.Time // Expiration date and time of the POST policy.
+	Conditions struct {  // Conditional policy structure.
+		Policies           []postPolicyCondition
+		ContentLengthRange contentLengthRange
+	}
+}
+
+// toString converts a policy value to string, numbers are kept as is.
+func toString(val interface{}) (string, bool) {
+	switch v := val.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	}
+	return "", false
+}
+
+// toInteger converts a policy value to int64.
+func toInteger(val interface{}) (int64, error) {
+	switch v := val.(type) {
+	case json.Number:
+		return v.Int64()
+	case string:
+		return json.Number(v).Int64()
+	}
+	return 0, errors.New("invalid number format")
+}
+
+// isNonNegative returns whether i is non-negative.
+func isNonNegative(i int64) bool {
+	return i >= 0
+}
+
+// parsePostPolicyForm - Parse JSON policy string into typed postPolicyForm structure.
+func parsePostPolicyForm(r io.Reader) (postPolicyForm, error) {
+	// Convert po into interfaces and
+	// perform strict type conversion using reflection.
+	var rawPolicy struct {
+		Expiration string        `json:"expiration"`
+		Conditions []interface{} `json:"conditions"`
+	}
+	d := json.NewDecoder(r)
+	d.UseNumber()
+	if err := d.Decode(&rawPolicy); err != nil {
+		return postPolicyForm{}, err
+	}
+
+	parsedPolicy := postPolicyForm{}
+
+	// Parse expiry time.
+	var err error
+	parsedPolicy.Expiration, err = time.Parse(time.RFC3339Nano, rawPolicy.Expiration)
+	if err != nil {
+		return postPolicyForm{}, err
+	}
+
+	// Parse conditions.
+	for _, val := range rawPolicy.Conditions {
+		switch condt := val.(type) {
+		case map[string]interface{}: // Handle key:value map types.
+			for k, v := range condt {
+				value, ok := toString(v)
+				if !ok {
+					return parsedPolicy, fmt.Errorf("unknown type %T of conditional field value %s found in POST policy form", v, v)
+				}
+				// {"acl": "public-read" } is an alternate way to indicate - [ "eq", "$acl", "public-read" ]
+				// In this case we will just collapse this into "eq" for all use cases.
+				parsedPolicy.Conditions.Policies = append(parsedPolicy.Conditions.Policies, postPolicyCondition{
+					Operator: policyCondEqual,
+					Key:      "$" + strings.ToLower(k),
+					Value:    value,
+				})
+			}
+		case []interface{}: // Handle array types.
+			if len(condt) != 3 { // Return error if we have insufficient elements.
+				return parsedPolicy, fmt.Errorf("malformed conditional fields %v of type %T found in POST policy form", condt, condt)
+			}
+			operator, ok := condt[0].(string)
+			if !ok {
+				return parsedPolicy, fmt.Errorf("unknown type %T of conditional field value %v found in POST policy form", condt[0], condt[0])
+			}
+			switch strings.ToLower(operator) {
+			case policyCondEqual, policyCondStartsWith:
+				key, ok1 := condt[1].(string)
+				value, ok2 := toString(condt[2])
+				if !ok1 || !ok2 || !strings.HasPrefix(key, "$") {
+					return parsedPolicy, fmt.Errorf("malformed conditional fields %v found in POST policy form", condt)
+				}
+				parsedPolicy.Conditions.Policies = append(parsedPolicy.Conditions.Policies, postPolicyCondition{
+					Operator: strings.ToLower(operator),
+					Key:      strings.ToLower(key),
+					Value:    value,
+				})
+			case policyCondContentLength:
+				min, err := toInteger(condt[1])
+				if err != nil {
+					return parsedPolicy, err
+				}
+				max, err := toInteger(condt[2])
+				if err != nil {
+					return parsedPolicy, err
+				}
+				if !isNonNegative(min) || !isNonNegative(max) || min > max {
+					return parsedPolicy, fmt.Errorf("invalid content-length-range [%d, %d] found in POST policy form", min, max)
+				}
+				parsedPolicy.Conditions.ContentLengthRange = contentLengthRange{
+					Min:   min,
+					Max:   max,
+					Valid: true,
+				}
+			default:
+				// Condition should be valid.
+				return parsedPolicy, fmt.Errorf("unknown type %T of conditional field value %v found in POST policy form", condt, condt)
+			}
+		default:
+			return parsedPolicy, fmt.Errorf("unknown field %v of type %T found in POST policy form", condt, condt)
+		}
+	}
+	return parsedPolicy, nil
+}
+
+// checkPolicyCond returns a boolean to indicate if a condition is satisfied according
+// to the passed operator
+func checkPolicyCond(op string, input1, input2 string) bool {
+	switch op {
+	case policyCondEqual:
+		return input1 == input2
+	case policyCondStartsWith:
+		return strings.HasPrefix(input1, input2)
+	}
+	return false
+}
+
+// checkPostPolicy - apply policy conditions and validate input values.
+// (http://docs.aws.amazon.com/AmazonS3/latest/dev/HTTPPOSTForms.html)
+func checkPostPolicy(formValues http.Header, postPolicyForm postPolicyForm) error {
+	// Check if policy document expiry date is still not reached
+	if !postPolicyForm.Expiration.After(time.Now().UTC()) {
+		return errors.New("Invalid according to Policy: Policy expired")
+	}
+	// mustFindInPolicy is a map to list all form keys that should be found in the policy.
+	mustFindInPolicy := make(map[string]struct{})
+	for formKey := range formValues {
+		key := strings.ToLower(formKey)
+		if ignoredFormKeys[key] || strings.HasPrefix(key, "x-ignore-") {
+			continue
+		}
+		mustFindInPolicy[key] = struct{}{}
+	}
+
+	for _, policy := range postPolicyForm.Conditions.Policies {
+		formKey := strings.TrimPrefix(policy.Key, "$")
+		// starts-with is only allowed for some conditions and metadata fields
+		if policy.Operator == policyCondStartsWith {
+			if allowed, ok := startsWithConds[policy.Key]; (ok && !allowed) || (!ok && !strings.HasPrefix(policy.Key, "$x-amz-meta-")) {
+				return fmt.Errorf("Invalid according to Policy: Policy Condition failed: [%s, %s, %s]", policy.Operator, policy.Key, policy.Value)
+			}
+		}
+		if !checkPolicyCond(policy.Operator, formValues.Get(http.CanonicalHeaderKey(formKey)), policy.Value) {
+			return fmt.Errorf("Invalid according to Policy: Policy Condition failed: [%s, %s, %s]", policy.Operator, policy.Key, policy.Value)
+		}
+		delete(mustFindInPolicy, formKey)
+	}
+	for key := range mustFindInPolicy {
+		return fmt.Errorf("Each form field that you specify in a form must appear in the list of policy conditions. %q not specified in the policy", key)
+	}
+	return nil
+}
+
+// decodePostPolicy decodes the base64 encoded policy of the form.
+func decodePostPolicy(encoded string) (postPolicyForm, error) {
+	policyBytes, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return postPolicyForm{}, err
+	}
+	return parsePostPolicyForm(bytes.NewReader(policyBytes))
+}
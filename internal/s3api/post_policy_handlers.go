@@ -0,0 +1,251 @@
+package s3api
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/yann-y/fds/internal/apierrors"
+	"github.com/yann-y/fds/internal/consts"
+	"github.com/yann-y/fds/internal/event"
+	"github.com/yann-y/fds/internal/response"
+	"github.com/yann-y/fds/internal/utils"
+	"github.com/yann-y/fds/internal/utils/hash"
+	"github.com/yann-y/fds/pkg/s3utils"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// maxFormMemory - the form fields and the part of the file kept in memory,
+// the rest of the file is buffered in a temporary file.
+const maxFormMemory = 32 << 20
+
+// maxFormSize - the largest body of a POST object request, the largest
+// object and its form fields.
+const maxFormSize = consts.MaxObjectSize + maxFormMemory
+
+// form fields of a POST object request, canonicalized like header keys.
+const (
+	formFile                  = "File"
+	formKey                   = "Key"
+	formPolicy                = "Policy"
+	formBucket                = "Bucket"
+	formACL                   = "Acl"
+	formSuccessActionRedirect = "Success_action_redirect"
+	formSuccessActionStatus   = "Success_action_status"
+	formRedirect              = "Redirect"
+)
+
+// PostPolicyBucketHandler - POST policy
+// ----------
+// This implementation of the POST operation handles object creation with a specified
+// signature policy in multipart/form-data
+// https://docs.aws.amazon.com/AmazonS3/latest/API/RESTObjectPOST.html
+func (s3a *s3ApiServer) PostPolicyBucketHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	bucket := mux.Vars(r)["bucket"]
+	log.Infof("PostPolicyBucketHandler %s", bucket)
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormSize)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		log.Errorf("PostPolicyBucketHandler MultipartReader err:%v", err)
+		response.WriteErrorResponse(w, r, apierrors.ErrMalformedPOSTRequest)
+		return
+	}
+	form, err := reader.ReadForm(maxFormMemory)
+	if err != nil {
+		log.Errorf("PostPolicyBucketHandler ReadForm err:%v", err)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			response.WriteErrorResponse(w, r, apierrors.ErrEntityTooLarge)
+			return
+		}
+		response.WriteErrorResponse(w, r, apierrors.ErrMalformedPOSTRequest)
+		return
+	}
+	defer form.RemoveAll()
+
+	// Canonicalize the form values into http.Header.
+	formValues := make(http.Header)
+	for k, v := range form.Value {
+		formValues[http.CanonicalHeaderKey(k)] = v
+	}
+	var fileHeader *multipart.FileHeader
+	for k, v := range form.File {
+		if http.CanonicalHeaderKey(k) == formFile && len(v) == 1 {
+			fileHeader = v[0]
+		}
+	}
+	if fileHeader == nil {
+		response.WriteErrorResponse(w, r, apierrors.ErrPOSTFileRequired)
+		return
+	}
+	formValues.Set(formBucket, bucket)
+
+	// Substitute ${filename} with the name of the uploaded file.
+	object := formValues.Get(formKey)
+	if strings.Contains(object, "${filename}") {
+		object = strings.ReplaceAll(object, "${filename}", path.Base(fileHeader.Filename))
+		formValues.Set(formKey, object)
+	}
+	if err = s3utils.CheckPutObjectArgs(ctx, bucket, object); err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
+		return
+	}
+
+	cred, s3err := s3a.authSys.CheckPostPolicyAuth(ctx, r, formValues, bucket, object)
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+
+	// A signed form must carry the policy it signs, anonymous forms may omit it.
+	var postPolicy postPolicyForm
+	if encoded := formValues.Get(formPolicy); encoded != "" {
+		postPolicy, err = decodePostPolicy(encoded)
+		if err != nil {
+			log.Errorf("PostPolicyBucketHandler decodePostPolicy err:%v", err)
+			response.WriteErrorResponse(w, r, apierrors.ErrPostPolicyConditionInvalidFormat)
+			return
+		}
+		if err = checkPostPolicy(formValues, postPolicy); err != nil {
+			log.Errorf("PostPolicyBucketHandler checkPostPolicy err:%v", err)
+			response.WriteErrorResponse(w, r, apierrors.ErrAccessDenied)
+			return
+		}
+	} else if cred.AccessKey != "" {
+		response.WriteErrorResponse(w, r, apierrors.ErrMalformedPOSTRequest)
+		return
+	}
+
+	size := fileHeader.Size
+	if lengthRange := postPolicy.Conditions.ContentLengthRange; lengthRange.Valid {
+		if size < lengthRange.Min {
+			response.WriteErrorResponse(w, r, apierrors.ErrEntityTooSmall)
+			return
+		}
+		if size > lengthRange.Max {
+			response.WriteErrorResponse(w, r, apierrors.ErrEntityTooLarge)
+			return
+		}
+	}
+	// maximum Upload size for objects in a single operation
+	if size > consts.MaxObjectSize {
+		response.WriteErrorResponse(w, r, apierrors.ErrEntityTooLarge)
+		return
+	}
+
+	if !s3a.bmSys.HasBucket(ctx, bucket) {
+		response.WriteErrorResponse(w, r, apierrors.ErrNoSuchBucket)
+		return
+	}
+
+	metadata := make(map[string]string)
+	if err = extractMetadataFromMime(ctx, textproto.MIMEHeader(formValues), metadata); err != nil {
+		log.Errorf("PostPolicyBucketHandler extractMetadata err:%v", err)
+		response.WriteErrorResponse(w, r, apierrors.ErrInvalidRequest)
+		return
+	}
+	delete(metadata, strings.ToLower(consts.AmzBucketReplicationStatus))
+	contentType := strings.ToLower(consts.ContentType)
+	if metadata[contentType] == "" {
+		metadata[contentType] = fileHeader.Header.Get(consts.ContentType)
+	}
+	if metadata[contentType] == "" {
+		metadata[contentType] = "binary/octet-stream"
+	}
+	// The canned ACL is given by the acl field, grants by x-amz-grant-* fields.
+	aclHeader := formValues.Clone()
+	aclHeader.Set(consts.AmzACL, formValues.Get(formACL))
+	if s3err = s3a.setObjectACLMetadata(ctx, aclHeader, bucket, cred.AccessKey, metadata); s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+
+	if s3err = s3a.checkQuota(ctx, bucket, size); s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		log.Errorf("PostPolicyBucketHandler Open err:%v", err)
+		response.WriteErrorResponse(w, r, apierrors.ErrInternalError)
+		return
+	}
+	defer file.Close()
+	hashReader, err := hash.NewReader(file, size, "", "", size)
+	if err != nil {
+		log.Errorf("PostPolicyBucketHandler NewReader err:%v", err)
+		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
+		return
+	}
+	objInfo, err := s3a.store.StoreObject(ctx, bucket, object, hashReader, size, metadata)
+	if err != nil {
+		log.Errorf("PostPolicyBucketHandler StoreObject err:%v", err)
+		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
+		return
+	}
+
+	defer s3a.queueReplication(r, objInfo, false)
+	defer s3a.sendEvent(w, r, event.ObjectCreatedPost, objInfo, cred.AccessKey)
+
+	location := getObjectLocation(r, s3a.domains, bucket, object)
+	setPutObjHeaders(w, objInfo, false)
+	w.Header().Set(consts.Location, location)
+
+	// Decide what http response to send depending on success_action_redirect and success_action_status.
+	redirect := formValues.Get(formSuccessActionRedirect)
+	if redirect == "" {
+		redirect = formValues.Get(formRedirect)
+	}
+	if redirect != "" {
+		redirectURL, err := url.Parse(redirect)
+		if err == nil {
+			query := redirectURL.Query()
+			query.Set("bucket", bucket)
+			query.Set("key", object)
+			query.Set("etag", `"`+objInfo.ETag+`"`)
+			redirectURL.RawQuery = query.Encode()
+			http.Redirect(w, r, redirectURL.String(), http.StatusSeeOther)
+			return
+		}
+		log.Errorf("PostPolicyBucketHandler invalid redirect %s: %v", redirect, err)
+	}
+
+	switch formValues.Get(formSuccessActionStatus) {
+	case "201":
+		resp := response.PostResponse{
+			Bucket:   bucket,
+			Key:      object,
+			ETag:     `"` + objInfo.ETag + `"`,
+			Location: location,
+		}
+		response.WriteXMLResponse(w, r, http.StatusCreated, resp)
+	case "200":
+		response.WriteSuccessResponseHeadersOnly(w, r)
+	default:
+		response.WriteSuccessNoContent(w)
+	}
+}
+
+// getObjectLocation returns the URL of the object as seen by the client.
+func getObjectLocation(r *http.Request, domains []string, bucket, object string) string {
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+	u := &url.URL{
+		Scheme: proto,
+		Host:   r.Host,
+		Path:   path.Join(consts.SlashSeparator, bucket, object),
+	}
+	// The bucket of a virtual-hosted-style request is part of the host.
+	if _, ok := utils.BucketFromHost(r.Host, domains); ok {
+		u.Path = path.Join(consts.SlashSeparator, object)
+	}
+	return u.String()
+}
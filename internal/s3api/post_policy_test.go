@@ -0,0 +1,77 @@
+package s3api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePostPolicyForm(t *testing.T) {
+	expiration := time.Now().UTC().Add(time.Hour).Format(time.RFC3339)
+	testCases := []struct {
+		policy  string
+		success bool
+	}{
+		{`{"expiration":"` + expiration + `","conditions":[{"bucket":"b1"},["starts-with","$key","user/"],["content-length-range",1,1024]]}`, true},
+		{`{"expiration":"` + expiration + `","conditions":[["eq","$Content-Type","image/jpeg"]]}`, true},
+		{`{"expiration":"` + expiration + `","conditions":[["content-length-range",1024,1]]}`, false},
+		{`{"expiration":"` + expiration + `","conditions":[["eq","key","a"]]}`, false},
+		{`{"expiration":"` + expiration + `","conditions":[["not-an-operator","$key","a"]]}`, false},
+		{`{"expiration":"` + expiration + `","conditions":[["eq","$key"]]}`, false},
+		{`{"expiration":"tomorrow","conditions":[]}`, false},
+		{`not json`, false},
+	}
+	for i, testCase := range testCases {
+		_, err := parsePostPolicyForm(strings.NewReader(testCase.policy))
+		if testCase.success && err != nil {
+			t.Errorf("Test %d: Expected success, but instead found %v", i+1, err)
+		}
+		if !testCase.success && err == nil {
+			t.Errorf("Test %d: Expected failure, but instead succeeded", i+1)
+		}
+	}
+}
+
+func TestCheckPostPolicy(t *testing.T) {
+	newForm := func(kv ...string) http.Header {
+		formValues := make(http.Header)
+		for i := 0; i < len(kv); i += 2 {
+			formValues.Set(kv[i], kv[i+1])
+		}
+		return formValues
+	}
+	expiration := time.Now().UTC().Add(time.Hour).Format(time.RFC3339)
+	policy := `{"expiration":"` + expiration + `","conditions":[{"bucket":"b1"},["starts-with","$key","user/"],["eq","$Content-Type","image/jpeg"],["starts-with","$x-amz-meta-tag",""]]}`
+	expired := `{"expiration":"` + time.Now().UTC().Add(-time.Hour).Format(time.RFC3339) + `","conditions":[]}`
+	startsWithBucket := `{"expiration":"` + expiration + `","conditions":[["starts-with","$bucket","b"]]}`
+
+	testCases := []struct {
+		policy     string
+		formValues http.Header
+		success    bool
+	}{
+		{policy, newForm("Bucket", "b1", "Key", "user/a.jpg", "Content-Type", "image/jpeg", "X-Amz-Meta-Tag", "x", "Policy", "p", "File", "f"), true},
+		{policy, newForm("Bucket", "b2", "Key", "user/a.jpg", "Content-Type", "image/jpeg"), false},
+		{policy, newForm("Bucket", "b1", "Key", "other/a.jpg", "Content-Type", "image/jpeg"), false},
+		{policy, newForm("Bucket", "b1", "Key", "user/a.jpg", "Content-Type", "image/png"), false},
+		// every field must be covered by a condition, unless ignored
+		{policy, newForm("Bucket", "b1", "Key", "user/a.jpg", "Content-Type", "image/jpeg", "Acl", "public-read"), false},
+		{policy, newForm("Bucket", "b1", "Key", "user/a.jpg", "Content-Type", "image/jpeg", "X-Ignore-Field", "x"), true},
+		{expired, newForm("Bucket", "b1"), false},
+		{startsWithBucket, newForm("Bucket", "b1"), false},
+	}
+	for i, testCase := range testCases {
+		form, err := parsePostPolicyForm(strings.NewReader(testCase.policy))
+		if err != nil {
+			t.Fatalf("Test %d: %v", i+1, err)
+		}
+		err = checkPostPolicy(testCase.formValues, form)
+		if testCase.success && err != nil {
+			t.Errorf("Test %d: Expected success, but instead found %v", i+1, err)
+		}
+		if !testCase.success && err == nil {
+			t.Errorf("Test %d: Expected failure, but instead succeeded", i+1)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package s3api
+
+import (
+	"encoding/xml"
+	"github.com/yann-y/fds/internal/apierrors"
+	"github.com/yann-y/fds/internal/consts"
+	"github.com/yann-y/fds/internal/iam/s3action"
+	"github.com/yann-y/fds/internal/replication"
+	"github.com/yann-y/fds/internal/response"
+	"github.com/yann-y/fds/internal/store"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxReplicationConfigSize - the maximum size of a replication configuration.
+const maxReplicationConfigSize = 1 << 20
+
+// ReplicationResyncResult - the response of ResyncBucketReplication.
+type ReplicationResyncResult struct {
+	XMLName xml.Name `xml:"ReplicationResyncResult"`
+	XMLNS   string   `xml:"xmlns,attr,omitempty"`
+	// Objects is the number of objects queued for replication.
+	Objects int `xml:"Objects"`
+}
+
+// PutBucketReplicationHandler Put bucket replication
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketReplication.html
+func (s3a *s3ApiServer) PutBucketReplicationHandler(w http.ResponseWriter, r *http.Request) {
+	bucket, _, _ := getBucketAndObject(r)
+	ctx := r.Context()
+	log.Infof("PutBucketReplicationHandler %s", bucket)
+	_, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.PutReplicationConfigurationAction, bucket, "")
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+
+	if !s3a.bmSys.HasBucket(ctx, bucket) {
+		response.WriteErrorResponse(w, r, apierrors.ErrNoSuchBucket)
+		return
+	}
+	config, err := replication.ParseConfig(io.LimitReader(r.Body, maxReplicationConfigSize), s3a.replicationSys.HasTarget)
+	if err != nil {
+		log.Errorf("PutBucketReplicationHandler ParseConfig err:%v", err)
+		s3err = apierrors.ToApiError(ctx, err)
+		if s3err == apierrors.ErrInternalError {
+			// not a destination error, the body is no valid configuration
+			s3err = apierrors.ErrMalformedXML
+		}
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+	config.XMLNS = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+	if err = s3a.bmSys.UpdateBucketReplication(ctx, bucket, config); err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
+		return
+	}
+
+	// Write success response.
+	response.WriteSuccessResponseHeadersOnly(w, r)
+}
+
+// GetBucketReplicationHandler Get bucket replication
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetBucketReplication.html
+func (s3a *s3ApiServer) GetBucketReplicationHandler(w http.ResponseWriter, r *http.Request) {
+	bucket, _, _ := getBucketAndObject(r)
+	ctx := r.Context()
+	log.Infof("GetBucketReplicationHandler %s", bucket)
+	_, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.GetReplicationConfigurationAction, bucket, "")
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+
+	config, err := s3a.bmSys.GetReplicationConfig(ctx, bucket)
+	if err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
+		return
+	}
+	response.WriteSuccessResponseXML(w, r, config)
+}
+
+// DeleteBucketReplicationHandler Delete bucket replication
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_DeleteBucketReplication.html
+func (s3a *s3ApiServer) DeleteBucketReplicationHandler(w http.ResponseWriter, r *http.Request) {
+	bucket, _, _ := getBucketAndObject(r)
+	ctx := r.Context()
+	log.Infof("DeleteBucketReplicationHandler %s", bucket)
+	_, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.PutReplicationConfigurationAction, bucket, "")
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+
+	if err := s3a.bmSys.DeleteBucketReplication(ctx, bucket); err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
+		return
+	}
+
+	// Write success response.
+	response.WriteSuccessNoContent(w)
+}
+
+// ResyncBucketReplicationHandler queues the replication of the existing
+// objects of a bucket, such as those written before its replication was
+// configured or whose replication failed.
+// POST /{bucket}?replication-resync
+func (s3a *s3ApiServer) ResyncBucketReplicationHandler(w http.ResponseWriter, r *http.Request) {
+	bucket, _, _ := getBucketAndObject(r)
+	ctx := r.Context()
+	log.Infof("ResyncBucketReplicationHandler %s", bucket)
+	_, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.PutReplicationConfigurationAction, bucket, "")
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+	if s3a.replicationSys == nil {
+		response.WriteErrorResponse(w, r, apierrors.ErrNotImplemented)
+		return
+	}
+
+	config, err := s3a.bmSys.GetReplicationConfig(ctx, bucket)
+	if err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
+		return
+	}
+	n, err := s3a.replicationSys.Resync(ctx, bucket, config)
+	if err != nil {
+		log.Errorf("ResyncBucketReplicationHandler Resync err:%v", err)
+		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
+		return
+	}
+	response.WriteSuccessResponseXML(w, r, ReplicationResyncResult{
+		XMLNS:   "http://s3.amazonaws.com/doc/2006-03-01/",
+		Objects: n,
+	})
+}
+
+// isReplicaRequest checks whether the request writes or deletes a replica,
+// which requires the replicate action.
+func (s3a *s3ApiServer) isReplicaRequest(r *http.Request, action s3action.Action, bucket, object string) (bool, apierrors.ErrorCode) {
+	if r.Header.Get(consts.AmzBucketReplicationStatus) != string(replication.StatusReplica) {
+		return false, apierrors.ErrNone
+	}
+	_, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(r.Context(), r, action, bucket, object)
+	if s3err != apierrors.ErrNone {
+		return false, s3err
+	}
+	return true, apierrors.ErrNone
+}
+
+// setReplicaMetadata keeps the replication status of the metadata of a new
+// object only when the request writes a replica.
+func (s3a *s3ApiServer) setReplicaMetadata(r *http.Request, bucket, object string, metadata map[string]string) apierrors.ErrorCode {
+	delete(metadata, strings.ToLower(consts.AmzBucketReplicationStatus))
+	replica, s3err := s3a.isReplicaRequest(r, s3action.ReplicateObjectAction, bucket, object)
+	if s3err != apierrors.ErrNone {
+		return s3err
+	}
+	if replica {
+		metadata[strings.ToLower(consts.AmzBucketReplicationStatus)] = string(replication.StatusReplica)
+	}
+	return apierrors.ErrNone
+}
+
+// queueReplication queues the replication of an object written or deleted,
+// when the replication configuration of its bucket applies to it.
+func (s3a *s3ApiServer) queueReplication(r *http.Request, objInfo store.ObjectInfo, isDelete bool) {
+	if s3a.replicationSys == nil {
+		return
+	}
+	meta, err := s3a.bmSys.GetBucketMeta(r.Context(), objInfo.Bucket)
+	if err != nil || meta.ReplicationConfig == nil {
+		return
+	}
+	s3a.replicationSys.Enqueue(r.Context(), meta.ReplicationConfig, objInfo.ReplicationInfo(), isDelete)
+}
@@ -1,21 +1,34 @@
 package s3api
 
 import (
+	"github.com/yann-y/fds/internal/apierrors"
 	"github.com/yann-y/fds/internal/consts"
+	"github.com/yann-y/fds/internal/cors"
+	"github.com/yann-y/fds/internal/event"
 	"github.com/yann-y/fds/internal/iam"
 	"github.com/yann-y/fds/internal/iam/set"
+	"github.com/yann-y/fds/internal/replication"
 	"github.com/yann-y/fds/internal/response"
 	"github.com/yann-y/fds/internal/store"
+	"github.com/yann-y/fds/internal/utils"
 
 	"github.com/gorilla/mux"
-	"github.com/rs/cors"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 type s3ApiServer struct {
 	authSys *iam.AuthSys
 	store   *store.StorageSys
 	bmSys   *store.BucketMetadataSys
+	// domains of virtual-hosted-style requests <bucket>.<domain>
+	domains         []string
+	notificationSys *event.NotificationSys
+	eventBus        *event.Bus
+	replicationSys  *replication.ReplicationSys
+	purger          *store.BucketPurger
+	quotaSys        *store.QuotaSys
 }
 
 // registerS3Router Register APIs
@@ -27,6 +40,10 @@ func (s3a *s3ApiServer) registerS3Router(router *mux.Router) {
 	// NotFound
 	apiRouter.NotFoundHandler = http.HandlerFunc(response.NotFoundHandler)
 	var routers []*mux.Router
+	for _, domain := range s3a.domains {
+		// The port of the host is ignored, the template has none.
+		routers = append(routers, apiRouter.Host("{bucket:.+}."+domain).Subrouter())
+	}
 	routers = append(routers, apiRouter.PathPrefix("/{bucket}").Subrouter())
 
 	for _, bucket := range routers {
@@ -65,10 +82,12 @@ func (s3a *s3ApiServer) registerS3Router(router *mux.Router) {
 		bucket.Methods(http.MethodDelete).Path("/{object:.+}").HandlerFunc(s3a.DeleteObjectHandler)
 		// DeleteMultipleObjects
 		bucket.Methods(http.MethodPost).HandlerFunc(s3a.DeleteMultipleObjectsHandler).Queries("delete", "")
+		// PostPolicy
+		bucket.Methods(http.MethodPost).HeadersRegexp(consts.ContentType, "multipart/form-data*").HandlerFunc(s3a.PostPolicyBucketHandler)
 
 		// Bucket operations
 		// GetBucketLocation
-		router.Methods(http.MethodGet).HandlerFunc(s3a.GetBucketLocationHandler).Queries("location", "")
+		bucket.Methods(http.MethodGet).HandlerFunc(s3a.GetBucketLocationHandler).Queries("location", "")
 
 		// PutBucketPolicy
 		bucket.Methods(http.MethodPut).HandlerFunc(s3a.PutBucketPolicyHandler).Queries("policy", "")
@@ -82,6 +101,13 @@ func (s3a *s3ApiServer) registerS3Router(router *mux.Router) {
 		// PutBucketACL
 		bucket.Methods(http.MethodPut).HandlerFunc(s3a.PutBucketAclHandler).Queries("acl", "")
 
+		// GetBucketOwnershipControls
+		bucket.Methods(http.MethodGet).HandlerFunc(s3a.GetBucketOwnershipControlsHandler).Queries("ownershipControls", "")
+		// PutBucketOwnershipControls
+		bucket.Methods(http.MethodPut).HandlerFunc(s3a.PutBucketOwnershipControlsHandler).Queries("ownershipControls", "")
+		// DeleteBucketOwnershipControls
+		bucket.Methods(http.MethodDelete).HandlerFunc(s3a.DeleteBucketOwnershipControlsHandler).Queries("ownershipControls", "")
+
 		// GetBucketCors
 		bucket.Methods(http.MethodGet).HandlerFunc(s3a.GetBucketCorsHandler).Queries("cors", "")
 		// PutBucketCors
@@ -89,12 +115,35 @@ func (s3a *s3ApiServer) registerS3Router(router *mux.Router) {
 		// DeleteBucketCors
 		bucket.Methods(http.MethodDelete).HandlerFunc(s3a.DeleteBucketCorsHandler).Queries("cors", "")
 
+		// GetBucketWebsite
+		bucket.Methods(http.MethodGet).HandlerFunc(s3a.GetBucketWebsiteHandler).Queries("website", "")
+		// PutBucketWebsite
+		bucket.Methods(http.MethodPut).HandlerFunc(s3a.PutBucketWebsiteHandler).Queries("website", "")
+		// DeleteBucketWebsite
+		bucket.Methods(http.MethodDelete).HandlerFunc(s3a.DeleteBucketWebsiteHandler).Queries("website", "")
+
+		// GetBucketNotification
+		bucket.Methods(http.MethodGet).HandlerFunc(s3a.GetBucketNotificationHandler).Queries("notification", "")
+		// PutBucketNotification
+		bucket.Methods(http.MethodPut).HandlerFunc(s3a.PutBucketNotificationHandler).Queries("notification", "")
+		// ListenBucketNotification
+		bucket.Methods(http.MethodGet).HandlerFunc(s3a.ListenBucketNotificationHandler).Queries("events", "{events:.*}")
+
+		// GetBucketReplication
+		bucket.Methods(http.MethodGet).HandlerFunc(s3a.GetBucketReplicationHandler).Queries("replication", "")
+		// PutBucketReplication
+		bucket.Methods(http.MethodPut).HandlerFunc(s3a.PutBucketReplicationHandler).Queries("replication", "")
+		// DeleteBucketReplication
+		bucket.Methods(http.MethodDelete).HandlerFunc(s3a.DeleteBucketReplicationHandler).Queries("replication", "")
+		// ResyncBucketReplication
+		bucket.Methods(http.MethodPost).HandlerFunc(s3a.ResyncBucketReplicationHandler).Queries("replication-resync", "")
+
 		// PutBucketTaggingHandler
 		bucket.Methods(http.MethodPut).HandlerFunc(s3a.PutBucketTaggingHandler).Queries("tagging", "")
 		// GetBucketTaggingHandler
-		router.Methods(http.MethodGet).HandlerFunc(s3a.GetBucketTaggingHandler).Queries("tagging", "")
+		bucket.Methods(http.MethodGet).HandlerFunc(s3a.GetBucketTaggingHandler).Queries("tagging", "")
 		// DeleteBucketTaggingHandler
-		router.Methods(http.MethodDelete).HandlerFunc(s3a.DeleteBucketTaggingHandler).Queries("tagging", "")
+		bucket.Methods(http.MethodDelete).HandlerFunc(s3a.DeleteBucketTaggingHandler).Queries("tagging", "")
 
 		// PutBucket
 		bucket.Methods(http.MethodPut).HandlerFunc(s3a.PutBucketHandler)
@@ -119,14 +168,37 @@ func (s3a *s3ApiServer) registerSTSRouter(router *mux.Router) {
 		noQueries := len(r.URL.RawQuery) == 0
 		return ctypeOk && authOk && noQueries
 	}).HandlerFunc(s3a.AssumeRole)
+
+	// AssumeRoleWithWebIdentity and AssumeRoleWithClientGrants are authenticated
+	// by the token they carry rather than a signature.
+	apiRouter.Methods(http.MethodPost).MatcherFunc(func(r *http.Request, rm *mux.RouteMatch) bool {
+		ctypeOk := set.MatchSimple("application/x-www-form-urlencoded*", r.Header.Get(consts.ContentType))
+		noAuth := r.Header.Get(consts.Authorization) == ""
+		noQueries := len(r.URL.RawQuery) == 0
+		return ctypeOk && noAuth && noQueries
+	}).HandlerFunc(s3a.AssumeRoleWithJWT)
+	apiRouter.Methods(http.MethodPost).HandlerFunc(s3a.AssumeRoleWithJWT).
+		Queries(consts.StsAction, consts.AssumeRoleWithWebIdentity, consts.StsWebIdentityToken, "{Token:.*}")
+	apiRouter.Methods(http.MethodPost).HandlerFunc(s3a.AssumeRoleWithJWT).
+		Queries(consts.StsAction, consts.AssumeRoleWithClientGrants, consts.StsToken, "{Token:.*}")
 }
 
-// NewS3Server Start a S3Server
-func NewS3Server(router *mux.Router, authSys *iam.AuthSys, bmSys *store.BucketMetadataSys, storageSys *store.StorageSys) {
+// NewS3Server Start a S3Server, notificationSys may be nil when no
+// notification target is configured, the events of object operations are
+// published on eventBus, replicationSys may be nil when no replication
+// target is configured, purger when buckets can't be force deleted, and
+// quotaSys when the quotas are not enforced.
+func NewS3Server(router *mux.Router, authSys *iam.AuthSys, bmSys *store.BucketMetadataSys, storageSys *store.StorageSys, domains []string, notificationSys *event.NotificationSys, eventBus *event.Bus, replicationSys *replication.ReplicationSys, purger *store.BucketPurger, quotaSys *store.QuotaSys) {
 	s3server := &s3ApiServer{
-		authSys: authSys,
-		store:   storageSys,
-		bmSys:   bmSys,
+		authSys:         authSys,
+		store:           storageSys,
+		bmSys:           bmSys,
+		domains:         domains,
+		notificationSys: notificationSys,
+		eventBus:        eventBus,
+		replicationSys:  replicationSys,
+		purger:          purger,
+		quotaSys:        quotaSys,
 	}
 	s3server.registerSTSRouter(router)
 	s3server.registerS3Router(router)
@@ -134,49 +206,101 @@ func NewS3Server(router *mux.Router, authSys *iam.AuthSys, bmSys *store.BucketMe
 	router.Use(iam.SetAuthHandler)
 }
 
-// CorsHandler handler for CORS (Cross Origin Resource Sharing)
-func CorsHandler(handler http.Handler) http.Handler {
-	commonS3Headers := []string{
-		consts.Date,
-		consts.ETag,
-		consts.ServerInfo,
-		consts.Connection,
-		consts.AcceptRanges,
-		consts.ContentRange,
-		consts.ContentEncoding,
-		consts.ContentLength,
-		consts.ContentType,
-		consts.ContentDisposition,
-		consts.LastModified,
-		consts.ContentLanguage,
-		consts.CacheControl,
-		consts.RetryAfter,
-		consts.AmzBucketRegion,
-		consts.Expires,
-		consts.Authorization,
-		consts.Action,
-		consts.Range,
-		"X-Amz*",
-		"x-amz*",
-		"*",
+// CorsHandler handler for CORS (Cross Origin Resource Sharing), cross origin
+// requests are evaluated against the CORS configuration of their bucket.
+func CorsHandler(handler http.Handler, bmSys *store.BucketMetadataSys, domains []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get(consts.Origin)
+		bucket := bucketFromRequest(r, domains)
+		if origin == "" || bucket == "" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		preflight := r.Method == http.MethodOptions && r.Header.Get(consts.AccessControlRequestMethod) != ""
+		config, err := bmSys.GetCorsConfig(r.Context(), bucket)
+		if err != nil {
+			if preflight {
+				response.WriteErrorResponse(w, r, apierrors.ErrCORSRequestNotAllowed)
+				return
+			}
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Add(consts.Vary, consts.Origin)
+		if !preflight {
+			if rule := config.Match(origin, r.Method, nil); rule != nil {
+				setCorsOriginHeaders(h, rule, origin)
+				if len(rule.ExposeHeaders) > 0 {
+					h.Set(consts.AccessControlExposeHeaders, strings.Join(rule.ExposeHeaders, ", "))
+				}
+			}
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		h.Add(consts.Vary, consts.AccessControlRequestMethod)
+		h.Add(consts.Vary, consts.AccessControlRequestHeaders)
+		var headers []string
+		for _, header := range strings.Split(r.Header.Get(consts.AccessControlRequestHeaders), ",") {
+			if header = strings.TrimSpace(header); header != "" {
+				headers = append(headers, header)
+			}
+		}
+		rule := config.Match(origin, r.Header.Get(consts.AccessControlRequestMethod), headers)
+		if rule == nil {
+			response.WriteErrorResponse(w, r, apierrors.ErrCORSRequestNotAllowed)
+			return
+		}
+		setCorsOriginHeaders(h, rule, origin)
+		h.Set(consts.AccessControlAllowMethods, strings.Join(rule.AllowedMethods, ", "))
+		if len(headers) > 0 {
+			h.Set(consts.AccessControlAllowHeaders, strings.Join(headers, ", "))
+		}
+		if rule.MaxAgeSeconds > 0 {
+			h.Set(consts.AccessControlMaxAge, strconv.Itoa(rule.MaxAgeSeconds))
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// setCorsOriginHeaders allows origin to read the response, credentials are
+// only allowed when the rule names the origin.
+func setCorsOriginHeaders(h http.Header, rule *cors.Rule, origin string) {
+	if rule.AllowsAnyOrigin() {
+		h.Set(consts.AccessControlAllowOrigin, "*")
+		return
 	}
+	h.Set(consts.AccessControlAllowOrigin, origin)
+	h.Set(consts.AccessControlAllowCredentials, "true")
+}
 
-	return cors.New(cors.Options{
-		AllowOriginFunc: func(origin string) bool {
-
-			return true
-		},
-		AllowedMethods: []string{
-			http.MethodGet,
-			http.MethodPut,
-			http.MethodHead,
-			http.MethodPost,
-			http.MethodDelete,
-			http.MethodOptions,
-			http.MethodPatch,
-		},
-		AllowedHeaders:   commonS3Headers,
-		ExposedHeaders:   commonS3Headers,
-		AllowCredentials: true,
-	}).Handler(handler)
+// nonS3Paths, nonS3PathPrefixes - the routes served alongside the S3 API,
+// the admin API, the calls of the cluster, the readiness probe and the
+// metrics, whose path names no bucket.
+var (
+	nonS3Paths        = []string{"/status", "/metrics"}
+	nonS3PathPrefixes = []string{"/admin/", "/cluster/"}
+)
+
+// bucketFromRequest returns the bucket of a virtual-hosted-style or a
+// path-style request, none for the routes served alongside the S3 API.
+func bucketFromRequest(r *http.Request, domains []string) string {
+	for _, path := range nonS3Paths {
+		if r.URL.Path == path {
+			return ""
+		}
+	}
+	for _, prefix := range nonS3PathPrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return ""
+		}
+	}
+	if bucket, ok := utils.BucketFromHost(r.Host, domains); ok {
+		return bucket
+	}
+	bucket, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, consts.SlashSeparator), consts.SlashSeparator)
+	return bucket
 }
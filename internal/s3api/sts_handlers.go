@@ -7,16 +7,23 @@ import (
 	"github.com/yann-y/fds/internal/consts"
 	"github.com/yann-y/fds/internal/iam"
 	"github.com/yann-y/fds/internal/iam/auth"
+	"github.com/yann-y/fds/internal/iam/policy"
 	"github.com/yann-y/fds/internal/response"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
 const (
 	parentClaim = "parent"
 	expClaim    = "exp"
+	subClaim    = "sub"
 )
 
+var validSessionName = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+
 // AssumeRole - implementation of AWS STS API AssumeRole to get temporary
 // credentials for regular users .
 // https://docs.aws.amazon.com/STS/latest/APIReference/API_AssumeRole.html
@@ -51,35 +58,257 @@ func (s3a *s3ApiServer) AssumeRole(w http.ResponseWriter, r *http.Request) {
 		response.WriteSTSErrorResponse(r.Context(), w, isErrCodeSTS, stsErr, nil)
 		return
 	}
-	defaultExpiryDuration := time.Duration(60) * time.Minute // Defaults to 1hr.
+	ctx := r.Context()
+	role, stsErr, err := s3a.getAssumedRole(r, user.AccessKey)
+	if stsErr != apierrors.ErrSTSNone {
+		response.WriteSTSErrorResponse(ctx, w, true, stsErr, err)
+		return
+	}
+	sessionName, duration, sessionPolicy, err := s3a.getSessionParams(r, role)
+	if err != nil {
+		response.WriteSTSErrorResponse(ctx, w, true, apierrors.ErrSTSInvalidParameterValue, err)
+		return
+	}
 
 	m := map[string]interface{}{
-		expClaim:    time.Now().UTC().Add(defaultExpiryDuration).Unix(),
+		expClaim:    time.Now().UTC().Add(duration).Unix(),
 		parentClaim: user.AccessKey,
 	}
 
 	secret := s3a.authSys.AdminCred.SecretKey
 	cred, err := auth.GetNewCredentialsWithMetadata(m, secret)
 	if err != nil {
-		response.WriteSTSErrorResponse(r.Context(), w, true, apierrors.ErrSTSInternalError, err)
+		response.WriteSTSErrorResponse(ctx, w, true, apierrors.ErrSTSInternalError, err)
 		return
 	}
 	// Set the parent of the temporary access key, so that it's access
-	// policy is inherited from `user.AccessKey`.
+	// policy is inherited from `user.AccessKey`, or from the assumed role.
 	cred.ParentUser = user.AccessKey
+	cred.RoleName = role.RoleName
 	// Set the newly generated credentials.
-	if err = s3a.authSys.Iam.SetTempUser(r.Context(), cred.AccessKey, cred, ""); err != nil {
-		response.WriteSTSErrorResponse(r.Context(), w, true, apierrors.ErrSTSInternalError, err)
+	if err = s3a.authSys.Iam.SetTempUser(ctx, cred.AccessKey, cred, sessionPolicy); err != nil {
+		response.WriteSTSErrorResponse(ctx, w, true, apierrors.ErrSTSInternalError, err)
 		return
 	}
 	assumeRoleResponse := &response.AssumeRoleResponse{
 		Result: response.AssumeRoleResult{
-			Credentials: cred,
+			AssumedRoleUser: getAssumedRoleUser(role, sessionName, cred),
+			Credentials:     cred,
 		},
 	}
 	assumeRoleResponse.ResponseMetadata.RequestID = w.Header().Get(consts.AmzRequestID)
 	response.WriteSuccessResponseXML(w, r, assumeRoleResponse)
 }
+
+// AssumeRoleWithJWT - implementation of AWS STS APIs AssumeRoleWithWebIdentity
+// and AssumeRoleWithClientGrants to get temporary credentials for identities
+// of the OpenID provider of their issuer. Unless a role is assumed, the credentials
+// are granted the managed policies named by the policy and groups claims of the token.
+// https://docs.aws.amazon.com/STS/latest/APIReference/API_AssumeRoleWithWebIdentity.html
+func (s3a *s3ApiServer) AssumeRoleWithJWT(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := parseForm(r); err != nil {
+		response.WriteSTSErrorResponse(ctx, w, true, apierrors.ErrSTSInvalidParameterValue, err)
+		return
+	}
+
+	if r.Form.Get(consts.StsVersion) != consts.StsAPIVersion {
+		response.WriteSTSErrorResponse(ctx, w, true, apierrors.ErrSTSMissingParameter, fmt.Errorf("invalid STS API version %s, expecting %s", r.Form.Get(consts.StsVersion), consts.StsAPIVersion))
+		return
+	}
+
+	action := r.Form.Get(consts.StsAction)
+	var token string
+	switch action {
+	case consts.AssumeRoleWithWebIdentity:
+		token = r.Form.Get(consts.StsWebIdentityToken)
+	case consts.AssumeRoleWithClientGrants:
+		token = r.Form.Get(consts.StsToken)
+	default:
+		response.WriteSTSErrorResponse(ctx, w, true, apierrors.ErrSTSInvalidParameterValue, fmt.Errorf("unsupported action %s", action))
+		return
+	}
+	if token == "" {
+		response.WriteSTSErrorResponse(ctx, w, true, apierrors.ErrSTSMissingParameter, fmt.Errorf("missing token for action %s", action))
+		return
+	}
+
+	providers := s3a.authSys.OpenID
+	if providers == nil {
+		response.WriteSTSErrorResponse(ctx, w, true, apierrors.ErrSTSNotInitialized, nil)
+		return
+	}
+	provider, claims, err := providers.Validate(ctx, token)
+	if err != nil {
+		response.WriteSTSErrorResponse(ctx, w, true, apierrors.ErrSTSInvalidIdentityToken, err)
+		return
+	}
+	sub := provider.Subject(claims)
+	parentUser := iam.FederatedUser(sub)
+
+	role, stsErr, err := s3a.getAssumedRole(r, parentUser)
+	if stsErr != apierrors.ErrSTSNone {
+		response.WriteSTSErrorResponse(ctx, w, true, stsErr, err)
+		return
+	}
+	var identityPolicy *policy.Policy
+	if role.RoleName == "" {
+		identityPolicy = s3a.getClaimsPolicy(ctx, provider.Policies(claims), provider.Groups(claims))
+		if identityPolicy == nil {
+			response.WriteSTSErrorResponse(ctx, w, true, apierrors.ErrSTSAccessDenied,
+				fmt.Errorf("no policy is mapped to the claims of %s", sub))
+			return
+		}
+	}
+	sessionName, duration, sessionPolicy, err := s3a.getSessionParams(r, role)
+	if err != nil {
+		response.WriteSTSErrorResponse(ctx, w, true, apierrors.ErrSTSInvalidParameterValue, err)
+		return
+	}
+
+	m := map[string]interface{}{
+		expClaim:    time.Now().UTC().Add(duration).Unix(),
+		parentClaim: parentUser,
+		subClaim:    sub,
+	}
+	cred, err := auth.GetNewCredentialsWithMetadata(m, s3a.authSys.AdminCred.SecretKey)
+	if err != nil {
+		response.WriteSTSErrorResponse(ctx, w, true, apierrors.ErrSTSInternalError, err)
+		return
+	}
+	cred.ParentUser = parentUser
+	cred.RoleName = role.RoleName
+	if err = s3a.authSys.Iam.SetFederatedTempUser(ctx, cred, identityPolicy, sessionPolicy); err != nil {
+		response.WriteSTSErrorResponse(ctx, w, true, apierrors.ErrSTSInternalError, err)
+		return
+	}
+
+	assumedRoleUser := getAssumedRoleUser(role, sessionName, cred)
+	audience := getAudience(claims)
+	issuer, _ := claims["iss"].(string)
+	var resp interface{}
+	if action == consts.AssumeRoleWithWebIdentity {
+		webIdentityResponse := &response.AssumeRoleWithWebIdentityResponse{
+			Result: response.WebIdentityResult{
+				AssumedRoleUser:             assumedRoleUser,
+				Audience:                    audience,
+				Credentials:                 cred,
+				Provider:                    issuer,
+				SubjectFromWebIdentityToken: sub,
+			},
+		}
+		webIdentityResponse.ResponseMetadata.RequestID = w.Header().Get(consts.AmzRequestID)
+		resp = webIdentityResponse
+	} else {
+		clientGrantsResponse := &response.AssumeRoleWithClientGrantsResponse{
+			Result: response.ClientGrantsResult{
+				AssumedRoleUser:  assumedRoleUser,
+				Audience:         audience,
+				Credentials:      cred,
+				Provider:         issuer,
+				SubjectFromToken: sub,
+			},
+		}
+		clientGrantsResponse.ResponseMetadata.RequestID = w.Header().Get(consts.AmzRequestID)
+		resp = clientGrantsResponse
+	}
+	response.WriteSuccessResponseXML(w, r, resp)
+}
+
+// getAssumedRole returns the role named by the RoleArn parameter after checking
+// principal is trusted by it, the zero Role is returned when no role is requested.
+func (s3a *s3ApiServer) getAssumedRole(r *http.Request, principal string) (iam.Role, apierrors.STSErrorCode, error) {
+	var role iam.Role
+	roleArn := r.Form.Get(consts.StsRoleArn)
+	if roleArn == "" {
+		return role, apierrors.ErrSTSNone, nil
+	}
+	roleName, ok := iam.RoleNameFromArn(roleArn)
+	if !ok {
+		return role, apierrors.ErrSTSInvalidParameterValue, fmt.Errorf("invalid role arn %s", roleArn)
+	}
+	role, err := s3a.authSys.Iam.GetRole(r.Context(), roleName)
+	if err != nil {
+		return role, apierrors.ErrSTSAccessDenied, err
+	}
+	if !role.TrustPolicy.IsAllowed(principal, getSTSConditions(r, principal)) {
+		return role, apierrors.ErrSTSAccessDenied, fmt.Errorf("%s is not allowed to assume role %s", principal, roleArn)
+	}
+	return role, apierrors.ErrSTSNone, nil
+}
+
+// getSessionParams validates the RoleSessionName, DurationSeconds and Policy parameters.
+func (s3a *s3ApiServer) getSessionParams(r *http.Request, role iam.Role) (sessionName string, duration time.Duration, sessionPolicy *policy.Policy, err error) {
+	sessionName = r.Form.Get(consts.StsRoleSessionName)
+	if sessionName != "" && !validSessionName.MatchString(sessionName) {
+		return "", 0, nil, fmt.Errorf("invalid role session name %s", sessionName)
+	}
+	duration, err = s3a.authSys.Iam.GetSTSDuration(r.Form.Get(consts.StsDurationSeconds), role.MaxSessionDuration)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	if sessionPolicyStr := r.Form.Get(consts.StsPolicy); sessionPolicyStr != "" {
+		if len(sessionPolicyStr) > consts.StsSessionPolicyLimit {
+			return "", 0, nil, fmt.Errorf("session policy should not exceed %d characters", consts.StsSessionPolicyLimit)
+		}
+		sessionPolicy, err = policy.ParseIdentityPolicy(strings.NewReader(sessionPolicyStr))
+		if err != nil {
+			return "", 0, nil, err
+		}
+	}
+	return sessionName, duration, sessionPolicy, nil
+}
+
+// getClaimsPolicy merges the managed policies named by the policy claim and
+// the groups claim, groups without a policy of the same name are ignored.
+func (s3a *s3ApiServer) getClaimsPolicy(ctx context.Context, policies, groups []string) *policy.Policy {
+	var merged *policy.Policy
+	seen := make(map[string]struct{})
+	for _, name := range append(policies, groups...) {
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		p, err := s3a.authSys.Iam.GetPolicy(ctx, name)
+		if err != nil {
+			continue
+		}
+		if merged == nil {
+			merged = &policy.Policy{}
+		}
+		*merged = merged.Merge(*p)
+		merged.Version = p.Version
+	}
+	return merged
+}
+
+// getAssumedRoleUser returns the identifiers of a role session.
+func getAssumedRoleUser(role iam.Role, sessionName string, cred auth.Credentials) response.AssumedRoleUser {
+	if role.RoleName == "" {
+		return response.AssumedRoleUser{}
+	}
+	if sessionName == "" {
+		sessionName = cred.AccessKey
+	}
+	return response.AssumedRoleUser{
+		Arn:           fmt.Sprintf("arn:aws:sts:::assumed-role/%s/%s", role.RoleName, sessionName),
+		AssumedRoleID: role.RoleName + ":" + sessionName,
+	}
+}
+
+// getAudience returns the aud claim, the first audience when there are several.
+func getAudience(claims map[string]interface{}) string {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return aud
+	case []interface{}:
+		if len(aud) > 0 {
+			s, _ := aud[0].(string)
+			return s
+		}
+	}
+	return ""
+}
 func (s3a *s3ApiServer) checkAssumeRoleAuth(ctx context.Context, r *http.Request) (user auth.Credentials, isErrCodeSTS bool, stsErr apierrors.STSErrorCode) {
 	if !iam.IsRequestSignatureV4(r) {
 		return user, true, apierrors.ErrSTSAccessDenied
@@ -103,6 +332,16 @@ func (s3a *s3ApiServer) checkAssumeRoleAuth(ctx context.Context, r *http.Request
 	return user, true, apierrors.ErrSTSNone
 }
 
+// getSTSConditions returns the condition values a role trust policy is evaluated with.
+func getSTSConditions(r *http.Request, username string) map[string][]string {
+	return map[string][]string{
+		"CurrentTime":     {time.Now().UTC().Format(time.RFC3339)},
+		"SecureTransport": {strconv.FormatBool(r.TLS != nil)},
+		"UserAgent":       {r.UserAgent()},
+		"username":        {username},
+	}
+}
+
 // Fetch the security token set by the client.
 func getSessionToken(r *http.Request) (token string) {
 	token = r.Header.Get(consts.AmzSecurityToken)
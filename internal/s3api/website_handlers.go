@@ -0,0 +1,232 @@
+package s3api
+
+import (
+	"fmt"
+	"github.com/yann-y/fds/internal/apierrors"
+	"github.com/yann-y/fds/internal/consts"
+	"github.com/yann-y/fds/internal/iam"
+	"github.com/yann-y/fds/internal/iam/s3action"
+	"github.com/yann-y/fds/internal/response"
+	"github.com/yann-y/fds/internal/store"
+	"github.com/yann-y/fds/internal/website"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxWebsiteConfigSize - the maximum size of a website configuration.
+const maxWebsiteConfigSize = 128 << 10
+
+// PutBucketWebsiteHandler Put bucket website
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketWebsite.html
+func (s3a *s3ApiServer) PutBucketWebsiteHandler(w http.ResponseWriter, r *http.Request) {
+	bucket, _, _ := getBucketAndObject(r)
+	ctx := r.Context()
+	log.Infof("PutBucketWebsiteHandler %s", bucket)
+	_, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.PutBucketWebsiteAction, bucket, "")
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+
+	config, err := website.ParseConfig(io.LimitReader(r.Body, maxWebsiteConfigSize))
+	if err != nil {
+		log.Errorf("PutBucketWebsiteHandler ParseConfig err:%v", err)
+		response.WriteErrorResponse(w, r, apierrors.ErrMalformedXML)
+		return
+	}
+	config.XMLNS = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+	if err = s3a.bmSys.UpdateBucketWebsite(ctx, bucket, config); err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
+		return
+	}
+
+	// Write success response.
+	response.WriteSuccessResponseHeadersOnly(w, r)
+}
+
+// GetBucketWebsiteHandler Get bucket website
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetBucketWebsite.html
+func (s3a *s3ApiServer) GetBucketWebsiteHandler(w http.ResponseWriter, r *http.Request) {
+	bucket, _, _ := getBucketAndObject(r)
+	ctx := r.Context()
+	log.Infof("GetBucketWebsiteHandler %s", bucket)
+	_, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.GetBucketWebsiteAction, bucket, "")
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+
+	config, err := s3a.bmSys.GetWebsiteConfig(ctx, bucket)
+	if err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
+		return
+	}
+	response.WriteSuccessResponseXML(w, r, config)
+}
+
+// DeleteBucketWebsiteHandler Delete bucket website
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_DeleteBucketWebsite.html
+func (s3a *s3ApiServer) DeleteBucketWebsiteHandler(w http.ResponseWriter, r *http.Request) {
+	bucket, _, _ := getBucketAndObject(r)
+	ctx := r.Context()
+	log.Infof("DeleteBucketWebsiteHandler %s", bucket)
+	_, _, s3err := s3a.authSys.CheckRequestAuthTypeCredential(ctx, r, s3action.DeleteBucketWebsiteAction, bucket, "")
+	if s3err != apierrors.ErrNone {
+		response.WriteErrorResponse(w, r, s3err)
+		return
+	}
+
+	if err := s3a.bmSys.DeleteBucketWebsite(ctx, bucket); err != nil {
+		response.WriteErrorResponse(w, r, apierrors.ToApiError(ctx, err))
+		return
+	}
+	response.WriteSuccessNoContent(w)
+}
+
+// websiteServer serves the website endpoint of buckets: anonymous GET and
+// HEAD requests resolved through the website configuration of the bucket.
+type websiteServer struct {
+	authSys *iam.AuthSys
+	store   *store.StorageSys
+	bmSys   *store.BucketMetadataSys
+	domain  string
+}
+
+// NewWebsiteHandler returns the handler of the website endpoint. The bucket
+// of a request is the first label of its host when the host is a subdomain
+// of domain, otherwise the whole host, as for buckets named after the domain
+// they are served on.
+func NewWebsiteHandler(authSys *iam.AuthSys, bmSys *store.BucketMetadataSys, storageSys *store.StorageSys, domain string) http.Handler {
+	return &websiteServer{
+		authSys: authSys,
+		store:   storageSys,
+		bmSys:   bmSys,
+		domain:  strings.ToLower(strings.TrimPrefix(domain, ".")),
+	}
+}
+
+// IsWebsiteHost - checks whether host is a subdomain of the website domain.
+func IsWebsiteHost(host, domain string) bool {
+	return domain != "" && strings.HasSuffix(hostWithoutPort(host), "."+strings.ToLower(strings.TrimPrefix(domain, ".")))
+}
+
+func hostWithoutPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+func (ws *websiteServer) bucketFromHost(host string) string {
+	host = hostWithoutPort(host)
+	if ws.domain != "" && strings.HasSuffix(host, "."+ws.domain) {
+		return strings.TrimSuffix(host, "."+ws.domain)
+	}
+	return host
+}
+
+func (ws *websiteServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeWebsiteError(w, r, apierrors.ErrMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	bucket := ws.bucketFromHost(r.Host)
+	key := strings.TrimPrefix(r.URL.Path, consts.SlashSeparator)
+	log.Infof("WebsiteHandler %s %s", bucket, key)
+
+	config, err := ws.bmSys.GetWebsiteConfig(ctx, bucket)
+	if err != nil {
+		writeWebsiteError(w, r, apierrors.ToApiError(ctx, err))
+		return
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if redirectAll := config.RedirectAllRequestsTo; redirectAll != nil {
+		http.Redirect(w, r, redirectAll.Location(scheme, r.URL.RequestURI()), http.StatusMovedPermanently)
+		return
+	}
+	if rule := config.MatchRoutingRule(key, 0); rule != nil {
+		location, code := rule.Location(r.Host, scheme, key)
+		http.Redirect(w, r, location, code)
+		return
+	}
+
+	s3err := ws.serveObject(w, r, bucket, config.IndexKey(key), http.StatusOK)
+	if s3err == apierrors.ErrNone {
+		return
+	}
+	// A directory requested without its trailing slash is redirected to it,
+	// probed only when anonymous requests may read its index so that the
+	// redirect tells nothing of the objects they can't.
+	if s3err == apierrors.ErrNoSuchKey && key != "" && config.IndexKey(key) == key {
+		indexKey := config.IndexKey(key + consts.SlashSeparator)
+		if ws.authSys.CheckAnonymousAccess(ctx, r, s3action.GetObjectAction, bucket, indexKey) == apierrors.ErrNone {
+			if _, err = ws.store.GetObjectInfo(ctx, bucket, indexKey); err == nil {
+				http.Redirect(w, r, r.URL.Path+consts.SlashSeparator, http.StatusFound)
+				return
+			}
+		}
+	}
+
+	code := apierrors.GetAPIError(s3err).HTTPStatusCode
+	if rule := config.MatchRoutingRule(key, code); rule != nil {
+		location, code := rule.Location(r.Host, scheme, key)
+		http.Redirect(w, r, location, code)
+		return
+	}
+	if config.ErrorDocument != nil && (s3err == apierrors.ErrNoSuchKey || s3err == apierrors.ErrAccessDenied) {
+		if ws.serveObject(w, r, bucket, config.ErrorDocument.Key, code) == apierrors.ErrNone {
+			return
+		}
+	}
+	writeWebsiteError(w, r, s3err)
+}
+
+// serveObject writes the object with statusCode when anonymous requests may
+// read it, the response is left untouched otherwise.
+func (ws *websiteServer) serveObject(w http.ResponseWriter, r *http.Request, bucket, key string, statusCode int) apierrors.ErrorCode {
+	ctx := r.Context()
+	if key == "" {
+		return apierrors.ErrNoSuchKey
+	}
+	if s3err := ws.authSys.CheckAnonymousAccess(ctx, r, s3action.GetObjectAction, bucket, key); s3err != apierrors.ErrNone {
+		return s3err
+	}
+	objInfo, reader, err := ws.store.GetObject(ctx, bucket, key)
+	if err != nil {
+		return apierrors.ToApiError(ctx, err)
+	}
+	defer reader.Close()
+
+	response.SetObjectHeaders(w, r, objInfo)
+	w.WriteHeader(statusCode)
+	if r.Method == http.MethodHead {
+		return apierrors.ErrNone
+	}
+	if _, err = io.Copy(w, reader); err != nil {
+		log.Errorf("WebsiteHandler copy %s/%s err:%v", bucket, key, err)
+	}
+	return apierrors.ErrNone
+}
+
+// writeWebsiteError writes an error as the HTML page browsers display.
+func writeWebsiteError(w http.ResponseWriter, r *http.Request, errorCode apierrors.ErrorCode) {
+	apiError := apierrors.GetAPIError(errorCode)
+	status := strconv.Itoa(apiError.HTTPStatusCode) + " " + http.StatusText(apiError.HTTPStatusCode)
+	body := fmt.Sprintf("<html>\n<head><title>%s</title></head>\n<body>\n<h1>%s</h1>\n<ul>\n<li>Code: %s</li>\n<li>Message: %s</li>\n</ul>\n</body>\n</html>\n",
+		status, status, html.EscapeString(apiError.Code), html.EscapeString(apiError.Description))
+	w.Header().Set(consts.ContentType, "text/html; charset=utf-8")
+	w.Header().Set(consts.ContentLength, strconv.Itoa(len(body)))
+	w.WriteHeader(apiError.HTTPStatusCode)
+	if r.Method != http.MethodHead {
+		io.WriteString(w, body)
+	}
+}
@@ -3,10 +3,14 @@ package store
 import (
 	"context"
 	"encoding/xml"
-	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/yann-y/fds/internal/cors"
+	"github.com/yann-y/fds/internal/event"
+	"github.com/yann-y/fds/internal/iam/acl"
 	"github.com/yann-y/fds/internal/iam/policy"
+	"github.com/yann-y/fds/internal/kv"
 	"github.com/yann-y/fds/internal/lock"
-	"github.com/yann-y/fds/internal/uleveldb"
+	"github.com/yann-y/fds/internal/replication"
+	"github.com/yann-y/fds/internal/website"
 	"time"
 )
 
@@ -43,15 +47,76 @@ func (e BucketTaggingNotFound) Error() string {
 	return "No bucket tagging configuration found for bucket: " + e.Bucket
 }
 
+// BucketCorsNotFound - no bucket CORS configuration found.
+type BucketCorsNotFound struct {
+	Bucket string
+	Err    error
+}
+
+func (e BucketCorsNotFound) Error() string {
+	return "No bucket CORS configuration found for bucket: " + e.Bucket
+}
+
+// BucketWebsiteNotFound - no bucket website configuration found.
+type BucketWebsiteNotFound struct {
+	Bucket string
+	Err    error
+}
+
+func (e BucketWebsiteNotFound) Error() string {
+	return "No bucket website configuration found for bucket: " + e.Bucket
+}
+
+// BucketReplicationNotFound - no bucket replication configuration found.
+type BucketReplicationNotFound struct {
+	Bucket string
+	Err    error
+}
+
+func (e BucketReplicationNotFound) Error() string {
+	return "No bucket replication configuration found for bucket: " + e.Bucket
+}
+
+// BucketOwnershipControlsNotFound - no bucket ownership controls found.
+type BucketOwnershipControlsNotFound struct {
+	Bucket string
+	Err    error
+}
+
+func (e BucketOwnershipControlsNotFound) Error() string {
+	return "No bucket ownership controls found for bucket: " + e.Bucket
+}
+
+// BucketACLNotSupported - the bucket enforces object ownership, ACLs are disabled.
+type BucketACLNotSupported struct {
+	Bucket string
+	Err    error
+}
+
+func (e BucketACLNotSupported) Error() string {
+	return "ACLs are disabled for bucket: " + e.Bucket
+}
+
+// InvalidBucketACLWithObjectOwnership - ownership can not be enforced while the bucket ACL grants access to others.
+type InvalidBucketACLWithObjectOwnership struct {
+	Bucket string
+	Err    error
+}
+
+func (e InvalidBucketACLWithObjectOwnership) Error() string {
+	return "Bucket ACL grants access to others than the owner for bucket: " + e.Bucket
+}
+
 // BucketMetadataSys captures all bucket metadata for a given cluster.
 type BucketMetadataSys struct {
-	db          *uleveldb.ULevelDB
-	nsLock      *lock.NsLockMap
+	db          *kv.DB
+	nsLock      lock.Provider
 	emptyBucket func(ctx context.Context, bucket string) (bool, error)
+	cleanBucket func(ctx context.Context, bucket string) error
 }
 
 // NewBucketMetadataSys - creates new policy system.
-func NewBucketMetadataSys(db *uleveldb.ULevelDB) *BucketMetadataSys {
+func NewBucketMetadataSys(db *kv.DB) *BucketMetadataSys {
 	return &BucketMetadataSys{
 		db:     db,
 		nsLock: lock.NewNSLock(),
@@ -80,8 +145,26 @@ type BucketMetadata struct {
 	Acl     string
 	Created time.Time
 
+	// Grants set through an access control policy or grant headers, when
+	// empty the grants are those of the canned Acl.
+	Grants []acl.Grant
+	// ObjectOwnership is empty until ownership controls are set, which
+	// behaves as acl.ObjectWriter.
+	ObjectOwnership string
+
 	PolicyConfig  *policy.Policy
 	TaggingConfig *Tags
+	CorsConfig    *cors.Config
+	WebsiteConfig *website.Config
+	// NotificationConfig is nil until a non-empty configuration is set.
+	NotificationConfig *event.Config
+	ReplicationConfig  *replication.Config
+	// QuotaConfig is nil until a quota is set, the bucket is unlimited.
+	QuotaConfig *Quota
+
+	// RecordVersion is the layout the record was written with, 0 before
+	// the records were versioned.
+	RecordVersion int `msgpack:",omitempty"`
 }
 
 // NewBucketMetadata creates BucketMetadata with the supplied name and Created to Now.
@@ -97,6 +180,12 @@ func NewBucketMetadata(name, region, accessKey, acl string) *BucketMetadata {
 	}
 }
 
+// SetLockProvider - sets the provider of the bucket locks, the in-process
+// locks unless set.
+func (sys *BucketMetadataSys) SetLockProvider(provider lock.Provider) {
+	sys.nsLock = provider
+}
+
 // NewNSLock - initialize a new namespace RWLocker instance.
 func (sys *BucketMetadataSys) NewNSLock(bucket string) lock.RWLocker {
 	return sys.nsLock.NewNSLock("meta", bucket)
@@ -106,8 +195,13 @@ func (sys *BucketMetadataSys) SetEmptyBucket(emptyBucket func(ctx context.Contex
 	sys.emptyBucket = emptyBucket
 }
 
+func (sys *BucketMetadataSys) SetCleanBucket(cleanBucket func(ctx context.Context, bucket string) error) {
+	sys.cleanBucket = cleanBucket
+}
+
 // setBucketMeta - sets a new metadata in-db
 func (sys *BucketMetadataSys) setBucketMeta(bucket string, meta *BucketMetadata) error {
+	meta.RecordVersion = RecordVersion
 	return sys.db.Put(bucketPrefix+bucket, meta)
 }
 
@@ -126,7 +220,7 @@ func (sys *BucketMetadataSys) CreateBucket(ctx context.Context, bucket, region,
 
 func (sys *BucketMetadataSys) getBucketMeta(bucket string) (meta BucketMetadata, err error) {
 	err = sys.db.Get(bucketPrefix+bucket, &meta)
-	if err == leveldb.ErrNotFound {
+	if err == kv.ErrNotFound {
 		err = BucketNotFound{Bucket: bucket, Err: err}
 	}
 	return meta, err
@@ -171,7 +265,39 @@ func (sys *BucketMetadataSys) DeleteBucket(ctx context.Context, bucket string) e
 		return ErrBucketNotEmpty
 	}
 
-	return sys.db.Delete(bucketPrefix + bucket)
+	return sys.deleteBucket(ctx, bucket)
+}
+
+// deleteBucket - deletes the bucket along with its usage at once.
+func (sys *BucketMetadataSys) deleteBucket(ctx context.Context, bucket string) error {
+	return sys.db.Update(func(tx *kv.Tx) error {
+		if err := deleteUsage(ctx, sys.db, tx, bucket); err != nil {
+			return err
+		}
+		tx.Delete(bucketPrefix + bucket)
+		return nil
+	})
+}
+
+// PurgeBucket - deletes the objects and the uploads of the bucket a page at a
+// time, then the bucket at once. An interrupted purge leaves the bucket with
+// the objects it did not delete yet.
+func (sys *BucketMetadataSys) PurgeBucket(ctx context.Context, bucket string) error {
+	lk := sys.NewNSLock(bucket)
+	lkctx, err := lk.GetLock(ctx, deleteOperationTimeout)
+	if err != nil {
+		return err
+	}
+	ctx = lkctx.Context()
+	defer lk.Unlock(lkctx.Cancel)
+
+	if _, err = sys.getBucketMeta(bucket); err != nil {
+		return err
+	}
+	if err = sys.cleanBucket(ctx, bucket); err != nil {
+		return err
+	}
+	return sys.deleteBucket(ctx, bucket)
 }
 
 // GetAllBucketsOfUser metadata for all bucket.
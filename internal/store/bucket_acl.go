@@ -2,10 +2,31 @@ package store
 
 import (
 	"context"
+	"github.com/yann-y/fds/internal/iam/acl"
 	"github.com/yann-y/fds/internal/iam/policy"
 )
 
-func (sys *BucketMetadataSys) UpdateBucketAcl(ctx context.Context, bucket, acl, accessKey string) error {
+// ACL returns the grants on the bucket, given explicitly or by its canned ACL.
+func (meta BucketMetadata) ACL() acl.ACL {
+	if len(meta.Grants) > 0 {
+		return acl.ACL{Owner: meta.Owner, Grants: meta.Grants}
+	}
+	a, err := acl.Canned(meta.Acl, meta.Owner, meta.Owner)
+	if err != nil {
+		// unknown canned ACLs were stored as private
+		a, _ = acl.Canned(policy.Private, meta.Owner, meta.Owner)
+	}
+	return a
+}
+
+// ACLsEnabled - checks whether the bucket ACL and its object ACLs are evaluated.
+func (meta BucketMetadata) ACLsEnabled() bool {
+	return meta.ObjectOwnership != acl.BucketOwnerEnforced
+}
+
+// UpdateBucketAcl sets the ACL of the bucket, either a canned ACL or a list of
+// grants. The statements of the canned ACL are kept in the bucket policy.
+func (sys *BucketMetadataSys) UpdateBucketAcl(ctx context.Context, bucket, canned string, grants []acl.Grant) error {
 	lk := sys.NewNSLock(bucket)
 	lkctx, err := lk.GetLock(ctx, globalOperationTimeout)
 	if err != nil {
@@ -19,19 +40,56 @@ func (sys *BucketMetadataSys) UpdateBucketAcl(ctx context.Context, bucket, acl,
 		return err
 	}
 
-	meta.Acl = acl
-	newPolicy := policy.CreateBucketPolicy(bucket, accessKey, acl)
+	meta.Acl = canned
+	meta.Grants = grants
+	if !meta.ACLsEnabled() && !meta.ACL().IsPrivate() {
+		return BucketACLNotSupported{Bucket: bucket}
+	}
+	newPolicy := policy.CreateBucketPolicy(bucket, meta.Owner, canned)
 	meta.PolicyConfig = newPolicy
 	return sys.setBucketMeta(bucket, &meta)
 }
-func (sys *BucketMetadataSys) GetBucketAcl(ctx context.Context, bucket string) (string, error) {
+
+// GetBucketAcl returns the ACL of the bucket.
+func (sys *BucketMetadataSys) GetBucketAcl(ctx context.Context, bucket string) (acl.ACL, error) {
+	meta, err := sys.GetBucketMeta(ctx, bucket)
+	if err != nil {
+		return acl.ACL{}, err
+	}
+	return meta.ACL(), nil
+}
+
+// UpdateBucketOwnership sets the object ownership controls of the bucket, an
+// empty ownership deletes them. Ownership can only be enforced while the
+// bucket ACL is private.
+func (sys *BucketMetadataSys) UpdateBucketOwnership(ctx context.Context, bucket, ownership string) error {
+	lk := sys.NewNSLock(bucket)
+	lkctx, err := lk.GetLock(ctx, globalOperationTimeout)
+	if err != nil {
+		return err
+	}
+	ctx = lkctx.Context()
+	defer lk.Unlock(lkctx.Cancel)
+
+	meta, err := sys.getBucketMeta(bucket)
+	if err != nil {
+		return err
+	}
+	if ownership == acl.BucketOwnerEnforced && !meta.ACL().IsPrivate() {
+		return InvalidBucketACLWithObjectOwnership{Bucket: bucket}
+	}
+	meta.ObjectOwnership = ownership
+	return sys.setBucketMeta(bucket, &meta)
+}
+
+// GetBucketOwnership returns the object ownership controls of the bucket.
+func (sys *BucketMetadataSys) GetBucketOwnership(ctx context.Context, bucket string) (string, error) {
 	meta, err := sys.GetBucketMeta(ctx, bucket)
 	if err != nil {
-		switch err.(type) {
-		case BucketNotFound:
-			return "", BucketTaggingNotFound{Bucket: bucket}
-		}
 		return "", err
 	}
-	return meta.Acl, nil
+	if meta.ObjectOwnership == "" {
+		return "", BucketOwnershipControlsNotFound{Bucket: bucket}
+	}
+	return meta.ObjectOwnership, nil
 }
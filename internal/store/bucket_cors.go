@@ -0,0 +1,43 @@
+package store
+
+import (
+	"context"
+	"github.com/yann-y/fds/internal/cors"
+)
+
+// UpdateBucketCors sets the CORS configuration of the bucket, a nil
+// configuration deletes it.
+func (sys *BucketMetadataSys) UpdateBucketCors(ctx context.Context, bucket string, config *cors.Config) error {
+	lk := sys.NewNSLock(bucket)
+	lkctx, err := lk.GetLock(ctx, globalOperationTimeout)
+	if err != nil {
+		return err
+	}
+	ctx = lkctx.Context()
+	defer lk.Unlock(lkctx.Cancel)
+
+	meta, err := sys.getBucketMeta(bucket)
+	if err != nil {
+		return err
+	}
+
+	meta.CorsConfig = config
+	return sys.setBucketMeta(bucket, &meta)
+}
+
+// DeleteBucketCors deletes the CORS configuration of the bucket.
+func (sys *BucketMetadataSys) DeleteBucketCors(ctx context.Context, bucket string) error {
+	return sys.UpdateBucketCors(ctx, bucket, nil)
+}
+
+// GetCorsConfig returns the CORS configuration of the bucket.
+func (sys *BucketMetadataSys) GetCorsConfig(ctx context.Context, bucket string) (*cors.Config, error) {
+	meta, err := sys.GetBucketMeta(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if meta.CorsConfig == nil {
+		return nil, BucketCorsNotFound{Bucket: bucket}
+	}
+	return meta.CorsConfig, nil
+}
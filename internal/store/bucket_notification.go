@@ -0,0 +1,42 @@
+package store
+
+import (
+	"context"
+	"github.com/yann-y/fds/internal/event"
+)
+
+// UpdateBucketNotification sets the notification configuration of the bucket,
+// a configuration without queues deletes it.
+func (sys *BucketMetadataSys) UpdateBucketNotification(ctx context.Context, bucket string, config *event.Config) error {
+	lk := sys.NewNSLock(bucket)
+	lkctx, err := lk.GetLock(ctx, globalOperationTimeout)
+	if err != nil {
+		return err
+	}
+	ctx = lkctx.Context()
+	defer lk.Unlock(lkctx.Cancel)
+
+	meta, err := sys.getBucketMeta(bucket)
+	if err != nil {
+		return err
+	}
+
+	if config != nil && len(config.QueueList) == 0 {
+		config = nil
+	}
+	meta.NotificationConfig = config
+	return sys.setBucketMeta(bucket, &meta)
+}
+
+// GetNotificationConfig returns the notification configuration of the bucket,
+// which is empty when none is set.
+func (sys *BucketMetadataSys) GetNotificationConfig(ctx context.Context, bucket string) (*event.Config, error) {
+	meta, err := sys.GetBucketMeta(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if meta.NotificationConfig == nil {
+		return &event.Config{}, nil
+	}
+	return meta.NotificationConfig, nil
+}
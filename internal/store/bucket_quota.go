@@ -0,0 +1,36 @@
+package store
+
+import (
+	"context"
+)
+
+// UpdateBucketQuota sets the quota of the bucket, a nil quota deletes it.
+func (sys *BucketMetadataSys) UpdateBucketQuota(ctx context.Context, bucket string, quota *Quota) error {
+	lk := sys.NewNSLock(bucket)
+	lkctx, err := lk.GetLock(ctx, globalOperationTimeout)
+	if err != nil {
+		return err
+	}
+	ctx = lkctx.Context()
+	defer lk.Unlock(lkctx.Cancel)
+
+	meta, err := sys.getBucketMeta(bucket)
+	if err != nil {
+		return err
+	}
+
+	meta.QuotaConfig = quota
+	return sys.setBucketMeta(bucket, &meta)
+}
+
+// GetBucketQuota returns the quota of the bucket, unlimited unless set.
+func (sys *BucketMetadataSys) GetBucketQuota(ctx context.Context, bucket string) (Quota, error) {
+	meta, err := sys.GetBucketMeta(ctx, bucket)
+	if err != nil {
+		return Quota{}, err
+	}
+	if meta.QuotaConfig == nil {
+		return Quota{}, nil
+	}
+	return *meta.QuotaConfig, nil
+}
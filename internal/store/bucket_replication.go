@@ -0,0 +1,43 @@
+package store
+
+import (
+	"context"
+	"github.com/yann-y/fds/internal/replication"
+)
+
+// UpdateBucketReplication sets the replication configuration of the bucket,
+// a nil configuration deletes it.
+func (sys *BucketMetadataSys) UpdateBucketReplication(ctx context.Context, bucket string, config *replication.Config) error {
+	lk := sys.NewNSLock(bucket)
+	lkctx, err := lk.GetLock(ctx, globalOperationTimeout)
+	if err != nil {
+		return err
+	}
+	ctx = lkctx.Context()
+	defer lk.Unlock(lkctx.Cancel)
+
+	meta, err := sys.getBucketMeta(bucket)
+	if err != nil {
+		return err
+	}
+
+	meta.ReplicationConfig = config
+	return sys.setBucketMeta(bucket, &meta)
+}
+
+// DeleteBucketReplication deletes the replication configuration of the bucket.
+func (sys *BucketMetadataSys) DeleteBucketReplication(ctx context.Context, bucket string) error {
+	return sys.UpdateBucketReplication(ctx, bucket, nil)
+}
+
+// GetReplicationConfig returns the replication configuration of the bucket.
+func (sys *BucketMetadataSys) GetReplicationConfig(ctx context.Context, bucket string) (*replication.Config, error) {
+	meta, err := sys.GetBucketMeta(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if meta.ReplicationConfig == nil {
+		return nil, BucketReplicationNotFound{Bucket: bucket}
+	}
+	return meta.ReplicationConfig, nil
+}
@@ -2,10 +2,13 @@ package store
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/yann-y/fds/internal/iam/acl"
 	"github.com/yann-y/fds/internal/iam/policy"
 	"github.com/yann-y/fds/internal/iam/policy/condition"
 	"github.com/yann-y/fds/internal/iam/s3action"
+	"github.com/yann-y/fds/internal/kv"
 	"github.com/yann-y/fds/internal/uleveldb"
 	"testing"
 	"time"
@@ -78,3 +81,182 @@ func TestBucketMetadataSys_GetPolicyConfig(t *testing.T) {
 	}
 	fmt.Println(p)
 }
+
+func TestBucketMetadataSys_BucketAclOwnership(t *testing.T) {
+	db, err := uleveldb.OpenDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.TODO()
+	s := NewBucketMetadataSys(db)
+	if err = s.CreateBucket(ctx, "bucket", "region", "owner", policy.PublicRead); err != nil {
+		t.Fatal(err)
+	}
+	a, err := s.GetBucketAcl(ctx, "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.IsAllowed("", acl.PermissionRead) {
+		t.Errorf("Expected public-read to grant READ to anonymous users")
+	}
+	if _, err = s.GetBucketOwnership(ctx, "bucket"); !errors.As(err, &BucketOwnershipControlsNotFound{}) {
+		t.Errorf("Expected BucketOwnershipControlsNotFound, got %v", err)
+	}
+	// ACLs can only be disabled while the bucket is private
+	if err = s.UpdateBucketOwnership(ctx, "bucket", acl.BucketOwnerEnforced); !errors.As(err, &InvalidBucketACLWithObjectOwnership{}) {
+		t.Errorf("Expected InvalidBucketACLWithObjectOwnership, got %v", err)
+	}
+	if err = s.UpdateBucketAcl(ctx, "bucket", "", []acl.Grant{acl.NewUserGrant("owner", acl.PermissionFullControl)}); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.UpdateBucketOwnership(ctx, "bucket", acl.BucketOwnerEnforced); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.UpdateBucketAcl(ctx, "bucket", policy.PublicRead, nil); !errors.As(err, &BucketACLNotSupported{}) {
+		t.Errorf("Expected BucketACLNotSupported, got %v", err)
+	}
+	ownership, err := s.GetBucketOwnership(ctx, "bucket")
+	if err != nil || ownership != acl.BucketOwnerEnforced {
+		t.Errorf("Expected %s, got %s %v", acl.BucketOwnerEnforced, ownership, err)
+	}
+}
+
+func TestBucketMetadataSys_PurgeBucket(t *testing.T) {
+	db, err := uleveldb.OpenDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	storageSys := &StorageSys{Db: db}
+	s := NewBucketMetadataSys(db)
+	s.SetCleanBucket(storageSys.CleanBucket)
+	if err = s.CreateBucket(context.TODO(), "bucket", "region", "user", ""); err != nil {
+		t.Fatal(err)
+	}
+	root := "QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+	writes := map[string]interface{}{
+		getObjectKey("bucket", "a"):      ObjectInfo{Bucket: "bucket", Name: "a", Cid: root},
+		getObjectKey("bucket2", "a"):     ObjectInfo{Bucket: "bucket2", Name: "a", Cid: root},
+		getUploadKey("bucket", "b", "1"): MultipartInfo{Bucket: "bucket", Object: "b", UploadID: "1", Parts: []objectPartInfo{{Number: 1, Cid: root}}},
+	}
+	for key, value := range writes {
+		if err = db.Put(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = s.PurgeBucket(context.TODO(), "bucket"); err != nil {
+		t.Fatal(err)
+	}
+	if s.HasBucket(context.TODO(), "bucket") {
+		t.Error("Expected the bucket to be deleted")
+	}
+	var o ObjectInfo
+	if err = db.Get(getObjectKey("bucket", "a"), &o); err != kv.ErrNotFound {
+		t.Errorf("Expected the object to be deleted, but instead found %v", err)
+	}
+	if err = db.Get(getObjectKey("bucket2", "a"), &o); err != nil {
+		t.Errorf("Expected the object of another bucket to be kept, but instead found %v", err)
+	}
+	var mi MultipartInfo
+	if err = db.Get(getUploadKey("bucket", "b", "1"), &mi); err != kv.ErrNotFound {
+		t.Errorf("Expected the upload to be deleted, but instead found %v", err)
+	}
+	marks := 0
+	all, err := db.ReadAllChan(context.TODO(), allDeletePrefixFormat, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range all {
+		marks++
+	}
+	if marks != 2 {
+		t.Errorf("Expected 2 marks to delete, but instead found %d", marks)
+	}
+	if err = s.PurgeBucket(context.TODO(), "bucket"); !errors.As(err, &BucketNotFound{}) {
+		t.Errorf("Expected %v, but instead found %v", BucketNotFound{Bucket: "bucket"}, err)
+	}
+}
+
+// countingReplicator - applies the writes to the local store, and counts the
+// writes of each update.
+type countingReplicator struct {
+	store kv.Store
+	// applied is called with the writes of each update once applied
+	applied func(n int)
+}
+
+func (r *countingReplicator) Apply(ops []kv.Op) error {
+	if err := r.store.Write(kv.NewBatch(ops...)); err != nil {
+		return err
+	}
+	r.applied(len(ops))
+	return nil
+}
+
+func (r *countingReplicator) Sync(ctx context.Context) error {
+	return nil
+}
+
+func TestBucketMetadataSys_PurgeBucketPages(t *testing.T) {
+	storageSys, s, _ := newTestQuotaSys(t)
+	db := storageSys.Db
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	if err := s.CreateBucket(ctx, "bucket", "region", "user", ""); err != nil {
+		t.Fatal(err)
+	}
+	objects := 2*purgePageSize + 1
+	err := db.Update(func(tx *kv.Tx) error {
+		for i := 0; i < objects; i++ {
+			name := fmt.Sprintf("%05d", i)
+			if err := tx.Put(getObjectKey("bucket", name), ObjectInfo{Bucket: "bucket", Name: name, Cid: testCid, Size: 1}); err != nil {
+				return err
+			}
+		}
+		return tx.Put(fmt.Sprintf(usageKeyFormat, "bucket"), Usage{Bytes: int64(objects), Objects: int64(objects)})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the purge is interrupted after its first page
+	var updates []int
+	db.SetReplicator(&countingReplicator{store: db.Store(), applied: func(n int) {
+		updates = append(updates, n)
+		cancel()
+	}})
+	if err = s.PurgeBucket(ctx, "bucket"); err == nil {
+		t.Fatal("Expected the interrupted purge to fail")
+	}
+	if !s.HasBucket(context.TODO(), "bucket") {
+		t.Fatal("Expected the bucket to be kept until its objects are deleted")
+	}
+	left := int64(objects - purgePageSize)
+	if usage, err := storageSys.BucketUsage(context.TODO(), "bucket"); err != nil || usage != (Usage{Bytes: left, Objects: left}) {
+		t.Errorf("Expected the usage of the %d objects left, but instead found %+v, %v", left, usage, err)
+	}
+
+	updates = nil
+	db.SetReplicator(&countingReplicator{store: db.Store(), applied: func(n int) {
+		updates = append(updates, n)
+	}})
+	if err = s.PurgeBucket(context.TODO(), "bucket"); err != nil {
+		t.Fatal(err)
+	}
+	// a page deletes its objects, marks their data and adds its usage
+	if len(updates) != 3 {
+		t.Errorf("Expected 2 pages and the bucket deleted, but instead found the updates %v", updates)
+	}
+	for i, n := range updates {
+		if n > 2*purgePageSize+1 {
+			t.Errorf("Update %d: Expected at most %d writes, but instead found %d", i+1, 2*purgePageSize+1, n)
+		}
+	}
+	if s.HasBucket(context.TODO(), "bucket") {
+		t.Error("Expected the bucket to be deleted")
+	}
+	if n := countUsageDeltas(t, db, "bucket"); n != 0 {
+		t.Errorf("Expected the usage deleted with the bucket, but instead found %d deltas", n)
+	}
+}
@@ -0,0 +1,43 @@
+package store
+
+import (
+	"context"
+	"github.com/yann-y/fds/internal/website"
+)
+
+// UpdateBucketWebsite sets the website configuration of the bucket, a nil
+// configuration deletes it.
+func (sys *BucketMetadataSys) UpdateBucketWebsite(ctx context.Context, bucket string, config *website.Config) error {
+	lk := sys.NewNSLock(bucket)
+	lkctx, err := lk.GetLock(ctx, globalOperationTimeout)
+	if err != nil {
+		return err
+	}
+	ctx = lkctx.Context()
+	defer lk.Unlock(lkctx.Cancel)
+
+	meta, err := sys.getBucketMeta(bucket)
+	if err != nil {
+		return err
+	}
+
+	meta.WebsiteConfig = config
+	return sys.setBucketMeta(bucket, &meta)
+}
+
+// DeleteBucketWebsite deletes the website configuration of the bucket.
+func (sys *BucketMetadataSys) DeleteBucketWebsite(ctx context.Context, bucket string) error {
+	return sys.UpdateBucketWebsite(ctx, bucket, nil)
+}
+
+// GetWebsiteConfig returns the website configuration of the bucket.
+func (sys *BucketMetadataSys) GetWebsiteConfig(ctx context.Context, bucket string) (*website.Config, error) {
+	meta, err := sys.GetBucketMeta(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if meta.WebsiteConfig == nil {
+		return nil, BucketWebsiteNotFound{Bucket: bucket}
+	}
+	return meta.WebsiteConfig, nil
+}
@@ -1,7 +1,10 @@
 package store
 
 import (
+	"github.com/yann-y/fds/internal/iam/acl"
+	"github.com/yann-y/fds/internal/iam/policy"
 	"github.com/yann-y/fds/internal/utils/hash"
+	"net/http"
 	"time"
 )
 
@@ -47,6 +50,11 @@ type ObjectInfo struct {
 	// ipfs key
 	Cid string
 	Acl string
+	// Owner of the object, empty when owned by the bucket owner.
+	Owner string
+	// Grants set through an access control policy or grant headers, when
+	// empty the grants are those of the canned Acl.
+	Grants []acl.Grant
 	// Version ID of this object.
 	VersionID string
 
@@ -74,6 +82,46 @@ type ObjectInfo struct {
 
 	//  The mod time of the successor object version if any
 	SuccessorModTime time.Time
+
+	// User tags of the object as the URL encoded query of x-amz-tagging.
+	UserTags string
+
+	// ReplicationStatus of the object, returned as x-amz-replication-status.
+	ReplicationStatus string
+
+	// RecordVersion is the layout the record was written with, 0 before
+	// the records were versioned.
+	RecordVersion int `msgpack:",omitempty"`
+}
+
+// ACL returns the grants on the object, given explicitly or by its canned ACL.
+func (o ObjectInfo) ACL(bucketOwner string) acl.ACL {
+	owner := o.Owner
+	if owner == "" {
+		owner = bucketOwner
+	}
+	if len(o.Grants) > 0 {
+		return acl.ACL{Owner: owner, Grants: o.Grants}
+	}
+	a, err := acl.Canned(o.Acl, owner, bucketOwner)
+	if err != nil {
+		a, _ = acl.Canned(policy.Default, owner, bucketOwner)
+	}
+	return a
+}
+
+// grantsFromMetadata returns the grants given by the x-amz-grant-* headers
+// saved in the metadata, they were validated when the request was received.
+func grantsFromMetadata(meta map[string]string) []acl.Grant {
+	h := make(http.Header)
+	for k, v := range meta {
+		h.Set(k, v)
+	}
+	grants, err := acl.ParseGrantHeaders(h)
+	if err != nil {
+		return nil
+	}
+	return grants
 }
 
 // objectPartInfo Info of each part kept in the multipart metadata
@@ -94,6 +142,9 @@ type MultipartInfo struct {
 	MetaData  map[string]string
 	// List of individual parts, maximum size of upto 10,000
 	Parts []objectPartInfo
+	// RecordVersion is the layout the record was written with, 0 before
+	// the records were versioned.
+	RecordVersion int `msgpack:",omitempty"`
 }
 
 // putObjReader is a type that wraps sio.EncryptReader and
@@ -0,0 +1,271 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/yann-y/fds/internal/kv"
+	"github.com/yann-y/fds/internal/utils"
+	"golang.org/x/xerrors"
+	"sync"
+	"time"
+)
+
+const (
+	purgeJobPrefix = "purgeJob/"
+	// purgePageSize - the number of objects listed at once by a purge.
+	purgePageSize = 1000
+	// DefaultPurgeWorkers - the default number of objects deleted at once.
+	DefaultPurgeWorkers = 16
+)
+
+// The states of a purge job.
+const (
+	PurgeRunning = "running"
+	PurgeDone    = "done"
+	PurgeFailed  = "failed"
+)
+
+// ErrPurgeJobNotFound - the bucket was never force deleted.
+var ErrPurgeJobNotFound = errors.New("purge job not found")
+
+// PurgeJob - the progress of the force deletion of a bucket, saved as it
+// goes so that the deletion resumes after a restart.
+type PurgeJob struct {
+	Bucket string `json:"bucket"`
+	// Owner - the owner of the bucket, who reads the job once the bucket is
+	// deleted.
+	Owner   string    `json:"owner,omitempty"`
+	Status  string    `json:"status"`
+	Deleted int64     `json:"deleted"`
+	Failed  int64     `json:"failed"`
+	Error   string    `json:"error,omitempty"`
+	Started time.Time `json:"started"`
+	Updated time.Time `json:"updated"`
+}
+
+// BucketPurger - force deletes buckets along with their objects in the
+// background, deleting the objects in parallel.
+type BucketPurger struct {
+	ctx        context.Context
+	storageSys *StorageSys
+	bmSys      *BucketMetadataSys
+	workers    int
+
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+// NewBucketPurger returns the purger deleting workers objects at once, its
+// jobs stop with ctx.
+func NewBucketPurger(ctx context.Context, storageSys *StorageSys, bmSys *BucketMetadataSys, workers int) *BucketPurger {
+	return &BucketPurger{
+		ctx:        ctx,
+		storageSys: storageSys,
+		bmSys:      bmSys,
+		workers:    workers,
+		running:    make(map[string]bool),
+	}
+}
+
+func getPurgeJobKey(bucket string) string {
+	return purgeJobPrefix + bucket
+}
+
+// Start - starts the force deletion of the bucket unless it runs already, and
+// returns its job.
+func (p *BucketPurger) Start(ctx context.Context, bucket string) (PurgeJob, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running[bucket] {
+		return p.Job(ctx, bucket)
+	}
+	meta, err := p.bmSys.GetBucketMeta(ctx, bucket)
+	if err != nil {
+		return PurgeJob{}, err
+	}
+	now := time.Now().UTC()
+	job := PurgeJob{Bucket: bucket, Owner: meta.Owner, Status: PurgeRunning, Started: now, Updated: now}
+	if err = p.storageSys.Db.Put(getPurgeJobKey(bucket), job); err != nil {
+		return PurgeJob{}, err
+	}
+	p.start(job)
+	return job, nil
+}
+
+// StartUser - starts the force deletion of the buckets of the user.
+func (p *BucketPurger) StartUser(ctx context.Context, accessKey string) ([]PurgeJob, error) {
+	buckets, err := p.bmSys.GetAllBucketsOfUser(ctx, accessKey)
+	if err != nil {
+		return nil, err
+	}
+	var jobs []PurgeJob
+	for _, bucket := range buckets {
+		job, err := p.Start(ctx, bucket.Name)
+		if err != nil {
+			return jobs, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Resume - restarts the jobs a stop of the gateway interrupted, and returns
+// how many were restarted.
+func (p *BucketPurger) Resume(ctx context.Context) (int, error) {
+	jobs, err := p.Jobs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, job := range jobs {
+		if job.Status != PurgeRunning || p.running[job.Bucket] {
+			continue
+		}
+		p.start(job)
+		n++
+	}
+	return n, nil
+}
+
+// Job - returns the job of the bucket.
+func (p *BucketPurger) Job(ctx context.Context, bucket string) (PurgeJob, error) {
+	var job PurgeJob
+	err := p.storageSys.Db.Get(getPurgeJobKey(bucket), &job)
+	if err == kv.ErrNotFound {
+		err = ErrPurgeJobNotFound
+	}
+	return job, err
+}
+
+// Jobs - returns the jobs of every bucket force deleted.
+func (p *BucketPurger) Jobs(ctx context.Context) ([]PurgeJob, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	all, err := p.storageSys.Db.ReadAllChan(ctx, purgeJobPrefix, "")
+	if err != nil {
+		return nil, err
+	}
+	var jobs []PurgeJob
+	for entry := range all {
+		var job PurgeJob
+		if err = entry.UnmarshalValue(&job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// start - runs the job in the background, with p.mu held.
+func (p *BucketPurger) start(job PurgeJob) {
+	p.running[job.Bucket] = true
+	go func() {
+		p.run(job)
+		p.mu.Lock()
+		delete(p.running, job.Bucket)
+		p.mu.Unlock()
+	}()
+}
+
+func (p *BucketPurger) run(job PurgeJob) {
+	ctx := p.ctx
+	save := func() {
+		job.Updated = time.Now().UTC()
+		if err := p.storageSys.Db.Put(getPurgeJobKey(job.Bucket), job); err != nil {
+			log.Errorf("save purge job of %s err:%v", job.Bucket, err)
+		}
+	}
+	err := p.storageSys.deleteObjectsInBucket(ctx, job.Bucket, p.workers, func(deleted, failed int) {
+		job.Deleted += int64(deleted)
+		job.Failed += int64(failed)
+		save()
+	})
+	if err == nil {
+		// removes the uploads and the objects put meanwhile along with the bucket
+		err = p.bmSys.PurgeBucket(ctx, job.Bucket)
+		if errors.As(err, &BucketNotFound{}) {
+			err = nil
+		}
+	}
+	if ctx.Err() != nil {
+		// the job resumes at the next start
+		return
+	}
+	if err != nil {
+		log.Errorf("force delete bucket %s err:%v", job.Bucket, err)
+		job.Status, job.Error = PurgeFailed, err.Error()
+	} else {
+		job.Status, job.Error = PurgeDone, ""
+	}
+	save()
+}
+
+// listObjectNames - returns at most limit names of the objects of the bucket
+// after the object seek.
+func (s *StorageSys) listObjectNames(ctx context.Context, bucket, seek string, limit int) ([]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	seekKey := ""
+	if seek != "" {
+		seekKey = fmt.Sprintf(allObjectSeekKeyFormat, bucket, seek)
+	}
+	all, err := s.Db.ReadAllChan(ctx, fmt.Sprintf(allObjectPrefixFormat, bucket, ""), seekKey)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for entry := range all {
+		var o ObjectInfo
+		if err = entry.UnmarshalValue(&o); err != nil {
+			return nil, err
+		}
+		names = append(names, o.Name)
+		if len(names) == limit {
+			break
+		}
+	}
+	return names, nil
+}
+
+// deleteObjectsInBucket - deletes the objects of the bucket a page at a time,
+// with workers deletions at once, and reports the progress of each page. The
+// objects which fail to delete are skipped and the first error is returned
+// once the others are deleted.
+func (s *StorageSys) deleteObjectsInBucket(ctx context.Context, bucket string, workers int, progress func(deleted, failed int)) error {
+	var firstErr error
+	seek := ""
+	for {
+		names, err := s.listObjectNames(ctx, bucket, seek, purgePageSize)
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			return firstErr
+		}
+		deleted, failed := 0, 0
+		utils.Parallel(len(names), workers, func(i int) error {
+			err := s.DeleteObject(ctx, bucket, names[i])
+			if xerrors.Is(err, ErrObjectNotFound) {
+				return nil
+			}
+			return err
+		}, func(i int, err error) {
+			if err == nil {
+				deleted++
+				return
+			}
+			failed++
+			if firstErr == nil {
+				firstErr = fmt.Errorf("delete %s: %w", names[i], err)
+			}
+		})
+		progress(deleted, failed)
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		seek = names[len(names)-1]
+	}
+}
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"github.com/yann-y/fds/internal/lock"
+	"github.com/yann-y/fds/internal/uleveldb"
+	"testing"
+	"time"
+)
+
+func waitPurgeJob(t *testing.T, p *BucketPurger, bucket string) PurgeJob {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := p.Job(context.TODO(), bucket)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status != PurgeRunning {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Expected the purge of %s to end", bucket)
+	return PurgeJob{}
+}
+
+func TestBucketPurger(t *testing.T) {
+	db, err := uleveldb.OpenDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	storageSys := &StorageSys{Db: db, nsLock: lock.NewNSLock()}
+	bmSys := NewBucketMetadataSys(db)
+	bmSys.SetCleanBucket(storageSys.CleanBucket)
+	storageSys.SetNewBucketNSLock(bmSys.NewNSLock)
+	ctx := context.TODO()
+	p := NewBucketPurger(ctx, storageSys, bmSys, 4)
+
+	if _, err = p.Start(ctx, "missing"); err == nil {
+		t.Fatal("Expected the purge of a missing bucket to fail")
+	}
+	if _, err = p.Job(ctx, "missing"); err != ErrPurgeJobNotFound {
+		t.Fatalf("Expected %v, but instead found %v", ErrPurgeJobNotFound, err)
+	}
+
+	if err = bmSys.CreateBucket(ctx, "bucket", "region", "user", ""); err != nil {
+		t.Fatal(err)
+	}
+	root := "QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+	objects := purgePageSize*2 + 10
+	for i := 0; i < objects; i++ {
+		name := fmt.Sprintf("object%05d", i)
+		if err = db.Put(getObjectKey("bucket", name), ObjectInfo{Bucket: "bucket", Name: name, Cid: root}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// an object whose data can't be marked to delete fails to delete
+	if err = db.Put(getObjectKey("bucket", "bad"), ObjectInfo{Bucket: "bucket", Name: "bad", Cid: "bad"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = p.Start(ctx, "bucket"); err != nil {
+		t.Fatal(err)
+	}
+	job := waitPurgeJob(t, p, "bucket")
+	if job.Status != PurgeFailed || job.Deleted != int64(objects) || job.Failed != 1 || job.Error == "" {
+		t.Fatalf("Expected the purge to fail on 1 object after deleting %d, but instead found %+v", objects, job)
+	}
+	if !bmSys.HasBucket(ctx, "bucket") {
+		t.Fatal("Expected the bucket of a failed purge to be kept")
+	}
+
+	if err = db.Delete(getObjectKey("bucket", "bad")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.Start(ctx, "bucket"); err != nil {
+		t.Fatal(err)
+	}
+	if job = waitPurgeJob(t, p, "bucket"); job.Status != PurgeDone || job.Error != "" || job.Owner != "user" {
+		t.Fatalf("Expected the purge to be done, but instead found %+v", job)
+	}
+	if bmSys.HasBucket(ctx, "bucket") {
+		t.Fatal("Expected the bucket to be deleted")
+	}
+	if names, _ := storageSys.listObjectNames(ctx, "bucket", "", 1); len(names) != 0 {
+		t.Fatalf("Expected no object left, but instead found %v", names)
+	}
+
+	// a job interrupted by a stop resumes
+	if err = bmSys.CreateBucket(ctx, "stopped", "region", "user", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Put(getPurgeJobKey("stopped"), PurgeJob{Bucket: "stopped", Status: PurgeRunning}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := p.Resume(ctx); err != nil || n != 1 {
+		t.Fatalf("Expected 1 job resumed, but instead found %d, %v", n, err)
+	}
+	if job = waitPurgeJob(t, p, "stopped"); job.Status != PurgeDone {
+		t.Fatalf("Expected the resumed purge to be done, but instead found %+v", job)
+	}
+	jobs, err := p.Jobs(ctx)
+	if err != nil || len(jobs) != 2 {
+		t.Fatalf("Expected 2 jobs, but instead found %+v, %v", jobs, err)
+	}
+}
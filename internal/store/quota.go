@@ -0,0 +1,281 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"github.com/yann-y/fds/internal/kv"
+)
+
+const (
+	userQuotaPrefix = "userQuota/"
+	// ownerUsageLockVolume - the volume of the locks of the usage of the
+	// owners of the buckets, no bucket is named so.
+	ownerUsageLockVolume = ".ownerUsage"
+)
+
+// ErrInvalidQuota - a quota is negative, or its soft limit is over its hard
+// limit.
+var ErrInvalidQuota = errors.New("invalid quota")
+
+// BucketQuotaExceeded - a write would take the bucket over its hard quota.
+type BucketQuotaExceeded struct {
+	Bucket string
+}
+
+func (e BucketQuotaExceeded) Error() string {
+	return "Bucket quota exceeded for bucket: " + e.Bucket
+}
+
+// UserQuotaExceeded - a write would take the user over their hard quota.
+type UserQuotaExceeded struct {
+	User string
+}
+
+func (e UserQuotaExceeded) Error() string {
+	return "User quota exceeded for user: " + e.User
+}
+
+// Quota - the bytes a bucket or a user may hold, 0 is unlimited.
+type Quota struct {
+	// Hard - the writes which would exceed it are rejected.
+	Hard int64 `json:"hard,omitempty"`
+	// Soft - exceeding it is only logged.
+	Soft int64 `json:"soft,omitempty"`
+}
+
+// Validate - checks the limits of the quota.
+func (q Quota) Validate() error {
+	if q.Hard < 0 || q.Soft < 0 || (q.Hard > 0 && q.Soft > q.Hard) {
+		return ErrInvalidQuota
+	}
+	return nil
+}
+
+// IsZero - reports whether the quota is unlimited.
+func (q Quota) IsZero() bool {
+	return q == Quota{}
+}
+
+// exceeded - reports whether usage is over the soft and the hard limits.
+func (q Quota) exceeded(usage int64) (soft, hard bool) {
+	return q.Soft > 0 && usage > q.Soft, q.Hard > 0 && usage > q.Hard
+}
+
+// UsageReport - the usage of a bucket or of a user along with its quota.
+type UsageReport struct {
+	Bucket       string `json:"bucket,omitempty"`
+	User         string `json:"user,omitempty"`
+	Usage        Usage  `json:"usage"`
+	Quota        Quota  `json:"quota"`
+	SoftExceeded bool   `json:"softExceeded"`
+	HardExceeded bool   `json:"hardExceeded"`
+}
+
+func newUsageReport(usage Usage, quota Quota) UsageReport {
+	report := UsageReport{Usage: usage, Quota: quota}
+	report.SoftExceeded, report.HardExceeded = quota.exceeded(usage.Total())
+	return report
+}
+
+// QuotaSys - keeps the quotas of the buckets and of the users, and checks the
+// writes against them.
+type QuotaSys struct {
+	db         *kv.DB
+	storageSys *StorageSys
+	bmSys      *BucketMetadataSys
+}
+
+// NewQuotaSys returns the quota system of the buckets of bmSys, whose usage
+// is kept by storageSys. The writes of storageSys growing the usage are
+// checked against the quotas from then on.
+func NewQuotaSys(storageSys *StorageSys, bmSys *BucketMetadataSys) *QuotaSys {
+	sys := &QuotaSys{
+		db:         storageSys.Db,
+		storageSys: storageSys,
+		bmSys:      bmSys,
+	}
+	storageSys.quotaSys = sys
+	return sys
+}
+
+// SetBucketQuota - sets the quota of the bucket, an unlimited quota deletes it.
+func (sys *QuotaSys) SetBucketQuota(ctx context.Context, bucket string, quota Quota) error {
+	if err := quota.Validate(); err != nil {
+		return err
+	}
+	if quota.IsZero() {
+		return sys.bmSys.UpdateBucketQuota(ctx, bucket, nil)
+	}
+	return sys.bmSys.UpdateBucketQuota(ctx, bucket, &quota)
+}
+
+// GetBucketQuota - returns the quota of the bucket.
+func (sys *QuotaSys) GetBucketQuota(ctx context.Context, bucket string) (Quota, error) {
+	return sys.bmSys.GetBucketQuota(ctx, bucket)
+}
+
+// SetUserQuota - sets the quota of the user, an unlimited quota deletes it.
+func (sys *QuotaSys) SetUserQuota(ctx context.Context, user string, quota Quota) error {
+	if err := quota.Validate(); err != nil {
+		return err
+	}
+	if quota.IsZero() {
+		return sys.db.Delete(userQuotaPrefix + user)
+	}
+	return sys.db.Put(userQuotaPrefix+user, quota)
+}
+
+// GetUserQuota - returns the quota of the user, unlimited unless set.
+func (sys *QuotaSys) GetUserQuota(ctx context.Context, user string) (Quota, error) {
+	var quota Quota
+	if err := sys.db.Get(userQuotaPrefix+user, &quota); err != nil && err != kv.ErrNotFound {
+		return Quota{}, err
+	}
+	return quota, nil
+}
+
+// DeleteUserQuota - deletes the quota of the user.
+func (sys *QuotaSys) DeleteUserQuota(ctx context.Context, user string) error {
+	return sys.SetUserQuota(ctx, user, Quota{})
+}
+
+// BucketUsage - returns the usage of the bucket.
+func (sys *QuotaSys) BucketUsage(ctx context.Context, bucket string) (UsageReport, error) {
+	quota, err := sys.bmSys.GetBucketQuota(ctx, bucket)
+	if err != nil {
+		return UsageReport{}, err
+	}
+	usage, err := sys.storageSys.BucketUsage(ctx, bucket)
+	if err != nil {
+		return UsageReport{}, err
+	}
+	report := newUsageReport(usage, quota)
+	report.Bucket = bucket
+	return report, nil
+}
+
+// UserUsage - returns the usage of the buckets the user owns.
+func (sys *QuotaSys) UserUsage(ctx context.Context, user string) (UsageReport, error) {
+	return sys.userUsage(ctx, user, sys.storageSys.BucketUsage)
+}
+
+// RecomputeBucketUsage - counts the usage of the bucket from its objects and
+// its uploads again.
+func (sys *QuotaSys) RecomputeBucketUsage(ctx context.Context, bucket string) (UsageReport, error) {
+	quota, err := sys.bmSys.GetBucketQuota(ctx, bucket)
+	if err != nil {
+		return UsageReport{}, err
+	}
+	usage, err := sys.storageSys.RecomputeUsage(ctx, bucket)
+	if err != nil {
+		return UsageReport{}, err
+	}
+	report := newUsageReport(usage, quota)
+	report.Bucket = bucket
+	return report, nil
+}
+
+// RecomputeUserUsage - counts the usage of the buckets the user owns from
+// their objects and their uploads again.
+func (sys *QuotaSys) RecomputeUserUsage(ctx context.Context, user string) (UsageReport, error) {
+	return sys.userUsage(ctx, user, sys.storageSys.RecomputeUsage)
+}
+
+func (sys *QuotaSys) userUsage(ctx context.Context, user string, bucketUsage func(ctx context.Context, bucket string) (Usage, error)) (UsageReport, error) {
+	quota, err := sys.GetUserQuota(ctx, user)
+	if err != nil {
+		return UsageReport{}, err
+	}
+	buckets, err := sys.bmSys.GetAllBucketsOfUser(ctx, user)
+	if err != nil {
+		return UsageReport{}, err
+	}
+	var usage Usage
+	for _, bucket := range buckets {
+		u, err := bucketUsage(ctx, bucket.Name)
+		// the bucket was deleted meanwhile
+		if _, ok := err.(BucketNotFound); ok {
+			continue
+		}
+		if err != nil {
+			return UsageReport{}, err
+		}
+		usage.add(u)
+	}
+	report := newUsageReport(usage, quota)
+	report.User = user
+	return report, nil
+}
+
+// CheckQuota - checks that writing size bytes to the bucket keeps the bucket
+// and its owner within their hard quotas, going over a soft quota is logged.
+// The handlers check a write before its data is stored, and the write is
+// checked again as it is saved.
+func (sys *QuotaSys) CheckQuota(ctx context.Context, bucket string, size int64) error {
+	meta, err := sys.bmSys.GetBucketMeta(ctx, bucket)
+	if err != nil {
+		return err
+	}
+	if meta.QuotaConfig != nil {
+		usage, err := sys.storageSys.BucketUsage(ctx, bucket)
+		if err != nil {
+			return err
+		}
+		soft, hard := meta.QuotaConfig.exceeded(usage.Total() + size)
+		if hard {
+			return BucketQuotaExceeded{Bucket: bucket}
+		}
+		if soft {
+			log.Warnw("bucket soft quota exceeded", "bucket", bucket, "usage", usage.Total(), "size", size, "soft", meta.QuotaConfig.Soft)
+		}
+	}
+
+	quota, err := sys.GetUserQuota(ctx, meta.Owner)
+	if err != nil || quota.IsZero() {
+		return err
+	}
+	report, err := sys.UserUsage(ctx, meta.Owner)
+	if err != nil {
+		return err
+	}
+	soft, hard := quota.exceeded(report.Usage.Total() + size)
+	if hard {
+		return UserQuotaExceeded{User: meta.Owner}
+	}
+	if soft {
+		log.Warnw("user soft quota exceeded", "user", meta.Owner, "usage", report.Usage.Total(), "size", size, "soft", quota.Soft)
+	}
+	return nil
+}
+
+// checkWrite - runs write, which grows the usage of the bucket by size, once
+// checked against the quotas. The writes to the buckets of an owner with a
+// quota are checked and run one at a time under the usage lock of the owner,
+// so that concurrent writes can't all pass the check and exceed a hard quota
+// together.
+func (sys *QuotaSys) checkWrite(ctx context.Context, bucket string, size int64, write func() error) error {
+	meta, err := sys.bmSys.GetBucketMeta(ctx, bucket)
+	if err != nil {
+		return err
+	}
+	quota, err := sys.GetUserQuota(ctx, meta.Owner)
+	if err != nil {
+		return err
+	}
+	if meta.QuotaConfig == nil && quota.IsZero() {
+		return write()
+	}
+
+	lk := sys.storageSys.nsLock.NewNSLock(ownerUsageLockVolume, meta.Owner)
+	lkctx, err := lk.GetLock(ctx, globalOperationTimeout)
+	if err != nil {
+		return err
+	}
+	ctx = lkctx.Context()
+	defer lk.Unlock(lkctx.Cancel)
+
+	if err = sys.CheckQuota(ctx, bucket, size); err != nil {
+		return err
+	}
+	return write()
+}
@@ -0,0 +1,210 @@
+package store
+
+import (
+	"context"
+	"github.com/yann-y/fds/internal/kv"
+	"testing"
+)
+
+func TestQuota_Validate(t *testing.T) {
+	testCases := []struct {
+		quota Quota
+		valid bool
+	}{
+		// Test case - 1.
+		// unlimited.
+		{quota: Quota{}, valid: true},
+		// Test case - 2.
+		{quota: Quota{Hard: 100, Soft: 50}, valid: true},
+		// Test case - 3.
+		// a soft limit alone.
+		{quota: Quota{Soft: 50}, valid: true},
+		// Test case - 4.
+		{quota: Quota{Hard: 100, Soft: 100}, valid: true},
+		// Test case - 5.
+		// the soft limit over the hard limit.
+		{quota: Quota{Hard: 50, Soft: 100}, valid: false},
+		// Test case - 6.
+		{quota: Quota{Hard: -1}, valid: false},
+		// Test case - 7.
+		{quota: Quota{Soft: -1}, valid: false},
+	}
+	for i, testCase := range testCases {
+		if err := testCase.quota.Validate(); (err == nil) != testCase.valid {
+			t.Errorf("Test %d: Expected valid %v, but instead found %v", i+1, testCase.valid, err)
+		}
+	}
+}
+
+func TestQuotaSys_CheckQuota(t *testing.T) {
+	s, bmSys, quotaSys := newTestQuotaSys(t)
+	ctx := context.TODO()
+	for _, bucket := range []string{"bucket1", "bucket2"} {
+		if err := bmSys.CreateBucket(ctx, bucket, "region", "user", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.putObjectInfo(ctx, ObjectInfo{Bucket: "bucket1", Name: "object", Cid: testCid, Size: 40}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.putObjectInfo(ctx, ObjectInfo{Bucket: "bucket2", Name: "object", Cid: testCid, Size: 30}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := quotaSys.SetBucketQuota(ctx, "bucket1", Quota{Hard: 50, Soft: 100}); err != ErrInvalidQuota {
+		t.Fatalf("Expected %v, but instead found %v", ErrInvalidQuota, err)
+	}
+	if err := quotaSys.SetBucketQuota(ctx, "missing", Quota{Hard: 50}); err == nil {
+		t.Fatal("Expected the quota of a missing bucket to fail")
+	}
+	if err := quotaSys.SetBucketQuota(ctx, "bucket1", Quota{Hard: 50, Soft: 45}); err != nil {
+		t.Fatal(err)
+	}
+	if err := quotaSys.SetUserQuota(ctx, "user", Quota{Hard: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		bucket   string
+		size     int64
+		expected error
+	}{
+		// Test case - 1.
+		// within the soft quota of the bucket.
+		{bucket: "bucket1", size: 5, expected: nil},
+		// Test case - 2.
+		// over the soft quota of the bucket, which is only logged.
+		{bucket: "bucket1", size: 10, expected: nil},
+		// Test case - 3.
+		// over the hard quota of the bucket.
+		{bucket: "bucket1", size: 11, expected: BucketQuotaExceeded{Bucket: "bucket1"}},
+		// Test case - 4.
+		// within the quota of the user.
+		{bucket: "bucket2", size: 30, expected: nil},
+		// Test case - 5.
+		// over the quota of the user along with bucket1.
+		{bucket: "bucket2", size: 31, expected: UserQuotaExceeded{User: "user"}},
+		// Test case - 6.
+		{bucket: "missing", size: 1, expected: BucketNotFound{Bucket: "missing"}},
+	}
+	for i, testCase := range testCases {
+		err := quotaSys.CheckQuota(ctx, testCase.bucket, testCase.size)
+		if testCase.expected == nil && err != nil {
+			t.Errorf("Test %d: Expected no error, but instead found %v", i+1, err)
+		}
+		if testCase.expected != nil && (err == nil || err.Error() != testCase.expected.Error()) {
+			t.Errorf("Test %d: Expected %v, but instead found %v", i+1, testCase.expected, err)
+		}
+	}
+
+	report, err := quotaSys.UserUsage(ctx, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Usage != (Usage{Bytes: 70, Objects: 2}) || report.Quota != (Quota{Hard: 100}) || report.HardExceeded {
+		t.Errorf("Expected the usage of both buckets, but instead found %+v", report)
+	}
+	if report, err = quotaSys.BucketUsage(ctx, "bucket1"); err != nil || report.Usage.Bytes != 40 || report.SoftExceeded {
+		t.Errorf("Expected the usage of bucket1, but instead found %+v, %v", report, err)
+	}
+	if report, err = quotaSys.RecomputeUserUsage(ctx, "user"); err != nil || report.Usage.Bytes != 70 {
+		t.Errorf("Expected the recomputed usage of both buckets, but instead found %+v, %v", report, err)
+	}
+
+	// an unlimited quota deletes it
+	if err = quotaSys.SetBucketQuota(ctx, "bucket1", Quota{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = quotaSys.DeleteUserQuota(ctx, "user"); err != nil {
+		t.Fatal(err)
+	}
+	if err = quotaSys.CheckQuota(ctx, "bucket1", 1000); err != nil {
+		t.Errorf("Expected no quota, but instead found %v", err)
+	}
+	if quota, err := quotaSys.GetUserQuota(ctx, "user"); err != nil || !quota.IsZero() {
+		t.Errorf("Expected no user quota, but instead found %+v, %v", quota, err)
+	}
+}
+
+func TestQuotaSys_checkWrite(t *testing.T) {
+	s, bmSys, quotaSys := newTestQuotaSys(t)
+	ctx := context.TODO()
+	for _, bucket := range []string{"bucket1", "bucket2"} {
+		if err := bmSys.CreateBucket(ctx, bucket, "region", "user", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := quotaSys.SetBucketQuota(ctx, "bucket1", Quota{Hard: 50}); err != nil {
+		t.Fatal(err)
+	}
+	if err := quotaSys.SetUserQuota(ctx, "user", Quota{Hard: 80}); err != nil {
+		t.Fatal(err)
+	}
+	// the writes were checked by the handlers against the usage of none of
+	// them, and are checked again as they are saved
+	for _, size := range []int64{30, 30} {
+		if err := quotaSys.CheckQuota(ctx, "bucket1", size); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		write    func() error
+		expected error
+	}{
+		// Test case - 1.
+		{
+			write: func() error {
+				return s.putObjectInfo(ctx, ObjectInfo{Bucket: "bucket1", Name: "a", Cid: testCid, Size: 30})
+			},
+			expected: nil,
+		},
+		// Test case - 2.
+		// over the hard quota of the bucket along with the first write.
+		{
+			write: func() error {
+				return s.putObjectInfo(ctx, ObjectInfo{Bucket: "bucket1", Name: "b", Cid: testCid, Size: 30})
+			},
+			expected: BucketQuotaExceeded{Bucket: "bucket1"},
+		},
+		// Test case - 3.
+		// the object replaced by a bigger one within the quota.
+		{
+			write: func() error {
+				return s.putObjectInfo(ctx, ObjectInfo{Bucket: "bucket1", Name: "a", Cid: testCid, Size: 50})
+			},
+			expected: nil,
+		},
+		// Test case - 4.
+		// the parts of an upload over the quota of the user.
+		{
+			write: func() error {
+				return s.updateUsage(ctx, "bucket2", Usage{MultipartBytes: 31}, func(tx *kv.Tx) error { return nil })
+			},
+			expected: UserQuotaExceeded{User: "user"},
+		},
+		// Test case - 5.
+		// a write shrinking the usage is never checked.
+		{
+			write: func() error {
+				return s.DeleteObject(ctx, "bucket1", "a")
+			},
+			expected: nil,
+		},
+	}
+	for i, testCase := range testCases {
+		err := testCase.write()
+		if testCase.expected == nil && err != nil {
+			t.Errorf("Test %d: Expected no error, but instead found %v", i+1, err)
+		}
+		if testCase.expected != nil && (err == nil || err.Error() != testCase.expected.Error()) {
+			t.Errorf("Test %d: Expected %v, but instead found %v", i+1, testCase.expected, err)
+		}
+	}
+	if usage, err := s.BucketUsage(ctx, "bucket1"); err != nil || usage != (Usage{}) {
+		t.Errorf("Expected the rejected writes to leave no usage, but instead found %+v, %v", usage, err)
+	}
+	if _, err := s.getObjectInfo(ctx, "bucket1", "b"); err == nil {
+		t.Error("Expected the rejected object not to be saved")
+	}
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"github.com/yann-y/fds/internal/kv"
+)
+
+// RecordVersion - the layout of the object, upload and bucket records written
+// by this version. The records of every version are read alike, msgpack
+// leaves empty the fields a record lacks and skips those it doesn't know, so
+// that the gateways of a rolling upgrade share the records.
+const RecordVersion = 1
+
+// UpgradeRecords - rewrites in tx the object, upload and bucket records
+// written with a layout older than RecordVersion, from the key after cursor
+// until tx holds limit writes. It returns the key of the last record read, or
+// "" once every record is read.
+func UpgradeRecords(ctx context.Context, db *kv.DB, tx *kv.Tx, cursor string, limit int) (string, error) {
+	// in the order of their keys, which the cursor follows
+	upgrades := []recordUpgrade{
+		{prefix: bucketPrefix, newRecord: func() interface{} { return &BucketMetadata{} }, upgrade: func(v interface{}) bool {
+			meta := v.(*BucketMetadata)
+			if meta.RecordVersion >= RecordVersion {
+				return false
+			}
+			meta.RecordVersion = RecordVersion
+			return true
+		}},
+		{prefix: allObjectsPrefix, newRecord: func() interface{} { return &ObjectInfo{} }, upgrade: func(v interface{}) bool {
+			oi := v.(*ObjectInfo)
+			if oi.RecordVersion >= RecordVersion {
+				return false
+			}
+			oi.RecordVersion = RecordVersion
+			return true
+		}},
+		{prefix: allUploadsPrefix, newRecord: func() interface{} { return &MultipartInfo{} }, upgrade: func(v interface{}) bool {
+			mi := v.(*MultipartInfo)
+			if mi.RecordVersion >= RecordVersion {
+				return false
+			}
+			mi.RecordVersion = RecordVersion
+			return true
+		}},
+	}
+	for _, u := range upgrades {
+		next, err := upgradeRecords(ctx, db, tx, u, cursor, limit)
+		if err != nil || next != "" {
+			return next, err
+		}
+	}
+	return "", nil
+}
+
+// recordUpgrade - the upgrade of the records under prefix.
+type recordUpgrade struct {
+	prefix    string
+	newRecord func() interface{}
+	// upgrade reports whether it changed the record
+	upgrade func(v interface{}) bool
+}
+
+// upgradeRecords - puts in tx the records under the prefix of u after cursor
+// which u changes, until tx holds limit writes. It returns the key of the last
+// record read, or "" once every record is read.
+func upgradeRecords(ctx context.Context, db *kv.DB, tx *kv.Tx, u recordUpgrade, cursor string, limit int) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	all, err := db.ReadAllChan(ctx, u.prefix, cursor)
+	if err != nil {
+		return "", err
+	}
+	for entry := range all {
+		v := u.newRecord()
+		if err = entry.UnmarshalValue(v); err != nil {
+			return "", err
+		}
+		if u.upgrade(v) {
+			if err = tx.Put(entry.Key, v); err != nil {
+				return "", err
+			}
+		}
+		if tx.Len() >= limit {
+			return entry.Key, nil
+		}
+	}
+	return "", ctx.Err()
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"github.com/yann-y/fds/internal/datatypes"
+	"github.com/yann-y/fds/internal/kv"
+	"sort"
+)
+
+// Recover - repairs the metadata left inconsistent by a crash of a previous
+// version, whose multi-key writes were not atomic, and returns the number of
+// repairs. It runs before the requests are served:
+//   - an upload which was completed but not removed is removed,
+//   - a mark to delete the data of a live object or upload is removed, the
+//     object was not saved after the data it replaced was marked, or it has
+//     the same data. An upload aborted but not removed keeps its parts, it
+//     can be aborted again.
+func (s *StorageSys) Recover(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the keys of the marks to delete of every cid
+	marks := make(map[string][]string)
+	all, err := s.Db.ReadAllChan(ctx, allDeletePrefixFormat, "")
+	if err != nil {
+		return 0, err
+	}
+	for entry := range all {
+		var root string
+		if err = entry.UnmarshalValue(&root); err != nil {
+			return 0, err
+		}
+		marks[root] = append(marks[root], entry.Key)
+	}
+
+	live := make(map[string]bool)
+	all, err = s.Db.ReadAllChan(ctx, allObjectsPrefix, "")
+	if err != nil {
+		return 0, err
+	}
+	for entry := range all {
+		var o ObjectInfo
+		if err = entry.UnmarshalValue(&o); err != nil {
+			return 0, err
+		}
+		live[o.Cid] = true
+	}
+
+	n := 0
+	err = s.Db.Update(func(tx *kv.Tx) error {
+		all, err := s.Db.ReadAllChan(ctx, allUploadsPrefix, "")
+		if err != nil {
+			return err
+		}
+		for entry := range all {
+			var mi MultipartInfo
+			if err = entry.UnmarshalValue(&mi); err != nil {
+				return err
+			}
+			// the parts of a completed upload are linked by its object
+			for _, part := range mi.Parts {
+				live[part.Cid] = true
+			}
+			if s.isCompletedUpload(tx, mi) {
+				log.Infow("remove completed upload", "bucket", mi.Bucket, "object", mi.Object, "uploadID", mi.UploadID)
+				tx.Delete(entry.Key)
+				if err = addUsage(tx, mi.Bucket, Usage{MultipartBytes: -mi.partsSize()}); err != nil {
+					return err
+				}
+				n++
+			}
+		}
+
+		for root, keys := range marks {
+			if !live[root] {
+				continue
+			}
+			log.Infow("unmark live data to delete", "cid", root)
+			for _, key := range keys {
+				tx.Delete(key)
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// isCompletedUpload - reports whether the object of the upload was completed
+// from all its parts, the upload began before the object was saved and the
+// ETag of the object is that of the parts.
+func (s *StorageSys) isCompletedUpload(tx *kv.Tx, mi MultipartInfo) bool {
+	var o ObjectInfo
+	if err := tx.Get(getObjectKey(mi.Bucket, mi.Object), &o); err != nil || len(mi.Parts) == 0 {
+		return false
+	}
+	if o.ModTime.Before(mi.Initiated) {
+		return false
+	}
+	// the last upload of a part number replaces the previous ones
+	latest := make(map[int]string)
+	for _, part := range mi.Parts {
+		latest[part.Number] = part.ETag
+	}
+	parts := make([]datatypes.CompletePart, 0, len(latest))
+	for number, etag := range latest {
+		parts = append(parts, datatypes.CompletePart{PartNumber: number, ETag: etag})
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].PartNumber < parts[j].PartNumber
+	})
+	return o.ETag == ComputeCompleteMultipartMD5(parts)
+}
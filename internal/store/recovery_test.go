@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"github.com/yann-y/fds/internal/datatypes"
+	"github.com/yann-y/fds/internal/kv"
+	"github.com/yann-y/fds/internal/uleveldb"
+	"testing"
+	"time"
+)
+
+func TestStorageSys_Recover(t *testing.T) {
+	db, err := uleveldb.OpenDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s := &StorageSys{Db: db}
+
+	initiated := time.Now().UTC().Add(-time.Hour)
+	parts := []objectPartInfo{{Number: 1, ETag: "a", Cid: "part1"}, {Number: 2, ETag: "b", Cid: "part2"}}
+	completed := MultipartInfo{Bucket: "bucket", Object: "completed", UploadID: "1", Initiated: initiated, Parts: parts}
+	pending := MultipartInfo{Bucket: "bucket", Object: "pending", UploadID: "2", Initiated: initiated,
+		Parts: []objectPartInfo{{Number: 1, ETag: "c", Cid: "part3"}}}
+	writes := map[string]interface{}{
+		getObjectKey("bucket", "object"): ObjectInfo{Bucket: "bucket", Name: "object", Cid: "live"},
+		getObjectKey("bucket", "completed"): ObjectInfo{Bucket: "bucket", Name: "completed", Cid: "root",
+			ModTime: time.Now().UTC(),
+			ETag:    ComputeCompleteMultipartMD5([]datatypes.CompletePart{{PartNumber: 1, ETag: "a"}, {PartNumber: 2, ETag: "b"}})},
+		getObjectKey("bucket", "pending"):        ObjectInfo{Bucket: "bucket", Name: "pending", Cid: "other", ModTime: time.Now().UTC()},
+		getUploadKey("bucket", "completed", "1"): completed,
+		getUploadKey("bucket", "pending", "2"):   pending,
+		"delObj/1":                               "live",
+		"delObj/2":                               "dead",
+		"delObj/3":                               "part3",
+		"delObj/4":                               "part1",
+		"delObj/5":                               "live",
+	}
+	for key, value := range writes {
+		if err = db.Put(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := s.Recover(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("Expected 4 repairs, but instead found %d", n)
+	}
+	testCases := []struct {
+		key    string
+		exists bool
+	}{
+		{getUploadKey("bucket", "completed", "1"), false},
+		{getUploadKey("bucket", "pending", "2"), true},
+		{"delObj/1", false},
+		{"delObj/2", true},
+		{"delObj/3", false},
+		{"delObj/4", false},
+		{"delObj/5", false},
+		{getObjectKey("bucket", "object"), true},
+	}
+	for i, testCase := range testCases {
+		var v interface{}
+		err = db.Get(testCase.key, &v)
+		if exists := err != kv.ErrNotFound; exists != testCase.exists {
+			t.Errorf("Test %d: Expected %q to exist: %v, but instead found %v", i+1, testCase.key, testCase.exists, exists)
+		}
+	}
+
+	if n, err = s.Recover(context.TODO()); err != nil || n != 0 {
+		t.Errorf("Expected a second recovery to repair nothing, but instead found %d, %v", n, err)
+	}
+}
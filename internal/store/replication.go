@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"github.com/yann-y/fds/internal/replication"
+	"golang.org/x/xerrors"
+	"io"
+)
+
+// ReplicationInfo returns the attributes of the object replicated.
+func (o ObjectInfo) ReplicationInfo() replication.ObjectInfo {
+	return replication.ObjectInfo{
+		Bucket:            o.Bucket,
+		Name:              o.Name,
+		Size:              o.Size,
+		ETag:              o.ETag,
+		ContentType:       o.ContentType,
+		ContentEncoding:   o.ContentEncoding,
+		UserTags:          o.UserTags,
+		ReplicationStatus: replication.StatusType(o.ReplicationStatus),
+	}
+}
+
+// GetReplicationObject returns the object to replicate.
+func (s *StorageSys) GetReplicationObject(ctx context.Context, bucket, object string) (replication.ObjectInfo, io.ReadCloser, error) {
+	objInfo, reader, err := s.GetObject(ctx, bucket, object)
+	if xerrors.Is(err, ErrObjectNotFound) {
+		return replication.ObjectInfo{}, nil, replication.ErrObjectNotFound
+	}
+	if err != nil {
+		return replication.ObjectInfo{}, nil, err
+	}
+	return objInfo.ReplicationInfo(), reader, nil
+}
+
+// SetReplicationStatus sets the replication status of the object, unless
+// it was overwritten since etag.
+func (s *StorageSys) SetReplicationStatus(ctx context.Context, bucket, object, etag string, status replication.StatusType) error {
+	lk := s.NewNSLock(bucket, object)
+	lkctx, err := lk.GetLock(ctx, globalOperationTimeout)
+	if err != nil {
+		return err
+	}
+	ctx = lkctx.Context()
+	defer lk.Unlock(lkctx.Cancel)
+
+	objInfo, err := s.getObjectInfo(ctx, bucket, object)
+	if xerrors.Is(err, ErrObjectNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if objInfo.ETag != etag {
+		return nil
+	}
+	objInfo.ReplicationStatus = string(status)
+	objInfo.RecordVersion = RecordVersion
+	return s.Db.Put(getObjectKey(bucket, object), objInfo)
+}
+
+// WalkReplicationObjects calls fn for every object of the bucket.
+func (s *StorageSys) WalkReplicationObjects(ctx context.Context, bucket string, fn func(replication.ObjectInfo) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	all, err := s.Db.ReadAllChan(ctx, fmt.Sprintf(allObjectPrefixFormat, bucket, ""), "")
+	if err != nil {
+		return err
+	}
+	for entry := range all {
+		var o ObjectInfo
+		if err = entry.UnmarshalValue(&o); err != nil {
+			return err
+		}
+		if err = fn(o.ReplicationInfo()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -8,18 +8,19 @@ import (
 	"github.com/dustin/go-humanize"
 	dagpoolcli "github.com/filedag-project/filedag-storage/dag/pool/client"
 	"github.com/google/uuid"
+	"github.com/ipfs/boxo/coreiface/path"
 	"github.com/ipfs/go-cid"
 	ipld "github.com/ipfs/go-ipld-format"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/ipfs/go-merkledag"
 	"github.com/shirou/gopsutil/cpu"
 	"github.com/shirou/gopsutil/mem"
-	"github.com/syndtr/goleveldb/leveldb"
 	dagpool "github.com/yann-y/fds/dag/pool/ipfs"
 	"github.com/yann-y/fds/internal/consts"
 	"github.com/yann-y/fds/internal/datatypes"
+	"github.com/yann-y/fds/internal/kv"
 	"github.com/yann-y/fds/internal/lock"
-	"github.com/yann-y/fds/internal/uleveldb"
+	"github.com/yann-y/fds/internal/metrics"
 	"github.com/yann-y/fds/internal/utils"
 	"github.com/yann-y/fds/internal/utils/hash"
 	"github.com/yann-y/fds/pkg/etag"
@@ -29,6 +30,7 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -43,10 +45,12 @@ const (
 	objectKeyFormat        = "obj/%s/%s"
 	allObjectPrefixFormat  = "obj/%s/%s"
 	allObjectSeekKeyFormat = "obj/%s/%s"
+	allObjectsPrefix       = "obj/"
 
 	uploadKeyFormat        = "uploadObj/%s/%s/%s"
 	allUploadPrefixFormat  = "uploadObj/%s/%s"
 	allUploadSeekKeyFormat = "uploadObj/%s/%s/%s"
+	allUploadsPrefix       = "uploadObj/"
 
 	deleteKeyFormat       = "delObj/%s"
 	allDeletePrefixFormat = "delObj/"
@@ -63,26 +67,42 @@ var ErrBucketNotEmpty = errors.New("bucket not empty")
 
 // StorageSys store sys
 type StorageSys struct {
-	Db              *uleveldb.ULevelDB
-	DagPool         ipld.DAGService
-	Pool            *dagpool.PoolClient
-	CidBuilder      cid.Builder
-	nsLock          *lock.NsLockMap
+	Db         *kv.DB
+	DagPool    ipld.DAGService
+	Pool       *dagpool.PoolClient
+	CidBuilder cid.Builder
+	// objects stores the data of the objects, that of Pool
+	objects         objectStore
+	nsLock          lock.Provider
 	newBucketNSLock func(bucket string) lock.RWLocker
 	hasBucket       func(ctx context.Context, bucket string) bool
+	// quotaSys checks the writes growing the usage, none unless set
+	quotaSys *QuotaSys
+
+	usageMu sync.Mutex
+	// usageDeltas - the deltas added to the usage of the buckets since they
+	// were last folded
+	usageDeltas map[string]int
 
 	gcPeriod  time.Duration
 	gcTimeout time.Duration
 }
 
+// objectStore - adds and reads the data of the objects by their root cid.
+type objectStore interface {
+	Add(ctx context.Context, reader io.ReadCloser) (path.Resolved, error)
+	Get(ctx context.Context, root string) (io.ReadCloser, error)
+}
+
 // NewStorageSys new a storage sys
-func NewStorageSys(ctx context.Context, pool *dagpool.PoolClient, db *uleveldb.ULevelDB) *StorageSys {
+func NewStorageSys(ctx context.Context, pool *dagpool.PoolClient, db *kv.DB) *StorageSys {
 	cidBuilder, _ := merkledag.PrefixForCidVersion(0)
 	s := &StorageSys{
 		Db:         db,
 		DagPool:    merkledag.NewDAGService(dagpool.NewBlockService(pool.Block())),
 		Pool:       pool,
 		CidBuilder: cidBuilder,
+		objects:    pool.Store(),
 		nsLock:     lock.NewNSLock(),
 		gcPeriod:   15 * time.Minute,
 		gcTimeout:  30 * time.Minute,
@@ -110,6 +130,12 @@ func (s *StorageSys) NewNSLock(bucket string, objects ...string) lock.RWLocker {
 	return s.nsLock.NewNSLock(bucket, objects...)
 }
 
+// SetLockProvider - sets the provider of the object locks, the in-process
+// locks unless set.
+func (s *StorageSys) SetLockProvider(provider lock.Provider) {
+	s.nsLock = provider
+}
+
 func (s *StorageSys) SetNewBucketNSLock(newBucketNSLock func(bucket string) lock.RWLocker) {
 	s.newBucketNSLock = newBucketNSLock
 }
@@ -119,24 +145,100 @@ func (s *StorageSys) SetHasBucket(hasBucket func(ctx context.Context, bucket str
 }
 
 func (s *StorageSys) store(ctx context.Context, reader io.ReadCloser, size int64) (cid.Cid, error) {
-	node, err := s.Pool.Store().Add(ctx, reader)
+	node, err := s.objects.Add(ctx, reader)
 	if err != nil {
 		return cid.Undef, err
 	}
 	return node.Cid(), nil
 }
 
-func (s *StorageSys) checkAndDeleteObjectData(ctx context.Context, bucket, object string) {
-	if oldObjInfo, err := s.getObjectInfo(ctx, bucket, object); err == nil {
-		c, err := cid.Decode(oldObjInfo.Cid)
-		if err != nil {
-			log.Warnw("decode cid error", "cid", oldObjInfo.ETag)
-		} else {
-			if err = s.markObjetToDelete(c); err != nil {
-				log.Errorw("mark Objet to delete error", "bucket", bucket, "object", object, "cid", oldObjInfo.ETag, "error", err)
+// discardStored - marks the data stored by a write to delete when the write
+// fails before it is saved, e.g. when it is cancelled at shutdown. The data
+// is content addressed, it is kept when an object or an upload part has it.
+func (s *StorageSys) discardStored(root cid.Cid) {
+	// the context of the write may be cancelled
+	ctx := context.Background()
+	err := s.Db.Update(func(tx *kv.Tx) error {
+		referenced, err := s.isCidReferenced(ctx, root.String())
+		if err != nil || referenced {
+			return err
+		}
+		return s.markObjetToDelete(tx, root)
+	})
+	if err != nil {
+		log.Errorw("mark discarded data to delete error", "cid", root.String(), "error", err)
+	}
+}
+
+// isCidReferenced - reports whether an object or an upload part has the data
+// of root.
+func (s *StorageSys) isCidReferenced(ctx context.Context, root string) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	all, err := s.Db.ReadAllChan(ctx, allObjectsPrefix, "")
+	if err != nil {
+		return false, err
+	}
+	for entry := range all {
+		var o ObjectInfo
+		if err = entry.UnmarshalValue(&o); err != nil {
+			return false, err
+		}
+		if o.Cid == root {
+			return true, nil
+		}
+	}
+	all, err = s.Db.ReadAllChan(ctx, allUploadsPrefix, "")
+	if err != nil {
+		return false, err
+	}
+	for entry := range all {
+		var mi MultipartInfo
+		if err = entry.UnmarshalValue(&mi); err != nil {
+			return false, err
+		}
+		for _, part := range mi.Parts {
+			if part.Cid == root {
+				return true, nil
 			}
 		}
 	}
+	return false, nil
+}
+
+// checkAndDeleteObjectData - marks the data of the object replaced by newCid
+// to delete in tx, unless the new object shares it.
+func (s *StorageSys) checkAndDeleteObjectData(tx *kv.Tx, bucket, object, newCid string) error {
+	var oldObjInfo ObjectInfo
+	if err := tx.Get(getObjectKey(bucket, object), &oldObjInfo); err != nil || oldObjInfo.Cid == newCid {
+		return nil
+	}
+	return s.markCidToDelete(tx, oldObjInfo.Cid)
+}
+
+// replaceObjectUsage - returns the change of the usage of the bucket when
+// the object, whose lock is held, is replaced by one of size.
+func (s *StorageSys) replaceObjectUsage(bucket, object string, size int64) Usage {
+	var oldObjInfo ObjectInfo
+	if err := s.Db.Get(getObjectKey(bucket, object), &oldObjInfo); err != nil {
+		return Usage{Bytes: size, Objects: 1}
+	}
+	return Usage{Bytes: size - oldObjInfo.Size}
+}
+
+// putObjectInfo - saves the object and marks the data of the object it
+// replaces to delete at once.
+func (s *StorageSys) putObjectInfo(ctx context.Context, objInfo ObjectInfo) error {
+	objInfo.RecordVersion = RecordVersion
+	usage := s.replaceObjectUsage(objInfo.Bucket, objInfo.Name, objInfo.Size)
+	return s.updateUsage(ctx, objInfo.Bucket, usage, func(tx *kv.Tx) error {
+		// Has old file?
+		if err := s.checkAndDeleteObjectData(tx, objInfo.Bucket, objInfo.Name, objInfo.Cid); err != nil {
+			return err
+		}
+		return tx.Put(getObjectKey(objInfo.Bucket, objInfo.Name), objInfo)
+	})
 }
 
 // CopyObject store object
@@ -153,19 +255,24 @@ func (s *StorageSys) CopyObject(ctx context.Context, bucket, object string, info
 		return ObjectInfo{}, BucketNotFound{Bucket: bucket}
 	}
 	objInfo := ObjectInfo{
-		Bucket:           bucket,
-		Name:             object,
-		ModTime:          time.Now().UTC(),
-		Size:             size,
-		IsDir:            false,
-		ETag:             info.ETag,
-		Cid:              info.Cid,
-		VersionID:        "",
-		IsLatest:         true,
-		DeleteMarker:     false,
-		ContentType:      meta[strings.ToLower(consts.ContentType)],
-		ContentEncoding:  meta[strings.ToLower(consts.ContentEncoding)],
-		SuccessorModTime: time.Now().UTC(),
+		Bucket:            bucket,
+		Name:              object,
+		ModTime:           time.Now().UTC(),
+		Size:              size,
+		IsDir:             false,
+		ETag:              info.ETag,
+		Cid:               info.Cid,
+		VersionID:         "",
+		IsLatest:          true,
+		DeleteMarker:      false,
+		Acl:               meta[consts.AmzACL],
+		Owner:             meta[consts.AmzObjectOwner],
+		Grants:            grantsFromMetadata(meta),
+		ContentType:       meta[strings.ToLower(consts.ContentType)],
+		ContentEncoding:   meta[strings.ToLower(consts.ContentEncoding)],
+		SuccessorModTime:  time.Now().UTC(),
+		UserTags:          meta[strings.ToLower(consts.AmzObjectTagging)],
+		ReplicationStatus: meta[strings.ToLower(consts.AmzBucketReplicationStatus)],
 	}
 	// Update expires
 	if exp, ok := meta[strings.ToLower(consts.Expires)]; ok {
@@ -182,10 +289,7 @@ func (s *StorageSys) CopyObject(ctx context.Context, bucket, object string, info
 	ctx = lkctx.Context()
 	defer lk.Unlock(lkctx.Cancel)
 
-	// Has old file?
-	s.checkAndDeleteObjectData(ctx, bucket, object)
-
-	err = s.Db.Put(getObjectKey(bucket, object), objInfo)
+	err = s.putObjectInfo(ctx, objInfo)
 	if err != nil {
 		return ObjectInfo{}, err
 	}
@@ -210,22 +314,31 @@ func (s *StorageSys) StoreObject(ctx context.Context, bucket, object string, rea
 	if err != nil {
 		return ObjectInfo{}, err
 	}
+	defer func() {
+		if err != nil {
+			s.discardStored(root)
+		}
+	}()
 
 	objInfo := ObjectInfo{
-		Bucket:           bucket,
-		Name:             object,
-		ModTime:          time.Now().UTC(),
-		Size:             size,
-		IsDir:            false,
-		ETag:             reader.ETag().String(),
-		Cid:              root.String(),
-		VersionID:        "",
-		IsLatest:         true,
-		DeleteMarker:     false,
-		Acl:              meta[consts.AmzACL],
-		ContentType:      meta[strings.ToLower(consts.ContentType)],
-		ContentEncoding:  meta[strings.ToLower(consts.ContentEncoding)],
-		SuccessorModTime: time.Now().UTC(),
+		Bucket:            bucket,
+		Name:              object,
+		ModTime:           time.Now().UTC(),
+		Size:              size,
+		IsDir:             false,
+		ETag:              reader.ETag().String(),
+		Cid:               root.String(),
+		VersionID:         "",
+		IsLatest:          true,
+		DeleteMarker:      false,
+		Acl:               meta[consts.AmzACL],
+		Owner:             meta[consts.AmzObjectOwner],
+		Grants:            grantsFromMetadata(meta),
+		ContentType:       meta[strings.ToLower(consts.ContentType)],
+		ContentEncoding:   meta[strings.ToLower(consts.ContentEncoding)],
+		SuccessorModTime:  time.Now().UTC(),
+		UserTags:          meta[strings.ToLower(consts.AmzObjectTagging)],
+		ReplicationStatus: meta[strings.ToLower(consts.AmzBucketReplicationStatus)],
 	}
 	// Update expires
 	if exp, ok := meta[strings.ToLower(consts.Expires)]; ok {
@@ -242,10 +355,7 @@ func (s *StorageSys) StoreObject(ctx context.Context, bucket, object string, rea
 	ctx = lkctx.Context()
 	defer lk.Unlock(lkctx.Cancel)
 
-	// Has old file?
-	s.checkAndDeleteObjectData(ctx, bucket, object)
-
-	err = s.Db.Put(getObjectKey(bucket, object), objInfo)
+	err = s.putObjectInfo(ctx, objInfo)
 	if err != nil {
 		return ObjectInfo{}, err
 	}
@@ -262,6 +372,7 @@ func (s *StorageSys) PutObjectInfo(ctx context.Context, objInfo ObjectInfo) erro
 	}
 	ctx = lkctx.Context()
 	defer lk.RUnlock(lkctx.Cancel)
+	objInfo.RecordVersion = RecordVersion
 	return s.Db.Put(getObjectKey(bucket, object), objInfo)
 }
 
@@ -279,7 +390,7 @@ func (s *StorageSys) GetObject(ctx context.Context, bucket, object string) (Obje
 	if err != nil {
 		return ObjectInfo{}, nil, err
 	}
-	file, err := s.Pool.Store().Get(ctx, meta.Cid)
+	file, err := s.objects.Get(ctx, meta.Cid)
 	if err != nil {
 		return ObjectInfo{}, nil, err
 	}
@@ -289,7 +400,7 @@ func (s *StorageSys) GetObject(ctx context.Context, bucket, object string) (Obje
 func (s *StorageSys) getObjectInfo(ctx context.Context, bucket, object string) (meta ObjectInfo, err error) {
 	err = s.Db.Get(getObjectKey(bucket, object), &meta)
 	if err != nil {
-		if xerrors.Is(err, leveldb.ErrNotFound) {
+		if xerrors.Is(err, kv.ErrNotFound) {
 			return meta, ErrObjectNotFound
 		}
 	}
@@ -310,6 +421,15 @@ func (s *StorageSys) GetObjectInfo(ctx context.Context, bucket, object string) (
 
 // DeleteObject delete object
 func (s *StorageSys) DeleteObject(ctx context.Context, bucket, object string) error {
+	// the bucket lock keeps a recount of the usage out while the object is deleted
+	bktlk := s.newBucketNSLock(bucket)
+	bktlkCtx, err := bktlk.GetRLock(ctx, deleteOperationTimeout)
+	if err != nil {
+		return err
+	}
+	ctx = bktlkCtx.Context()
+	defer bktlk.RUnlock(bktlkCtx.Cancel)
+
 	lk := s.NewNSLock(bucket, object)
 	lkctx, err := lk.GetLock(ctx, deleteOperationTimeout)
 	if err != nil {
@@ -327,35 +447,87 @@ func (s *StorageSys) DeleteObject(ctx context.Context, bucket, object string) er
 		return err
 	}
 
-	if err = s.Db.Delete(getObjectKey(bucket, object)); err != nil {
+	return s.updateUsage(ctx, bucket, Usage{Bytes: -meta.Size, Objects: -1}, func(tx *kv.Tx) error {
+		tx.Delete(getObjectKey(bucket, object))
+		return s.markObjetToDelete(tx, cid)
+	})
+}
+
+// CleanObjectsInBucket - deletes the objects of the bucket in parallel, and
+// returns the first error once the others are deleted.
+func (s *StorageSys) CleanObjectsInBucket(ctx context.Context, bucket string) error {
+	return s.deleteObjectsInBucket(ctx, bucket, DefaultPurgeWorkers, func(deleted, failed int) {})
+}
+
+// CleanBucket - deletes the objects and the uploads of the bucket a page at a
+// time and marks their data to delete, each page along with its usage so that
+// an interrupted clean leaves the usage of the bucket right.
+func (s *StorageSys) CleanBucket(ctx context.Context, bucket string) error {
+	cleanObject := func(tx *kv.Tx, unmarshal func(v interface{}) error) (Usage, error) {
+		var o ObjectInfo
+		if err := unmarshal(&o); err != nil {
+			return Usage{}, err
+		}
+		return Usage{Bytes: -o.Size, Objects: -1}, s.markCidToDelete(tx, o.Cid)
+	}
+	cleanUpload := func(tx *kv.Tx, unmarshal func(v interface{}) error) (Usage, error) {
+		var mi MultipartInfo
+		if err := unmarshal(&mi); err != nil {
+			return Usage{}, err
+		}
+		for _, part := range mi.Parts {
+			if err := s.markCidToDelete(tx, part.Cid); err != nil {
+				return Usage{}, err
+			}
+		}
+		return Usage{MultipartBytes: -mi.partsSize()}, nil
+	}
+	if err := s.cleanPages(ctx, bucket, fmt.Sprintf(allObjectPrefixFormat, bucket, ""), cleanObject); err != nil {
 		return err
 	}
+	return s.cleanPages(ctx, bucket, fmt.Sprintf(allUploadPrefixFormat, bucket, ""), cleanUpload)
+}
 
-	if err = s.markObjetToDelete(cid); err != nil {
-		log.Errorw("mark Objet to delete error", "bucket", bucket, "object", object, "cid", meta.ETag, "error", err)
+// cleanPages - deletes the records under prefix, purgePageSize of them in a
+// tx along with the writes of clean for each one and their usage.
+func (s *StorageSys) cleanPages(ctx context.Context, bucket, prefix string, clean func(tx *kv.Tx, unmarshal func(v interface{}) error) (Usage, error)) error {
+	for {
+		n, err := s.cleanPage(ctx, bucket, prefix, clean)
+		if err != nil || n < purgePageSize {
+			return err
+		}
 	}
-	return nil
 }
 
-func (s *StorageSys) CleanObjectsInBucket(ctx context.Context, bucket string) error {
+// cleanPage - deletes the first records under prefix in a tx, at most
+// purgePageSize of them, and returns how many it deleted.
+func (s *StorageSys) cleanPage(ctx context.Context, bucket, prefix string, clean func(tx *kv.Tx, unmarshal func(v interface{}) error) (Usage, error)) (int, error) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
-
-	prefixKey := fmt.Sprintf(allObjectPrefixFormat, bucket, "")
-	all, err := s.Db.ReadAllChan(ctx, prefixKey, "")
+	all, err := s.Db.ReadAllChan(ctx, prefix, "")
 	if err != nil {
-		return err
+		return 0, err
 	}
-	for entry := range all {
-		var o ObjectInfo
-		if err = entry.UnmarshalValue(&o); err != nil {
-			return err
+	n := 0
+	err = s.Db.Update(func(tx *kv.Tx) error {
+		var usage Usage
+		for entry := range all {
+			tx.Delete(entry.Key)
+			d, err := clean(tx, entry.UnmarshalValue)
+			if err != nil {
+				return err
+			}
+			usage.add(d)
+			if n++; n == purgePageSize {
+				break
+			}
 		}
-		if err = s.DeleteObject(ctx, bucket, o.Name); err != nil {
+		if err := ctx.Err(); err != nil {
 			return err
 		}
-	}
-	return nil
+		return addUsage(tx, bucket, usage)
+	})
+	return n, err
 }
 
 // ListObjectsInfo - container for list objects.
@@ -511,11 +683,12 @@ func (s *StorageSys) NewMultipartUpload(ctx context.Context, bucket string, obje
 	// uploadId is random, so don't to lock it
 	uploadId := mustGetUUID()
 	info := MultipartInfo{
-		Bucket:    bucket,
-		Object:    object,
-		UploadID:  uploadId,
-		MetaData:  meta,
-		Initiated: time.Now().UTC(),
+		Bucket:        bucket,
+		Object:        object,
+		UploadID:      uploadId,
+		MetaData:      meta,
+		Initiated:     time.Now().UTC(),
+		RecordVersion: RecordVersion,
 	}
 
 	err = s.Db.Put(getUploadKey(bucket, object, uploadId), info)
@@ -564,6 +737,11 @@ func (s *StorageSys) PutObjectPart(ctx context.Context, bucket string, object st
 	if err != nil {
 		return pi, err
 	}
+	defer func() {
+		if err != nil {
+			s.discardStored(root)
+		}
+	}()
 
 	partInfo := objectPartInfo{
 		Number:  partID,
@@ -587,17 +765,16 @@ func (s *StorageSys) PutObjectPart(ctx context.Context, bucket string, object st
 	}
 
 	mi.Parts = append(mi.Parts, partInfo)
-	err = s.Db.Put(getUploadKey(bucket, object, uploadID), mi)
+	mi.RecordVersion = RecordVersion
+	err = s.updateUsage(ctx, bucket, Usage{MultipartBytes: size}, func(tx *kv.Tx) error {
+		return tx.Put(getUploadKey(bucket, object, uploadID), mi)
+	})
 	if err != nil {
 		return pi, err
 	}
 	return partInfo, nil
 }
 
-func (s *StorageSys) removeMultipartInfo(ctx context.Context, bucket string, object string, uploadID string) error {
-	return s.Db.Delete(getUploadKey(bucket, object, uploadID))
-}
-
 // objectPartIndex - returns the index of matching object part number.
 func objectPartIndex(parts []objectPartInfo, partNumber int) int {
 	for i, part := range parts {
@@ -694,19 +871,22 @@ func (s *StorageSys) CompleteMultiPartUpload(ctx context.Context, bucket string,
 	}
 	etag := ComputeCompleteMultipartMD5(parts)
 	objInfo := ObjectInfo{
-		Bucket:           bucket,
-		Name:             object,
-		ModTime:          time.Now().UTC(),
-		Size:             objectSize,
-		IsDir:            false,
-		ETag:             etag,
-		Cid:              root.String(),
-		VersionID:        "",
-		IsLatest:         true,
-		DeleteMarker:     false,
-		ContentType:      mi.MetaData[strings.ToLower(consts.ContentType)],
-		ContentEncoding:  mi.MetaData[strings.ToLower(consts.ContentEncoding)],
-		SuccessorModTime: time.Now().UTC(),
+		Bucket:            bucket,
+		Name:              object,
+		ModTime:           time.Now().UTC(),
+		Size:              objectSize,
+		IsDir:             false,
+		ETag:              etag,
+		Cid:               root.String(),
+		VersionID:         "",
+		IsLatest:          true,
+		DeleteMarker:      false,
+		ContentType:       mi.MetaData[strings.ToLower(consts.ContentType)],
+		ContentEncoding:   mi.MetaData[strings.ToLower(consts.ContentEncoding)],
+		SuccessorModTime:  time.Now().UTC(),
+		UserTags:          mi.MetaData[strings.ToLower(consts.AmzObjectTagging)],
+		ReplicationStatus: mi.MetaData[strings.ToLower(consts.AmzBucketReplicationStatus)],
+		RecordVersion:     RecordVersion,
 	}
 	// Update expires
 	if exp, ok := mi.MetaData[strings.ToLower(consts.Expires)]; ok {
@@ -723,19 +903,23 @@ func (s *StorageSys) CompleteMultiPartUpload(ctx context.Context, bucket string,
 	ctx = lkctx.Context()
 	defer lk.Unlock(lkctx.Cancel)
 
-	// Has old file?
-	s.checkAndDeleteObjectData(ctx, bucket, object)
-
-	err = s.Db.Put(getObjectKey(bucket, object), objInfo)
+	usage := s.replaceObjectUsage(bucket, object, objInfo.Size)
+	usage.MultipartBytes = -mi.partsSize()
+	err = s.updateUsage(ctx, bucket, usage, func(tx *kv.Tx) error {
+		// Has old file?
+		if err := s.checkAndDeleteObjectData(tx, bucket, object, objInfo.Cid); err != nil {
+			return err
+		}
+		if err := tx.Put(getObjectKey(bucket, object), objInfo); err != nil {
+			return err
+		}
+		// remove MultipartInfo
+		tx.Delete(getUploadKey(bucket, object, uploadID))
+		return nil
+	})
 	if err != nil {
 		return ObjectInfo{}, err
 	}
-
-	// remove MultipartInfo
-	err = s.removeMultipartInfo(ctx, bucket, object, uploadID)
-	if err != nil {
-		log.Errorw("remove MultipartInfo error", "bucket", bucket, "object", object, "uploadID", uploadID, "error", err)
-	}
 	return objInfo, nil
 }
 
@@ -765,23 +949,20 @@ func (s *StorageSys) AbortMultipartUpload(ctx context.Context, bucket string, ob
 		return err
 	}
 
-	for _, part := range mi.Parts {
-		c, err := cid.Decode(part.Cid)
-		if err != nil {
-			return err
-		}
-
-		if err = s.markObjetToDelete(c); err != nil {
-			log.Errorw("mark Objet to delete error", "bucket", bucket, "object", object, "cid", part.ETag, "error", err)
+	return s.updateUsage(ctx, bucket, Usage{MultipartBytes: -mi.partsSize()}, func(tx *kv.Tx) error {
+		for _, part := range mi.Parts {
+			c, err := cid.Decode(part.Cid)
+			if err != nil {
+				return err
+			}
+			if err = s.markObjetToDelete(tx, c); err != nil {
+				return err
+			}
 		}
-	}
-
-	// remove MultipartInfo
-	err = s.removeMultipartInfo(ctx, bucket, object, uploadID)
-	if err != nil {
-		log.Errorw("remove MultipartInfo error", "bucket", bucket, "object", object, "uploadID", uploadID, "error", err)
-	}
-	return nil
+		// remove MultipartInfo
+		tx.Delete(getUploadKey(bucket, object, uploadID))
+		return nil
+	})
 }
 
 // ListPartsInfo - represents list of all parts.
@@ -1003,11 +1184,27 @@ func (s *StorageSys) ListMultipartUploads(ctx context.Context, bucket, prefix, k
 	return result, nil
 }
 
-func (s *StorageSys) markObjetToDelete(c cid.Cid) error {
-	return s.Db.Put(newDelObjectKey(), c.String())
+// markObjetToDelete - schedules the removal of the DAG of c by the GC in tx.
+func (s *StorageSys) markObjetToDelete(tx *kv.Tx, c cid.Cid) error {
+	return tx.Put(newDelObjectKey(), c.String())
+}
+
+// markCidToDelete - marks the DAG of root to delete in tx, skipping a root
+// which does not decode.
+func (s *StorageSys) markCidToDelete(tx *kv.Tx, root string) error {
+	c, err := cid.Decode(root)
+	if err != nil {
+		log.Warnw("decode cid error", "cid", root)
+		return nil
+	}
+	return s.markObjetToDelete(tx, c)
 }
 
-func (s *StorageSys) deleteObjets(ctx context.Context) error {
+func (s *StorageSys) deleteObjets(ctx context.Context) (err error) {
+	start, removed, failed := time.Now(), 0, false
+	defer func() {
+		metrics.ObserveGC(removed, failed || err != nil, time.Since(start))
+	}()
 	ctx, cancel := context.WithTimeout(ctx, s.gcTimeout)
 	defer cancel()
 
@@ -1030,11 +1227,13 @@ func (s *StorageSys) deleteObjets(ctx context.Context) error {
 		}
 		if err = dagpoolcli.RemoveDAG(ctx, s.DagPool, c); err != nil {
 			log.Errorw("remove DAG error", "cid", c.String(), "error", err)
+			failed = true
 			break
 		}
 		if err = s.Db.Delete(entry.Key); err != nil {
 			return err
 		}
+		removed++
 	}
 	return nil
 }
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"github.com/ipfs/boxo/coreiface/path"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+	"github.com/yann-y/fds/internal/utils/hash"
+	"io"
+	"testing"
+	"time"
+)
+
+// memObjectStore - stores the data of an object as a single raw block.
+type memObjectStore struct {
+	dag ipld.DAGService
+	// added is called once the data is stored
+	added func()
+}
+
+func (m *memObjectStore) Add(ctx context.Context, reader io.ReadCloser) (path.Resolved, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	node := merkledag.NewRawNode(data)
+	if err = m.dag.Add(ctx, node); err != nil {
+		return nil, err
+	}
+	if m.added != nil {
+		m.added()
+	}
+	return path.IpfsPath(node.Cid()), nil
+}
+
+func (m *memObjectStore) Get(ctx context.Context, root string) (io.ReadCloser, error) {
+	c, err := cid.Decode(root)
+	if err != nil {
+		return nil, err
+	}
+	node, err := m.dag.Get(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(node.RawData())), nil
+}
+
+func newTestStorageSys(t *testing.T) (*StorageSys, *memObjectStore) {
+	s, bmSys, _ := newTestQuotaSys(t)
+	if err := bmSys.CreateBucket(context.TODO(), "bucket", "region", "user", ""); err != nil {
+		t.Fatal(err)
+	}
+	objects := &memObjectStore{dag: mdtest.Mock()}
+	s.DagPool, s.objects, s.gcTimeout = objects.dag, objects, time.Minute
+	return s, objects
+}
+
+func storeTestObject(ctx context.Context, s *StorageSys, object string, data []byte) (ObjectInfo, error) {
+	reader, err := hash.NewReader(bytes.NewReader(data), int64(len(data)), "", "", int64(len(data)))
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return s.StoreObject(ctx, "bucket", object, reader, int64(len(data)), map[string]string{})
+}
+
+func TestStorageSys_DiscardStored(t *testing.T) {
+	s, objects := newTestStorageSys(t)
+	data := []byte("live data")
+	if _, err := storeTestObject(context.TODO(), s, "object", data); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		object string
+		data   []byte
+		// kept reports whether the data of the failed write is kept
+		kept bool
+	}{
+		// Test case - 1.
+		// the same data as the live object is overwritten and the write fails.
+		{object: "object", data: data, kept: true},
+		// Test case - 2.
+		// the same data as the live object is written to another key.
+		{object: "other", data: data, kept: true},
+		// Test case - 3.
+		// data no object has.
+		{object: "other", data: []byte("new data"), kept: false},
+	}
+	for i, testCase := range testCases {
+		// the write is cancelled once its data is stored, its lock fails
+		ctx, cancel := context.WithCancel(context.TODO())
+		objects.added = cancel
+		_, err := storeTestObject(ctx, s, testCase.object, testCase.data)
+		objects.added = nil
+		cancel()
+		if err == nil {
+			t.Fatalf("Test %d: Expected the write to fail", i+1)
+		}
+		if err = s.deleteObjets(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+
+		_, reader, err := s.GetObject(context.TODO(), "bucket", "object")
+		if err != nil {
+			t.Fatalf("Test %d: Expected the live object to be read, but instead found %v", i+1, err)
+		}
+		got, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("Test %d: Expected %q, but instead found %q, %v", i+1, data, got, err)
+		}
+		has, err := objects.dag.Get(context.TODO(), merkledag.NewRawNode(testCase.data).Cid())
+		if (err == nil) != testCase.kept {
+			t.Errorf("Test %d: Expected the data kept %v, but instead found %v, %v", i+1, testCase.kept, has != nil, err)
+		}
+	}
+}
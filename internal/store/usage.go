@@ -0,0 +1,274 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"github.com/yann-y/fds/internal/kv"
+)
+
+const (
+	usageKeyFormat            = "usage/%s"
+	usageDeltaKeyFormat       = "usageDelta/%s/%s"
+	allUsageDeltaPrefixFormat = "usageDelta/%s/"
+	// usageCompactThreshold - the number of deltas added to the usage of a
+	// bucket which are folded into it once reached.
+	usageCompactThreshold = 128
+	// usageLockVolume - the volume of the usage locks, no bucket is named so.
+	usageLockVolume = ".usage"
+)
+
+// Usage - the storage a bucket or a user holds.
+type Usage struct {
+	// Bytes - the size of the objects.
+	Bytes int64 `json:"bytes"`
+	// Objects - the number of objects.
+	Objects int64 `json:"objects"`
+	// MultipartBytes - the size of the parts of the uploads in progress.
+	MultipartBytes int64 `json:"multipartBytes"`
+}
+
+// Total - returns the bytes the quotas limit, those of the objects and of the
+// uploads in progress.
+func (u Usage) Total() int64 {
+	return u.Bytes + u.MultipartBytes
+}
+
+func (u *Usage) add(d Usage) {
+	u.Bytes += d.Bytes
+	u.Objects += d.Objects
+	u.MultipartBytes += d.MultipartBytes
+}
+
+// partsSize - returns the size of the parts uploaded.
+func (mi MultipartInfo) partsSize() int64 {
+	var size int64
+	for _, part := range mi.Parts {
+		size += part.Size
+	}
+	return size
+}
+
+// addUsage - adds d to the usage of the bucket in tx. The usage is the sum of
+// its deltas, which the concurrent writes can't lose as they would lose the
+// updates of a counter read and written back.
+func addUsage(tx *kv.Tx, bucket string, d Usage) error {
+	if d == (Usage{}) {
+		return nil
+	}
+	return tx.Put(fmt.Sprintf(usageDeltaKeyFormat, bucket, mustGetUUID()), d)
+}
+
+// updateUsage - runs update in a tx which adds d to the usage of the bucket.
+// A write growing the usage is checked against the quotas first, and the
+// deltas are folded into the usage once the bucket has many.
+func (s *StorageSys) updateUsage(ctx context.Context, bucket string, d Usage, update func(tx *kv.Tx) error) error {
+	write := func() error {
+		return s.Db.Update(func(tx *kv.Tx) error {
+			if err := addUsage(tx, bucket, d); err != nil {
+				return err
+			}
+			return update(tx)
+		})
+	}
+	var err error
+	if s.quotaSys != nil && d.Total() > 0 {
+		err = s.quotaSys.checkWrite(ctx, bucket, d.Total(), write)
+	} else {
+		err = write()
+	}
+	if err != nil || d == (Usage{}) || !s.usageAdded(bucket) {
+		return err
+	}
+	if err = s.compactUsage(ctx, bucket); err != nil {
+		log.Errorf("compact usage of %s err:%v", bucket, err)
+	}
+	return nil
+}
+
+// usageAdded - counts a delta added to the usage of the bucket, and reports
+// whether the deltas are to be folded into it.
+func (s *StorageSys) usageAdded(bucket string) bool {
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+	if s.usageDeltas == nil {
+		s.usageDeltas = make(map[string]int)
+	}
+	if s.usageDeltas[bucket]++; s.usageDeltas[bucket] < usageCompactThreshold {
+		return false
+	}
+	delete(s.usageDeltas, bucket)
+	return true
+}
+
+// readUsage - returns the usage of the bucket and the keys of its deltas.
+func readUsage(ctx context.Context, db *kv.DB, bucket string) (Usage, []string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var usage Usage
+	if err := db.Get(fmt.Sprintf(usageKeyFormat, bucket), &usage); err != nil && err != kv.ErrNotFound {
+		return Usage{}, nil, err
+	}
+	all, err := db.ReadAllChan(ctx, fmt.Sprintf(allUsageDeltaPrefixFormat, bucket), "")
+	if err != nil {
+		return Usage{}, nil, err
+	}
+	var keys []string
+	for entry := range all {
+		var d Usage
+		if err = entry.UnmarshalValue(&d); err != nil {
+			return Usage{}, nil, err
+		}
+		usage.add(d)
+		keys = append(keys, entry.Key)
+	}
+	return usage, keys, ctx.Err()
+}
+
+// deleteUsage - deletes the usage of the bucket in tx.
+func deleteUsage(ctx context.Context, db *kv.DB, tx *kv.Tx, bucket string) error {
+	_, keys, err := readUsage(ctx, db, bucket)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		tx.Delete(key)
+	}
+	tx.Delete(fmt.Sprintf(usageKeyFormat, bucket))
+	return nil
+}
+
+// computeUsage - returns the usage of the bucket counted from its objects and
+// its uploads.
+func computeUsage(ctx context.Context, db *kv.DB, bucket string) (Usage, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var usage Usage
+	objects, err := db.ReadAllChan(ctx, fmt.Sprintf(allObjectPrefixFormat, bucket, ""), "")
+	if err != nil {
+		return Usage{}, err
+	}
+	for entry := range objects {
+		var o ObjectInfo
+		if err = entry.UnmarshalValue(&o); err != nil {
+			return Usage{}, err
+		}
+		usage.Bytes += o.Size
+		usage.Objects++
+	}
+	uploads, err := db.ReadAllChan(ctx, fmt.Sprintf(allUploadPrefixFormat, bucket, ""), "")
+	if err != nil {
+		return Usage{}, err
+	}
+	for entry := range uploads {
+		var mi MultipartInfo
+		if err = entry.UnmarshalValue(&mi); err != nil {
+			return Usage{}, err
+		}
+		usage.MultipartBytes += mi.partsSize()
+	}
+	return usage, ctx.Err()
+}
+
+// setUsage - replaces the usage of the bucket and its deltas with usage in tx.
+func setUsage(ctx context.Context, db *kv.DB, tx *kv.Tx, bucket string, usage Usage) error {
+	if err := deleteUsage(ctx, db, tx, bucket); err != nil {
+		return err
+	}
+	return tx.Put(fmt.Sprintf(usageKeyFormat, bucket), usage)
+}
+
+// ComputeUsage - sets in tx the usage of the buckets after the key cursor
+// counted from their objects and their uploads, until tx holds limit writes.
+// It returns the key of the last bucket read, or "" once every bucket is.
+func ComputeUsage(ctx context.Context, db *kv.DB, tx *kv.Tx, cursor string, limit int) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	all, err := db.ReadAllChan(ctx, bucketPrefix, cursor)
+	if err != nil {
+		return "", err
+	}
+	for entry := range all {
+		var meta BucketMetadata
+		if err = entry.UnmarshalValue(&meta); err != nil {
+			return "", err
+		}
+		usage, err := computeUsage(ctx, db, meta.Name)
+		if err != nil {
+			return "", err
+		}
+		if err = setUsage(ctx, db, tx, meta.Name, usage); err != nil {
+			return "", err
+		}
+		if tx.Len() >= limit {
+			return entry.Key, nil
+		}
+	}
+	return "", ctx.Err()
+}
+
+// BucketUsage - returns the usage of the bucket.
+func (s *StorageSys) BucketUsage(ctx context.Context, bucket string) (Usage, error) {
+	usage, _, err := readUsage(ctx, s.Db, bucket)
+	return usage, err
+}
+
+// compactUsage - folds the deltas of the usage of the bucket into it, the
+// deltas added meanwhile are kept. The deltas left by the writes of another
+// gateway or before a restart are folded along.
+func (s *StorageSys) compactUsage(ctx context.Context, bucket string) error {
+	lk := s.nsLock.NewNSLock(usageLockVolume, bucket)
+	lkctx, err := lk.GetLock(ctx, globalOperationTimeout)
+	if err != nil {
+		return err
+	}
+	ctx = lkctx.Context()
+	defer lk.Unlock(lkctx.Cancel)
+
+	usage, keys, err := readUsage(ctx, s.Db, bucket)
+	if err != nil {
+		return err
+	}
+	return s.Db.Update(func(tx *kv.Tx) error {
+		for _, key := range keys {
+			tx.Delete(key)
+		}
+		return tx.Put(fmt.Sprintf(usageKeyFormat, bucket), usage)
+	})
+}
+
+// RecomputeUsage - counts the usage of the bucket from its objects and its
+// uploads again, the writes to the bucket wait meanwhile.
+func (s *StorageSys) RecomputeUsage(ctx context.Context, bucket string) (Usage, error) {
+	bktlk := s.newBucketNSLock(bucket)
+	bktlkCtx, err := bktlk.GetLock(ctx, globalOperationTimeout)
+	if err != nil {
+		return Usage{}, err
+	}
+	ctx = bktlkCtx.Context()
+	defer bktlk.Unlock(bktlkCtx.Cancel)
+
+	// the bucket is read past its lock, which is held already
+	var meta BucketMetadata
+	if err = s.Db.Get(bucketPrefix+bucket, &meta); err == kv.ErrNotFound {
+		return Usage{}, BucketNotFound{Bucket: bucket}
+	} else if err != nil {
+		return Usage{}, err
+	}
+
+	lk := s.nsLock.NewNSLock(usageLockVolume, bucket)
+	lkctx, err := lk.GetLock(ctx, globalOperationTimeout)
+	if err != nil {
+		return Usage{}, err
+	}
+	ctx = lkctx.Context()
+	defer lk.Unlock(lkctx.Cancel)
+
+	usage, err := computeUsage(ctx, s.Db, bucket)
+	if err != nil {
+		return Usage{}, err
+	}
+	err = s.Db.Update(func(tx *kv.Tx) error {
+		return setUsage(ctx, s.Db, tx, bucket, usage)
+	})
+	return usage, err
+}
@@ -0,0 +1,163 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"github.com/yann-y/fds/internal/kv"
+	"github.com/yann-y/fds/internal/lock"
+	"github.com/yann-y/fds/internal/uleveldb"
+	"testing"
+)
+
+const testCid = "QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n"
+
+func newTestQuotaSys(t *testing.T) (*StorageSys, *BucketMetadataSys, *QuotaSys) {
+	db, err := uleveldb.OpenDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	storageSys := &StorageSys{Db: db, nsLock: lock.NewNSLock()}
+	bmSys := NewBucketMetadataSys(db)
+	storageSys.SetNewBucketNSLock(bmSys.NewNSLock)
+	storageSys.SetHasBucket(bmSys.HasBucket)
+	bmSys.SetEmptyBucket(storageSys.EmptyBucket)
+	bmSys.SetCleanBucket(storageSys.CleanBucket)
+	return storageSys, bmSys, NewQuotaSys(storageSys, bmSys)
+}
+
+func countUsageDeltas(t *testing.T, db *kv.DB, bucket string) int {
+	_, keys, err := readUsage(context.TODO(), db, bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(keys)
+}
+
+func TestStorageSys_Usage(t *testing.T) {
+	s, bmSys, _ := newTestQuotaSys(t)
+	ctx := context.TODO()
+	if err := bmSys.CreateBucket(ctx, "bucket", "region", "user", ""); err != nil {
+		t.Fatal(err)
+	}
+	upload := MultipartInfo{Bucket: "bucket", Object: "multipart", UploadID: "1", Parts: []objectPartInfo{
+		{Number: 1, Cid: testCid, Size: 3},
+		{Number: 2, Cid: testCid, Size: 5},
+	}}
+
+	testCases := []struct {
+		write    func() error
+		expected Usage
+	}{
+		// Test case - 1.
+		// a new object.
+		{
+			write: func() error {
+				return s.putObjectInfo(ctx, ObjectInfo{Bucket: "bucket", Name: "a", Cid: testCid, Size: 10})
+			},
+			expected: Usage{Bytes: 10, Objects: 1},
+		},
+		// Test case - 2.
+		// the object replaced by a smaller one.
+		{
+			write: func() error {
+				return s.putObjectInfo(ctx, ObjectInfo{Bucket: "bucket", Name: "a", Cid: testCid, Size: 4})
+			},
+			expected: Usage{Bytes: 4, Objects: 1},
+		},
+		// Test case - 3.
+		// another object.
+		{
+			write: func() error {
+				return s.putObjectInfo(ctx, ObjectInfo{Bucket: "bucket", Name: "b", Cid: testCid, Size: 6})
+			},
+			expected: Usage{Bytes: 10, Objects: 2},
+		},
+		// Test case - 4.
+		// the parts of an upload.
+		{
+			write: func() error {
+				return s.Db.Update(func(tx *kv.Tx) error {
+					if err := addUsage(tx, "bucket", Usage{MultipartBytes: upload.partsSize()}); err != nil {
+						return err
+					}
+					return tx.Put(getUploadKey("bucket", upload.Object, upload.UploadID), upload)
+				})
+			},
+			expected: Usage{Bytes: 10, Objects: 2, MultipartBytes: 8},
+		},
+		// Test case - 5.
+		// the upload aborted.
+		{
+			write: func() error {
+				return s.AbortMultipartUpload(ctx, "bucket", upload.Object, upload.UploadID)
+			},
+			expected: Usage{Bytes: 10, Objects: 2},
+		},
+		// Test case - 6.
+		// an object deleted.
+		{
+			write: func() error {
+				return s.DeleteObject(ctx, "bucket", "a")
+			},
+			expected: Usage{Bytes: 6, Objects: 1},
+		},
+	}
+	for i, testCase := range testCases {
+		if err := testCase.write(); err != nil {
+			t.Fatalf("Test %d: %v", i+1, err)
+		}
+		usage, err := s.BucketUsage(ctx, "bucket")
+		if err != nil {
+			t.Fatalf("Test %d: %v", i+1, err)
+		}
+		if usage != testCase.expected {
+			t.Errorf("Test %d: Expected the usage %+v, but instead found %+v", i+1, testCase.expected, usage)
+		}
+	}
+
+	// the deltas are folded by the writes once they are many, the usage unread
+	for i := 0; i < 2*usageCompactThreshold; i++ {
+		if err := s.putObjectInfo(ctx, ObjectInfo{Bucket: "bucket", Name: fmt.Sprintf("c%d", i), Cid: testCid, Size: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := countUsageDeltas(t, s.Db, "bucket"); n >= usageCompactThreshold {
+		t.Errorf("Expected the deltas to be folded, but instead found %d", n)
+	}
+	expected := Usage{Bytes: 6 + 2*usageCompactThreshold, Objects: 1 + 2*usageCompactThreshold}
+	if usage, err := s.BucketUsage(ctx, "bucket"); err != nil || usage != expected {
+		t.Fatalf("Expected the usage %+v, but instead found %+v, %v", expected, usage, err)
+	}
+	if err := s.compactUsage(ctx, "bucket"); err != nil {
+		t.Fatal(err)
+	}
+	if n := countUsageDeltas(t, s.Db, "bucket"); n != 0 {
+		t.Errorf("Expected the deltas to be folded, but instead found %d", n)
+	}
+	if usage, err := s.BucketUsage(ctx, "bucket"); err != nil || usage != expected {
+		t.Errorf("Expected the folded usage %+v, but instead found %+v, %v", expected, usage, err)
+	}
+
+	// a wrong usage is counted again
+	if err := s.Db.Put(fmt.Sprintf(usageKeyFormat, "bucket"), Usage{Bytes: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if usage, err := s.RecomputeUsage(ctx, "bucket"); err != nil || usage != expected {
+		t.Errorf("Expected the recomputed usage %+v, but instead found %+v, %v", expected, usage, err)
+	}
+	if usage, err := s.BucketUsage(ctx, "bucket"); err != nil || usage != expected {
+		t.Errorf("Expected the usage %+v, but instead found %+v, %v", expected, usage, err)
+	}
+	if _, err := s.RecomputeUsage(ctx, "missing"); err == nil {
+		t.Error("Expected the recount of a missing bucket to fail")
+	}
+
+	// the usage is deleted with the bucket
+	if err := bmSys.PurgeBucket(ctx, "bucket"); err != nil {
+		t.Fatal(err)
+	}
+	if usage, err := s.BucketUsage(ctx, "bucket"); err != nil || usage != (Usage{}) {
+		t.Errorf("Expected no usage, but instead found %+v, %v", usage, err)
+	}
+}
@@ -1,26 +1,30 @@
 package uleveldb
 
 import (
-	"context"
+	"bytes"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
 	"github.com/syndtr/goleveldb/leveldb/errors"
 	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/memdb"
 	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/syndtr/goleveldb/leveldb/util"
-	"github.com/vmihailenco/msgpack/v5"
-	"go.uber.org/zap/buffer"
+	"github.com/yann-y/fds/internal/kv"
+	"sync"
 )
 
 var log = logging.Logger("leveldb")
 
-// ULevelDB level db store key-struct
-type ULevelDB struct {
-	DB *leveldb.DB
+// Store - the LevelDB implementation of kv.Store.
+type Store struct {
+	db *leveldb.DB
+	// writeMu serializes the writes with the transactions
+	writeMu sync.Mutex
 }
 
-// OpenDb open a db client
-func OpenDb(path string) (*ULevelDB, error) {
+// Open opens the LevelDB store at path, recovering it when it is corrupted.
+func Open(path string) (*Store, error) {
 	newDb, err := leveldb.OpenFile(path, nil)
 	if _, corrupted := err.(*errors.ErrCorrupted); corrupted {
 		newDb, err = leveldb.RecoverFile(path, nil)
@@ -29,89 +33,248 @@ func OpenDb(path string) (*ULevelDB, error) {
 		log.Errorf("Open Db path: %v,err:%v,", path, err)
 		return nil, err
 	}
-	return &ULevelDB{
-		DB: newDb,
-	}, nil
+	return &Store{db: newDb}, nil
 }
 
-// Close db close
-func (l *ULevelDB) Close() error {
-	return l.DB.Close()
+// OpenDb open a db client
+func OpenDb(path string) (*kv.DB, error) {
+	store, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return kv.NewDB(store), nil
+}
+
+// Get - returns the value of key.
+func (s *Store) Get(key []byte) ([]byte, error) {
+	return get(s.db.Get(key, nil))
+}
+
+// Put - sets the value of key.
+func (s *Store) Put(key, value []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.db.Put(key, value, nil)
 }
 
-// Put
-// * @param {string} key
-// * @param {interface{}} value
-func (l *ULevelDB) Put(key string, value interface{}) error {
-	result, err := msgpack.Marshal(value)
+// Delete - removes key.
+func (s *Store) Delete(key []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.db.Delete(key, nil)
+}
+
+// Write - applies the batch atomically.
+func (s *Store) Write(batch *kv.Batch) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.db.Write(toBatch(batch), nil)
+}
+
+// NewIterator - iterates over the keys with prefix from seek.
+func (s *Store) NewIterator(prefix, seek []byte) kv.Iterator {
+	return newIterator(s.db.NewIterator, prefix, seek)
+}
+
+// NewSnapshot - returns a snapshot of the store.
+func (s *Store) NewSnapshot() (kv.Snapshot, error) {
+	snap, err := s.db.GetSnapshot()
 	if err != nil {
-		log.Errorf("marshal error%v", err)
-		return err
+		return nil, err
 	}
-	return l.DB.Put([]byte(key), result, nil)
+	return &snapshot{snap: snap}, nil
 }
 
-// Get
-// * @param {string} key
-// * @param {interface{}} value
-func (l *ULevelDB) Get(key string, value interface{}) error {
-	get, err := l.DB.Get([]byte(key), nil)
-	if err != nil {
-		return err
+// NewTxn - opens a transaction, which blocks the other writes until it ends.
+// Its writes are kept in memory and written in a single batch on Commit.
+func (s *Store) NewTxn() (kv.Txn, error) {
+	s.writeMu.Lock()
+	return &txn{s: s, writes: memdb.New(comparer.DefaultComparer, 0)}, nil
+}
+
+// Close db close
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+type snapshot struct {
+	snap *leveldb.Snapshot
+}
+
+func (s *snapshot) Get(key []byte) ([]byte, error) {
+	return get(s.snap.Get(key, nil))
+}
+
+func (s *snapshot) NewIterator(prefix, seek []byte) kv.Iterator {
+	return newIterator(s.snap.NewIterator, prefix, seek)
+}
+
+func (s *snapshot) Release() {
+	s.snap.Release()
+}
+
+// the first byte of the values of the writes of a txn
+const (
+	txnDelete byte = iota
+	txnPut
+)
+
+type txn struct {
+	s *Store
+	// writes holds the puts of the txn, their values prefixed by txnPut, and
+	// its deletes as txnDelete
+	writes *memdb.DB
+	done   bool
+}
+
+func (t *txn) Get(key []byte) ([]byte, error) {
+	if value, err := t.writes.Get(key); err == nil {
+		if value[0] == txnDelete {
+			return nil, kv.ErrNotFound
+		}
+		return append([]byte(nil), value[1:]...), nil
 	}
-	return msgpack.Unmarshal(get, value)
+	return t.s.Get(key)
 }
 
-// Delete
-// * @param {string} key
-// * @param {interface{}} value
-func (l *ULevelDB) Delete(key string) error {
-	return l.DB.Delete([]byte(key), nil)
+func (t *txn) NewIterator(prefix, seek []byte) kv.Iterator {
+	writes := func(slice *util.Range, _ *opt.ReadOptions) iterator.Iterator {
+		return t.writes.NewIterator(slice)
+	}
+	return &txnIterator{
+		writes:    newIterator(writes, prefix, seek),
+		db:        t.s.NewIterator(prefix, seek),
+		nextWrite: true,
+		nextDB:    true,
+	}
 }
 
-// NewIterator /**
-func (l *ULevelDB) NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator {
-	return l.DB.NewIterator(slice, ro)
+func (t *txn) Put(key, value []byte) error {
+	return t.writes.Put(key, append([]byte{txnPut}, value...))
 }
 
-type entry struct {
-	Key   string
-	Value []byte
+func (t *txn) Delete(key []byte) error {
+	return t.writes.Put(key, []byte{txnDelete})
 }
 
-func (e *entry) UnmarshalValue(value interface{}) error {
-	return msgpack.Unmarshal(e.Value, value)
+func (t *txn) Commit() error {
+	if t.done {
+		return leveldb.ErrClosed
+	}
+	defer t.end()
+	batch := new(leveldb.Batch)
+	iter := t.writes.NewIterator(nil)
+	defer iter.Release()
+	for iter.Next() {
+		if value := iter.Value(); value[0] == txnDelete {
+			batch.Delete(iter.Key())
+		} else {
+			batch.Put(iter.Key(), value[1:])
+		}
+	}
+	if batch.Len() == 0 {
+		return nil
+	}
+	return t.s.db.Write(batch, nil)
 }
 
-// ReadAllChan read all key value
-func (l *ULevelDB) ReadAllChan(ctx context.Context, prefix string, seekKey string) (<-chan *entry, error) {
-	ch := make(chan *entry)
-	var slice *util.Range
-	if prefix != "" {
-		slice = util.BytesPrefix([]byte(prefix))
+func (t *txn) Discard() {
+	if !t.done {
+		t.end()
 	}
-	iter := l.NewIterator(slice, nil)
-	if seekKey != "" {
-		iter.Seek([]byte(seekKey))
+}
+
+func (t *txn) end() {
+	t.done = true
+	t.s.writeMu.Unlock()
+}
+
+// txnIterator - merges the writes of a txn over the keys of the db.
+type txnIterator struct {
+	writes, db kv.Iterator
+	// validWrite and validDB tell whether writes and db are at a key
+	validWrite, validDB bool
+	// nextWrite and nextDB tell which of them Next moves past the current key
+	nextWrite, nextDB bool
+	key, value        []byte
+}
+
+func (it *txnIterator) Next() bool {
+	if it.nextWrite {
+		it.validWrite = it.writes.Next()
 	}
-	go func() {
-		defer func() {
-			iter.Release()
-			close(ch)
-		}()
-		for iter.Next() {
-			key := string(iter.Key())
-			buf := buffer.Buffer{}
-			buf.Write(iter.Value())
-			select {
-			case <-ctx.Done():
-				return
-			case ch <- &entry{
-				Key:   key,
-				Value: buf.Bytes(),
-			}:
-			}
+	if it.nextDB {
+		it.validDB = it.db.Next()
+	}
+	it.nextWrite, it.nextDB = false, false
+	for it.validWrite || it.validDB {
+		c := -1
+		if !it.validWrite {
+			c = 1
+		} else if it.validDB {
+			c = bytes.Compare(it.writes.Key(), it.db.Key())
+		}
+		if c > 0 {
+			it.nextDB = true
+			it.key, it.value = it.db.Key(), it.db.Value()
+			return true
 		}
-	}()
-	return ch, nil
+		if value := it.writes.Value(); value[0] == txnPut {
+			it.nextWrite, it.nextDB = true, c == 0
+			it.key, it.value = it.writes.Key(), value[1:]
+			return true
+		}
+		// the key is deleted by the txn
+		it.validWrite = it.writes.Next()
+		if c == 0 {
+			it.validDB = it.db.Next()
+		}
+	}
+	it.key, it.value = nil, nil
+	return false
+}
+
+func (it *txnIterator) Key() []byte {
+	return it.key
+}
+
+func (it *txnIterator) Value() []byte {
+	return it.value
+}
+
+func (it *txnIterator) Error() error {
+	if err := it.writes.Error(); err != nil {
+		return err
+	}
+	return it.db.Error()
+}
+
+func (it *txnIterator) Release() {
+	it.writes.Release()
+	it.db.Release()
+}
+
+func get(value []byte, err error) ([]byte, error) {
+	if err == leveldb.ErrNotFound {
+		return nil, kv.ErrNotFound
+	}
+	return value, err
+}
+
+func toBatch(batch *kv.Batch) *leveldb.Batch {
+	b := new(leveldb.Batch)
+	for _, op := range batch.Ops() {
+		if op.Delete {
+			b.Delete([]byte(op.Key))
+		} else {
+			b.Put([]byte(op.Key), op.Value)
+		}
+	}
+	return b
+}
+
+// newIterator - returns the iterator of fn over the keys with prefix from
+// seek.
+func newIterator(fn func(*util.Range, *opt.ReadOptions) iterator.Iterator, prefix, seek []byte) kv.Iterator {
+	return fn(&util.Range{Start: kv.IteratorStart(prefix, seek), Limit: kv.PrefixEnd(prefix)}, nil)
 }
@@ -1,10 +1,20 @@
 package uleveldb
 
 import (
+	"errors"
 	"fmt"
+	"github.com/yann-y/fds/internal/kv"
+	"github.com/yann-y/fds/internal/kv/kvtest"
+	"sync"
 	"testing"
 )
 
+func TestStore(t *testing.T) {
+	kvtest.Run(t, func(dir string) (kv.Store, error) {
+		return Open(dir)
+	})
+}
+
 func TestULeveldb(t *testing.T) {
 	db, err := OpenDb(t.TempDir())
 	if err != nil {
@@ -22,3 +32,88 @@ func TestULeveldb(t *testing.T) {
 	}
 	fmt.Println(a)
 }
+
+func TestUpdate(t *testing.T) {
+	db, err := OpenDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err = db.Put("a", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Update(func(tx *kv.Tx) error {
+		if err := tx.Put("b", 2); err != nil {
+			return err
+		}
+		tx.Delete("a")
+		var b int
+		if err := tx.Get("b", &b); err != nil || b != 2 {
+			t.Errorf("Expected the tx to read 2, but instead found %d, %v", b, err)
+		}
+		if err := tx.Get("a", &b); err != kv.ErrNotFound {
+			t.Errorf("Expected %v, but instead found %v", kv.ErrNotFound, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v int
+	if err = db.Get("a", &v); err != kv.ErrNotFound {
+		t.Errorf("Expected %v, but instead found %v", kv.ErrNotFound, err)
+	}
+	if err = db.Get("b", &v); err != nil || v != 2 {
+		t.Errorf("Expected 2, but instead found %d, %v", v, err)
+	}
+
+	failed := errors.New("failed")
+	err = db.Update(func(tx *kv.Tx) error {
+		tx.Delete("b")
+		return failed
+	})
+	if err != failed {
+		t.Errorf("Expected %v, but instead found %v", failed, err)
+	}
+	if err = db.Get("b", &v); err != nil {
+		t.Errorf("Expected a failed update to write nothing, but instead found %v", err)
+	}
+}
+
+func TestUpdate_Isolation(t *testing.T) {
+	db, err := OpenDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// the concurrent increments must not overwrite each other
+	const n = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- db.Update(func(tx *kv.Tx) error {
+				var v int
+				if err := tx.Get("counter", &v); err != nil && err != kv.ErrNotFound {
+					return err
+				}
+				return tx.Put("counter", v+1)
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var v int
+	if err = db.Get("counter", &v); err != nil || v != n {
+		t.Errorf("Expected %d, but instead found %d, %v", n, v, err)
+	}
+}
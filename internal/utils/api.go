@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// APIName returns the name of a handler function such as
+// internal/s3api.(*s3ApiServer).PutObjectHandler-fm as PutObject.
+func APIName(h http.Handler) string {
+	v := reflect.ValueOf(h)
+	if v.Kind() != reflect.Func {
+		return v.Type().Name()
+	}
+	fn := runtime.FuncForPC(v.Pointer())
+	if fn == nil {
+		return ""
+	}
+	name := strings.TrimSuffix(fn.Name(), "-fm")
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimSuffix(name, "Handler")
+}
@@ -0,0 +1,14 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// BearerTokenMatches returns whether the request carries token as bearer
+// token, compared in constant time.
+func BearerTokenMatches(r *http.Request, token string) bool {
+	scheme, bearer, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	return scheme == "Bearer" && subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1
+}
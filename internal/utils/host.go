@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"net"
+	"strings"
+)
+
+// BucketFromHost returns the bucket of a virtual-hosted-style request, whose
+// host is <bucket>.<domain> for one of domains. ok is false for path-style
+// requests.
+func BucketFromHost(host string, domains []string) (bucket string, ok bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+		if bucket = strings.TrimSuffix(host, "."+domain); bucket != host && bucket != "" {
+			return bucket, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,28 @@
+package utils
+
+import "testing"
+
+func TestBucketFromHost(t *testing.T) {
+	domains := []string{"s3.example.com", ".fds.local"}
+	testCases := []struct {
+		host   string
+		bucket string
+		ok     bool
+	}{
+		{"bucket.s3.example.com", "bucket", true},
+		{"bucket.s3.example.com:9000", "bucket", true},
+		{"Bucket.S3.Example.com", "bucket", true},
+		{"my.dotted.bucket.s3.example.com", "my.dotted.bucket", true},
+		{"bucket.fds.local", "bucket", true},
+		{"s3.example.com", "", false},
+		{"s3.example.com:9000", "", false},
+		{"bucket.other.com", "", false},
+		{"127.0.0.1:9000", "", false},
+	}
+	for i, testCase := range testCases {
+		bucket, ok := BucketFromHost(testCase.host, domains)
+		if bucket != testCase.bucket || ok != testCase.ok {
+			t.Errorf("Test %d: Expected %q %v, got %q %v", i+1, testCase.bucket, testCase.ok, bucket, ok)
+		}
+	}
+}
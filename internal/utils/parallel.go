@@ -0,0 +1,39 @@
+package utils
+
+import "sync"
+
+// Parallel calls fn for every index below n with at most workers calls at
+// once. done is called with the index and the error of each call as the calls
+// complete, from the calling goroutine so that it needs no lock.
+func Parallel(n, workers int, fn func(i int) error, done func(i int, err error)) {
+	if workers < 1 {
+		workers = 1
+	}
+	type result struct {
+		i   int
+		err error
+	}
+	indexes := make(chan int)
+	results := make(chan result, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results <- result{i: i, err: fn(i)}
+			}
+		}()
+	}
+	go func() {
+		for i := 0; i < n; i++ {
+			indexes <- i
+		}
+		close(indexes)
+		wg.Wait()
+		close(results)
+	}()
+	for res := range results {
+		done(res.i, res.err)
+	}
+}
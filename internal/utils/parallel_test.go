@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParallel(t *testing.T) {
+	testCases := []struct {
+		n, workers int
+	}{
+		{0, 4},
+		{1, 4},
+		{10, 1},
+		{100, 8},
+		{5, 0},
+	}
+	for i, testCase := range testCases {
+		var running, max int32
+		calls := make([]int, testCase.n)
+		failed := 0
+		Parallel(testCase.n, testCase.workers, func(j int) error {
+			if r := atomic.AddInt32(&running, 1); r > atomic.LoadInt32(&max) {
+				atomic.StoreInt32(&max, r)
+			}
+			defer atomic.AddInt32(&running, -1)
+			if j%3 == 0 {
+				return errors.New("failed")
+			}
+			return nil
+		}, func(j int, err error) {
+			calls[j]++
+			if err != nil {
+				failed++
+			}
+		})
+		for j, c := range calls {
+			if c != 1 {
+				t.Errorf("Test %d: Expected index %d done once, but instead found %d", i+1, j, c)
+			}
+		}
+		if want := (testCase.n + 2) / 3; failed != want {
+			t.Errorf("Test %d: Expected %d errors, but instead found %d", i+1, want, failed)
+		}
+		if workers := testCase.workers; workers > 0 && int(max) > workers {
+			t.Errorf("Test %d: Expected at most %d calls at once, but instead found %d", i+1, workers, max)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+// Package website models the static website configuration of a bucket: index
+// and error documents, routing rules and redirects.
+package website
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxRoutingRules is the maximum number of routing rules of a configuration.
+const maxRoutingRules = 50
+
+var (
+	errRedirectAllExclusive = errors.New("RedirectAllRequestsTo can not be combined with other website configuration")
+	errMissingHostName      = errors.New("RedirectAllRequestsTo requires a HostName")
+	errMissingIndexDocument = errors.New("website configuration requires an IndexDocument")
+	errInvalidSuffix        = errors.New("IndexDocument Suffix must be non-empty and must not contain a slash")
+	errMissingErrorKey      = errors.New("ErrorDocument requires a Key")
+	errInvalidProtocol      = errors.New("invalid redirect Protocol")
+	errTooManyRoutingRules  = fmt.Errorf("website configuration has more than %d routing rules", maxRoutingRules)
+	errEmptyCondition       = errors.New("routing rule Condition must not be empty")
+	errInvalidErrorCode     = errors.New("HttpErrorCodeReturnedEquals must be a 4XX or 5XX code")
+	errEmptyRedirect        = errors.New("routing rule Redirect must not be empty")
+	errReplaceKeyExclusive  = errors.New("ReplaceKeyWith can not be combined with ReplaceKeyPrefixWith")
+	errInvalidRedirectCode  = errors.New("HttpRedirectCode must be a 3XX code")
+)
+
+// Config - WebsiteConfiguration of a bucket as per
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutBucketWebsite.html
+type Config struct {
+	XMLName               xml.Name               `xml:"WebsiteConfiguration"`
+	XMLNS                 string                 `xml:"xmlns,attr,omitempty"`
+	RedirectAllRequestsTo *RedirectAllRequestsTo `xml:"RedirectAllRequestsTo,omitempty"`
+	IndexDocument         *IndexDocument         `xml:"IndexDocument,omitempty"`
+	ErrorDocument         *ErrorDocument         `xml:"ErrorDocument,omitempty"`
+	RoutingRules          []RoutingRule          `xml:"RoutingRules>RoutingRule,omitempty"`
+}
+
+// RedirectAllRequestsTo redirects every request to another host.
+type RedirectAllRequestsTo struct {
+	HostName string `xml:"HostName"`
+	Protocol string `xml:"Protocol,omitempty"`
+}
+
+// IndexDocument - the suffix appended to requests for a directory.
+type IndexDocument struct {
+	Suffix string `xml:"Suffix"`
+}
+
+// ErrorDocument - the object returned when an error occurs.
+type ErrorDocument struct {
+	Key string `xml:"Key"`
+}
+
+// RoutingRule redirects the requests matching its condition, every request
+// when it has no condition.
+type RoutingRule struct {
+	Condition *Condition `xml:"Condition,omitempty"`
+	Redirect  Redirect   `xml:"Redirect"`
+}
+
+// Condition - the key prefix and the error code a request must match.
+type Condition struct {
+	HTTPErrorCodeReturnedEquals string `xml:"HttpErrorCodeReturnedEquals,omitempty"`
+	KeyPrefixEquals             string `xml:"KeyPrefixEquals,omitempty"`
+}
+
+// Redirect - where a matching request is redirected to.
+type Redirect struct {
+	HostName             string `xml:"HostName,omitempty"`
+	HTTPRedirectCode     string `xml:"HttpRedirectCode,omitempty"`
+	Protocol             string `xml:"Protocol,omitempty"`
+	ReplaceKeyPrefixWith string `xml:"ReplaceKeyPrefixWith,omitempty"`
+	ReplaceKeyWith       string `xml:"ReplaceKeyWith,omitempty"`
+}
+
+// ParseConfig parses and validates a WebsiteConfiguration.
+func ParseConfig(reader io.Reader) (*Config, error) {
+	var config Config
+	if err := xml.NewDecoder(reader).Decode(&config); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Validate - checks the configuration either redirects every request, or
+// has an index document and valid routing rules.
+func (c Config) Validate() error {
+	if c.RedirectAllRequestsTo != nil {
+		if c.IndexDocument != nil || c.ErrorDocument != nil || len(c.RoutingRules) > 0 {
+			return errRedirectAllExclusive
+		}
+		if c.RedirectAllRequestsTo.HostName == "" {
+			return errMissingHostName
+		}
+		return validateProtocol(c.RedirectAllRequestsTo.Protocol)
+	}
+	if c.IndexDocument == nil {
+		return errMissingIndexDocument
+	}
+	if c.IndexDocument.Suffix == "" || strings.Contains(c.IndexDocument.Suffix, "/") {
+		return errInvalidSuffix
+	}
+	if c.ErrorDocument != nil && c.ErrorDocument.Key == "" {
+		return errMissingErrorKey
+	}
+	if len(c.RoutingRules) > maxRoutingRules {
+		return errTooManyRoutingRules
+	}
+	for _, rule := range c.RoutingRules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate - checks the condition and the redirect of the rule.
+func (r RoutingRule) Validate() error {
+	if r.Condition != nil {
+		if r.Condition.KeyPrefixEquals == "" && r.Condition.HTTPErrorCodeReturnedEquals == "" {
+			return errEmptyCondition
+		}
+		if code := r.Condition.HTTPErrorCodeReturnedEquals; code != "" {
+			if n, err := strconv.Atoi(code); err != nil || n < 400 || n > 599 {
+				return fmt.Errorf("%w: %s", errInvalidErrorCode, code)
+			}
+		}
+	}
+	redirect := r.Redirect
+	if redirect == (Redirect{}) {
+		return errEmptyRedirect
+	}
+	if redirect.ReplaceKeyWith != "" && redirect.ReplaceKeyPrefixWith != "" {
+		return errReplaceKeyExclusive
+	}
+	if code := redirect.HTTPRedirectCode; code != "" {
+		if n, err := strconv.Atoi(code); err != nil || n < 300 || n > 399 {
+			return fmt.Errorf("%w: %s", errInvalidRedirectCode, code)
+		}
+	}
+	return validateProtocol(redirect.Protocol)
+}
+
+func validateProtocol(protocol string) error {
+	switch protocol {
+	case "", "http", "https":
+		return nil
+	}
+	return fmt.Errorf("%w: %s", errInvalidProtocol, protocol)
+}
+
+// IndexKey returns the key served for key, the index document of the
+// directory when key is the root or ends with a slash.
+func (c Config) IndexKey(key string) string {
+	if c.IndexDocument != nil && (key == "" || strings.HasSuffix(key, "/")) {
+		return key + c.IndexDocument.Suffix
+	}
+	return key
+}
+
+// MatchRoutingRule returns the first routing rule matching key, nil when no
+// rule does. errorCode is the status of the response, rules conditioned on an
+// error code never match a zero errorCode.
+func (c Config) MatchRoutingRule(key string, errorCode int) *RoutingRule {
+	for i := range c.RoutingRules {
+		rule := &c.RoutingRules[i]
+		if rule.matches(key, errorCode) {
+			return rule
+		}
+	}
+	return nil
+}
+
+func (r RoutingRule) matches(key string, errorCode int) bool {
+	if r.Condition == nil {
+		return true
+	}
+	if !strings.HasPrefix(key, r.Condition.KeyPrefixEquals) {
+		return false
+	}
+	if code := r.Condition.HTTPErrorCodeReturnedEquals; code != "" {
+		return code == strconv.Itoa(errorCode)
+	}
+	return true
+}
+
+// Location returns the location and the status code a request for key is
+// redirected with, host and scheme are those of the request.
+func (r RoutingRule) Location(host, scheme, key string) (string, int) {
+	redirect := r.Redirect
+	if redirect.HostName != "" {
+		host = redirect.HostName
+	}
+	if redirect.Protocol != "" {
+		scheme = redirect.Protocol
+	}
+	switch {
+	case redirect.ReplaceKeyWith != "":
+		key = redirect.ReplaceKeyWith
+	case redirect.ReplaceKeyPrefixWith != "":
+		prefix := ""
+		if r.Condition != nil {
+			prefix = r.Condition.KeyPrefixEquals
+		}
+		key = redirect.ReplaceKeyPrefixWith + strings.TrimPrefix(key, prefix)
+	}
+	code := http.StatusMovedPermanently
+	if redirect.HTTPRedirectCode != "" {
+		code, _ = strconv.Atoi(redirect.HTTPRedirectCode)
+	}
+	return scheme + "://" + host + "/" + key, code
+}
+
+// Location returns the location a request for path is redirected to, scheme
+// is the scheme of the request.
+func (r RedirectAllRequestsTo) Location(scheme, path string) string {
+	if r.Protocol != "" {
+		scheme = r.Protocol
+	}
+	return scheme + "://" + r.HostName + path
+}
@@ -0,0 +1,93 @@
+package website
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	testCases := []struct {
+		config  string
+		success bool
+	}{
+		{`<WebsiteConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><IndexDocument><Suffix>index.html</Suffix></IndexDocument><ErrorDocument><Key>404.html</Key></ErrorDocument></WebsiteConfiguration>`, true},
+		{`<WebsiteConfiguration><RedirectAllRequestsTo><HostName>example.com</HostName><Protocol>https</Protocol></RedirectAllRequestsTo></WebsiteConfiguration>`, true},
+		{`<WebsiteConfiguration><IndexDocument><Suffix>index.html</Suffix></IndexDocument><RoutingRules><RoutingRule><Condition><KeyPrefixEquals>docs/</KeyPrefixEquals></Condition><Redirect><ReplaceKeyPrefixWith>documents/</ReplaceKeyPrefixWith></Redirect></RoutingRule></RoutingRules></WebsiteConfiguration>`, true},
+		{`<WebsiteConfiguration></WebsiteConfiguration>`, false},
+		{`<WebsiteConfiguration><IndexDocument><Suffix>a/index.html</Suffix></IndexDocument></WebsiteConfiguration>`, false},
+		{`<WebsiteConfiguration><RedirectAllRequestsTo><HostName>example.com</HostName></RedirectAllRequestsTo><IndexDocument><Suffix>index.html</Suffix></IndexDocument></WebsiteConfiguration>`, false},
+		{`<WebsiteConfiguration><RedirectAllRequestsTo><HostName>example.com</HostName><Protocol>ftp</Protocol></RedirectAllRequestsTo></WebsiteConfiguration>`, false},
+		{`<WebsiteConfiguration><IndexDocument><Suffix>index.html</Suffix></IndexDocument><RoutingRules><RoutingRule><Redirect></Redirect></RoutingRule></RoutingRules></WebsiteConfiguration>`, false},
+		{`<WebsiteConfiguration><IndexDocument><Suffix>index.html</Suffix></IndexDocument><RoutingRules><RoutingRule><Condition><HttpErrorCodeReturnedEquals>200</HttpErrorCodeReturnedEquals></Condition><Redirect><HostName>example.com</HostName></Redirect></RoutingRule></RoutingRules></WebsiteConfiguration>`, false},
+		{`<WebsiteConfiguration><IndexDocument><Suffix>index.html</Suffix></IndexDocument><RoutingRules><RoutingRule><Redirect><HttpRedirectCode>200</HttpRedirectCode></Redirect></RoutingRule></RoutingRules></WebsiteConfiguration>`, false},
+		{`<WebsiteConfiguration><IndexDocument><Suffix>index.html</Suffix></IndexDocument><RoutingRules><RoutingRule><Redirect><ReplaceKeyWith>a</ReplaceKeyWith><ReplaceKeyPrefixWith>b</ReplaceKeyPrefixWith></Redirect></RoutingRule></RoutingRules></WebsiteConfiguration>`, false},
+	}
+	for i, testCase := range testCases {
+		_, err := ParseConfig(strings.NewReader(testCase.config))
+		if testCase.success && err != nil {
+			t.Errorf("Test %d: Expected success, but instead found %v", i+1, err)
+		}
+		if !testCase.success && err == nil {
+			t.Errorf("Test %d: Expected failure, but instead succeeded", i+1)
+		}
+	}
+}
+
+func TestIndexKey(t *testing.T) {
+	config := Config{IndexDocument: &IndexDocument{Suffix: "index.html"}}
+	testCases := []struct {
+		key      string
+		expected string
+	}{
+		{"", "index.html"},
+		{"docs/", "docs/index.html"},
+		{"docs", "docs"},
+		{"docs/a.html", "docs/a.html"},
+	}
+	for i, testCase := range testCases {
+		if key := config.IndexKey(testCase.key); key != testCase.expected {
+			t.Errorf("Test %d: Expected %s, got %s", i+1, testCase.expected, key)
+		}
+	}
+}
+
+func TestRoutingRules(t *testing.T) {
+	config := Config{
+		IndexDocument: &IndexDocument{Suffix: "index.html"},
+		RoutingRules: []RoutingRule{
+			{
+				Condition: &Condition{KeyPrefixEquals: "docs/"},
+				Redirect:  Redirect{ReplaceKeyPrefixWith: "documents/"},
+			},
+			{
+				Condition: &Condition{HTTPErrorCodeReturnedEquals: "404"},
+				Redirect:  Redirect{HostName: "example.com", Protocol: "https", ReplaceKeyWith: "missing.html", HTTPRedirectCode: "302"},
+			},
+		},
+	}
+	testCases := []struct {
+		key       string
+		errorCode int
+		location  string
+		code      int
+	}{
+		{"docs/a.html", 0, "http://bucket.site/documents/a.html", http.StatusMovedPermanently},
+		{"images/a.png", 0, "", 0},
+		{"images/a.png", 404, "https://example.com/missing.html", http.StatusFound},
+		{"images/a.png", 403, "", 0},
+	}
+	for i, testCase := range testCases {
+		rule := config.MatchRoutingRule(testCase.key, testCase.errorCode)
+		if rule == nil {
+			if testCase.location != "" {
+				t.Errorf("Test %d: Expected a matching rule", i+1)
+			}
+			continue
+		}
+		location, code := rule.Location("bucket.site", "http", testCase.key)
+		if location != testCase.location || code != testCase.code {
+			t.Errorf("Test %d: Expected %s %d, got %s %d", i+1, testCase.location, testCase.code, location, code)
+		}
+	}
+}